@@ -0,0 +1,729 @@
+// Package client is a Go client for the AI chatbot mock API.
+//
+// Every method takes a context and returns an *APIError when the server
+// answers with an error status. Requests rejected with 429 Too Many Requests
+// or 503 Service Unavailable are retried with exponential backoff.
+package client
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "math/rand"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Client calls the API served at a base URL
+type Client struct {
+    baseURL    string
+    httpClient *http.Client
+    maxRetries int
+    minBackoff time.Duration
+    maxBackoff time.Duration
+    user       string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+    return func(c *Client) {
+        c.httpClient = httpClient
+    }
+}
+
+// WithMaxRetries sets how many times a rate limited or unavailable request
+// is retried. Zero disables retries.
+func WithMaxRetries(n int) Option {
+    return func(c *Client) {
+        c.maxRetries = n
+    }
+}
+
+// WithBackoff sets the delay before the first retry and the upper bound the
+// exponentially growing delay is capped at
+func WithBackoff(min, max time.Duration) Option {
+    return func(c *Client) {
+        c.minBackoff = min
+        c.maxBackoff = max
+    }
+}
+
+// WithUser names the user sending the requests in the X-User header, as a
+// proxy authenticating users would. Uploaded files are recorded as uploaded
+// by the user.
+func WithUser(user string) Option {
+    return func(c *Client) {
+        c.user = user
+    }
+}
+
+// New returns a client for the API served at baseURL, e.g.
+// "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+    c := &Client{
+        baseURL:    strings.TrimRight(baseURL, "/"),
+        httpClient: http.DefaultClient,
+        maxRetries: 3,
+        minBackoff: 200 * time.Millisecond,
+        maxBackoff: 5 * time.Second,
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
+}
+
+// Chat sends a chat message and returns the reply
+func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+    var resp ChatResponse
+    if err := c.doJSON(ctx, http.MethodPost, "/chat", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return &resp, nil
+}
+
+// CreateAssistant creates an assistant
+func (c *Client) CreateAssistant(ctx context.Context, req AssistantRequest) error {
+    return c.doJSON(ctx, http.MethodPost, "/createAssistant", nil, req, nil)
+}
+
+// UpdateAssistant replaces the role setting of an assistant
+func (c *Client) UpdateAssistant(ctx context.Context, req AssistantRequest) error {
+    return c.doJSON(ctx, http.MethodPut, "/updateAssistant", nil, req, nil)
+}
+
+// DeleteAssistant deletes an assistant with its knowledge base and histories
+func (c *Client) DeleteAssistant(ctx context.Context, title string) error {
+    return c.doJSON(ctx, http.MethodDelete, "/deleteAssistant", url.Values{"title": {title}}, nil, nil)
+}
+
+// RenameAssistant renames an assistant
+func (c *Client) RenameAssistant(ctx context.Context, currentTitle, newTitle string) error {
+    req := RenameRequest{CurrentTitle: currentTitle, NewTitle: newTitle}
+    return c.doJSON(ctx, http.MethodPut, "/renameAssistant", nil, req, nil)
+}
+
+// ListAssistants lists all assistants
+func (c *Client) ListAssistants(ctx context.Context) ([]Assistant, error) {
+    var assistants []Assistant
+    if err := c.doJSON(ctx, http.MethodGet, "/listAssistants", nil, nil, &assistants); err != nil {
+        return nil, err
+    }
+    return assistants, nil
+}
+
+// GetRoleSetting returns the role setting of an assistant
+func (c *Client) GetRoleSetting(ctx context.Context, title string) (*RoleSetting, error) {
+    var resp RoleSetting
+    if err := c.doJSON(ctx, http.MethodGet, "/getRoleSetting", url.Values{"title": {title}}, nil, &resp); err != nil {
+        return nil, err
+    }
+    return &resp, nil
+}
+
+// Upload adds a file to the knowledge base named after an assistant, which
+// is created and attached to the assistant if needed. The content is read
+// into memory so the request can be retried.
+func (c *Client) Upload(ctx context.Context, title, filename string, content io.Reader) error {
+    _, err := c.UploadFiles(ctx, title, File{Name: filename, Content: content})
+    return err
+}
+
+// UploadFiles adds up to 20 files to the knowledge base named after an
+// assistant like Upload and reports the size and ingestion status of each.
+// Either all files are stored or, if one is rejected, none is; files beyond
+// the server's size limits fail with ErrTooLarge, and files of types the
+// knowledge base does not accept with ErrUnsupportedType.
+func (c *Client) UploadFiles(ctx context.Context, title string, files ...File) ([]UploadResult, error) {
+    resp, err := c.sendFiles(ctx, http.MethodPost, "/upload", url.Values{"title": {title}}, files...)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    var result uploadResponse
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return nil, err
+    }
+    return result.Files, nil
+}
+
+// CreateUpload starts a resumable upload of a file of size bytes with the
+// given hex SHA-256 to the knowledge base named after an assistant. Send
+// the content with UploadChunk and store the file with FinalizeUpload, or
+// let UploadResumable do all of it.
+func (c *Client) CreateUpload(ctx context.Context, title, fileName string, size int64, sha256 string) (*UploadSession, error) {
+    var resp UploadSession
+    req := createUploadRequest{Title: title, FileName: fileName, Size: size, SHA256: sha256}
+    if err := c.doJSON(ctx, http.MethodPost, "/create-upload", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return &resp, nil
+}
+
+// GetUpload returns a resumable upload with the offset to send the next
+// chunk at
+func (c *Client) GetUpload(ctx context.Context, title, uploadID string) (*UploadSession, error) {
+    var resp UploadSession
+    query := url.Values{"title": {title}, "uploadID": {uploadID}}
+    if err := c.doJSON(ctx, http.MethodGet, "/get-upload", query, nil, &resp); err != nil {
+        return nil, err
+    }
+    return &resp, nil
+}
+
+// UploadChunk appends chunk to a resumable upload. Offset must be the
+// offset received so far, otherwise the chunk fails with ErrConflict.
+func (c *Client) UploadChunk(ctx context.Context, title, uploadID string, offset int64, chunk []byte) (*UploadSession, error) {
+    query := url.Values{"title": {title}, "uploadID": {uploadID}}
+    header := http.Header{}
+    header.Set("Content-Type", "application/offset+octet-stream")
+    header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+    resp, err := c.doWithHeader(ctx, http.MethodPatch, "/upload-chunk", query, header, chunk)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    var session UploadSession
+    if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+        return nil, err
+    }
+    return &session, nil
+}
+
+// FinalizeUpload stores the file of a complete resumable upload. It fails
+// with ErrConflict if the upload is incomplete; an upload whose content
+// does not match its checksum is discarded.
+func (c *Client) FinalizeUpload(ctx context.Context, title, uploadID string) ([]UploadResult, error) {
+    var resp uploadResponse
+    req := uploadSessionRequest{Title: title, UploadID: uploadID}
+    if err := c.doJSON(ctx, http.MethodPost, "/finalize-upload", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Files, nil
+}
+
+// CancelUpload discards a resumable upload
+func (c *Client) CancelUpload(ctx context.Context, title, uploadID string) error {
+    req := uploadSessionRequest{Title: title, UploadID: uploadID}
+    return c.doJSON(ctx, http.MethodPost, "/cancel-upload", nil, req, nil)
+}
+
+// UploadResumable uploads size bytes of content in chunks of chunkSize
+// bytes with a resumable upload. A chunk that fails because the connection
+// dropped is sent again from the offset the server received, up to the
+// client's number of retries in a row.
+func (c *Client) UploadResumable(ctx context.Context, title, fileName string, content io.ReaderAt, size int64, chunkSize int) ([]UploadResult, error) {
+    hash := sha256.New()
+    if _, err := io.Copy(hash, io.NewSectionReader(content, 0, size)); err != nil {
+        return nil, err
+    }
+    session, err := c.CreateUpload(ctx, title, fileName, size, hex.EncodeToString(hash.Sum(nil)))
+    if err != nil {
+        return nil, err
+    }
+
+    chunk := make([]byte, chunkSize)
+    failures := 0
+    for session.Offset < session.Size {
+        n, err := content.ReadAt(chunk[:min(int64(chunkSize), session.Size-session.Offset)], session.Offset)
+        if err != nil && err != io.EOF {
+            return nil, err
+        }
+        next, err := c.UploadChunk(ctx, title, session.UploadID, session.Offset, chunk[:n])
+        if err == nil {
+            session, failures = next, 0
+            continue
+        }
+        var apiErr *APIError
+        if (errors.As(err, &apiErr) && !errors.Is(err, ErrConflict)) || ctx.Err() != nil || failures >= c.maxRetries {
+            return nil, err
+        }
+        // Resume from what the server received
+        failures++
+        if session, err = c.GetUpload(ctx, title, session.UploadID); err != nil {
+            return nil, err
+        }
+    }
+    return c.FinalizeUpload(ctx, title, session.UploadID)
+}
+
+// ImportHistories imports the conversations of an OpenAI messages JSON,
+// ChatGPT conversations.json or JSONL file as chat histories of an
+// assistant and reports the result per conversation
+func (c *Client) ImportHistories(ctx context.Context, assistantTitle, filename string, content io.Reader) (*ImportResponse, error) {
+    file := File{Name: filename, Content: content}
+    resp, err := c.sendFiles(ctx, http.MethodPost, "/import-histories", url.Values{"assistant": {assistantTitle}}, file)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    var result ImportResponse
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return nil, err
+    }
+    return &result, nil
+}
+
+// sendFiles sends files as the file fields of a multipart form
+func (c *Client) sendFiles(ctx context.Context, method, path string, query url.Values, files ...File) (*http.Response, error) {
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    for _, file := range files {
+        part, err := mw.CreateFormFile("file", file.Name)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := io.Copy(part, file.Content); err != nil {
+            return nil, err
+        }
+    }
+    if err := mw.Close(); err != nil {
+        return nil, err
+    }
+    return c.do(ctx, method, path, query, mw.FormDataContentType(), body.Bytes())
+}
+
+// CreateKnowledgeBase creates a knowledge base
+func (c *Client) CreateKnowledgeBase(ctx context.Context, name string) error {
+    return c.doJSON(ctx, http.MethodPost, "/create-knowledgebase", nil, directoryRequest{Name: name}, nil)
+}
+
+// ListKnowledgeBases lists the names of all knowledge bases
+func (c *Client) ListKnowledgeBases(ctx context.Context) ([]string, error) {
+    var resp listDirectoriesResponse
+    if err := c.doJSON(ctx, http.MethodGet, "/list-knowledgebase", nil, nil, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Directories, nil
+}
+
+// DeleteKnowledgeBase deletes a knowledge base with all its files
+func (c *Client) DeleteKnowledgeBase(ctx context.Context, name string) error {
+    return c.doJSON(ctx, http.MethodPost, "/delete-knowledgebase", nil, knowledgeBaseRequest{KnowledgeBaseName: name}, nil)
+}
+
+// RenameKnowledgeBase renames a knowledge base
+func (c *Client) RenameKnowledgeBase(ctx context.Context, currentName, newName string) error {
+    req := renameDirectoryRequest{CurrentName: currentName, NewName: newName}
+    return c.doJSON(ctx, http.MethodPut, "/rename-knowledgebase", nil, req, nil)
+}
+
+// AttachKnowledgeBase attaches a knowledge base to an assistant. A
+// knowledge base can be attached to any number of assistants.
+func (c *Client) AttachKnowledgeBase(ctx context.Context, assistantTitle, knowledgeBase string) error {
+    req := attachKnowledgeBaseRequest{AssistantTitle: assistantTitle, KnowledgeBaseName: knowledgeBase}
+    return c.doJSON(ctx, http.MethodPost, "/attach-knowledgebase", nil, req, nil)
+}
+
+// DetachKnowledgeBase detaches a knowledge base from an assistant, the
+// knowledge base itself is kept
+func (c *Client) DetachKnowledgeBase(ctx context.Context, assistantTitle, knowledgeBase string) error {
+    req := attachKnowledgeBaseRequest{AssistantTitle: assistantTitle, KnowledgeBaseName: knowledgeBase}
+    return c.doJSON(ctx, http.MethodPost, "/detach-knowledgebase", nil, req, nil)
+}
+
+// ListAssistantKnowledgeBases lists the names of the knowledge bases
+// attached to an assistant
+func (c *Client) ListAssistantKnowledgeBases(ctx context.Context, assistantTitle string) ([]string, error) {
+    var resp assistantKnowledgeBasesResponse
+    query := url.Values{"title": {assistantTitle}}
+    if err := c.doJSON(ctx, http.MethodGet, "/list-assistant-knowledgebases", query, nil, &resp); err != nil {
+        return nil, err
+    }
+    return resp.KnowledgeBases, nil
+}
+
+// ListFiles lists the files of a knowledge base with their metadata, sorted
+// and filtered by opts
+func (c *Client) ListFiles(ctx context.Context, knowledgeBase string, opts ListFilesOptions) ([]FileInfo, error) {
+    var resp listFilesResponse
+    req := listFilesRequest{KnowledgeBaseName: knowledgeBase, ListFilesOptions: opts}
+    if err := c.doJSON(ctx, http.MethodPost, "/list-files-knowledgebase", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Files, nil
+}
+
+// DownloadFile downloads a file of a knowledge base. The caller must close
+// the returned reader.
+func (c *Client) DownloadFile(ctx context.Context, knowledgeBase, fileName string) (io.ReadCloser, error) {
+    query := url.Values{"knowledgeBaseName": {knowledgeBase}, "fileName": {fileName}}
+    resp, err := c.do(ctx, http.MethodGet, "/download-file-knowledgebase", query, "", nil)
+    if err != nil {
+        return nil, err
+    }
+    return resp.Body, nil
+}
+
+// PreviewFile returns the start of the text extracted from a knowledge base
+// file, at most maxLength characters or the server default if zero
+func (c *Client) PreviewFile(ctx context.Context, knowledgeBase, fileName string, maxLength int) (*FilePreview, error) {
+    var preview FilePreview
+    req := filePreviewRequest{KnowledgeBaseName: knowledgeBase, FileName: fileName, MaxLength: maxLength}
+    if err := c.doJSON(ctx, http.MethodPost, "/preview-file-knowledgebase", nil, req, &preview); err != nil {
+        return nil, err
+    }
+    return &preview, nil
+}
+
+// DeleteFile deletes a file of a knowledge base
+func (c *Client) DeleteFile(ctx context.Context, knowledgeBase, fileName string) error {
+    req := fileRequest{KnowledgeBaseName: knowledgeBase, FileName: fileName}
+    return c.doJSON(ctx, http.MethodPost, "/delete-file-knowledgebase", nil, req, nil)
+}
+
+// ReplaceFile replaces the content of a file of a knowledge base, which is
+// then ingested again. The content is read into memory so the request can
+// be retried.
+func (c *Client) ReplaceFile(ctx context.Context, knowledgeBase, fileName string, content io.Reader) error {
+    query := url.Values{"knowledgeBaseName": {knowledgeBase}, "fileName": {fileName}}
+    resp, err := c.sendFiles(ctx, http.MethodPut, "/replace-file-knowledgebase", query, File{Name: fileName, Content: content})
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// GetChunkingSettings returns how the files of a knowledge base are split
+// into chunks
+func (c *Client) GetChunkingSettings(ctx context.Context, knowledgeBase string) (*ChunkingSettings, error) {
+    var resp chunkingSettingsResponse
+    query := url.Values{"knowledgeBaseName": {knowledgeBase}}
+    if err := c.doJSON(ctx, http.MethodGet, "/get-chunking-settings", query, nil, &resp); err != nil {
+        return nil, err
+    }
+    return &resp.Settings, nil
+}
+
+// UpdateChunkingSettings changes how the files of a knowledge base are
+// split into chunks. The server chunks the files again in the background.
+func (c *Client) UpdateChunkingSettings(ctx context.Context, knowledgeBase string, settings ChunkingSettings) error {
+    req := chunkingSettingsRequest{KnowledgeBaseName: knowledgeBase, ChunkingSettings: settings}
+    return c.doJSON(ctx, http.MethodPut, "/update-chunking-settings", nil, req, nil)
+}
+
+// GetFileTypePolicy returns the MIME types of the files a knowledge base
+// accepts
+func (c *Client) GetFileTypePolicy(ctx context.Context, knowledgeBase string) (*FileTypePolicy, error) {
+    var resp fileTypePolicyResponse
+    query := url.Values{"knowledgeBaseName": {knowledgeBase}}
+    if err := c.doJSON(ctx, http.MethodGet, "/get-file-type-policy", query, nil, &resp); err != nil {
+        return nil, err
+    }
+    return &resp.Policy, nil
+}
+
+// UpdateFileTypePolicy changes the MIME types of the files a knowledge base
+// accepts. Files already in the knowledge base are kept.
+func (c *Client) UpdateFileTypePolicy(ctx context.Context, knowledgeBase string, policy FileTypePolicy) error {
+    req := fileTypePolicyRequest{KnowledgeBaseName: knowledgeBase, FileTypePolicy: policy}
+    return c.doJSON(ctx, http.MethodPut, "/update-file-type-policy", nil, req, nil)
+}
+
+// PreviewChunks splits the text of a knowledge base file into chunks with
+// settings, or with the settings of the knowledge base if nil, without
+// storing them
+func (c *Client) PreviewChunks(ctx context.Context, knowledgeBase, fileName string, settings *ChunkingSettings) ([]Chunk, error) {
+    var resp previewChunksResponse
+    req := previewChunksRequest{KnowledgeBaseName: knowledgeBase, FileName: fileName, Settings: settings}
+    if err := c.doJSON(ctx, http.MethodPost, "/preview-chunks", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Chunks, nil
+}
+
+// SearchKnowledgeBases ranks the chunks of knowledge bases against a query.
+// Lexical searches rank with BM25 the chunks containing any of the words or
+// prefixes such as invoi*, and all of the "quoted phrases". Semantic
+// searches rank by the similarity of embeddings, hybrid searches fuse both.
+func (c *Client) SearchKnowledgeBases(ctx context.Context, q string, opts KnowledgeSearchOptions) ([]KnowledgeSearchResult, error) {
+    req := searchKnowledgeBasesRequest{Query: q, Mode: opts.Mode, KnowledgeBases: opts.KnowledgeBases, TopK: opts.TopK}
+    filters := knowledgeSearchFilters{Files: opts.Files, Extensions: opts.Extensions, Heading: opts.Heading, MinScore: opts.MinScore}
+    if len(filters.Files) > 0 || len(filters.Extensions) > 0 || filters.Heading != "" || filters.MinScore != 0 {
+        req.Filters = &filters
+    }
+    var resp searchKnowledgeBasesResponse
+    if err := c.doJSON(ctx, http.MethodPost, "/search-knowledgebases", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Results, nil
+}
+
+// ListHistories lists the file names of the chat histories
+func (c *Client) ListHistories(ctx context.Context) ([]string, error) {
+    var resp chatHistoryResponse
+    if err := c.doJSON(ctx, http.MethodGet, "/chat-history", nil, nil, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Files, nil
+}
+
+// ListConversations returns a page of the conversations of all assistants,
+// or of opts.Assistant
+func (c *Client) ListConversations(ctx context.Context, opts ListConversationsOptions) (*ConversationPage, error) {
+    query := url.Values{}
+    for name, value := range map[string]string{"assistant": opts.Assistant, "sort": opts.Sort, "order": opts.Order, "cursor": opts.Cursor} {
+        if value != "" {
+            query.Set(name, value)
+        }
+    }
+    if opts.Limit > 0 {
+        query.Set("limit", strconv.Itoa(opts.Limit))
+    }
+    var page ConversationPage
+    if err := c.doJSON(ctx, http.MethodGet, "/list-conversations", query, nil, &page); err != nil {
+        return nil, err
+    }
+    return &page, nil
+}
+
+// SearchHistories searches the messages of all chat histories. Words of the
+// query must all occur in a conversation, "quoted phrases" must occur as
+// written and words ending in * match every word they start.
+func (c *Client) SearchHistories(ctx context.Context, q string, opts SearchOptions) ([]SearchResult, error) {
+    query := url.Values{"q": {q}}
+    for name, value := range map[string]string{"assistant": opts.Assistant, "from": opts.From, "to": opts.To} {
+        if value != "" {
+            query.Set(name, value)
+        }
+    }
+    if opts.Limit > 0 {
+        query.Set("limit", strconv.Itoa(opts.Limit))
+    }
+    var resp searchHistoriesResponse
+    if err := c.doJSON(ctx, http.MethodGet, "/search-histories", query, nil, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Results, nil
+}
+
+// CreateHistory creates an empty chat history for an assistant and returns
+// its ID
+func (c *Client) CreateHistory(ctx context.Context, assistantTitle string) (string, error) {
+    var resp createHistoryResponse
+    req := createHistoryRequest{AssistantTitle: assistantTitle}
+    if err := c.doJSON(ctx, http.MethodPost, "/create-history", nil, req, &resp); err != nil {
+        return "", err
+    }
+    return resp.FileID, nil
+}
+
+// DeleteHistory deletes a chat history
+func (c *Client) DeleteHistory(ctx context.Context, assistantTitle, historyID string) error {
+    req := deleteHistoryRequest{AssistantTitle: assistantTitle, ChatHistoryID: historyID}
+    return c.doJSON(ctx, http.MethodDelete, "/delete-history", nil, req, nil)
+}
+
+// UpdateChatContext replaces the content of a chat history
+func (c *Client) UpdateChatContext(ctx context.Context, assistantTitle, historyID, content string) error {
+    req := updateChatContextRequest{AssistantTitle: assistantTitle, Context: content}
+    return c.doJSON(ctx, http.MethodPut, "/update-chat-context/"+url.PathEscape(historyID), nil, req, nil)
+}
+
+// FetchHistory returns the content of a chat history
+func (c *Client) FetchHistory(ctx context.Context, assistantTitle, historyID string) (string, error) {
+    var resp fetchHistoryResponse
+    req := fetchHistoryRequest{AssistantTitle: assistantTitle, HistoryID: historyID}
+    if err := c.doJSON(ctx, http.MethodPost, "/fetch-history", nil, req, &resp); err != nil {
+        return "", err
+    }
+    return resp.Context, nil
+}
+
+// RenameHistory sets the title of a chat history. The server no longer
+// generates titles for it afterwards.
+func (c *Client) RenameHistory(ctx context.Context, assistantTitle, historyID, title string) error {
+    req := renameHistoryRequest{AssistantTitle: assistantTitle, HistoryID: historyID, Title: title}
+    return c.doJSON(ctx, http.MethodPut, "/rename-history", nil, req, nil)
+}
+
+// AppendMessages appends messages to a chat history and returns their IDs.
+// If afterMessageID is not empty the messages are only appended when it is
+// the ID of the last message of the history, otherwise the server answers
+// with a conflict.
+func (c *Client) AppendMessages(ctx context.Context, assistantTitle, historyID, afterMessageID string, messages ...Message) ([]string, error) {
+    var resp appendMessagesResponse
+    req := appendMessagesRequest{AssistantTitle: assistantTitle, HistoryID: historyID, Messages: messages, AfterMessageID: afterMessageID}
+    if err := c.doJSON(ctx, http.MethodPost, "/append-messages", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.MessageIDs, nil
+}
+
+// EditMessage replaces a message of the active branch of a chat history
+// with messages, which start a new branch next to it, and returns their
+// IDs. The original message and its replies are kept in the old branch.
+func (c *Client) EditMessage(ctx context.Context, assistantTitle, historyID, editMessageID string, messages ...Message) ([]string, error) {
+    var resp appendMessagesResponse
+    req := appendMessagesRequest{AssistantTitle: assistantTitle, HistoryID: historyID, Messages: messages, EditMessageID: editMessageID}
+    if err := c.doJSON(ctx, http.MethodPost, "/append-messages", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.MessageIDs, nil
+}
+
+// SwitchBranch makes the branch holding a message the active branch of a
+// chat history and returns the message IDs of the branch
+func (c *Client) SwitchBranch(ctx context.Context, assistantTitle, historyID, messageID string) ([]string, error) {
+    var resp switchBranchResponse
+    req := branchRequest{AssistantTitle: assistantTitle, HistoryID: historyID, MessageID: messageID}
+    if err := c.doJSON(ctx, http.MethodPut, "/switch-branch", nil, req, &resp); err != nil {
+        return nil, err
+    }
+    return resp.MessageIDs, nil
+}
+
+// ForkHistory copies a chat history up to and including a message into a
+// new history and returns its ID. An empty messageID copies the whole
+// active branch.
+func (c *Client) ForkHistory(ctx context.Context, assistantTitle, historyID, messageID string) (string, error) {
+    var resp forkHistoryResponse
+    req := branchRequest{AssistantTitle: assistantTitle, HistoryID: historyID, MessageID: messageID}
+    if err := c.doJSON(ctx, http.MethodPost, "/fork-history", nil, req, &resp); err != nil {
+        return "", err
+    }
+    return resp.HistoryID, nil
+}
+
+// ExportHistory downloads a chat history in the given format: markdown,
+// text, html or jsonl. The caller must close the returned reader.
+func (c *Client) ExportHistory(ctx context.Context, assistantTitle, historyID, format string) (io.ReadCloser, error) {
+    query := url.Values{"assistant": {assistantTitle}, "historyID": {historyID}, "format": {format}}
+    resp, err := c.do(ctx, http.MethodGet, "/export-history", query, "", nil)
+    if err != nil {
+        return nil, err
+    }
+    return resp.Body, nil
+}
+
+// ExportHistories downloads all chat histories of an assistant in the given
+// format as a zip archive. The caller must close the returned reader.
+func (c *Client) ExportHistories(ctx context.Context, assistantTitle, format string) (io.ReadCloser, error) {
+    query := url.Values{"assistant": {assistantTitle}, "format": {format}}
+    resp, err := c.do(ctx, http.MethodGet, "/export-histories", query, "", nil)
+    if err != nil {
+        return nil, err
+    }
+    return resp.Body, nil
+}
+
+// doJSON sends in as JSON body (if not nil) and decodes the response into
+// out (if not nil)
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+    var body []byte
+    contentType := ""
+    if in != nil {
+        var err error
+        if body, err = json.Marshal(in); err != nil {
+            return err
+        }
+        contentType = "application/json"
+    }
+
+    resp, err := c.do(ctx, method, path, query, contentType, body)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if out == nil {
+        io.Copy(io.Discard, resp.Body)
+        return nil
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends a request, retrying it while the server is rate limiting or
+// unavailable. Responses with an error status are turned into an *APIError,
+// otherwise the caller must close the response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+    header := http.Header{}
+    if contentType != "" {
+        header.Set("Content-Type", contentType)
+    }
+    return c.doWithHeader(ctx, method, path, query, header, body)
+}
+
+// doWithHeader is do with further request headers
+func (c *Client) doWithHeader(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+    target := c.baseURL + path
+    if len(query) > 0 {
+        target += "?" + query.Encode()
+    }
+
+    for attempt := 0; ; attempt++ {
+        var reader io.Reader
+        if body != nil {
+            reader = bytes.NewReader(body)
+        }
+        req, err := http.NewRequestWithContext(ctx, method, target, reader)
+        if err != nil {
+            return nil, err
+        }
+        if c.user != "" {
+            req.Header.Set("X-User", c.user)
+        }
+        for key, values := range header {
+            req.Header[key] = values
+        }
+
+        resp, err := c.httpClient.Do(req)
+        if err != nil {
+            return nil, err
+        }
+        if resp.StatusCode < 300 {
+            return resp, nil
+        }
+
+        data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+        resp.Body.Close()
+
+        retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+        if !retryable || attempt >= c.maxRetries {
+            return nil, newAPIError(resp.StatusCode, data)
+        }
+
+        timer := time.NewTimer(c.backoff(attempt, resp.Header.Get("Retry-After")))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return nil, ctx.Err()
+        case <-timer.C:
+        }
+    }
+}
+
+// backoff returns how long to wait before retry number attempt+1, honouring
+// a Retry-After header given in seconds or as an HTTP date
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+    if retryAfter != "" {
+        if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+            return min(time.Duration(seconds)*time.Second, c.maxBackoff)
+        }
+        if at, err := http.ParseTime(retryAfter); err == nil {
+            return min(max(time.Until(at), 0), c.maxBackoff)
+        }
+    }
+
+    delay := c.maxBackoff
+    if attempt < 30 && c.minBackoff<<attempt < c.maxBackoff {
+        delay = c.minBackoff << attempt
+    }
+    // Full jitter over the upper half keeps clients from retrying in lockstep
+    if delay > 1 {
+        delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+    }
+    return delay
+}
@@ -0,0 +1,742 @@
+package client
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// recordedRequest is what the fake server saw of a request
+type recordedRequest struct {
+    Method string
+    Path   string
+    Query  string
+    Body   map[string]interface{}
+}
+
+// newRecorder starts a server that records the request and replies with
+// the given JSON body
+func newRecorder(t *testing.T, status int, reply string) (*httptest.Server, *recordedRequest) {
+    t.Helper()
+    var got recordedRequest
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = recordedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery}
+        if r.Header.Get("Content-Type") == "application/json" {
+            json.NewDecoder(r.Body).Decode(&got.Body)
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(status)
+        io.WriteString(w, reply)
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &got
+}
+
+func TestEndpoints(t *testing.T) {
+    ctx := context.Background()
+    tests := []struct {
+        name  string
+        reply string
+        call  func(c *Client) (interface{}, error)
+        want  recordedRequest
+        out   interface{}
+    }{
+        {
+            name:  "Chat",
+            reply: `{"response":"Hello!"}`,
+            call:  func(c *Client) (interface{}, error) { return c.Chat(ctx, ChatRequest{Context: "hi"}) },
+            want:  recordedRequest{Method: "POST", Path: "/chat", Body: map[string]interface{}{"context": "hi"}},
+            out:   &ChatResponse{Response: "Hello!"},
+        },
+        {
+            name:  "Chat with retrieval",
+            reply: `{"response":"Monthly. [1]","historyID":"h1","citations":[{"footnote":1,"knowledgeBase":"Docs","fileName":"a.md","chunkID":"c1","start":0,"end":8,"score":1.5}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.Chat(ctx, ChatRequest{Context: "how often?", AssistantTitle: "Lets Chat", Retrieval: &RetrievalOptions{Mode: "semantic"}})
+            },
+            want: recordedRequest{Method: "POST", Path: "/chat", Body: map[string]interface{}{
+                "context": "how often?", "assistantTitle": "Lets Chat", "retrieval": map[string]interface{}{"mode": "semantic"},
+            }},
+            out: &ChatResponse{Response: "Monthly. [1]", HistoryID: "h1", Citations: []Citation{{Footnote: 1, KnowledgeBase: "Docs", FileName: "a.md", ChunkID: "c1", End: 8, Score: 1.5}}},
+        },
+        {
+            name: "CreateAssistant",
+            call: func(c *Client) (interface{}, error) {
+                return nil, c.CreateAssistant(ctx, AssistantRequest{Title: "Bot", RoleSetting: "helpful"})
+            },
+            want: recordedRequest{Method: "POST", Path: "/createAssistant", Body: map[string]interface{}{"title": "Bot", "roleSetting": "helpful"}},
+        },
+        {
+            name: "UpdateAssistant",
+            call: func(c *Client) (interface{}, error) {
+                return nil, c.UpdateAssistant(ctx, AssistantRequest{Title: "Bot", RoleSetting: "terse"})
+            },
+            want: recordedRequest{Method: "PUT", Path: "/updateAssistant", Body: map[string]interface{}{"title": "Bot", "roleSetting": "terse"}},
+        },
+        {
+            name: "DeleteAssistant",
+            call: func(c *Client) (interface{}, error) { return nil, c.DeleteAssistant(ctx, "My Bot") },
+            want: recordedRequest{Method: "DELETE", Path: "/deleteAssistant", Query: "title=My+Bot"},
+        },
+        {
+            name: "RenameAssistant",
+            call: func(c *Client) (interface{}, error) { return nil, c.RenameAssistant(ctx, "Old", "New") },
+            want: recordedRequest{Method: "PUT", Path: "/renameAssistant", Body: map[string]interface{}{"currentTitle": "Old", "newTitle": "New"}},
+        },
+        {
+            name:  "ListAssistants",
+            reply: `[{"title":"Bot","avatar":"🤖"}]`,
+            call:  func(c *Client) (interface{}, error) { return c.ListAssistants(ctx) },
+            want:  recordedRequest{Method: "GET", Path: "/listAssistants"},
+            out:   []Assistant{{Title: "Bot", Avatar: "🤖"}},
+        },
+        {
+            name:  "GetRoleSetting",
+            reply: `{"title":"Bot","roleSetting":"helpful"}`,
+            call:  func(c *Client) (interface{}, error) { return c.GetRoleSetting(ctx, "Bot") },
+            want:  recordedRequest{Method: "GET", Path: "/getRoleSetting", Query: "title=Bot"},
+            out:   &RoleSetting{Title: "Bot", RoleSetting: "helpful"},
+        },
+        {
+            name: "CreateKnowledgeBase",
+            call: func(c *Client) (interface{}, error) { return nil, c.CreateKnowledgeBase(ctx, "Docs") },
+            want: recordedRequest{Method: "POST", Path: "/create-knowledgebase", Body: map[string]interface{}{"name": "Docs"}},
+        },
+        {
+            name:  "ListKnowledgeBases",
+            reply: `{"directories":["Docs"]}`,
+            call:  func(c *Client) (interface{}, error) { return c.ListKnowledgeBases(ctx) },
+            want:  recordedRequest{Method: "GET", Path: "/list-knowledgebase"},
+            out:   []string{"Docs"},
+        },
+        {
+            name: "DeleteKnowledgeBase",
+            call: func(c *Client) (interface{}, error) { return nil, c.DeleteKnowledgeBase(ctx, "Docs") },
+            want: recordedRequest{Method: "POST", Path: "/delete-knowledgebase", Body: map[string]interface{}{"knowledgeBaseName": "Docs"}},
+        },
+        {
+            name: "RenameKnowledgeBase",
+            call: func(c *Client) (interface{}, error) { return nil, c.RenameKnowledgeBase(ctx, "Docs", "Manuals") },
+            want: recordedRequest{Method: "PUT", Path: "/rename-knowledgebase", Body: map[string]interface{}{"currentName": "Docs", "newName": "Manuals"}},
+        },
+        {
+            name: "AttachKnowledgeBase",
+            call: func(c *Client) (interface{}, error) { return nil, c.AttachKnowledgeBase(ctx, "Bot", "Docs") },
+            want: recordedRequest{Method: "POST", Path: "/attach-knowledgebase", Body: map[string]interface{}{"assistantTitle": "Bot", "knowledgeBaseName": "Docs"}},
+        },
+        {
+            name: "DetachKnowledgeBase",
+            call: func(c *Client) (interface{}, error) { return nil, c.DetachKnowledgeBase(ctx, "Bot", "Docs") },
+            want: recordedRequest{Method: "POST", Path: "/detach-knowledgebase", Body: map[string]interface{}{"assistantTitle": "Bot", "knowledgeBaseName": "Docs"}},
+        },
+        {
+            name:  "ListAssistantKnowledgeBases",
+            reply: `{"title":"Bot","knowledgeBases":["Bot","Docs"]}`,
+            call:  func(c *Client) (interface{}, error) { return c.ListAssistantKnowledgeBases(ctx, "Bot") },
+            want:  recordedRequest{Method: "GET", Path: "/list-assistant-knowledgebases", Query: "title=Bot"},
+            out:   []string{"Bot", "Docs"},
+        },
+        {
+            name:  "ListFiles",
+            reply: `{"files":[{"name":"a.txt","type":"document","sha256":"abc","originalName":"A.txt","uploadedBy":"alice","creationTime":"t1","updatedTime":"t2","status":"failed","error":"no text","textLength":0,"chunks":0}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.ListFiles(ctx, "Docs", ListFilesOptions{Sort: "size", UploadedBy: "alice", MinSize: 10})
+            },
+            want: recordedRequest{Method: "POST", Path: "/list-files-knowledgebase", Body: map[string]interface{}{
+                "knowledgeBaseName": "Docs", "sort": "size", "uploadedBy": "alice", "minSize": float64(10),
+            }},
+            out: []FileInfo{{Name: "a.txt", Type: "document", SHA256: "abc", OriginalName: "A.txt", UploadedBy: "alice", CreationTime: "t1", UpdatedTime: "t2", Status: "failed", Error: "no text"}},
+        },
+        {
+            name:  "DownloadFile",
+            reply: "%PDF-1.4",
+            call: func(c *Client) (interface{}, error) {
+                body, err := c.DownloadFile(ctx, "Docs", "a.pdf")
+                if err != nil {
+                    return nil, err
+                }
+                defer body.Close()
+                data, err := io.ReadAll(body)
+                return string(data), err
+            },
+            want: recordedRequest{Method: "GET", Path: "/download-file-knowledgebase", Query: "fileName=a.pdf&knowledgeBaseName=Docs"},
+            out:  "%PDF-1.4",
+        },
+        {
+            name:  "PreviewFile",
+            reply: `{"fileName":"a.txt","preview":"Hel","textLength":5,"truncated":true}`,
+            call:  func(c *Client) (interface{}, error) { return c.PreviewFile(ctx, "Docs", "a.txt", 3) },
+            want:  recordedRequest{Method: "POST", Path: "/preview-file-knowledgebase", Body: map[string]interface{}{"knowledgeBaseName": "Docs", "fileName": "a.txt", "maxLength": float64(3)}},
+            out:   &FilePreview{FileName: "a.txt", Preview: "Hel", TextLength: 5, Truncated: true},
+        },
+        {
+            name: "DeleteFile",
+            call: func(c *Client) (interface{}, error) { return nil, c.DeleteFile(ctx, "Docs", "a.txt") },
+            want: recordedRequest{Method: "POST", Path: "/delete-file-knowledgebase", Body: map[string]interface{}{"knowledgeBaseName": "Docs", "fileName": "a.txt"}},
+        },
+        {
+            name: "ReplaceFile",
+            call: func(c *Client) (interface{}, error) {
+                return nil, c.ReplaceFile(ctx, "Docs", "a.txt", strings.NewReader("Hello"))
+            },
+            want: recordedRequest{Method: "PUT", Path: "/replace-file-knowledgebase", Query: "fileName=a.txt&knowledgeBaseName=Docs"},
+        },
+        {
+            name:  "CreateUpload",
+            reply: `{"uploadID":"u1","title":"Bot","fileName":"a.pdf","size":10,"sha256":"ab","offset":0,"expiresAt":"2024-01-03T00:00:00Z"}`,
+            call:  func(c *Client) (interface{}, error) { return c.CreateUpload(ctx, "Bot", "a.pdf", 10, "ab") },
+            want:  recordedRequest{Method: "POST", Path: "/create-upload", Body: map[string]interface{}{"title": "Bot", "fileName": "a.pdf", "size": float64(10), "sha256": "ab"}},
+            out:   &UploadSession{UploadID: "u1", Title: "Bot", FileName: "a.pdf", Size: 10, SHA256: "ab", ExpiresAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+        },
+        {
+            name:  "GetUpload",
+            reply: `{"uploadID":"u1","offset":4}`,
+            call:  func(c *Client) (interface{}, error) { return c.GetUpload(ctx, "Bot", "u1") },
+            want:  recordedRequest{Method: "GET", Path: "/get-upload", Query: "title=Bot&uploadID=u1"},
+            out:   &UploadSession{UploadID: "u1", Offset: 4},
+        },
+        {
+            name:  "FinalizeUpload",
+            reply: `{"message":"File uploaded successfully","files":[{"fileName":"a.pdf","size":10,"status":"pending"}]}`,
+            call:  func(c *Client) (interface{}, error) { return c.FinalizeUpload(ctx, "Bot", "u1") },
+            want:  recordedRequest{Method: "POST", Path: "/finalize-upload", Body: map[string]interface{}{"title": "Bot", "uploadID": "u1"}},
+            out:   []UploadResult{{FileName: "a.pdf", Size: 10, Status: "pending"}},
+        },
+        {
+            name: "CancelUpload",
+            call: func(c *Client) (interface{}, error) { return nil, c.CancelUpload(ctx, "Bot", "u1") },
+            want: recordedRequest{Method: "POST", Path: "/cancel-upload", Body: map[string]interface{}{"title": "Bot", "uploadID": "u1"}},
+        },
+        {
+            name:  "GetFileTypePolicy",
+            reply: `{"knowledgeBaseName":"Docs","policy":{"allowedTypes":["text/*"]}}`,
+            call:  func(c *Client) (interface{}, error) { return c.GetFileTypePolicy(ctx, "Docs") },
+            want:  recordedRequest{Method: "GET", Path: "/get-file-type-policy", Query: "knowledgeBaseName=Docs"},
+            out:   &FileTypePolicy{AllowedTypes: []string{"text/*"}},
+        },
+        {
+            name: "UpdateFileTypePolicy",
+            call: func(c *Client) (interface{}, error) {
+                return nil, c.UpdateFileTypePolicy(ctx, "Docs", FileTypePolicy{DeniedTypes: []string{"video/*"}})
+            },
+            want: recordedRequest{Method: "PUT", Path: "/update-file-type-policy", Body: map[string]interface{}{"knowledgeBaseName": "Docs", "deniedTypes": []interface{}{"video/*"}}},
+        },
+        {
+            name:  "GetChunkingSettings",
+            reply: `{"knowledgeBaseName":"Docs","settings":{"strategy":"fixed","chunkSize":100,"overlap":10}}`,
+            call:  func(c *Client) (interface{}, error) { return c.GetChunkingSettings(ctx, "Docs") },
+            want:  recordedRequest{Method: "GET", Path: "/get-chunking-settings", Query: "knowledgeBaseName=Docs"},
+            out:   &ChunkingSettings{Strategy: "fixed", ChunkSize: 100, Overlap: 10},
+        },
+        {
+            name: "UpdateChunkingSettings",
+            call: func(c *Client) (interface{}, error) {
+                return nil, c.UpdateChunkingSettings(ctx, "Docs", ChunkingSettings{Strategy: "markdown", ChunkSize: 50})
+            },
+            want: recordedRequest{Method: "PUT", Path: "/update-chunking-settings", Body: map[string]interface{}{"knowledgeBaseName": "Docs", "strategy": "markdown", "chunkSize": float64(50)}},
+        },
+        {
+            name:  "PreviewChunks",
+            reply: `{"fileName":"a.md","settings":{"strategy":"sentence","chunkSize":20},"chunks":[{"id":"c1","file":"a.md","index":0,"start":0,"end":3,"tokens":1,"text":"Hi."}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.PreviewChunks(ctx, "Docs", "a.md", &ChunkingSettings{Strategy: "sentence", ChunkSize: 20})
+            },
+            want: recordedRequest{Method: "POST", Path: "/preview-chunks", Body: map[string]interface{}{
+                "knowledgeBaseName": "Docs", "fileName": "a.md", "settings": map[string]interface{}{"strategy": "sentence", "chunkSize": float64(20)},
+            }},
+            out: []Chunk{{ID: "c1", File: "a.md", End: 3, Tokens: 1, Text: "Hi."}},
+        },
+        {
+            name:  "SearchKnowledgeBases",
+            reply: `{"results":[{"knowledgeBase":"Docs","score":1.5,"snippet":"<mark>Hi</mark>.","id":"c1","file":"a.md","index":0,"start":0,"end":3,"tokens":1,"text":"Hi."}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.SearchKnowledgeBases(ctx, "hi", KnowledgeSearchOptions{Mode: "hybrid", KnowledgeBases: []string{"Docs"}, TopK: 3, Extensions: []string{".md"}})
+            },
+            want: recordedRequest{Method: "POST", Path: "/search-knowledgebases", Body: map[string]interface{}{
+                "query": "hi", "mode": "hybrid", "knowledgeBases": []interface{}{"Docs"}, "topK": float64(3), "filters": map[string]interface{}{"extensions": []interface{}{".md"}},
+            }},
+            out: []KnowledgeSearchResult{{KnowledgeBase: "Docs", Score: 1.5, Snippet: "<mark>Hi</mark>.", Chunk: Chunk{ID: "c1", File: "a.md", End: 3, Tokens: 1, Text: "Hi."}}},
+        },
+        {
+            name:  "ListHistories",
+            reply: `{"files":["a.json"]}`,
+            call:  func(c *Client) (interface{}, error) { return c.ListHistories(ctx) },
+            want:  recordedRequest{Method: "GET", Path: "/chat-history"},
+            out:   []string{"a.json"},
+        },
+        {
+            name:  "ListConversations",
+            reply: `{"conversations":[{"id":"abc","assistant":"Lets Chat","messageCount":2}],"nextCursor":"next"}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.ListConversations(ctx, ListConversationsOptions{Assistant: "Lets Chat", Sort: "title", Limit: 10})
+            },
+            want: recordedRequest{Method: "GET", Path: "/list-conversations", Query: "assistant=Lets+Chat&limit=10&sort=title"},
+            out:  &ConversationPage{Conversations: []ConversationSummary{{ID: "abc", Assistant: "Lets Chat", MessageCount: 2}}, NextCursor: "next"},
+        },
+        {
+            name:  "SearchHistories",
+            reply: `{"results":[{"historyID":"abc","assistant":"Lets Chat","matches":[{"messageID":"m1","role":"user","snippet":"<mark>hi</mark>"}]}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.SearchHistories(ctx, `"hi there"`, SearchOptions{From: "2024-01-02"})
+            },
+            want: recordedRequest{Method: "GET", Path: "/search-histories", Query: "from=2024-01-02&q=%22hi+there%22"},
+            out:  []SearchResult{{HistoryID: "abc", Assistant: "Lets Chat", Matches: []SearchMatch{{MessageID: "m1", Role: "user", Snippet: "<mark>hi</mark>"}}}},
+        },
+        {
+            name:  "CreateHistory",
+            reply: `{"message":"ok","fileID":"abc"}`,
+            call:  func(c *Client) (interface{}, error) { return c.CreateHistory(ctx, "Lets Chat") },
+            want:  recordedRequest{Method: "POST", Path: "/create-history", Body: map[string]interface{}{"assistantTitle": "Lets Chat"}},
+            out:   "abc",
+        },
+        {
+            name: "DeleteHistory",
+            call: func(c *Client) (interface{}, error) { return nil, c.DeleteHistory(ctx, "Lets Chat", "abc") },
+            want: recordedRequest{Method: "DELETE", Path: "/delete-history", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "chatHistoryID": "abc"}},
+        },
+        {
+            name: "UpdateChatContext",
+            call: func(c *Client) (interface{}, error) { return nil, c.UpdateChatContext(ctx, "Lets Chat", "abc", "{}") },
+            want: recordedRequest{Method: "PUT", Path: "/update-chat-context/abc", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "context": "{}"}},
+        },
+        {
+            name:  "FetchHistory",
+            reply: `{"context":"{}"}`,
+            call:  func(c *Client) (interface{}, error) { return c.FetchHistory(ctx, "Lets Chat", "abc") },
+            want:  recordedRequest{Method: "POST", Path: "/fetch-history", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "historyID": "abc"}},
+            out:   "{}",
+        },
+        {
+            name: "RenameHistory",
+            call: func(c *Client) (interface{}, error) { return nil, c.RenameHistory(ctx, "Lets Chat", "abc", "Invoices") },
+            want: recordedRequest{Method: "PUT", Path: "/rename-history", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "historyID": "abc", "title": "Invoices"}},
+        },
+        {
+            name:  "ExportHistory",
+            reply: "# Invoices",
+            call: func(c *Client) (interface{}, error) {
+                body, err := c.ExportHistory(ctx, "Lets Chat", "abc", "markdown")
+                if err != nil {
+                    return nil, err
+                }
+                defer body.Close()
+                data, err := io.ReadAll(body)
+                return string(data), err
+            },
+            want: recordedRequest{Method: "GET", Path: "/export-history", Query: "assistant=Lets+Chat&format=markdown&historyID=abc"},
+            out:  "# Invoices",
+        },
+        {
+            name:  "EditMessage",
+            reply: `{"message":"ok","messageIDs":["m3"]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.EditMessage(ctx, "Lets Chat", "abc", "m1", Message{Role: "user", Content: "hi"})
+            },
+            want: recordedRequest{Method: "POST", Path: "/append-messages", Body: map[string]interface{}{
+                "assistantTitle": "Lets Chat", "historyID": "abc", "editMessageID": "m1",
+                "messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi", "createdAt": "0001-01-01T00:00:00Z"}},
+            }},
+            out: []string{"m3"},
+        },
+        {
+            name:  "SwitchBranch",
+            reply: `{"message":"ok","messageIDs":["m1","m2"]}`,
+            call:  func(c *Client) (interface{}, error) { return c.SwitchBranch(ctx, "Lets Chat", "abc", "m1") },
+            want:  recordedRequest{Method: "PUT", Path: "/switch-branch", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "historyID": "abc", "messageID": "m1"}},
+            out:   []string{"m1", "m2"},
+        },
+        {
+            name:  "ForkHistory",
+            reply: `{"message":"ok","historyID":"def"}`,
+            call:  func(c *Client) (interface{}, error) { return c.ForkHistory(ctx, "Lets Chat", "abc", "m1") },
+            want:  recordedRequest{Method: "POST", Path: "/fork-history", Body: map[string]interface{}{"assistantTitle": "Lets Chat", "historyID": "abc", "messageID": "m1"}},
+            out:   "def",
+        },
+        {
+            name:  "ImportHistories",
+            reply: `{"format":"openai","imported":1,"results":[{"index":0,"title":"Hi","historyID":"abc","messages":1}]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.ImportHistories(ctx, "Lets Chat", "export.json", strings.NewReader(`[{"role":"user","content":"Hi"}]`))
+            },
+            want: recordedRequest{Method: "POST", Path: "/import-histories", Query: "assistant=Lets+Chat"},
+            out:  &ImportResponse{Format: "openai", Imported: 1, Results: []ImportResult{{Index: 0, Title: "Hi", HistoryID: "abc", Messages: 1}}},
+        },
+        {
+            name:  "AppendMessages",
+            reply: `{"message":"ok","messageIDs":["m3"]}`,
+            call: func(c *Client) (interface{}, error) {
+                return c.AppendMessages(ctx, "Lets Chat", "abc", "m2", Message{Role: "user", Content: "hi"})
+            },
+            want: recordedRequest{Method: "POST", Path: "/append-messages", Body: map[string]interface{}{
+                "assistantTitle": "Lets Chat", "historyID": "abc", "afterMessageID": "m2",
+                "messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi", "createdAt": "0001-01-01T00:00:00Z"}},
+            }},
+            out: []string{"m3"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            reply := tt.reply
+            if reply == "" {
+                reply = `{"message":"ok"}`
+            }
+            srv, got := newRecorder(t, http.StatusOK, reply)
+
+            out, err := tt.call(New(srv.URL))
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if !reflect.DeepEqual(*got, tt.want) {
+                t.Errorf("request = %+v, want %+v", *got, tt.want)
+            }
+            if tt.out != nil && !reflect.DeepEqual(out, tt.out) {
+                t.Errorf("result = %#v, want %#v", out, tt.out)
+            }
+        })
+    }
+}
+
+func TestUpload(t *testing.T) {
+    var title, user, filename, content string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        title, user = r.URL.Query().Get("title"), r.Header.Get("X-User")
+        file, header, err := r.FormFile("file")
+        if err != nil {
+            http.Error(w, "Failed to get file from request", http.StatusBadRequest)
+            return
+        }
+        defer file.Close()
+        data, _ := io.ReadAll(file)
+        filename, content = header.Filename, string(data)
+        io.WriteString(w, `{"message":"File uploaded successfully"}`)
+    }))
+    defer srv.Close()
+
+    err := New(srv.URL, WithUser("alice")).Upload(context.Background(), "Bot", "notes.txt", strings.NewReader("hello"))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if title != "Bot" || user != "alice" || filename != "notes.txt" || content != "hello" {
+        t.Errorf("server got title=%q user=%q filename=%q content=%q", title, user, filename, content)
+    }
+}
+
+func TestUploadFiles(t *testing.T) {
+    var names []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if err := r.ParseMultipartForm(1 << 20); err != nil {
+            http.Error(w, "Failed to get file from request", http.StatusBadRequest)
+            return
+        }
+        for _, header := range r.MultipartForm.File["file"] {
+            names = append(names, header.Filename)
+        }
+        io.WriteString(w, `{"message":"Files uploaded successfully","files":[{"fileName":"a.txt","size":1,"status":"pending"},{"fileName":"b.txt","size":2,"status":"pending"}]}`)
+    }))
+    defer srv.Close()
+
+    got, err := New(srv.URL).UploadFiles(context.Background(), "Bot",
+        File{Name: "a.txt", Content: strings.NewReader("a")},
+        File{Name: "b.txt", Content: strings.NewReader("bb")},
+    )
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !reflect.DeepEqual(names, []string{"a.txt", "b.txt"}) {
+        t.Errorf("server got files %v", names)
+    }
+    want := []UploadResult{{FileName: "a.txt", Size: 1, Status: "pending"}, {FileName: "b.txt", Size: 2, Status: "pending"}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("results = %+v, want %+v", got, want)
+    }
+}
+
+func TestUploadResumable(t *testing.T) {
+    const content = "The quick brown fox jumps over the lazy dog"
+    var received []byte
+    var dropped, finalized bool
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        session := func() {
+            fmt.Fprintf(w, `{"uploadID":"u1","size":%d,"offset":%d}`, len(content), len(received))
+        }
+        switch r.URL.Path {
+        case "/create-upload":
+            var req createUploadRequest
+            json.NewDecoder(r.Body).Decode(&req)
+            if sum := sha256.Sum256([]byte(content)); req.SHA256 != hex.EncodeToString(sum[:]) || req.Size != int64(len(content)) {
+                http.Error(w, "bad upload", http.StatusBadRequest)
+                return
+            }
+            w.WriteHeader(http.StatusCreated)
+            session()
+        case "/get-upload":
+            session()
+        case "/upload-chunk":
+            chunk, _ := io.ReadAll(r.Body)
+            if r.Header.Get("Upload-Offset") != strconv.Itoa(len(received)) {
+                http.Error(w, "wrong offset", http.StatusConflict)
+                return
+            }
+            received = append(received, chunk...)
+            // The connection drops once after the server got the chunk
+            if len(received) > 20 && !dropped {
+                dropped = true
+                panic(http.ErrAbortHandler)
+            }
+            session()
+        case "/finalize-upload":
+            finalized = true
+            fmt.Fprintf(w, `{"files":[{"fileName":"fox.txt","size":%d,"status":"pending"}]}`, len(received))
+        }
+    }))
+    defer srv.Close()
+
+    results, err := New(srv.URL).UploadResumable(context.Background(), "Bot", "fox.txt", strings.NewReader(content), int64(len(content)), 16)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if string(received) != content || !dropped || !finalized {
+        t.Errorf("server got %q, dropped=%v finalized=%v", received, dropped, finalized)
+    }
+    if len(results) != 1 || results[0].Size != int64(len(content)) {
+        t.Errorf("results = %+v", results)
+    }
+}
+
+func TestErrors(t *testing.T) {
+    tests := []struct {
+        name     string
+        status   int
+        body     string
+        sentinel error
+        message  string
+        fields   []FieldError
+    }{
+        {
+            name:     "validation error",
+            status:   http.StatusBadRequest,
+            body:     `{"error":"Invalid request","fields":[{"field":"title","message":"is required"}]}`,
+            sentinel: ErrBadRequest,
+            message:  "Invalid request",
+            fields:   []FieldError{{Field: "title", Message: "is required"}},
+        },
+        {
+            name:     "plain text error",
+            status:   http.StatusInternalServerError,
+            body:     "Failed to read roleSetting file\n",
+            sentinel: ErrServer,
+            message:  "Failed to read roleSetting file",
+        },
+        {
+            name:     "not found",
+            status:   http.StatusNotFound,
+            sentinel: ErrNotFound,
+            message:  "Not Found",
+        },
+        {
+            name:     "precondition failed",
+            status:   http.StatusPreconditionFailed,
+            body:     `{"error":"History was modified"}`,
+            sentinel: ErrConflict,
+            message:  "History was modified",
+        },
+        {
+            name:     "too large",
+            status:   http.StatusRequestEntityTooLarge,
+            body:     `{"error":"Request body must not be larger than 1048576 bytes"}`,
+            sentinel: ErrTooLarge,
+            message:  "Request body must not be larger than 1048576 bytes",
+        },
+        {
+            name:     "unsupported type",
+            status:   http.StatusUnsupportedMediaType,
+            body:     "File \"a.pdf\" is an executable (application/x-elf) disguised by its name\n",
+            sentinel: ErrUnsupportedType,
+            message:  `File "a.pdf" is an executable (application/x-elf) disguised by its name`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            srv, _ := newRecorder(t, tt.status, tt.body)
+
+            _, err := New(srv.URL).GetRoleSetting(context.Background(), "Bot")
+
+            var apiErr *APIError
+            if !errors.As(err, &apiErr) {
+                t.Fatalf("error = %v, want *APIError", err)
+            }
+            if !errors.Is(err, tt.sentinel) {
+                t.Errorf("errors.Is(%v, %v) = false", err, tt.sentinel)
+            }
+            if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+                t.Errorf("got status=%d message=%q, want status=%d message=%q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+            }
+            if !reflect.DeepEqual(apiErr.Fields, tt.fields) {
+                t.Errorf("fields = %+v, want %+v", apiErr.Fields, tt.fields)
+            }
+        })
+    }
+}
+
+// flakyServer fails the first failures requests with status
+func flakyServer(t *testing.T, status, failures int, retryAfter string) (*httptest.Server, *int32) {
+    t.Helper()
+    var calls int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        if string(body) != `{"context":"hi"}` {
+            t.Errorf("attempt %d got body %q", atomic.LoadInt32(&calls)+1, body)
+        }
+        if atomic.AddInt32(&calls, 1) <= int32(failures) {
+            if retryAfter != "" {
+                w.Header().Set("Retry-After", retryAfter)
+            }
+            http.Error(w, http.StatusText(status), status)
+            return
+        }
+        io.WriteString(w, `{"response":"Hello!"}`)
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &calls
+}
+
+func TestRetries(t *testing.T) {
+    for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+        t.Run(http.StatusText(status), func(t *testing.T) {
+            srv, calls := flakyServer(t, status, 2, "")
+            c := New(srv.URL, WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+            resp, err := c.Chat(context.Background(), ChatRequest{Context: "hi"})
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if resp.Response != "Hello!" || *calls != 3 {
+                t.Errorf("response = %q after %d calls, want Hello! after 3", resp.Response, *calls)
+            }
+        })
+    }
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+    srv, calls := flakyServer(t, http.StatusServiceUnavailable, 10, "")
+    c := New(srv.URL, WithMaxRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+
+    _, err := c.Chat(context.Background(), ChatRequest{Context: "hi"})
+    if !errors.Is(err, ErrUnavailable) {
+        t.Fatalf("error = %v, want ErrUnavailable", err)
+    }
+    if *calls != 3 {
+        t.Errorf("calls = %d, want 3", *calls)
+    }
+}
+
+func TestNoRetryOnClientErrors(t *testing.T) {
+    srv, calls := flakyServer(t, http.StatusBadRequest, 10, "")
+    c := New(srv.URL, WithBackoff(time.Millisecond, time.Millisecond))
+
+    if _, err := c.Chat(context.Background(), ChatRequest{Context: "hi"}); !errors.Is(err, ErrBadRequest) {
+        t.Fatalf("error = %v, want ErrBadRequest", err)
+    }
+    if *calls != 1 {
+        t.Errorf("calls = %d, want 1", *calls)
+    }
+}
+
+func TestRetryHonoursContext(t *testing.T) {
+    srv, _ := flakyServer(t, http.StatusTooManyRequests, 10, "60")
+    c := New(srv.URL, WithBackoff(time.Millisecond, time.Minute))
+
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    _, err := c.Chat(ctx, ChatRequest{Context: "hi"})
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+    }
+    if elapsed := time.Since(start); elapsed > 5*time.Second {
+        t.Errorf("waited %v despite the context deadline", elapsed)
+    }
+}
+
+func TestBackoff(t *testing.T) {
+    c := New("http://example.com", WithBackoff(100*time.Millisecond, time.Second))
+
+    for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+        got := c.backoff(attempt, "")
+        if got < max/2 || got > max {
+            t.Errorf("backoff(%d) = %v, want within [%v, %v]", attempt, got, max/2, max)
+        }
+    }
+    if got := c.backoff(0, "1"); got != time.Second {
+        t.Errorf("backoff with Retry-After: 1 = %v, want 1s", got)
+    }
+    if got := c.backoff(0, "120"); got != time.Second {
+        t.Errorf("backoff with Retry-After: 120 = %v, want capped at 1s", got)
+    }
+}
+
+func TestChatStream(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/chat-stream" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "text/event-stream")
+        io.WriteString(w, ": comment\n\ndata: {\"delta\":\"Hello! \"}\n\ndata: {\"delta\":\"Bye\"}\n\ndata: {\"delta\":\"\",\"historyID\":\"h1\",\"messageIDs\":[\"m1\",\"m2\"],\"citations\":[{\"footnote\":1,\"fileName\":\"a.md\",\"chunkID\":\"c1\"}]}\n\ndata: [DONE]\n\n")
+    }))
+    defer srv.Close()
+
+    stream, err := New(srv.URL).ChatStream(context.Background(), ChatRequest{Context: "hi"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer stream.Close()
+
+    first, err := stream.Next()
+    if err != nil || first != "Hello! " {
+        t.Fatalf("Next() = %q, %v", first, err)
+    }
+    rest, err := stream.Collect()
+    if err != nil || rest != "Bye" {
+        t.Errorf("Collect() = %q, %v", rest, err)
+    }
+    if _, err := stream.Next(); err != io.EOF {
+        t.Errorf("Next() after end = %v, want io.EOF", err)
+    }
+    if stream.HistoryID() != "h1" || !reflect.DeepEqual(stream.MessageIDs(), []string{"m1", "m2"}) {
+        t.Errorf("stored in %q as %v, want h1 as [m1 m2]", stream.HistoryID(), stream.MessageIDs())
+    }
+    if want := []Citation{{Footnote: 1, FileName: "a.md", ChunkID: "c1"}}; !reflect.DeepEqual(stream.Citations(), want) {
+        t.Errorf("citations = %+v, want %+v", stream.Citations(), want)
+    }
+}
+
+func TestChatStreamTruncated(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, "data: {\"delta\":\"Hel\"}\n\n")
+    }))
+    defer srv.Close()
+
+    stream, err := New(srv.URL).ChatStream(context.Background(), ChatRequest{Context: "hi"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer stream.Close()
+
+    if _, err := stream.Collect(); err != io.ErrUnexpectedEOF {
+        t.Errorf("Collect() error = %v, want io.ErrUnexpectedEOF", err)
+    }
+}
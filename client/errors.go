@@ -0,0 +1,80 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// Errors matched by errors.Is against the *APIError returned for failed
+// requests
+var (
+    ErrBadRequest       = errors.New("bad request")
+    ErrNotFound         = errors.New("not found")
+    ErrMethodNotAllowed = errors.New("method not allowed")
+    ErrConflict         = errors.New("conflict")
+    ErrTooLarge         = errors.New("request too large")
+    ErrUnsupportedType  = errors.New("unsupported media type")
+    ErrRateLimited      = errors.New("rate limited")
+    ErrUnavailable      = errors.New("service unavailable")
+    ErrServer           = errors.New("server error")
+)
+
+// APIError is returned when the server answers with a non-success status
+type APIError struct {
+    StatusCode int
+    Message    string
+    Fields     []FieldError // field-level problems reported for invalid requests
+}
+
+func (e *APIError) Error() string {
+    msg := fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+    for _, f := range e.Fields {
+        msg += fmt.Sprintf("; %s %s", f.Field, f.Message)
+    }
+    return msg
+}
+
+// Unwrap maps the status code to one of the package's sentinel errors
+func (e *APIError) Unwrap() error {
+    switch {
+    case e.StatusCode == http.StatusBadRequest:
+        return ErrBadRequest
+    case e.StatusCode == http.StatusNotFound:
+        return ErrNotFound
+    case e.StatusCode == http.StatusMethodNotAllowed:
+        return ErrMethodNotAllowed
+    case e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed:
+        return ErrConflict
+    case e.StatusCode == http.StatusRequestEntityTooLarge:
+        return ErrTooLarge
+    case e.StatusCode == http.StatusUnsupportedMediaType:
+        return ErrUnsupportedType
+    case e.StatusCode == http.StatusTooManyRequests:
+        return ErrRateLimited
+    case e.StatusCode == http.StatusServiceUnavailable:
+        return ErrUnavailable
+    case e.StatusCode >= 500:
+        return ErrServer
+    }
+    return nil
+}
+
+// newAPIError builds an APIError from an error response body, which is
+// either a JSON ErrorResponse or a plain text message
+func newAPIError(status int, body []byte) *APIError {
+    apiErr := &APIError{StatusCode: status}
+    var resp errorResponse
+    if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+        apiErr.Message = resp.Error
+        apiErr.Fields = resp.Fields
+        return apiErr
+    }
+    apiErr.Message = strings.TrimSpace(string(body))
+    if apiErr.Message == "" {
+        apiErr.Message = http.StatusText(status)
+    }
+    return apiErr
+}
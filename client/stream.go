@@ -0,0 +1,105 @@
+package client
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// ChatStream reads the reply of a streamed chat request
+type ChatStream struct {
+    body    io.ReadCloser
+    scanner *bufio.Scanner
+    done    bool
+    stored  ChatStreamChunk
+}
+
+// ChatStream sends a chat message and returns a stream of the reply. The
+// caller must close the stream.
+func (c *Client) ChatStream(ctx context.Context, req ChatRequest) (*ChatStream, error) {
+    body, err := json.Marshal(req)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := c.do(ctx, http.MethodPost, "/chat-stream", nil, "application/json", body)
+    if err != nil {
+        return nil, err
+    }
+    return &ChatStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next returns the next piece of the reply, or io.EOF once the reply is
+// complete
+func (s *ChatStream) Next() (string, error) {
+    if s.done {
+        return "", io.EOF
+    }
+    for s.scanner.Scan() {
+        line := s.scanner.Text()
+        data, ok := strings.CutPrefix(line, "data:")
+        if !ok {
+            // Blank event separators, comments and other fields
+            continue
+        }
+        data = strings.TrimSpace(data)
+        if data == "[DONE]" {
+            s.done = true
+            return "", io.EOF
+        }
+        var chunk ChatStreamChunk
+        if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+            return "", err
+        }
+        if chunk.HistoryID != "" {
+            s.stored = chunk
+            continue
+        }
+        return chunk.Delta, nil
+    }
+    if err := s.scanner.Err(); err != nil {
+        return "", err
+    }
+    return "", io.ErrUnexpectedEOF
+}
+
+// Collect reads the remaining reply and returns it as a whole
+func (s *ChatStream) Collect() (string, error) {
+    var b strings.Builder
+    for {
+        delta, err := s.Next()
+        if err == io.EOF {
+            return b.String(), nil
+        }
+        if err != nil {
+            return b.String(), err
+        }
+        b.WriteString(delta)
+    }
+}
+
+// HistoryID returns the ID of the history the message and the reply were
+// stored in, once the reply is complete. It is empty if the request named
+// neither a history nor an assistant.
+func (s *ChatStream) HistoryID() string {
+    return s.stored.HistoryID
+}
+
+// MessageIDs returns the IDs of the stored message and reply, once the
+// reply is complete
+func (s *ChatStream) MessageIDs() []string {
+    return s.stored.MessageIDs
+}
+
+// Citations returns the knowledge base chunks the footnotes of the reply
+// refer to, once the reply is complete
+func (s *ChatStream) Citations() []Citation {
+    return s.stored.Citations
+}
+
+// Close releases the connection of the stream
+func (s *ChatStream) Close() error {
+    return s.body.Close()
+}
@@ -0,0 +1,480 @@
+package client
+
+import (
+    "io"
+    "time"
+)
+
+// ChatRequest represents the structure of the request for chat
+type ChatRequest struct {
+    Context string `json:"context"`
+    // AssistantTitle and HistoryID name the history the message and the
+    // reply are stored in; without a history ID a new one is created
+    AssistantTitle string `json:"assistantTitle,omitempty"`
+    HistoryID      string `json:"historyID,omitempty"`
+    // EditMessageID is a message of the history the message replaces, it
+    // starts a new branch next to it
+    EditMessageID string `json:"editMessageID,omitempty"`
+    // Retrieval makes the reply draw on the knowledge bases attached to
+    // the assistant, it requires AssistantTitle
+    Retrieval *RetrievalOptions `json:"retrieval,omitempty"`
+}
+
+// RetrievalOptions configures the knowledge base search of a chat reply.
+// Zero values use the server defaults.
+type RetrievalOptions struct {
+    Mode string `json:"mode,omitempty"` // lexical, semantic or hybrid
+    TopK int    `json:"topK,omitempty"`
+}
+
+// ChatResponse represents the structure of the response for chat
+type ChatResponse struct {
+    Response   string     `json:"response"`
+    HistoryID  string     `json:"historyID,omitempty"`
+    MessageIDs []string   `json:"messageIDs,omitempty"`
+    Title      string     `json:"title,omitempty"`
+    Citations  []Citation `json:"citations,omitempty"`
+}
+
+// Citation points at the knowledge base chunk behind a footnote such as
+// [1] of a reply. Start and End are byte offsets in the extracted text of
+// the file.
+type Citation struct {
+    Footnote      int     `json:"footnote"`
+    KnowledgeBase string  `json:"knowledgeBase"`
+    FileName      string  `json:"fileName"`
+    ChunkID       string  `json:"chunkID"`
+    Heading       string  `json:"heading,omitempty"`
+    Start         int     `json:"start"`
+    End           int     `json:"end"`
+    Score         float64 `json:"score"`
+}
+
+// ChatStreamChunk represents a single event of a streamed chat response
+type ChatStreamChunk struct {
+    Delta      string     `json:"delta"`
+    HistoryID  string     `json:"historyID,omitempty"`
+    MessageIDs []string   `json:"messageIDs,omitempty"`
+    Citations  []Citation `json:"citations,omitempty"`
+}
+
+// AssistantRequest represents the structure of the request for creating or updating an assistant
+type AssistantRequest struct {
+    Title       string `json:"title"`
+    RoleSetting string `json:"roleSetting"`
+}
+
+// RenameRequest represents the structure of the request for renaming an assistant
+type RenameRequest struct {
+    CurrentTitle string `json:"currentTitle"`
+    NewTitle     string `json:"newTitle"`
+}
+
+// Assistant represents an assistant as returned by ListAssistants
+type Assistant struct {
+    Title  string `json:"title"`
+    Avatar string `json:"avatar"`
+}
+
+// RoleSetting represents the role setting of an assistant
+type RoleSetting struct {
+    Title       string `json:"title"`
+    RoleSetting string `json:"roleSetting"`
+}
+
+// MessageResponse represents the structure of a generic success response
+type MessageResponse struct {
+    Message string `json:"message"`
+}
+
+// FileInfo represents a file of a knowledge base
+type FileInfo struct {
+    Name         string `json:"name"`
+    Type         string `json:"type"`        // image, video, audio, document or unknown
+    ContentType  string `json:"contentType"` // MIME type detected from the content
+    Size         int64  `json:"size"`        // in bytes
+    SHA256       string `json:"sha256"`
+    OriginalName string `json:"originalName"` // as uploaded
+    UploadedBy   string `json:"uploadedBy,omitempty"`
+    CreationTime string `json:"creationTime"` // when a file of the name was first uploaded
+    UpdatedTime  string `json:"updatedTime"`  // when the content last changed
+    // Status is the ingestion status of the file: pending, processed or
+    // failed, with the reason in Error
+    Status     string `json:"status"`
+    Error      string `json:"error,omitempty"`
+    TextLength int    `json:"textLength"`
+    Chunks     int    `json:"chunks"`
+}
+
+// ListFilesOptions sorts and filters the files listed by ListFiles. Zero
+// values use the server defaults and disable the filters.
+type ListFilesOptions struct {
+    Sort         string `json:"sort,omitempty"`        // name, size, type, createdAt or updatedAt
+    Order        string `json:"order,omitempty"`       // asc or desc
+    Type         string `json:"type,omitempty"`        // image, video, audio, document or unknown
+    ContentType  string `json:"contentType,omitempty"` // such as application/pdf or image/*
+    Status       string `json:"status,omitempty"`      // pending, processed or failed
+    UploadedBy   string `json:"uploadedBy,omitempty"`
+    NameContains string `json:"nameContains,omitempty"` // ignoring case
+    MinSize      int64  `json:"minSize,omitempty"`      // in bytes
+    MaxSize      int64  `json:"maxSize,omitempty"`
+}
+
+// FilePreview is the start of the text extracted from a knowledge base file
+type FilePreview struct {
+    FileName   string `json:"fileName"`
+    Preview    string `json:"preview"`
+    TextLength int    `json:"textLength"` // in characters of the whole text
+    Truncated  bool   `json:"truncated"`
+}
+
+// ChunkingSettings configures how the files of a knowledge base are split
+// into chunks. Sizes are counted in words.
+type ChunkingSettings struct {
+    Strategy  string `json:"strategy"` // fixed, sentence, paragraph or markdown
+    ChunkSize int    `json:"chunkSize,omitempty"`
+    Overlap   int    `json:"overlap,omitempty"` // of the fixed strategy's windows
+}
+
+// FileTypePolicy limits the MIME types of the files uploaded to a
+// knowledge base. Entries are types such as application/pdf or families
+// such as image/*; files of denied types, and of types not allowed when
+// AllowedTypes is set, fail with ErrUnsupportedType. Executables disguised
+// by the name of another type are always refused.
+type FileTypePolicy struct {
+    AllowedTypes []string `json:"allowedTypes,omitempty"`
+    DeniedTypes  []string `json:"deniedTypes,omitempty"`
+}
+
+// Chunk is a piece of the extracted text of a knowledge base file. Start
+// and End are byte offsets in the extracted text.
+type Chunk struct {
+    ID      string `json:"id"`
+    File    string `json:"file"`
+    Index   int    `json:"index"`
+    Start   int    `json:"start"`
+    End     int    `json:"end"`
+    Tokens  int    `json:"tokens"`
+    Heading string `json:"heading,omitempty"`
+    Text    string `json:"text"`
+}
+
+// KnowledgeSearchOptions narrows a knowledge base search. Zero values use
+// the server defaults.
+type KnowledgeSearchOptions struct {
+    Mode           string   // lexical, semantic or hybrid
+    KnowledgeBases []string // all knowledge bases if empty
+    TopK           int
+    Files          []string
+    Extensions     []string // such as .md
+    Heading        string
+    MinScore       float64
+}
+
+// KnowledgeSearchResult is a chunk matching a knowledge base search. The
+// snippet is HTML escaped with the matching words wrapped in <mark>
+// elements.
+type KnowledgeSearchResult struct {
+    KnowledgeBase string  `json:"knowledgeBase"`
+    Score         float64 `json:"score"`
+    Snippet       string  `json:"snippet"`
+    Chunk
+}
+
+// Message is a single message of a conversation. ID and CreatedAt are
+// assigned by the server when left empty, ParentID is set by the server.
+type Message struct {
+    ID        string                 `json:"id,omitempty"`
+    ParentID  string                 `json:"parentID,omitempty"`
+    Role      string                 `json:"role"`
+    Content   string                 `json:"content"`
+    CreatedAt time.Time              `json:"createdAt,omitempty"`
+    Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ConversationSummary describes a conversation as returned by
+// ListConversations
+type ConversationSummary struct {
+    ID           string    `json:"id"`
+    Assistant    string    `json:"assistant"`
+    Title        string    `json:"title"`
+    MessageCount int       `json:"messageCount"`
+    LastMessage  string    `json:"lastMessage"`
+    CreatedAt    time.Time `json:"createdAt"`
+    UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ListConversationsOptions selects the conversations and the page returned
+// by ListConversations. Zero values use the server defaults.
+type ListConversationsOptions struct {
+    Assistant string
+    Sort      string // updatedAt, createdAt or title
+    Order     string // asc or desc
+    Limit     int
+    Cursor    string // NextCursor of the previous page
+}
+
+// ConversationPage is a page of a conversation listing
+type ConversationPage struct {
+    Conversations []ConversationSummary `json:"conversations"`
+    NextCursor    string                `json:"nextCursor"`
+}
+
+// SearchOptions narrows a search. Zero values use the server defaults.
+type SearchOptions struct {
+    Assistant string
+    From, To  string // dates such as 2024-01-02 or RFC 3339 times
+    Limit     int
+}
+
+// SearchResult is a conversation matching a search
+type SearchResult struct {
+    HistoryID string        `json:"historyID"`
+    Assistant string        `json:"assistant"`
+    Title     string        `json:"title"`
+    UpdatedAt time.Time     `json:"updatedAt"`
+    Matches   []SearchMatch `json:"matches"`
+}
+
+// SearchMatch is a message matching a search. The snippet is HTML escaped
+// with the matching words wrapped in <mark> elements.
+type SearchMatch struct {
+    MessageID string    `json:"messageID"`
+    Role      string    `json:"role"`
+    CreatedAt time.Time `json:"createdAt"`
+    Snippet   string    `json:"snippet"`
+}
+
+// File is a file to upload
+type File struct {
+    Name    string
+    Content io.Reader
+}
+
+// UploadResult reports a file stored by UploadFiles
+type UploadResult struct {
+    FileName    string `json:"fileName"`
+    Size        int64  `json:"size"`
+    ContentType string `json:"contentType"` // detected from the content
+    Status      string `json:"status"`      // ingestion status, pending until the text is extracted
+}
+
+type uploadResponse struct {
+    Message string         `json:"message"`
+    Files   []UploadResult `json:"files"`
+}
+
+// UploadSession describes a resumable upload. Offset is the number of
+// bytes received so far.
+type UploadSession struct {
+    UploadID  string    `json:"uploadID"`
+    Title     string    `json:"title"`
+    FileName  string    `json:"fileName"`
+    Size      int64     `json:"size"`
+    SHA256    string    `json:"sha256"`
+    Offset    int64     `json:"offset"`
+    ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type createUploadRequest struct {
+    Title    string `json:"title"`
+    FileName string `json:"fileName"`
+    Size     int64  `json:"size"`
+    SHA256   string `json:"sha256"`
+}
+
+type uploadSessionRequest struct {
+    Title    string `json:"title"`
+    UploadID string `json:"uploadID"`
+}
+
+// ImportResponse reports the result of ImportHistories
+type ImportResponse struct {
+    Format   string         `json:"format"` // openai, chatgpt or jsonl
+    Imported int            `json:"imported"`
+    Failed   int            `json:"failed"`
+    Results  []ImportResult `json:"results"`
+}
+
+// ImportResult reports what happened to a single imported conversation
+type ImportResult struct {
+    Index     int    `json:"index"`
+    Title     string `json:"title"`
+    HistoryID string `json:"historyID,omitempty"`
+    Messages  int    `json:"messages"`
+    Error     string `json:"error,omitempty"`
+}
+
+// FieldError describes what the server found wrong with a single request field
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+type directoryRequest struct {
+    Name string `json:"name"`
+}
+
+type knowledgeBaseRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+}
+
+type renameDirectoryRequest struct {
+    CurrentName string `json:"currentName"`
+    NewName     string `json:"newName"`
+}
+
+type attachKnowledgeBaseRequest struct {
+    AssistantTitle    string `json:"assistantTitle"`
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+}
+
+type assistantKnowledgeBasesResponse struct {
+    KnowledgeBases []string `json:"knowledgeBases"`
+}
+
+type listDirectoriesResponse struct {
+    Directories []string `json:"directories"`
+}
+
+type listFilesRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+    ListFilesOptions
+}
+
+type listFilesResponse struct {
+    Files []FileInfo `json:"files"`
+}
+
+type chunkingSettingsRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+    ChunkingSettings
+}
+
+type fileTypePolicyRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+    FileTypePolicy
+}
+
+type fileTypePolicyResponse struct {
+    KnowledgeBaseName string         `json:"knowledgeBaseName"`
+    Policy            FileTypePolicy `json:"policy"`
+}
+
+type chunkingSettingsResponse struct {
+    KnowledgeBaseName string           `json:"knowledgeBaseName"`
+    Settings          ChunkingSettings `json:"settings"`
+}
+
+type fileRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+    FileName          string `json:"fileName"`
+}
+
+type filePreviewRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName"`
+    FileName          string `json:"fileName"`
+    MaxLength         int    `json:"maxLength,omitempty"`
+}
+
+type previewChunksRequest struct {
+    KnowledgeBaseName string            `json:"knowledgeBaseName"`
+    FileName          string            `json:"fileName"`
+    Settings          *ChunkingSettings `json:"settings,omitempty"`
+}
+
+type previewChunksResponse struct {
+    Chunks []Chunk `json:"chunks"`
+}
+
+type knowledgeSearchFilters struct {
+    Files      []string `json:"files,omitempty"`
+    Extensions []string `json:"extensions,omitempty"`
+    Heading    string   `json:"heading,omitempty"`
+    MinScore   float64  `json:"minScore,omitempty"`
+}
+
+type searchKnowledgeBasesRequest struct {
+    Query          string                  `json:"query"`
+    Mode           string                  `json:"mode,omitempty"`
+    KnowledgeBases []string                `json:"knowledgeBases,omitempty"`
+    TopK           int                     `json:"topK,omitempty"`
+    Filters        *knowledgeSearchFilters `json:"filters,omitempty"`
+}
+
+type searchKnowledgeBasesResponse struct {
+    Results []KnowledgeSearchResult `json:"results"`
+}
+
+type chatHistoryResponse struct {
+    Files []string `json:"files"`
+}
+
+type createHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+}
+
+type createHistoryResponse struct {
+    Message string `json:"message"`
+    FileID  string `json:"fileID"`
+}
+
+type deleteHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+    ChatHistoryID  string `json:"chatHistoryID"`
+}
+
+type updateChatContextRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+    Context        string `json:"context"`
+}
+
+type fetchHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+    HistoryID      string `json:"historyID"`
+}
+
+type fetchHistoryResponse struct {
+    Context string `json:"context"`
+}
+
+type renameHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+    HistoryID      string `json:"historyID"`
+    Title          string `json:"title"`
+}
+
+type appendMessagesRequest struct {
+    AssistantTitle string    `json:"assistantTitle"`
+    HistoryID      string    `json:"historyID"`
+    Messages       []Message `json:"messages"`
+    AfterMessageID string    `json:"afterMessageID,omitempty"`
+    EditMessageID  string    `json:"editMessageID,omitempty"`
+}
+
+type appendMessagesResponse struct {
+    MessageIDs []string `json:"messageIDs"`
+}
+
+type branchRequest struct {
+    AssistantTitle string `json:"assistantTitle"`
+    HistoryID      string `json:"historyID"`
+    MessageID      string `json:"messageID,omitempty"`
+}
+
+type switchBranchResponse struct {
+    MessageIDs []string `json:"messageIDs"`
+}
+
+type forkHistoryResponse struct {
+    HistoryID string `json:"historyID"`
+}
+
+type searchHistoriesResponse struct {
+    Results []SearchResult `json:"results"`
+}
+
+type errorResponse struct {
+    Error  string       `json:"error"`
+    Fields []FieldError `json:"fields"`
+}
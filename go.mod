@@ -2,4 +2,4 @@ module ai-chatbot-api
 
 go 1.24.0
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,267 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "io/fs"
+    "net/http"
+    "path"
+)
+
+// AssistantRequest represents the structure of the incoming request for assistant
+type AssistantRequest struct {
+    Title       string `json:"title" validate:"required,max=100,charset=name"`
+    RoleSetting string `json:"roleSetting" validate:"max=10000"`
+}
+
+// RenameRequest represents the structure of the rename request
+type RenameRequest struct {
+    CurrentTitle string `json:"currentTitle" validate:"required,max=100,charset=name"`
+    NewTitle     string `json:"newTitle" validate:"required,max=100,charset=name"`
+}
+
+// AssistantResponse represents the structure of the response for listing assistants
+type AssistantResponse struct {
+    Title  string `json:"title"`
+    Avatar string `json:"avatar"`
+}
+
+// RoleSettingResponse represents the structure of the response for role settings
+type RoleSettingResponse struct {
+    Title       string `json:"title"`
+    RoleSetting string `json:"roleSetting"`
+}
+
+func (s *Server) createAssistantHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var assistantRequest AssistantRequest
+    if !decodeRequest(w, r, &assistantRequest) {
+        return
+    }
+
+    // Create the assistant folder
+    assistantDir := path.Join("assistants", assistantRequest.Title)
+    err := s.store.MkdirAll(assistantDir)
+    if err != nil {
+        http.Error(w, "Failed to create assistant directory", http.StatusInternalServerError)
+        return
+    }
+
+    // Create the roleSetting.txt file
+    roleSettingFile := path.Join(assistantDir, "roleSetting.txt")
+    err = s.store.WriteFile(roleSettingFile, []byte(assistantRequest.RoleSetting))
+    if err != nil {
+        http.Error(w, "Failed to create roleSetting file", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Assistant created successfully"})
+}
+
+func (s *Server) deleteAssistantHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodDelete {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "title", titleRules) {
+        return
+    }
+    title := r.URL.Query().Get("title")
+
+    assistantDir := path.Join("assistants", title)
+    if !s.exists(assistantDir) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+
+    err := s.store.RemoveAll(assistantDir)
+    if err != nil {
+        http.Error(w, "Failed to delete assistant directory", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Assistant deleted successfully"})
+}
+
+func (s *Server) updateAssistantHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var assistantRequest AssistantRequest
+    if !decodeRequest(w, r, &assistantRequest) {
+        return
+    }
+
+    roleSettingFile := path.Join("assistants", assistantRequest.Title, "roleSetting.txt")
+    err := s.store.WriteFile(roleSettingFile, []byte(assistantRequest.RoleSetting))
+    if err != nil {
+        writeStoreError(w, err, "Assistant not found", "Failed to update roleSetting file")
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Role setting updated successfully"})
+}
+
+func (s *Server) renameAssistantHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var renameRequest RenameRequest
+    if !decodeRequest(w, r, &renameRequest) {
+        return
+    }
+
+    currentDir := path.Join("assistants", renameRequest.CurrentTitle)
+    newDir := path.Join("assistants", renameRequest.NewTitle)
+
+    if !s.exists(currentDir) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    if s.exists(newDir) {
+        http.Error(w, "An assistant with this title already exists", http.StatusConflict)
+        return
+    }
+
+    err := s.store.Rename(currentDir, newDir)
+    if err != nil {
+        http.Error(w, "Failed to rename assistant directory", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Assistant renamed successfully"})
+}
+
+// List Assistants Handler
+func (s *Server) listAssistantsHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    assistantsDir := "assistants"
+    files, err := s.store.ReadDir(assistantsDir)
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, "Failed to read assistants directory", http.StatusInternalServerError)
+        return
+    }
+
+    assistants := []AssistantResponse{}
+    for _, file := range files {
+        if file.IsDir() {
+            assistants = append(assistants, AssistantResponse{
+                Title:  file.Name(),
+                Avatar: "🤖", // Static avatar for each assistant
+            })
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(assistants)
+}
+
+
+// Get Role Setting Handler
+func (s *Server) getRoleSettingHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "title", titleRules) {
+        return
+    }
+    title := r.URL.Query().Get("title")
+
+    roleSettingFile := path.Join("assistants", title, "roleSetting.txt")
+    content, err := s.store.ReadFile(roleSettingFile)
+    if err != nil {
+        writeStoreError(w, err, "Assistant not found", "Failed to read roleSetting file")
+        return
+    }
+
+    response := RoleSettingResponse{
+        Title:       title,
+        RoleSetting: string(content),
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// Upload File Handler
+func (s *Server) uploadFileHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    // Parse the assistant title from the request
+    if !validateQuery(w, r, "title", titleRules) {
+        return
+    }
+    title := r.URL.Query().Get("title")
+
+    if !s.exists(path.Join("assistants", title)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+
+    // Files are uploaded to the knowledge base named after the assistant,
+    // which is created and attached to it if needed
+    err := s.store.MkdirAll(knowledgeBaseDir(title))
+    if err != nil {
+        http.Error(w, "Failed to create KnowledgeBase directory", http.StatusInternalServerError)
+        return
+    }
+
+    // Receive every file before storing any, then extract their text in
+    // the background
+    uploads, ok := s.receiveUploads(w, r, title, "")
+    if !ok {
+        return
+    }
+    err = s.updateAttachments(title, attaching(title))
+    if err != nil {
+        for _, u := range uploads {
+            s.store.Remove(u.tmp)
+        }
+        http.Error(w, "Failed to update attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+    results, ok := s.storeUploads(w, title, uploads)
+    if !ok {
+        return
+    }
+
+    // Respond with success message
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(UploadResponse{Message: "Files uploaded successfully", Files: results})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+    "bytes"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "slices"
+    "testing"
+)
+
+func TestAssistantHandlers(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "create",
+            method: http.MethodPost,
+            target: "/createAssistant",
+            body:   `{"title":"Tester","roleSetting":"You test things"}`,
+            status: http.StatusCreated,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "assistants/Tester/roleSetting.txt", "You test things")
+                wantMissing(t, s, "knowledgebases/Tester")
+            },
+        },
+        {
+            name:   "create without role setting",
+            method: http.MethodPost,
+            target: "/createAssistant",
+            body:   `{"title":"Tester"}`,
+            status: http.StatusCreated,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "assistants/Tester/roleSetting.txt", "")
+            },
+        },
+        {
+            name:   "create with invalid title",
+            method: http.MethodPost,
+            target: "/createAssistant",
+            body:   `{"title":"a/b"}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "delete",
+            method: http.MethodDelete,
+            target: "/deleteAssistant?title=Writer",
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "assistants/Writer")
+            },
+        },
+        {
+            name:   "delete missing",
+            method: http.MethodDelete,
+            target: "/deleteAssistant?title=Nobody",
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "delete without title",
+            method: http.MethodDelete,
+            target: "/deleteAssistant",
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "update",
+            method: http.MethodPut,
+            target: "/updateAssistant",
+            body:   `{"title":"Writer","roleSetting":"You write tests"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "assistants/Writer/roleSetting.txt", "You write tests")
+            },
+        },
+        {
+            name:   "update missing",
+            method: http.MethodPut,
+            target: "/updateAssistant",
+            body:   `{"title":"Nobody","roleSetting":"x"}`,
+            status: http.StatusNotFound,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "assistants/Nobody")
+            },
+        },
+        {
+            name:   "rename",
+            method: http.MethodPut,
+            target: "/renameAssistant",
+            body:   `{"currentTitle":"Writer","newTitle":"Author"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "assistants/Writer")
+                wantFile(t, s, "assistants/Author/roleSetting.txt", "You write docs")
+            },
+        },
+        {
+            name:   "rename missing",
+            method: http.MethodPut,
+            target: "/renameAssistant",
+            body:   `{"currentTitle":"Nobody","newTitle":"Somebody"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "rename onto existing assistant",
+            method: http.MethodPut,
+            target: "/renameAssistant",
+            body:   `{"currentTitle":"Writer","newTitle":"Reviewer"}`,
+            status: http.StatusConflict,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "assistants/Writer/roleSetting.txt", "You write docs")
+                wantFile(t, s, "assistants/Reviewer/roleSetting.txt", "You review code")
+            },
+        },
+        {
+            name:   "list",
+            method: http.MethodGet,
+            target: "/listAssistants",
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got []AssistantResponse
+                decodeBody(t, rec, &got)
+                want := []AssistantResponse{{Title: "Reviewer", Avatar: "🤖"}, {Title: "Writer", Avatar: "🤖"}}
+                if !reflect.DeepEqual(got, want) {
+                    t.Errorf("assistants = %+v, want %+v", got, want)
+                }
+            },
+        },
+        {
+            name:   "get role setting",
+            method: http.MethodGet,
+            target: "/getRoleSetting?title=Reviewer",
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got RoleSettingResponse
+                decodeBody(t, rec, &got)
+                if got != (RoleSettingResponse{Title: "Reviewer", RoleSetting: "You review code"}) {
+                    t.Errorf("role setting = %+v", got)
+                }
+            },
+        },
+        {
+            name:   "get role setting of missing assistant",
+            method: http.MethodGet,
+            target: "/getRoleSetting?title=Nobody",
+            status: http.StatusNotFound,
+        },
+    })
+}
+
+func TestListAssistantsEmpty(t *testing.T) {
+    rec := serve(newTestServer(t), http.MethodGet, "/listAssistants", "")
+    if rec.Code != http.StatusOK || rec.Body.String() != "[]\n" {
+        t.Errorf("got %d %q, want an empty list", rec.Code, rec.Body.String())
+    }
+}
+
+// uploadRequest builds a multipart upload of a single file
+func uploadRequest(t *testing.T, target, filename, content string) *http.Request {
+    t.Helper()
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    if filename != "" {
+        part, err := mw.CreateFormFile("file", filename)
+        if err != nil {
+            t.Fatal(err)
+        }
+        part.Write([]byte(content))
+    }
+    mw.Close()
+    req := httptest.NewRequest(http.MethodPost, target, &body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    return req
+}
+
+func TestUploadFile(t *testing.T) {
+    tests := []struct {
+        name     string
+        target   string
+        filename string
+        status   int
+    }{
+        {"upload", "/upload?title=Reviewer", "notes.txt", http.StatusOK},
+        {"upload creates knowledge base", "/upload?title=Writer", "notes.txt", http.StatusOK},
+        {"missing assistant", "/upload?title=Nobody", "notes.txt", http.StatusNotFound},
+        {"missing file", "/upload?title=Reviewer", "", http.StatusBadRequest},
+        {"missing title", "/upload", "notes.txt", http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newFixtureServer(t)
+            rec := httptest.NewRecorder()
+            s.ServeHTTP(rec, uploadRequest(t, tt.target, tt.filename, "remember this"))
+
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.status, rec.Body.String())
+            }
+            if tt.status == http.StatusOK {
+                title := tt.target[len("/upload?title="):]
+                wantFile(t, s, "knowledgebases/"+title+"/notes.txt", "remember this")
+                names, err := s.attachedKnowledgeBases(title)
+                if err != nil || !slices.Contains(names, title) {
+                    t.Errorf("attached knowledge bases = %v, %v; want %s attached", names, err, title)
+                }
+            }
+            if tt.status == http.StatusNotFound {
+                wantMissing(t, s, "assistants/Nobody")
+            }
+        })
+    }
+}
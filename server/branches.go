@@ -0,0 +1,294 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "slices"
+)
+
+// Conversations are trees of messages. Editing an earlier message starts a
+// new branch next to it, so the original answers are not lost. The
+// messages of the active branch, from the first message to its last one,
+// are the Messages of the conversation; the messages of all other branches
+// are kept in Branches. Every message names the message it follows in
+// ParentID, the first messages of all branches have none.
+
+// messageTree indexes the messages of all branches of a conversation
+type messageTree struct {
+    byID     map[string]Message
+    children map[string][]string // message IDs by parent ID, in creation order
+}
+
+func newMessageTree(c *Conversation) messageTree {
+    t := messageTree{byID: map[string]Message{}, children: map[string][]string{}}
+    for _, m := range slices.Concat(c.Messages, c.Branches) {
+        t.byID[m.ID] = m
+        t.children[m.ParentID] = append(t.children[m.ParentID], m.ID)
+    }
+    for _, ids := range t.children {
+        slices.SortStableFunc(ids, func(a, b string) int {
+            return t.byID[a].CreatedAt.Compare(t.byID[b].CreatedAt)
+        })
+    }
+    return t
+}
+
+// path returns the messages from the first message of the branch up to
+// and including the message with the given ID
+func (t messageTree) path(id string) []Message {
+    var path []Message
+    for m, ok := t.byID[id]; ok && len(path) < len(t.byID); m, ok = t.byID[m.ParentID] {
+        path = append(path, m)
+    }
+    slices.Reverse(path)
+    return path
+}
+
+// latestLeaf follows the most recent replies from a message to the end of
+// its branch and returns the ID of the last message
+func (t messageTree) latestLeaf(id string) string {
+    for depth := 0; depth < len(t.byID); depth++ {
+        children := t.children[id]
+        if len(children) == 0 {
+            break
+        }
+        id = children[len(children)-1]
+    }
+    return id
+}
+
+// linkMessages sets the parent IDs of the active branch from the order of
+// its messages and drops the messages of other branches that no longer
+// follow a message of the conversation, for example after the active
+// branch was replaced
+func linkMessages(c *Conversation) {
+    parent := ""
+    for i := range c.Messages {
+        c.Messages[i].ParentID = parent
+        parent = c.Messages[i].ID
+    }
+    if len(c.Branches) == 0 {
+        c.Branches = nil
+        return
+    }
+
+    t := newMessageTree(c)
+    reachable := map[string]bool{}
+    pending := []string{""}
+    for len(pending) > 0 {
+        id := pending[len(pending)-1]
+        pending = pending[:len(pending)-1]
+        for _, child := range t.children[id] {
+            if !reachable[child] {
+                reachable[child] = true
+                pending = append(pending, child)
+            }
+        }
+    }
+    c.Branches = slices.DeleteFunc(c.Branches, func(m Message) bool { return !reachable[m.ID] })
+    if len(c.Branches) == 0 {
+        c.Branches = nil
+    }
+}
+
+// branchAt starts a new branch next to the message with the given ID: the
+// message and the ones after it are moved out of the active branch, so
+// messages appended next become its siblings. It reports false if the
+// message is not part of the active branch.
+func branchAt(c *Conversation, id string) bool {
+    i := slices.IndexFunc(c.Messages, func(m Message) bool { return m.ID == id })
+    if i < 0 {
+        return false
+    }
+    c.Branches = append(c.Branches, c.Messages[i:]...)
+    c.Messages = slices.Clip(c.Messages[:i])
+    return true
+}
+
+// switchBranch makes the branch holding the message with the given ID the
+// active branch. It continues after the message with its most recent
+// replies. It reports false if the conversation has no such message.
+func switchBranch(c *Conversation, id string) bool {
+    t := newMessageTree(c)
+    if _, ok := t.byID[id]; !ok {
+        return false
+    }
+    active := t.path(t.latestLeaf(id))
+    inActive := map[string]bool{}
+    for _, m := range active {
+        inActive[m.ID] = true
+    }
+
+    var branches []Message
+    for _, m := range slices.Concat(c.Messages, c.Branches) {
+        if !inActive[m.ID] {
+            branches = append(branches, m)
+        }
+    }
+    c.Messages = active
+    c.Branches = branches
+    return true
+}
+
+// messageSiblings returns, for every message of the active branch that has
+// other versions, the IDs of all versions in creation order
+func messageSiblings(c *Conversation) map[string][]string {
+    if len(c.Branches) == 0 {
+        return nil
+    }
+    t := newMessageTree(c)
+    siblings := map[string][]string{}
+    for _, m := range c.Messages {
+        if ids := t.children[m.ParentID]; len(ids) > 1 {
+            siblings[m.ID] = ids
+        }
+    }
+    return siblings
+}
+
+// hasMessage reports whether any branch of a conversation has a message
+// with the given ID
+func hasMessage(c *Conversation, id string) bool {
+    has := func(m Message) bool { return m.ID == id }
+    return slices.ContainsFunc(c.Messages, has) || slices.ContainsFunc(c.Branches, has)
+}
+
+// ForkHistoryRequest represents the structure of the incoming request for forking a chat history
+type ForkHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    HistoryID      string `json:"historyID" validate:"required,max=64,charset=id"`
+    // MessageID is the last message copied into the new history, of any
+    // branch. Without it the whole active branch is copied.
+    MessageID string `json:"messageID,omitempty" validate:"max=64,charset=id"`
+}
+
+// ForkHistoryResponse represents the structure of the response for forking a chat history
+type ForkHistoryResponse struct {
+    Message   string `json:"message"`
+    HistoryID string `json:"historyID"`
+}
+
+// Fork History Handler copies a chat history up to a message into a new
+// history of the same assistant
+func (s *Server) forkHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var forkRequest ForkHistoryRequest
+    if !decodeRequest(w, r, &forkRequest) {
+        return
+    }
+
+    source, err := s.loadConversation(forkRequest.AssistantTitle, forkRequest.HistoryID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+
+    linkMessages(source)
+    messages := source.Messages
+    if forkRequest.MessageID != "" {
+        messages = newMessageTree(source).path(forkRequest.MessageID)
+        if len(messages) == 0 {
+            http.Error(w, "Message not found", http.StatusNotFound)
+            return
+        }
+    }
+
+    fork := s.newConversation(s.newID(), source.Assistant)
+    fork.Title = source.Title
+    fork.Messages = slices.Clone(messages)
+    fork.Metadata = map[string]interface{}{
+        "forkedFrom": map[string]interface{}{"historyID": source.ID, "messageID": forkRequest.MessageID},
+    }
+    if titleSource, ok := source.Metadata["titleSource"]; ok {
+        fork.Metadata["titleSource"] = titleSource
+    }
+    s.autoTitle(fork)
+
+    err = s.saveConversation(fork)
+    if err != nil {
+        http.Error(w, "Failed to create history file", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("ETag", conversationETag(fork))
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(ForkHistoryResponse{
+        Message:   "History forked successfully",
+        HistoryID: fork.ID,
+    })
+}
+
+// SwitchBranchRequest represents the structure of the incoming request for switching the active branch of a chat history
+type SwitchBranchRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    HistoryID      string `json:"historyID" validate:"required,max=64,charset=id"`
+    // MessageID is a message of the branch to activate. The branch
+    // continues after it with the most recent replies.
+    MessageID string `json:"messageID" validate:"required,max=64,charset=id"`
+}
+
+// SwitchBranchResponse represents the structure of the response for switching the active branch of a chat history
+type SwitchBranchResponse struct {
+    Message    string   `json:"message"`
+    MessageIDs []string `json:"messageIDs"` // of the active branch
+}
+
+// Switch Branch Handler
+func (s *Server) switchBranchHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var switchRequest SwitchBranchRequest
+    if !decodeRequest(w, r, &switchRequest) {
+        return
+    }
+
+    unlock := s.lockConversation(switchRequest.AssistantTitle, switchRequest.HistoryID)
+    defer unlock()
+
+    conversation, err := s.loadConversation(switchRequest.AssistantTitle, switchRequest.HistoryID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+
+    if !etagMatches(r.Header.Get("If-Match"), conversationETag(conversation)) {
+        http.Error(w, "History was modified since it was fetched", http.StatusPreconditionFailed)
+        return
+    }
+
+    linkMessages(conversation)
+    if !switchBranch(conversation, switchRequest.MessageID) {
+        http.Error(w, "Message not found", http.StatusNotFound)
+        return
+    }
+    conversation.Version = conversationVersion
+    conversation.UpdatedAt = s.now().UTC()
+
+    err = s.saveConversation(conversation)
+    if err != nil {
+        http.Error(w, "Failed to update history file", http.StatusInternalServerError)
+        return
+    }
+
+    messageIDs := make([]string, len(conversation.Messages))
+    for i, m := range conversation.Messages {
+        messageIDs[i] = m.ID
+    }
+    w.Header().Set("ETag", conversationETag(conversation))
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(SwitchBranchResponse{
+        Message:    "Branch switched successfully",
+        MessageIDs: messageIDs,
+    })
+}
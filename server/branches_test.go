@@ -0,0 +1,178 @@
+package server
+
+import (
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// newBranchServer returns a fixture server whose clock advances a second
+// on every reading, so sibling messages have distinct creation times
+func newBranchServer(t *testing.T) *Server {
+    t.Helper()
+    now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    return newFixtureServer(t, func(o *Options) {
+        o.Clock = func() time.Time {
+            now = now.Add(time.Second)
+            return now
+        }
+    })
+}
+
+func messageIDs(messages []Message) []string {
+    ids := []string{}
+    for _, m := range messages {
+        ids = append(ids, m.ID)
+    }
+    return ids
+}
+
+func TestEditMessageStartsBranch(t *testing.T) {
+    s := newBranchServer(t)
+    newConversationFixture(t, s)
+
+    rec := serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","editMessageID":"m1","messages":[{"id":"m3","role":"user","content":"hi again"}]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    c := readConversation(t, s, "Lets Chat", rootHistoryID)
+    if got := messageIDs(c.Messages); !reflect.DeepEqual(got, []string{"m3"}) {
+        t.Errorf("active branch = %v, want [m3]", got)
+    }
+    if got := messageIDs(c.Branches); !reflect.DeepEqual(got, []string{"m1", "m2"}) {
+        t.Errorf("other branches = %v, want [m1 m2]", got)
+    }
+    if c.Branches[1].ParentID != "m1" || c.Messages[0].ParentID != "" {
+        t.Errorf("parent IDs: m2 follows %q, m3 follows %q", c.Branches[1].ParentID, c.Messages[0].ParentID)
+    }
+
+    rec = serve(s, http.MethodPost, "/fetch-history", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`"}`)
+    var fetched FetchHistoryResponse
+    decodeBody(t, rec, &fetched)
+    if want := map[string][]string{"m3": {"m1", "m3"}}; !reflect.DeepEqual(fetched.Siblings, want) {
+        t.Errorf("siblings = %v, want %v", fetched.Siblings, want)
+    }
+
+    // Switching to the original message continues with its replies
+    etag := rec.Header().Get("ETag")
+    rec = serveWithHeader(s, http.MethodPut, "/switch-branch", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","messageID":"m1"}`, "If-Match", etag)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("switch: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var switched SwitchBranchResponse
+    decodeBody(t, rec, &switched)
+    if want := []string{"m1", "m2"}; !reflect.DeepEqual(switched.MessageIDs, want) {
+        t.Errorf("active branch = %v, want %v", switched.MessageIDs, want)
+    }
+    c = readConversation(t, s, "Lets Chat", rootHistoryID)
+    if got := messageIDs(c.Messages); !reflect.DeepEqual(got, []string{"m1", "m2"}) {
+        t.Errorf("stored active branch = %v", got)
+    }
+    if got := rec.Header().Get("ETag"); got != conversationETag(c) {
+        t.Errorf("ETag = %s, want %s", got, conversationETag(c))
+    }
+
+    rec = serveWithHeader(s, http.MethodPut, "/switch-branch", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","messageID":"m3"}`, "If-Match", etag)
+    if rec.Code != http.StatusPreconditionFailed {
+        t.Errorf("stale switch: status = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+    }
+}
+
+func TestChatEditMessage(t *testing.T) {
+    s := newBranchServer(t)
+    newConversationFixture(t, s)
+
+    rec := serve(s, http.MethodPost, "/chat", `{"context":"hi there","assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","editMessageID":"m1"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var resp ChatResponse
+    decodeBody(t, rec, &resp)
+    c := readConversation(t, s, "Lets Chat", rootHistoryID)
+    if got := messageIDs(c.Messages); !reflect.DeepEqual(got, resp.MessageIDs) {
+        t.Errorf("active branch = %v, want the new message and reply %v", got, resp.MessageIDs)
+    }
+    if len(c.Branches) != 2 {
+        t.Errorf("other branches = %v, want the original messages", messageIDs(c.Branches))
+    }
+}
+
+func TestForkHistory(t *testing.T) {
+    s := newBranchServer(t)
+    newConversationFixture(t, s)
+    serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","editMessageID":"m2","messages":[{"id":"m3","role":"assistant","content":"hey"}]}`)
+
+    tests := []struct {
+        name      string
+        messageID string
+        want      []string
+    }{
+        {"active branch", "", []string{"m1", "m3"}},
+        {"up to a message", "m1", []string{"m1"}},
+        {"other branch", "m2", []string{"m1", "m2"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rec := serve(s, http.MethodPost, "/fork-history", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","messageID":"`+tt.messageID+`"}`)
+            if rec.Code != http.StatusCreated {
+                t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+            var resp ForkHistoryResponse
+            decodeBody(t, rec, &resp)
+            if resp.HistoryID == rootHistoryID {
+                t.Fatal("fork has the ID of its source")
+            }
+            c := readConversation(t, s, "Lets Chat", resp.HistoryID)
+            if got := messageIDs(c.Messages); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("messages = %v, want %v", got, tt.want)
+            }
+            if len(c.Branches) != 0 {
+                t.Errorf("fork has other branches %v", messageIDs(c.Branches))
+            }
+            forkedFrom, _ := c.Metadata["forkedFrom"].(map[string]interface{})
+            if forkedFrom["historyID"] != rootHistoryID || forkedFrom["messageID"] != tt.messageID {
+                t.Errorf("forkedFrom = %v", c.Metadata["forkedFrom"])
+            }
+        })
+    }
+}
+
+func TestUpdateChatContextDropsOrphanedBranches(t *testing.T) {
+    s := newBranchServer(t)
+    newConversationFixture(t, s)
+    serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","editMessageID":"m2","messages":[{"id":"m3","role":"assistant","content":"hey"}]}`)
+
+    rec := serve(s, http.MethodPut, "/update-chat-context/"+rootHistoryID, `{"assistantTitle":"Lets Chat","context":"{\"version\":1,\"messages\":[{\"id\":\"x1\",\"role\":\"user\",\"content\":\"new\"}]}"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if c := readConversation(t, s, "Lets Chat", rootHistoryID); len(c.Branches) != 0 {
+        t.Errorf("branches = %v, want none", messageIDs(c.Branches))
+    }
+}
+
+func TestBranchErrors(t *testing.T) {
+    s := newBranchServer(t)
+    newConversationFixture(t, s)
+    history := `"assistantTitle":"Lets Chat","historyID":"` + rootHistoryID + `"`
+    tests := []struct {
+        name, method, target, body string
+        status                     int
+    }{
+        {"switch to unknown message", http.MethodPut, "/switch-branch", `{` + history + `,"messageID":"nope"}`, http.StatusNotFound},
+        {"fork at unknown message", http.MethodPost, "/fork-history", `{` + history + `,"messageID":"nope"}`, http.StatusNotFound},
+        {"fork unknown history", http.MethodPost, "/fork-history", `{"assistantTitle":"Lets Chat","historyID":"missing"}`, http.StatusNotFound},
+        {"edit unknown message", http.MethodPost, "/append-messages", `{` + history + `,"editMessageID":"nope","messages":[{"role":"user","content":"x"}]}`, http.StatusConflict},
+        {"edit and after", http.MethodPost, "/append-messages", `{` + history + `,"editMessageID":"m1","afterMessageID":"m2","messages":[{"role":"user","content":"x"}]}`, http.StatusBadRequest},
+        {"chat edit without history", http.MethodPost, "/chat", `{"context":"x","assistantTitle":"Lets Chat","editMessageID":"m1"}`, http.StatusBadRequest},
+        {"branch with unknown parent", http.MethodPut, "/update-chat-context/" + rootHistoryID, `{"assistantTitle":"Lets Chat","context":"{\"version\":1,\"messages\":[],\"branches\":[{\"id\":\"b1\",\"parentID\":\"nope\",\"role\":\"user\",\"content\":\"x\"}]}"}`, http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if rec := serve(s, tt.method, tt.target, tt.body); rec.Code != tt.status {
+                t.Errorf("status = %d, want %d; body: %s", rec.Code, tt.status, rec.Body.String())
+            }
+        })
+    }
+}
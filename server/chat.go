@@ -0,0 +1,288 @@
+package server
+
+import (
+    "encoding/json"
+    "math/rand"
+    "net/http"
+    "path"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ChatRequest represents the structure of the incoming request for chat
+type ChatRequest struct {
+    Context string `json:"context" validate:"required,max=10000"`
+    // AssistantTitle and HistoryID name the chat history the message and
+    // the reply are appended to. Without a history ID a new history is
+    // created for the assistant; without either nothing is stored.
+    AssistantTitle string `json:"assistantTitle,omitempty" validate:"max=100,charset=name"`
+    HistoryID      string `json:"historyID,omitempty" validate:"max=64,charset=id"`
+    // EditMessageID, if set, is the ID of a message of the history the
+    // message replaces. The message and the reply start a new branch next
+    // to it; see AppendMessagesRequest.
+    EditMessageID string `json:"editMessageID,omitempty" validate:"max=64,charset=id"`
+    // Retrieval, if set, makes the reply draw on the knowledge bases
+    // attached to the assistant. It requires AssistantTitle.
+    Retrieval *RetrievalOptions `json:"retrieval,omitempty"`
+}
+
+// ChatResponse represents the structure of the response for chat
+type ChatResponse struct {
+    Response string `json:"response"`
+    // HistoryID and MessageIDs identify the stored message and reply, and
+    // Title is the title of the history. They are only set if the request
+    // named a history or an assistant.
+    HistoryID  string   `json:"historyID,omitempty"`
+    MessageIDs []string `json:"messageIDs,omitempty"`
+    Title      string   `json:"title,omitempty"`
+    // Citations are the knowledge base chunks the footnotes of the reply
+    // refer to. They are also stored in the citations metadata entry of
+    // the reply.
+    Citations []Citation `json:"citations,omitempty"`
+}
+
+// Prompt is what a Responder replies to
+type Prompt struct {
+    Message string
+    // Assistant and History are the assistant and the earlier messages of
+    // the conversation, if the chat request named one
+    Assistant string
+    History   []Message
+    // Grounded is set if the chat request asked for retrieval. Sources are
+    // the chunks found for the message, best first; replies cite
+    // Sources[i] as [i+1].
+    Grounded bool
+    Sources  []KnowledgeSearchResult
+}
+
+// Responder generates the reply to a chat message
+type Responder interface {
+    Respond(prompt Prompt) string
+}
+
+// ResponderFunc adapts a function to the Responder interface
+type ResponderFunc func(prompt Prompt) string
+
+// Respond calls f(prompt)
+func (f ResponderFunc) Respond(prompt Prompt) string {
+    return f(prompt)
+}
+
+// randomResponses holds a list of possible responses
+var randomResponses = []string{
+    "Hello! How can I assist you today?",
+    "I'm here to help you with your queries.",
+    "What would you like to know?",
+    "Feel free to ask me anything!",
+}
+
+// randomResponder replies with one of the canned responses, or with
+// sentences of the sources of grounded prompts
+type randomResponder struct {
+    mu  *sync.Mutex
+    rng *rand.Rand
+}
+
+func (rr randomResponder) Respond(prompt Prompt) string {
+    if prompt.Grounded {
+        return groundedReply(prompt)
+    }
+    rr.mu.Lock()
+    defer rr.mu.Unlock()
+    return randomResponses[rr.rng.Intn(len(randomResponses))]
+}
+
+// Title names a conversation after the keywords of its first messages
+func (rr randomResponder) Title(messages []Message) string {
+    return heuristicTitle(messages)
+}
+
+// respond generates the reply to a chat request. If the request names a
+// history or an assistant, the message and the reply are appended to the
+// history under its lock, and the ETag of the updated history is set on the
+// response. On failure the error response is written and ok is false.
+func (s *Server) respond(w http.ResponseWriter, chatRequest ChatRequest) (resp ChatResponse, ok bool) {
+    if chatRequest.EditMessageID != "" && chatRequest.HistoryID == "" {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{
+            Error:  "Invalid request",
+            Fields: []FieldError{{Field: "editMessageID", Message: "requires historyID"}},
+        })
+        return resp, false
+    }
+    if chatRequest.Retrieval != nil {
+        errs := validateStruct(chatRequest.Retrieval)
+        for i := range errs {
+            errs[i].Field = "retrieval." + errs[i].Field
+        }
+        if chatRequest.AssistantTitle == "" {
+            errs = append(errs, FieldError{Field: "retrieval", Message: "requires assistantTitle"})
+        }
+        if len(errs) > 0 {
+            writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+            return resp, false
+        }
+    }
+    if chatRequest.AssistantTitle == "" && chatRequest.HistoryID == "" {
+        return ChatResponse{Response: s.responder.Respond(Prompt{Message: chatRequest.Context})}, true
+    }
+
+    assistant := chatRequest.AssistantTitle
+    if assistant == "" {
+        assistant = defaultAssistant
+    }
+
+    var conversation *Conversation
+    if chatRequest.HistoryID == "" {
+        if assistant != defaultAssistant && !s.exists(path.Join("assistants", assistant)) {
+            http.Error(w, "Assistant not found", http.StatusNotFound)
+            return resp, false
+        }
+        if err := s.store.MkdirAll(historyDir(assistant)); err != nil {
+            http.Error(w, "Failed to create History directory", http.StatusInternalServerError)
+            return resp, false
+        }
+        conversation = s.newConversation(s.newID(), assistant)
+    } else {
+        unlock := s.lockConversation(assistant, chatRequest.HistoryID)
+        defer unlock()
+
+        var err error
+        conversation, err = s.loadConversation(assistant, chatRequest.HistoryID)
+        if err != nil {
+            writeStoreError(w, err, "History not found", "Failed to read history file")
+            return resp, false
+        }
+    }
+    if chatRequest.EditMessageID != "" {
+        linkMessages(conversation)
+        if !branchAt(conversation, chatRequest.EditMessageID) {
+            http.Error(w, "History has no message "+chatRequest.EditMessageID+" in its active branch", http.StatusConflict)
+            return resp, false
+        }
+    }
+
+    prompt := Prompt{
+        Message:   chatRequest.Context,
+        Assistant: assistant,
+        History:   conversation.Messages,
+    }
+    if chatRequest.Retrieval != nil {
+        var err error
+        prompt.Grounded = true
+        prompt.Sources, err = s.retrieve(assistant, chatRequest.Context, *chatRequest.Retrieval)
+        if err != nil {
+            http.Error(w, "Failed to search knowledge bases", http.StatusInternalServerError)
+            return resp, false
+        }
+    }
+    reply := s.responder.Respond(prompt)
+    citations := citeSources(reply, prompt.Sources)
+
+    messages := []Message{
+        {Role: RoleUser, Content: chatRequest.Context},
+        {Role: RoleAssistant, Content: reply},
+    }
+    if len(citations) > 0 {
+        messages[1].Metadata = map[string]interface{}{"citations": citations}
+    }
+    s.completeMessages(messages)
+    conversation.Version = conversationVersion
+    conversation.Messages = append(conversation.Messages, messages...)
+    conversation.UpdatedAt = s.now().UTC()
+    s.autoTitle(conversation)
+
+    if err := s.saveConversation(conversation); err != nil {
+        http.Error(w, "Failed to update history file", http.StatusInternalServerError)
+        return resp, false
+    }
+
+    w.Header().Set("ETag", conversationETag(conversation))
+    return ChatResponse{
+        Response:   reply,
+        HistoryID:  conversation.ID,
+        MessageIDs: []string{messages[0].ID, messages[1].ID},
+        Title:      conversation.Title,
+        Citations:  citations,
+    }, true
+}
+
+func (s *Server) chatHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var chatRequest ChatRequest
+    if !decodeRequest(w, r, &chatRequest) {
+        return
+    }
+
+    chatResponse, ok := s.respond(w, chatRequest)
+    if !ok {
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(chatResponse)
+}
+
+// ChatStreamChunk represents a single server-sent event of a streamed chat response
+type ChatStreamChunk struct {
+    Delta string `json:"delta"`
+    // HistoryID, MessageIDs and Citations are sent in a last event before
+    // [DONE] when the message and the reply were stored in a history
+    HistoryID  string     `json:"historyID,omitempty"`
+    MessageIDs []string   `json:"messageIDs,omitempty"`
+    Citations  []Citation `json:"citations,omitempty"`
+}
+
+// Chat Stream Handler streams the reply word by word as server-sent events,
+// terminated by a "data: [DONE]" event. The reply is stored in the history
+// before streaming starts.
+func (s *Server) chatStreamHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var chatRequest ChatRequest
+    if !decodeRequest(w, r, &chatRequest) {
+        return
+    }
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+        return
+    }
+
+    chatResponse, ok := s.respond(w, chatRequest)
+    if !ok {
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+
+    for _, word := range strings.SplitAfter(chatResponse.Response, " ") {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-time.After(s.streamDelay):
+        }
+        data, _ := json.Marshal(ChatStreamChunk{Delta: word})
+        w.Write([]byte("data: " + string(data) + "\n\n"))
+        flusher.Flush()
+    }
+    if chatResponse.HistoryID != "" {
+        data, _ := json.Marshal(ChatStreamChunk{HistoryID: chatResponse.HistoryID, MessageIDs: chatResponse.MessageIDs, Citations: chatResponse.Citations})
+        w.Write([]byte("data: " + string(data) + "\n\n"))
+    }
+    w.Write([]byte("data: [DONE]\n\n"))
+    flusher.Flush()
+}
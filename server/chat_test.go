@@ -0,0 +1,209 @@
+package server
+
+import (
+    "bufio"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestChatStreamHandler(t *testing.T) {
+    rec := httptest.NewRecorder()
+    newTestServer(t).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chat-stream", strings.NewReader(`{"context":"hi"}`)))
+
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+    }
+    if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+        t.Errorf("Content-Type = %q", ct)
+    }
+
+    var reply strings.Builder
+    done := false
+    scanner := bufio.NewScanner(rec.Body)
+    for scanner.Scan() {
+        data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+        if !ok {
+            continue
+        }
+        if data == "[DONE]" {
+            done = true
+            break
+        }
+        var chunk ChatStreamChunk
+        if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+            t.Fatalf("invalid event %q: %v", data, err)
+        }
+        reply.WriteString(chunk.Delta)
+    }
+
+    if !done {
+        t.Error("stream was not terminated with [DONE]")
+    }
+    found := false
+    for _, response := range randomResponses {
+        found = found || response == reply.String()
+    }
+    if !found {
+        t.Errorf("streamed reply %q is not one of the canned responses", reply.String())
+    }
+}
+
+func TestChatHandler(t *testing.T) {
+    var got Prompt
+    s := newTestServer(t, func(o *Options) {
+        o.Responder = ResponderFunc(func(p Prompt) string {
+            got = p
+            return "pong"
+        })
+    })
+
+    rec := serve(s, http.MethodPost, "/chat", `{"context":"ping"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+    }
+    var resp ChatResponse
+    decodeBody(t, rec, &resp)
+    if resp.Response != "pong" {
+        t.Errorf("response = %q, want pong", resp.Response)
+    }
+    if got.Message != "ping" {
+        t.Errorf("responder got %+v, want the chat message", got)
+    }
+}
+
+func TestChatAppendsToHistory(t *testing.T) {
+    var prompts []Prompt
+    s := newFixtureServer(t, func(o *Options) {
+        o.Responder = ResponderFunc(func(p Prompt) string {
+            prompts = append(prompts, p)
+            return "reply to " + p.Message
+        })
+    })
+
+    // Without a history ID a new history is created for the assistant
+    rec := serve(s, http.MethodPost, "/chat", `{"context":"first","assistantTitle":"Writer"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var first ChatResponse
+    decodeBody(t, rec, &first)
+    if first.HistoryID == "" || len(first.MessageIDs) != 2 {
+        t.Fatalf("response = %+v, want a history ID and two message IDs", first)
+    }
+
+    rec = serve(s, http.MethodPost, "/chat", `{"context":"second","assistantTitle":"Writer","historyID":"`+first.HistoryID+`"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var second ChatResponse
+    decodeBody(t, rec, &second)
+    if second.HistoryID != first.HistoryID {
+        t.Errorf("historyID = %q, want %q", second.HistoryID, first.HistoryID)
+    }
+
+    c := readConversation(t, s, "Writer", first.HistoryID)
+    if got := rec.Header().Get("ETag"); got != conversationETag(c) {
+        t.Errorf("ETag = %s, want %s", got, conversationETag(c))
+    }
+    want := []struct{ id, role, content string }{
+        {first.MessageIDs[0], RoleUser, "first"},
+        {first.MessageIDs[1], RoleAssistant, "reply to first"},
+        {second.MessageIDs[0], RoleUser, "second"},
+        {second.MessageIDs[1], RoleAssistant, "reply to second"},
+    }
+    if len(c.Messages) != len(want) {
+        t.Fatalf("history has %d messages, want %d", len(c.Messages), len(want))
+    }
+    for i, m := range c.Messages {
+        if m.ID != want[i].id || m.Role != want[i].role || m.Content != want[i].content {
+            t.Errorf("message %d = %+v, want %+v", i, m, want[i])
+        }
+    }
+
+    // The responder sees the conversation so far
+    if last := prompts[len(prompts)-1]; last.Assistant != "Writer" || len(last.History) != 2 {
+        t.Errorf("responder got assistant %q and %d earlier messages, want Writer and 2", last.Assistant, len(last.History))
+    }
+}
+
+func TestChatWithoutHistory(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := serve(s, http.MethodPost, "/chat", `{"context":"hi"}`)
+    var resp ChatResponse
+    decodeBody(t, rec, &resp)
+    if resp.HistoryID != "" || resp.MessageIDs != nil {
+        t.Errorf("response = %+v, want nothing stored", resp)
+    }
+    if rec.Header().Get("ETag") != "" {
+        t.Error("ETag set although nothing was stored")
+    }
+}
+
+func TestChatHistoryErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "unknown assistant",
+            method: http.MethodPost,
+            target: "/chat",
+            body:   `{"context":"hi","assistantTitle":"Nobody"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "unknown history",
+            method: http.MethodPost,
+            target: "/chat",
+            body:   `{"context":"hi","historyID":"missing"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "invalid history ID",
+            method: http.MethodPost,
+            target: "/chat",
+            body:   `{"context":"hi","historyID":"../x"}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "stream to unknown history",
+            method: http.MethodPost,
+            target: "/chat-stream",
+            body:   `{"context":"hi","assistantTitle":"Reviewer","historyID":"missing"}`,
+            status: http.StatusNotFound,
+        },
+    })
+}
+
+func TestChatStreamAppendsToHistory(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := serve(s, http.MethodPost, "/chat-stream", `{"context":"hi","historyID":"`+rootHistoryID+`"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+
+    var stored ChatStreamChunk
+    scanner := bufio.NewScanner(rec.Body)
+    for scanner.Scan() {
+        data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+        if !ok || data == "[DONE]" {
+            continue
+        }
+        var chunk ChatStreamChunk
+        if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+            t.Fatalf("invalid event %q: %v", data, err)
+        }
+        if chunk.HistoryID != "" {
+            stored = chunk
+        }
+    }
+    if stored.HistoryID != rootHistoryID || len(stored.MessageIDs) != 2 {
+        t.Fatalf("last event = %+v, want the history and two message IDs", stored)
+    }
+
+    c := readConversation(t, s, "Lets Chat", rootHistoryID)
+    n := len(c.Messages)
+    if n < 2 || c.Messages[n-2].ID != stored.MessageIDs[0] || c.Messages[n-1].ID != stored.MessageIDs[1] {
+        t.Errorf("stored messages %+v do not end with %v", c.Messages, stored.MessageIDs)
+    }
+}
@@ -0,0 +1,517 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// The extracted text of knowledge base files is split into chunks, the
+// pieces retrieved by searches. Chunk sizes are counted in tokens, which
+// are approximated by words: runs of characters between white space.
+
+// Chunking strategies
+const (
+    chunkFixed     = "fixed"     // windows of chunkSize tokens overlapping by overlap tokens
+    chunkSentence  = "sentence"  // whole sentences, packed up to chunkSize tokens
+    chunkParagraph = "paragraph" // whole paragraphs, packed up to chunkSize tokens
+    chunkMarkdown  = "markdown"  // paragraphs under a Markdown heading, labeled with the heading
+)
+
+// ChunkingSettings configures how the files of a knowledge base are
+// split into chunks
+type ChunkingSettings struct {
+    Strategy  string `json:"strategy" validate:"required,oneof=fixed|sentence|paragraph|markdown"`
+    ChunkSize int    `json:"chunkSize" validate:"range=16|2048"` // maximum number of tokens of a chunk
+    // Overlap is the number of tokens the fixed windows share with the
+    // previous one
+    Overlap int `json:"overlap,omitempty" validate:"range=0|1024"`
+}
+
+// defaultChunkingSettings are used by knowledge bases that were never
+// configured, and fill in the chunk size of settings without one
+var defaultChunkingSettings = ChunkingSettings{Strategy: chunkParagraph, ChunkSize: 200}
+
+// validateChunkingSettings returns the problems of settings, with the
+// field names prefixed by prefix
+func validateChunkingSettings(prefix string, settings ChunkingSettings) []FieldError {
+    errs := validateStruct(settings)
+    if settings.Overlap > 0 && settings.Strategy != chunkFixed {
+        errs = append(errs, FieldError{Field: "overlap", Message: "is only supported by the fixed strategy"})
+    }
+    if size := withDefaults(settings).ChunkSize; settings.Overlap >= size {
+        errs = append(errs, FieldError{Field: "overlap", Message: fmt.Sprintf("must be less than the chunk size of %d", size)})
+    }
+    for i := range errs {
+        errs[i].Field = prefix + errs[i].Field
+    }
+    return errs
+}
+
+func withDefaults(settings ChunkingSettings) ChunkingSettings {
+    if settings.ChunkSize == 0 {
+        settings.ChunkSize = defaultChunkingSettings.ChunkSize
+    }
+    return settings
+}
+
+// Chunk is a piece of the extracted text of a knowledge base file
+type Chunk struct {
+    ID      string `json:"id"`
+    File    string `json:"file"`
+    Index   int    `json:"index"` // position of the chunk in the file
+    Start   int    `json:"start"` // byte offset of the chunk in the extracted text
+    End     int    `json:"end"`
+    Tokens  int    `json:"tokens"`
+    Heading string `json:"heading,omitempty"` // Markdown headings the chunk is under, separated by " > "
+    Text    string `json:"text"`
+}
+
+// chunkID derives the ID of a chunk from its content and position, so
+// chunking a file again keeps the IDs of unchanged chunks
+func chunkID(file string, start int, text string) string {
+    sum := sha256.Sum256([]byte(file + "\x00" + strconv.Itoa(start) + "\x00" + text))
+    return hex.EncodeToString(sum[:8])
+}
+
+// chunker splits a text into spans of at most size tokens
+type chunker struct {
+    text string
+    size int
+}
+
+// tokens returns the spans of the tokens within sp
+func (c chunker) tokens(sp span) []span {
+    var tokens []span
+    start := -1
+    for i, r := range c.text[sp.start:sp.end] {
+        if unicode.IsSpace(r) {
+            if start >= 0 {
+                tokens = append(tokens, span{sp.start + start, sp.start + i})
+                start = -1
+            }
+        } else if start < 0 {
+            start = i
+        }
+    }
+    if start >= 0 {
+        tokens = append(tokens, span{sp.start + start, sp.end})
+    }
+    return tokens
+}
+
+// fixed splits sp into windows of size tokens, each starting overlap
+// tokens before the end of the previous one
+func (c chunker) fixed(sp span, overlap int) []span {
+    tokens := c.tokens(sp)
+    var spans []span
+    for i := 0; i < len(tokens); i += c.size - overlap {
+        j := min(i+c.size, len(tokens))
+        spans = append(spans, span{tokens[i].start, tokens[j-1].end})
+        if j == len(tokens) {
+            break
+        }
+    }
+    return spans
+}
+
+// split returns the pieces of sp separated by the boundaries found by
+// next, which returns the end of the current piece and the start of the
+// next one, or -1 at the end of sp. Pieces are trimmed of white space and
+// empty ones dropped.
+func (c chunker) split(sp span, next func(s string) (end, nextStart int)) []span {
+    var pieces []span
+    add := func(start, end int) {
+        s := c.text[start:end]
+        trimmed := strings.TrimLeftFunc(s, unicode.IsSpace)
+        start += len(s) - len(trimmed)
+        end = start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+        if start < end {
+            pieces = append(pieces, span{start, end})
+        }
+    }
+    for pos := sp.start; pos < sp.end; {
+        end, nextStart := next(c.text[pos:sp.end])
+        if end < 0 {
+            add(pos, sp.end)
+            break
+        }
+        add(pos, pos+end)
+        pos += nextStart
+    }
+    return pieces
+}
+
+// paragraphs splits sp at blank lines
+func (c chunker) paragraphs(sp span) []span {
+    return c.split(sp, func(s string) (int, int) {
+        i := strings.Index(s, "\n\n")
+        if i < 0 {
+            return -1, -1
+        }
+        return i, i + 2
+    })
+}
+
+// sentences splits sp after sentence punctuation followed by white space,
+// and at line breaks
+func (c chunker) sentences(sp span) []span {
+    return c.split(sp, func(s string) (int, int) {
+        for i, r := range s {
+            switch r {
+            case '\n':
+                return i, i + 1
+            case '.', '!', '?':
+                next, size := utf8.DecodeRuneInString(s[i+1:])
+                if size > 0 && unicode.IsSpace(next) {
+                    return i + 1, i + 1
+                }
+            }
+        }
+        return -1, -1
+    })
+}
+
+// pack joins consecutive units into spans of at most size tokens. Units
+// larger than that are split with the next of the finer splitters, or
+// into fixed windows.
+func (c chunker) pack(units []span, finer ...func(span) []span) []span {
+    var spans []span
+    current, tokens := span{}, 0
+    flush := func() {
+        if tokens > 0 {
+            spans = append(spans, current)
+        }
+        current, tokens = span{}, 0
+    }
+    for _, unit := range units {
+        n := len(c.tokens(unit))
+        if n > c.size {
+            flush()
+            if len(finer) > 0 {
+                spans = append(spans, c.pack(finer[0](unit), finer[1:]...)...)
+            } else {
+                spans = append(spans, c.fixed(unit, 0)...)
+            }
+            continue
+        }
+        if tokens+n > c.size {
+            flush()
+        }
+        if tokens == 0 {
+            current.start = unit.start
+        }
+        current.end = unit.end
+        tokens += n
+    }
+    flush()
+    return spans
+}
+
+// markdownSection is the text under a Markdown heading
+type markdownSection struct {
+    span
+    heading string
+}
+
+// markdownSections splits text at Markdown headings, ignoring the lines of
+// fenced code blocks. The first section holds the text before the first
+// heading.
+func markdownSections(text string) []markdownSection {
+    var sections []markdownSection
+    var headings []string
+    current := markdownSection{}
+    fenced := false
+    for pos := 0; pos < len(text); {
+        end := strings.IndexByte(text[pos:], '\n')
+        if end < 0 {
+            end = len(text) - pos
+        }
+        line := text[pos : pos+end]
+        if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+            fenced = !fenced
+        }
+        level := len(line) - len(strings.TrimLeft(line, "#"))
+        if !fenced && level >= 1 && level <= 6 && strings.HasPrefix(line[level:], " ") {
+            current.end = pos
+            sections = append(sections, current)
+            headings = append(headings[:min(level-1, len(headings))], strings.TrimSpace(line[level:]))
+            // The heading line itself is only kept as the heading
+            current = markdownSection{span: span{start: min(pos+end+1, len(text))}, heading: strings.Join(headings, " > ")}
+        }
+        pos += end + 1
+    }
+    current.end = len(text)
+    return append(sections, current)
+}
+
+// chunkText splits the extracted text of a file into chunks
+func chunkText(file, text string, settings ChunkingSettings) []Chunk {
+    settings = withDefaults(settings)
+    c := chunker{text: text, size: settings.ChunkSize}
+    all := span{0, len(text)}
+
+    type piece struct {
+        span
+        heading string
+    }
+    var pieces []piece
+    switch settings.Strategy {
+    case chunkFixed:
+        for _, sp := range c.fixed(all, settings.Overlap) {
+            pieces = append(pieces, piece{span: sp})
+        }
+    case chunkSentence:
+        for _, sp := range c.pack(c.sentences(all)) {
+            pieces = append(pieces, piece{span: sp})
+        }
+    case chunkMarkdown:
+        for _, section := range markdownSections(text) {
+            for _, sp := range c.pack(c.paragraphs(section.span), c.sentences) {
+                pieces = append(pieces, piece{span: sp, heading: section.heading})
+            }
+        }
+    default:
+        for _, sp := range c.pack(c.paragraphs(all), c.sentences) {
+            pieces = append(pieces, piece{span: sp})
+        }
+    }
+
+    chunks := make([]Chunk, len(pieces))
+    for i, p := range pieces {
+        chunkText := text[p.start:p.end]
+        chunks[i] = Chunk{
+            ID:      chunkID(file, p.start, chunkText),
+            File:    file,
+            Index:   i,
+            Start:   p.start,
+            End:     p.end,
+            Tokens:  len(c.tokens(p.span)),
+            Heading: p.heading,
+            Text:    chunkText,
+        }
+    }
+    return chunks
+}
+
+// knowledgeBaseSettings are the settings of a knowledge base
+type knowledgeBaseSettings struct {
+    Chunking  ChunkingSettings `json:"chunking"`
+    FileTypes FileTypePolicy   `json:"fileTypes"`
+}
+
+func knowledgeBaseSettingsPath(name string) string {
+    return path.Join(knowledgeBaseDir(name), metaDir, "settings.json")
+}
+
+// knowledgeBaseSettings returns the settings of a knowledge base, or the
+// defaults if it was never configured
+func (s *Server) knowledgeBaseSettings(name string) (knowledgeBaseSettings, error) {
+    settings := knowledgeBaseSettings{Chunking: defaultChunkingSettings}
+    data, err := s.store.ReadFile(knowledgeBaseSettingsPath(name))
+    if errors.Is(err, fs.ErrNotExist) {
+        return settings, nil
+    }
+    if err != nil {
+        return settings, err
+    }
+    err = json.Unmarshal(data, &settings)
+    return settings, err
+}
+
+// chunkFile holds the chunks of a knowledge base file
+type chunkFile struct {
+    Settings ChunkingSettings `json:"settings"` // the chunks were made with
+    Chunks   []Chunk          `json:"chunks"`
+}
+
+// chunksDir is the folder holding the chunk files of a knowledge base
+func chunksDir(knowledgeBase string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "chunks")
+}
+
+func chunksPath(knowledgeBase, name string) string {
+    return path.Join(chunksDir(knowledgeBase), name+".json")
+}
+
+// chunks returns the stored chunks of a knowledge base file
+func (s *Server) chunks(knowledgeBase, name string) (*chunkFile, error) {
+    data, err := s.store.ReadFile(chunksPath(knowledgeBase, name))
+    if err != nil {
+        return nil, err
+    }
+    var chunks chunkFile
+    if err := json.Unmarshal(data, &chunks); err != nil {
+        return nil, err
+    }
+    return &chunks, nil
+}
+
+// ChunkingSettingsResponse represents the structure of the response for the chunking settings of a knowledge base
+type ChunkingSettingsResponse struct {
+    KnowledgeBaseName string           `json:"knowledgeBaseName"`
+    Settings          ChunkingSettings `json:"settings"`
+}
+
+// Get Chunking Settings Handler
+func (s *Server) getChunkingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "knowledgeBaseName", titleRules) {
+        return
+    }
+    name := r.URL.Query().Get("knowledgeBaseName")
+
+    if !s.exists(knowledgeBaseDir(name)) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+    settings, err := s.knowledgeBaseSettings(name)
+    if err != nil {
+        http.Error(w, "Failed to read knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ChunkingSettingsResponse{KnowledgeBaseName: name, Settings: settings.Chunking})
+}
+
+// UpdateChunkingSettingsRequest represents the structure of the incoming request for updating the chunking settings of a knowledge base
+type UpdateChunkingSettingsRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    ChunkingSettings
+}
+
+// Update Chunking Settings Handler. The files of the knowledge base are
+// chunked again in the background.
+func (s *Server) updateChunkingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var updateRequest UpdateChunkingSettingsRequest
+    if !decodeRequest(w, r, &updateRequest) {
+        return
+    }
+    if errs := validateChunkingSettings("", updateRequest.ChunkingSettings); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+
+    name := updateRequest.KnowledgeBaseName
+    files, err := s.store.ReadDir(knowledgeBaseDir(name))
+    if err != nil {
+        writeStoreError(w, err, "Knowledge base not found", "Failed to read directory")
+        return
+    }
+
+    unlock := s.settingsLocks.Lock(name)
+    settings, err := s.knowledgeBaseSettings(name)
+    if err != nil {
+        unlock()
+        http.Error(w, "Failed to read knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+    settings.Chunking = withDefaults(updateRequest.ChunkingSettings)
+    data, _ := json.Marshal(settings)
+    err = s.writeMetaFile(knowledgeBaseSettingsPath(name), data)
+    unlock()
+    if err != nil {
+        http.Error(w, "Failed to write knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+
+    for _, file := range files {
+        if file.IsDir() {
+            continue
+        }
+        info, err := file.Info()
+        if err == nil {
+            _, err = s.queueIngestion(name, file.Name(), info)
+        }
+        if err != nil {
+            http.Error(w, "Failed to queue file for ingestion", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ChunkingSettingsResponse{KnowledgeBaseName: name, Settings: settings.Chunking})
+}
+
+// PreviewChunksRequest represents the structure of the incoming request for previewing the chunks of a file
+type PreviewChunksRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    FileName          string `json:"fileName" validate:"required,max=255,charset=name"`
+    // Settings to try instead of the settings of the knowledge base. The
+    // stored chunks are left unchanged.
+    Settings *ChunkingSettings `json:"settings,omitempty"`
+}
+
+// PreviewChunksResponse represents the structure of the response for previewing the chunks of a file
+type PreviewChunksResponse struct {
+    FileName string           `json:"fileName"`
+    Settings ChunkingSettings `json:"settings"`
+    Chunks   []Chunk          `json:"chunks"`
+}
+
+// Preview Chunks Handler
+func (s *Server) previewChunksHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var previewRequest PreviewChunksRequest
+    if !decodeRequest(w, r, &previewRequest) {
+        return
+    }
+    if previewRequest.Settings != nil {
+        if errs := validateChunkingSettings("settings.", *previewRequest.Settings); len(errs) > 0 {
+            writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+            return
+        }
+    }
+
+    kb, name := previewRequest.KnowledgeBaseName, previewRequest.FileName
+    text, ok := s.readExtractedText(w, kb, name)
+    if !ok {
+        return
+    }
+
+    settings, err := s.knowledgeBaseSettings(kb)
+    if err != nil {
+        http.Error(w, "Failed to read knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+    chunking := settings.Chunking
+    if previewRequest.Settings != nil {
+        chunking = withDefaults(*previewRequest.Settings)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(PreviewChunksResponse{
+        FileName: name,
+        Settings: chunking,
+        Chunks:   chunkText(name, text, chunking),
+    })
+}
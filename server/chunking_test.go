@@ -0,0 +1,239 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func chunkTexts(chunks []Chunk) []string {
+    texts := []string{}
+    for _, c := range chunks {
+        texts = append(texts, c.Text)
+    }
+    return texts
+}
+
+// words returns n numbered words separated by spaces
+func words(prefix string, n int) string {
+    w := make([]string, n)
+    for i := range w {
+        w[i] = prefix + string(rune('a'+i%26))
+    }
+    return strings.Join(w, " ")
+}
+
+func TestChunkText(t *testing.T) {
+    markdown := "Intro text.\n\n# Setup\n\nInstall it.\n\n## Linux\n\nUse apt.\n\n```\n# not a heading\n```\n\n# Usage\n\nRun it."
+    tests := []struct {
+        name     string
+        text     string
+        settings ChunkingSettings
+        want     []string
+        headings []string
+    }{
+        {
+            name:     "fixed with overlap",
+            text:     words("w", 40),
+            settings: ChunkingSettings{Strategy: chunkFixed, ChunkSize: 16, Overlap: 4},
+            want:     []string{words("w", 40)[:16*3-1], words("w", 40)[12*3 : 28*3-1], words("w", 40)[24*3 : 40*3-1]},
+        },
+        {
+            name:     "sentences packed",
+            text:     "One two three. Four five six seven! Eight nine ten eleven twelve thirteen fourteen fifteen sixteen?\nSeventeen.",
+            settings: ChunkingSettings{Strategy: chunkSentence, ChunkSize: 16},
+            want: []string{
+                "One two three. Four five six seven! Eight nine ten eleven twelve thirteen fourteen fifteen sixteen?",
+                "Seventeen.",
+            },
+        },
+        {
+            name:     "paragraphs packed",
+            text:     words("a", 10) + "\n\n" + words("b", 5) + "\n\n" + words("c", 10),
+            settings: ChunkingSettings{Strategy: chunkParagraph, ChunkSize: 16},
+            want:     []string{words("a", 10) + "\n\n" + words("b", 5), words("c", 10)},
+        },
+        {
+            name:     "long paragraph split into sentences",
+            text:     words("a", 12) + ". " + words("b", 12) + ".",
+            settings: ChunkingSettings{Strategy: chunkParagraph, ChunkSize: 16},
+            want:     []string{words("a", 12) + ".", words("b", 12) + "."},
+        },
+        {
+            name:     "markdown sections",
+            text:     markdown,
+            settings: ChunkingSettings{Strategy: chunkMarkdown, ChunkSize: 100},
+            want: []string{
+                "Intro text.",
+                "Install it.",
+                "Use apt.\n\n```\n# not a heading\n```",
+                "Run it.",
+            },
+            headings: []string{"", "Setup", "Setup > Linux", "Usage"},
+        },
+        {
+            name:     "empty",
+            text:     "",
+            settings: defaultChunkingSettings,
+            want:     []string{},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            chunks := chunkText("doc.md", tt.text, tt.settings)
+            if got := chunkTexts(chunks); !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("chunks = %q, want %q", got, tt.want)
+            }
+            for i, c := range chunks {
+                if c.Index != i || c.File != "doc.md" || tt.text[c.Start:c.End] != c.Text || c.Tokens > tt.settings.ChunkSize {
+                    t.Errorf("chunk %d = %+v", i, c)
+                }
+                if tt.headings != nil && c.Heading != tt.headings[i] {
+                    t.Errorf("chunk %d heading = %q, want %q", i, c.Heading, tt.headings[i])
+                }
+            }
+        })
+    }
+
+    a := chunkText("a.txt", "Same.\n\nSame.", ChunkingSettings{Strategy: chunkSentence, ChunkSize: 1})
+    b := chunkText("a.txt", "Same.\n\nSame.\n\nOther.", ChunkingSettings{Strategy: chunkParagraph, ChunkSize: 1})
+    if a[0].ID != b[0].ID || b[0].ID == b[1].ID || len(a[0].ID) != 16 {
+        t.Errorf("chunk IDs %s, %s, %s: want stable IDs unique per position", a[0].ID, b[0].ID, b[1].ID)
+    }
+}
+
+func TestChunkingSettings(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, uploadRequest(t, "/upload?title=Reviewer", "guide.md", "# Guide\n\n"+words("g", 30)+"\n\n# Notes\n\nShort."))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("upload: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    s.Wait()
+
+    chunks, err := s.chunks("Reviewer", "guide.md")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if chunks.Settings != defaultChunkingSettings || len(chunks.Chunks) != 1 {
+        t.Errorf("chunks with default settings = %+v", chunks)
+    }
+
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "get default settings",
+            method: http.MethodGet,
+            target: "/get-chunking-settings?knowledgeBaseName=Reviewer",
+            status: http.StatusOK,
+            check: func(t *testing.T, _ *Server, rec *httptest.ResponseRecorder) {
+                var got ChunkingSettingsResponse
+                decodeBody(t, rec, &got)
+                if got.Settings != defaultChunkingSettings {
+                    t.Errorf("settings = %+v", got.Settings)
+                }
+            },
+        },
+        {
+            name:   "settings of missing knowledge base",
+            method: http.MethodGet,
+            target: "/get-chunking-settings?knowledgeBaseName=Recipes",
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "update missing knowledge base",
+            method: http.MethodPut,
+            target: "/update-chunking-settings",
+            body:   `{"knowledgeBaseName":"Recipes","strategy":"fixed"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "overlap of other strategy",
+            method: http.MethodPut,
+            target: "/update-chunking-settings",
+            body:   `{"knowledgeBaseName":"Reviewer","strategy":"sentence","overlap":10}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "overlap larger than chunk",
+            method: http.MethodPut,
+            target: "/update-chunking-settings",
+            body:   `{"knowledgeBaseName":"Reviewer","strategy":"fixed","chunkSize":20,"overlap":20}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "unknown strategy",
+            method: http.MethodPost,
+            target: "/preview-chunks",
+            body:   `{"knowledgeBaseName":"Manuals","fileName":"guide.pdf","settings":{"strategy":"pages"}}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "preview missing file",
+            method: http.MethodPost,
+            target: "/preview-chunks",
+            body:   `{"knowledgeBaseName":"Manuals","fileName":"missing.pdf"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "preview file never ingested",
+            method: http.MethodPost,
+            target: "/preview-chunks",
+            body:   `{"knowledgeBaseName":"Manuals","fileName":"guide.pdf"}`,
+            status: http.StatusConflict,
+        },
+    })
+
+    // Previews leave the stored chunks unchanged
+    rec = serve(s, http.MethodPost, "/preview-chunks", `{"knowledgeBaseName":"Reviewer","fileName":"guide.md","settings":{"strategy":"markdown","chunkSize":16}}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("preview: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var preview PreviewChunksResponse
+    decodeBody(t, rec, &preview)
+    if len(preview.Chunks) != 3 || preview.Chunks[2].Heading != "Notes" || preview.Settings.Strategy != chunkMarkdown {
+        t.Errorf("preview = %+v", preview)
+    }
+    if chunks, _ := s.chunks("Reviewer", "guide.md"); len(chunks.Chunks) != 1 {
+        t.Errorf("stored chunks changed by preview: %+v", chunks)
+    }
+
+    // Updating the settings chunks the files again
+    rec = serve(s, http.MethodPut, "/update-chunking-settings", `{"knowledgeBaseName":"Reviewer","strategy":"markdown","chunkSize":16}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("update: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    s.Wait()
+    chunks, err = s.chunks("Reviewer", "guide.md")
+    if err != nil || !reflect.DeepEqual(chunks.Chunks, preview.Chunks) {
+        t.Errorf("chunks after update = %+v, %v; want the preview", chunks, err)
+    }
+    rec = serve(s, http.MethodGet, "/get-chunking-settings?knowledgeBaseName=Reviewer", "")
+    var got ChunkingSettingsResponse
+    decodeBody(t, rec, &got)
+    if want := (ChunkingSettings{Strategy: chunkMarkdown, ChunkSize: 16}); got.Settings != want {
+        t.Errorf("settings = %+v, want %+v", got.Settings, want)
+    }
+}
+
+func TestUpdateChunkingSettingsConcurrently(t *testing.T) {
+    s := newFixtureServer(t)
+    var wg sync.WaitGroup
+    codes := make([]int, 8)
+    for i := range codes {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            rec := serve(s, http.MethodPut, "/update-chunking-settings", `{"knowledgeBaseName":"Reviewer","strategy":"sentence"}`)
+            codes[i] = rec.Code
+        }()
+    }
+    wg.Wait()
+    for i, code := range codes {
+        if code != http.StatusOK {
+            t.Errorf("update %d: status = %d, want %d", i, code, http.StatusOK)
+        }
+    }
+}
@@ -0,0 +1,583 @@
+package server
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "path"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+// conversationVersion is the version of the conversation document format
+// written by this server
+const conversationVersion = 1
+
+// defaultAssistant is the title of the general purpose assistant whose
+// histories are kept in the root History folder
+const defaultAssistant = "Lets Chat"
+
+// Message roles
+const (
+    RoleSystem    = "system"
+    RoleUser      = "user"
+    RoleAssistant = "assistant"
+    RoleTool      = "tool"
+)
+
+// maxMessageLength is the longest message content a conversation may hold
+const maxMessageLength = 100000
+
+// Conversation is the document stored in every chat history file
+type Conversation struct {
+    Version   int                    `json:"version"`
+    ID        string                 `json:"id"`
+    Assistant string                 `json:"assistant"`
+    Title     string                 `json:"title"`
+    CreatedAt time.Time              `json:"createdAt"`
+    UpdatedAt time.Time              `json:"updatedAt"`
+    Messages  []Message              `json:"messages"`           // of the active branch
+    Branches  []Message              `json:"branches,omitempty"` // messages of the other branches
+    Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Message is a single message of a conversation
+type Message struct {
+    ID        string                 `json:"id"`
+    ParentID  string                 `json:"parentID,omitempty"` // of the message this one follows
+    Role      string                 `json:"role"`
+    Content   string                 `json:"content"`
+    CreatedAt time.Time              `json:"createdAt"`
+    Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// historyDir returns the folder holding the chat histories of an assistant
+func historyDir(assistant string) string {
+    if assistant == defaultAssistant {
+        return "History"
+    }
+    return path.Join("assistants", assistant, "History")
+}
+
+// historyPath returns the file of a chat history
+func historyPath(assistant, id string) string {
+    return path.Join(historyDir(assistant), id+".json")
+}
+
+// newConversation returns an empty conversation created now
+func (s *Server) newConversation(id, assistant string) *Conversation {
+    now := s.now().UTC()
+    return &Conversation{
+        Version:   conversationVersion,
+        ID:        id,
+        Assistant: assistant,
+        CreatedAt: now,
+        UpdatedAt: now,
+        Messages:  []Message{},
+    }
+}
+
+// loadConversation reads a chat history. Files written before histories
+// had a schema are migrated in memory, they are rewritten on the next save.
+// The assistant and ID are those of the file's location, which change when
+// an assistant is renamed.
+func (s *Server) loadConversation(assistant, id string) (*Conversation, error) {
+    name := historyPath(assistant, id)
+    data, err := s.store.ReadFile(name)
+    if err != nil {
+        return nil, err
+    }
+    if isConversationDocument(data) {
+        var c Conversation
+        if err := json.Unmarshal(data, &c); err != nil {
+            return nil, fmt.Errorf("%s: %w", name, err)
+        }
+        if c.Messages == nil {
+            c.Messages = []Message{}
+        }
+        c.Assistant, c.ID = assistant, id
+        return &c, nil
+    }
+
+    info, err := s.store.Stat(name)
+    if err != nil {
+        return nil, err
+    }
+    return migrateConversation(data, id, assistant, info.ModTime()), nil
+}
+
+// saveConversation writes a chat history. Callers changing an existing
+// history hold its lock. The parent IDs of the active branch are set from
+// the order of its messages.
+func (s *Server) saveConversation(c *Conversation) error {
+    linkMessages(c)
+    data, err := json.MarshalIndent(c, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(s.store, historyPath(c.Assistant, c.ID), data)
+}
+
+// lockConversation serializes read-modify-write cycles of a chat history
+// and returns the function releasing the lock
+func (s *Server) lockConversation(assistant, id string) (unlock func()) {
+    return s.historyLocks.Lock(historyPath(assistant, id))
+}
+
+// conversationETag returns the entity tag of the current state of a
+// conversation, used for optimistic concurrency control
+func conversationETag(c *Conversation) string {
+    data, _ := json.Marshal(c)
+    sum := sha256.Sum256(data)
+    return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match header allows changing a
+// conversation with the given entity tag. An absent header always matches.
+func etagMatches(ifMatch, etag string) bool {
+    if ifMatch == "" {
+        return true
+    }
+    for _, candidate := range strings.Split(ifMatch, ",") {
+        candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+        if candidate == "*" || candidate == etag {
+            return true
+        }
+    }
+    return false
+}
+
+// isConversationDocument reports whether data holds a versioned
+// conversation document rather than a legacy free-form history
+func isConversationDocument(data []byte) bool {
+    var probe struct {
+        Version int `json:"version"`
+    }
+    return json.Unmarshal(data, &probe) == nil && probe.Version >= 1
+}
+
+// parseConversation strictly decodes a conversation document sent by a
+// client and validates it. Fields owned by the server (ID, assistant,
+// timestamps of the conversation) are ignored by the caller.
+func parseConversation(data string) (*Conversation, []FieldError) {
+    dec := json.NewDecoder(strings.NewReader(data))
+    dec.DisallowUnknownFields()
+
+    var c Conversation
+    if err := dec.Decode(&c); err != nil {
+        _, resp := decodeError(err)
+        if len(resp.Fields) > 0 {
+            for i := range resp.Fields {
+                resp.Fields[i].Field = "context." + resp.Fields[i].Field
+            }
+            return nil, resp.Fields
+        }
+        return nil, []FieldError{{Field: "context", Message: "must be a conversation document: " + resp.Error}}
+    }
+    if dec.More() {
+        return nil, []FieldError{{Field: "context", Message: "must contain a single conversation document"}}
+    }
+    if errs := validateConversation(&c); len(errs) > 0 {
+        return nil, errs
+    }
+    if c.Messages == nil {
+        c.Messages = []Message{}
+    }
+    return &c, nil
+}
+
+// validateConversation checks the parts of a conversation a client controls
+func validateConversation(c *Conversation) []FieldError {
+    var errs []FieldError
+    if c.Version > conversationVersion {
+        errs = append(errs, FieldError{Field: "context.version", Message: fmt.Sprintf("must be at most %d", conversationVersion)})
+    }
+    errs = append(errs, validateValue("context.title", c.Title, "max=200")...)
+
+    seen := map[string]bool{}
+    for i, m := range c.Messages {
+        field := fmt.Sprintf("context.messages[%d]", i)
+        errs = append(errs, validateMessage(field, m)...)
+        if m.ID != "" && seen[m.ID] {
+            errs = append(errs, FieldError{Field: field + ".id", Message: "must be unique within the conversation"})
+        }
+        seen[m.ID] = true
+    }
+    for i, m := range c.Branches {
+        field := fmt.Sprintf("context.branches[%d]", i)
+        errs = append(errs, validateMessage(field, m)...)
+        if m.ID == "" {
+            errs = append(errs, FieldError{Field: field + ".id", Message: "is required"})
+        } else if seen[m.ID] {
+            errs = append(errs, FieldError{Field: field + ".id", Message: "must be unique within the conversation"})
+        }
+        seen[m.ID] = true
+    }
+    for i, m := range c.Branches {
+        if m.ParentID != "" && !seen[m.ParentID] {
+            errs = append(errs, FieldError{Field: fmt.Sprintf("context.branches[%d].parentID", i), Message: "must be the ID of a message of the conversation"})
+        }
+    }
+    return errs
+}
+
+// validateMessage checks a single message, field is its path in the request
+func validateMessage(field string, m Message) []FieldError {
+    var errs []FieldError
+    errs = append(errs, validateValue(field+".id", m.ID, "max=64,charset=id")...)
+    switch m.Role {
+    case RoleSystem, RoleUser, RoleAssistant, RoleTool:
+    case "":
+        errs = append(errs, FieldError{Field: field + ".role", Message: "is required"})
+    default:
+        errs = append(errs, FieldError{Field: field + ".role", Message: "must be one of system, user, assistant or tool"})
+    }
+    errs = append(errs, validateValue(field+".content", m.Content, fmt.Sprintf("max=%d", maxMessageLength))...)
+    return errs
+}
+
+// completeMessages assigns an ID and creation time to messages that lack them
+func (s *Server) completeMessages(messages []Message) {
+    for i := range messages {
+        if messages[i].ID == "" {
+            messages[i].ID = s.newID()
+        }
+        if messages[i].CreatedAt.IsZero() {
+            messages[i].CreatedAt = s.now().UTC()
+        }
+    }
+}
+
+// migrateConversation converts the content of a free-form history file
+// into a conversation. Arrays of messages, alone or in a "messages" field,
+// are converted message by message; content that cannot be converted is
+// kept verbatim in the legacyContent metadata entry. Message IDs are derived
+// from their position, so migrating the same file twice gives the same
+// result.
+func migrateConversation(data []byte, id, assistant string, modTime time.Time) *Conversation {
+    c := &Conversation{
+        Version:   conversationVersion,
+        ID:        id,
+        Assistant: assistant,
+        CreatedAt: modTime.UTC(),
+        UpdatedAt: modTime.UTC(),
+        Messages:  []Message{},
+    }
+    keepLegacy := func() *Conversation {
+        c.Metadata = map[string]interface{}{"legacyContent": string(data)}
+        return c
+    }
+
+    if len(bytes.TrimSpace(data)) == 0 {
+        return c
+    }
+    var raw interface{}
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return keepLegacy()
+    }
+
+    var items []interface{}
+    switch v := raw.(type) {
+    case []interface{}:
+        items = v
+    case map[string]interface{}:
+        if len(v) == 0 {
+            return c
+        }
+        messages, ok := v["messages"].([]interface{})
+        if !ok {
+            return keepLegacy()
+        }
+        items = messages
+        if title, ok := v["title"].(string); ok {
+            c.Title = title
+        }
+    default:
+        return keepLegacy()
+    }
+
+    lossy := false
+    for i, item := range items {
+        obj, _ := item.(map[string]interface{})
+        content, ok := firstString(obj, "content", "text", "message")
+        if !ok {
+            lossy = true
+            continue
+        }
+        m := Message{
+            ID:        fmt.Sprintf("legacy-%d", i+1),
+            Role:      legacyRole(obj),
+            Content:   content,
+            CreatedAt: c.CreatedAt,
+        }
+        if ts, ok := firstString(obj, "createdAt", "timestamp", "time"); ok {
+            if t, err := time.Parse(time.RFC3339, ts); err == nil {
+                m.CreatedAt = t.UTC()
+            }
+        }
+        c.Messages = append(c.Messages, m)
+    }
+    if lossy {
+        return keepLegacy()
+    }
+    return c
+}
+
+// legacyRole maps the role of a legacy message to one of the message roles
+func legacyRole(obj map[string]interface{}) string {
+    role, _ := firstString(obj, "role", "sender", "author", "from")
+    switch strings.ToLower(role) {
+    case RoleSystem, "developer":
+        return RoleSystem
+    case RoleAssistant, "bot", "ai", "model":
+        return RoleAssistant
+    case RoleTool, "function":
+        return RoleTool
+    }
+    return RoleUser
+}
+
+// firstString returns the first of the keys of obj holding a string
+func firstString(obj map[string]interface{}, keys ...string) (string, bool) {
+    for _, key := range keys {
+        if v, ok := obj[key].(string); ok {
+            return v, true
+        }
+    }
+    return "", false
+}
+
+// historyLocation is a folder of chat histories and the assistant owning it
+type historyLocation struct {
+    Assistant string
+    Dir       string
+}
+
+// historyLocations lists the root History folder and the History folders
+// of all assistants that exist in the store
+func historyLocations(store Store) ([]historyLocation, error) {
+    locations := []historyLocation{{Assistant: defaultAssistant, Dir: historyDir(defaultAssistant)}}
+    assistants, err := store.ReadDir("assistants")
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, err
+    }
+    for _, a := range assistants {
+        if a.IsDir() && a.Name() != defaultAssistant {
+            locations = append(locations, historyLocation{Assistant: a.Name(), Dir: historyDir(a.Name())})
+        }
+    }
+    return locations, nil
+}
+
+// MigrateHistories rewrites every legacy free-form chat history in the
+// store as a versioned conversation document and returns how many files
+// were migrated
+func MigrateHistories(store Store) (int, error) {
+    locations, err := historyLocations(store)
+    if err != nil {
+        return 0, err
+    }
+
+    migrated := 0
+    for _, loc := range locations {
+        files, err := store.ReadDir(loc.Dir)
+        if errors.Is(err, fs.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return migrated, err
+        }
+        for _, file := range files {
+            if file.IsDir() || path.Ext(file.Name()) != ".json" {
+                continue
+            }
+            name := path.Join(loc.Dir, file.Name())
+            data, err := store.ReadFile(name)
+            if err != nil {
+                return migrated, err
+            }
+            if isConversationDocument(data) {
+                continue
+            }
+            info, err := file.Info()
+            if err != nil {
+                return migrated, err
+            }
+            c := migrateConversation(data, strings.TrimSuffix(file.Name(), ".json"), loc.Assistant, info.ModTime())
+            out, err := json.MarshalIndent(c, "", "  ")
+            if err != nil {
+                return migrated, err
+            }
+            if err := writeFileAtomic(store, name, out); err != nil {
+                return migrated, err
+            }
+            migrated++
+        }
+    }
+    return migrated, nil
+}
+
+// maxPreviewLength is the number of characters of the last message shown in
+// a conversation summary
+const maxPreviewLength = 100
+
+// ConversationSummary describes a conversation in a listing
+type ConversationSummary struct {
+    ID           string    `json:"id"`
+    Assistant    string    `json:"assistant"`
+    Title        string    `json:"title"`
+    MessageCount int       `json:"messageCount"`
+    LastMessage  string    `json:"lastMessage"` // preview of the last message
+    CreatedAt    time.Time `json:"createdAt"`
+    UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// summarizeConversation returns the listing entry of a conversation
+func summarizeConversation(c *Conversation) ConversationSummary {
+    summary := ConversationSummary{
+        ID:           c.ID,
+        Assistant:    c.Assistant,
+        Title:        c.Title,
+        MessageCount: len(c.Messages),
+        CreatedAt:    c.CreatedAt,
+        UpdatedAt:    c.UpdatedAt,
+    }
+    if n := len(c.Messages); n > 0 {
+        summary.LastMessage = preview(c.Messages[n-1].Content, maxPreviewLength)
+    }
+    return summary
+}
+
+// preview collapses the whitespace of s and shortens it to at most n
+// characters
+func preview(s string, n int) string {
+    s = strings.Join(strings.Fields(s), " ")
+    if utf8.RuneCountInString(s) <= n {
+        return s
+    }
+    runes := []rune(s)
+    return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// summaryCache keeps the summaries of history files, so listing thousands
+// of conversations does not parse every file on every request. Entries are
+// valid as long as the size and modification time of their file are.
+type summaryCache struct {
+    mu      sync.Mutex
+    entries map[string]cachedSummary
+}
+
+type cachedSummary struct {
+    size    int64
+    modTime time.Time
+    summary ConversationSummary
+}
+
+// historyFile is a chat history file found in the store
+type historyFile struct {
+    Assistant string
+    ID        string
+    Info      fs.FileInfo
+}
+
+// historyFiles lists the history files of the given assistants, or of all
+// assistants if none are given. It also returns the folders that were
+// read, so caches can drop the entries of files that no longer exist.
+func (s *Server) historyFiles(assistants ...string) ([]historyFile, []string, error) {
+    locations, err := historyLocations(s.store)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var found []historyFile
+    var dirs []string
+    for _, loc := range locations {
+        if len(assistants) > 0 && !slices.Contains(assistants, loc.Assistant) {
+            continue
+        }
+        dirs = append(dirs, loc.Dir)
+        files, err := s.store.ReadDir(loc.Dir)
+        if errors.Is(err, fs.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return nil, nil, err
+        }
+        for _, file := range files {
+            if file.IsDir() || path.Ext(file.Name()) != ".json" {
+                continue
+            }
+            info, err := file.Info()
+            if err != nil {
+                continue // removed while listing
+            }
+            found = append(found, historyFile{Assistant: loc.Assistant, ID: strings.TrimSuffix(file.Name(), ".json"), Info: info})
+        }
+    }
+    return found, dirs, nil
+}
+
+// listConversations returns the summaries of the conversations of the
+// given assistants, or of all assistants if none are given
+func (s *Server) listConversations(assistants ...string) ([]ConversationSummary, error) {
+    files, dirs, err := s.historyFiles(assistants...)
+    if err != nil {
+        return nil, err
+    }
+
+    summaries := []ConversationSummary{}
+    seen := map[string]bool{}
+    for _, file := range files {
+        seen[historyPath(file.Assistant, file.ID)] = true
+        if summary, ok := s.summarize(file.Assistant, file.ID, file.Info); ok {
+            summaries = append(summaries, summary)
+        }
+    }
+    s.summaries.prune(dirs, seen)
+    return summaries, nil
+}
+
+// summarize returns the summary of a history file, from the cache if the
+// file is unchanged. Files that cannot be read are left out of listings.
+func (s *Server) summarize(assistant, id string, info fs.FileInfo) (ConversationSummary, bool) {
+    name := historyPath(assistant, id)
+
+    s.summaries.mu.Lock()
+    entry, ok := s.summaries.entries[name]
+    s.summaries.mu.Unlock()
+    if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+        return entry.summary, true
+    }
+
+    c, err := s.loadConversation(assistant, id)
+    if err != nil {
+        return ConversationSummary{}, false
+    }
+    summary := summarizeConversation(c)
+
+    s.summaries.mu.Lock()
+    if s.summaries.entries == nil {
+        s.summaries.entries = map[string]cachedSummary{}
+    }
+    s.summaries.entries[name] = cachedSummary{size: info.Size(), modTime: info.ModTime(), summary: summary}
+    s.summaries.mu.Unlock()
+    return summary, true
+}
+
+// prune drops the cached summaries of files in dirs that no longer exist
+func (c *summaryCache) prune(dirs []string, seen map[string]bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for name := range c.entries {
+        if slices.Contains(dirs, path.Dir(name)) && !seen[name] {
+            delete(c.entries, name)
+        }
+    }
+}
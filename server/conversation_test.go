@@ -0,0 +1,155 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestMigrateConversation(t *testing.T) {
+    modTime := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+    tests := []struct {
+        name     string
+        data     string
+        title    string
+        messages []Message
+        legacy   bool
+    }{
+        {name: "empty file", data: ``},
+        {name: "empty object", data: `{}`},
+        {
+            name: "array of messages",
+            data: `[{"role":"user","content":"hi"},{"role":"bot","content":"hello","timestamp":"2023-05-06T07:10:00Z"}]`,
+            messages: []Message{
+                {ID: "legacy-1", Role: RoleUser, Content: "hi", CreatedAt: modTime},
+                {ID: "legacy-2", Role: RoleAssistant, Content: "hello", CreatedAt: time.Date(2023, 5, 6, 7, 10, 0, 0, time.UTC)},
+            },
+        },
+        {
+            name:  "messages field with title",
+            data:  `{"title":"Greeting","messages":[{"sender":"human","text":"hi"}]}`,
+            title: "Greeting",
+            messages: []Message{
+                {ID: "legacy-1", Role: RoleUser, Content: "hi", CreatedAt: modTime},
+            },
+        },
+        {
+            name: "partially convertible",
+            data: `[{"role":"user","content":"hi"},{"role":"user","content":{"parts":["x"]}}]`,
+            messages: []Message{
+                {ID: "legacy-1", Role: RoleUser, Content: "hi", CreatedAt: modTime},
+            },
+            legacy: true,
+        },
+        {name: "plain text", data: `just some notes`, legacy: true},
+        {name: "unknown object", data: `{"foo":"bar"}`, legacy: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c := migrateConversation([]byte(tt.data), "abc", "Lets Chat", modTime)
+
+            if c.Version != conversationVersion || c.ID != "abc" || c.Assistant != "Lets Chat" || !c.CreatedAt.Equal(modTime) {
+                t.Errorf("conversation header = %+v", c)
+            }
+            if c.Title != tt.title {
+                t.Errorf("title = %q, want %q", c.Title, tt.title)
+            }
+            want := tt.messages
+            if want == nil {
+                want = []Message{}
+            }
+            if !reflect.DeepEqual(c.Messages, want) {
+                t.Errorf("messages = %+v, want %+v", c.Messages, want)
+            }
+            if got := c.Metadata["legacyContent"]; tt.legacy != (got == tt.data) {
+                t.Errorf("legacyContent = %v, want kept: %v", got, tt.legacy)
+            }
+        })
+    }
+}
+
+func TestParseConversation(t *testing.T) {
+    tests := []struct {
+        name   string
+        data   string
+        fields []string
+    }{
+        {name: "valid", data: `{"title":"t","messages":[{"id":"m1","role":"user","content":"hi"},{"role":"assistant","content":"hello"}]}`},
+        {name: "full document", data: `{"version":1,"id":"x","assistant":"a","title":"","createdAt":"2024-01-01T00:00:00Z","updatedAt":"2024-01-01T00:00:00Z","messages":[],"metadata":{"pinned":true}}`},
+        {name: "not JSON", data: `hello`, fields: []string{"context"}},
+        {name: "unknown field", data: `{"msgs":[]}`, fields: []string{"context.msgs"}},
+        {name: "wrong type", data: `{"messages":[{"role":"user","content":7}]}`, fields: []string{"context.messages[0].content"}},
+        {name: "missing role", data: `{"messages":[{"content":"hi"}]}`, fields: []string{"context.messages[0].role"}},
+        {name: "invalid role", data: `{"messages":[{"role":"robot","content":"hi"}]}`, fields: []string{"context.messages[0].role"}},
+        {name: "duplicate IDs", data: `{"messages":[{"id":"a","role":"user"},{"id":"a","role":"user"}]}`, fields: []string{"context.messages[1].id"}},
+        {name: "invalid ID", data: `{"messages":[{"id":"../x","role":"user"}]}`, fields: []string{"context.messages[0].id"}},
+        {name: "future version", data: `{"version":2}`, fields: []string{"context.version"}},
+        {name: "multiple documents", data: `{} {}`, fields: []string{"context"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c, errs := parseConversation(tt.data)
+            var fields []string
+            for _, e := range errs {
+                fields = append(fields, e.Field)
+            }
+            if !reflect.DeepEqual(fields, tt.fields) {
+                t.Fatalf("errors = %+v, want fields %v", errs, tt.fields)
+            }
+            if tt.fields == nil && c.Messages == nil {
+                t.Error("messages of a valid conversation are nil")
+            }
+        })
+    }
+}
+
+func TestFetchMigratesLegacyHistory(t *testing.T) {
+    s := newFixtureServer(t)
+    legacy := `[{"role":"user","content":"hi"}]`
+    s.store.WriteFile(historyPath("Lets Chat", rootHistoryID), []byte(legacy))
+
+    fetch := func() *Conversation {
+        rec := serve(s, http.MethodPost, "/fetch-history", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`"}`)
+        var resp FetchHistoryResponse
+        decodeBody(t, rec, &resp)
+        return resp.Conversation
+    }
+    first, second := fetch(), fetch()
+    if len(first.Messages) != 1 || first.Messages[0].Content != "hi" {
+        t.Fatalf("migrated messages = %+v", first.Messages)
+    }
+    if !reflect.DeepEqual(first, second) {
+        t.Errorf("migrating twice gave different results: %+v != %+v", first, second)
+    }
+    // Reading does not rewrite the file
+    wantFile(t, s, historyPath("Lets Chat", rootHistoryID), legacy)
+}
+
+func TestMigrateHistories(t *testing.T) {
+    s := newFixtureServer(t)
+    current, _ := json.Marshal(s.newConversation("0f0f0f0f-0000-0000-0000-000000000000", "Writer"))
+    s.store.MkdirAll(historyDir("Writer"))
+    s.store.WriteFile(historyPath("Writer", "0f0f0f0f-0000-0000-0000-000000000000"), current)
+
+    n, err := MigrateHistories(s.store)
+    if err != nil {
+        t.Fatalf("MigrateHistories: %v", err)
+    }
+    // The fixtures hold one legacy history at the root and one of Reviewer
+    if n != 2 {
+        t.Errorf("migrated %d histories, want 2", n)
+    }
+    for _, h := range []struct{ assistant, id string }{{"Lets Chat", rootHistoryID}, {"Reviewer", reviewerHistoryID}} {
+        data, _ := s.store.ReadFile(historyPath(h.assistant, h.id))
+        if !isConversationDocument(data) {
+            t.Errorf("%s/%s was not migrated: %s", h.assistant, h.id, data)
+        }
+    }
+    wantFile(t, s, historyPath("Writer", "0f0f0f0f-0000-0000-0000-000000000000"), string(current))
+
+    if n, err := MigrateHistories(s.store); n != 0 || err != nil {
+        t.Errorf("second migration = %d, %v; want nothing to do", n, err)
+    }
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "hash/fnv"
+    "math"
+    "path"
+)
+
+// Embedder turns text into vectors whose cosine similarity tells how
+// related two texts are. It backs the semantic knowledge base searches.
+type Embedder interface {
+    // Model names the embedding model. Vectors of different models are
+    // never compared: chunks are embedded again when the model changes.
+    Model() string
+    Embed(text string) []float32
+}
+
+// hashEmbedder is a deterministic offline Embedder. It hashes the words,
+// word pairs and character trigrams of a text into a fixed number of
+// dimensions, so texts sharing words or word stems get similar vectors.
+type hashEmbedder struct {
+    dimensions int
+}
+
+// defaultEmbeddingDimensions is the vector size of the default embedder
+const defaultEmbeddingDimensions = 256
+
+func (e hashEmbedder) Model() string {
+    return fmt.Sprintf("hashed-ngrams-%d", e.dimensions)
+}
+
+// Embed returns the L2 normalized sum of the hashed features of text, or a
+// zero vector if it has no words
+func (e hashEmbedder) Embed(text string) []float32 {
+    vector := make([]float64, e.dimensions)
+    add := func(feature string, weight float64) {
+        h := fnv.New32a()
+        h.Write([]byte(feature))
+        sum := h.Sum32()
+        // The top bit picks the sign so that collisions tend to cancel out
+        if sum&(1<<31) != 0 {
+            weight = -weight
+        }
+        vector[int(sum%uint32(e.dimensions))] += weight
+    }
+
+    tokens := tokenize(text)
+    for i, t := range tokens {
+        add("w:"+t.term, 1)
+        if i > 0 {
+            add("b:"+tokens[i-1].term+" "+t.term, 0.5)
+        }
+        word := []rune("^" + t.term + "$")
+        for j := 0; j+3 <= len(word); j++ {
+            add("t:"+string(word[j:j+3]), 0.25)
+        }
+    }
+
+    var norm float64
+    for _, v := range vector {
+        norm += v * v
+    }
+    norm = math.Sqrt(norm)
+    embedding := make([]float32, e.dimensions)
+    if norm > 0 {
+        for i, v := range vector {
+            embedding[i] = float32(v / norm)
+        }
+    }
+    return embedding
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 if either is
+// zero or their sizes differ
+func cosine(a, b []float32) float64 {
+    if len(a) != len(b) {
+        return 0
+    }
+    var dot, na, nb float64
+    for i := range a {
+        dot += float64(a[i]) * float64(b[i])
+        na += float64(a[i]) * float64(a[i])
+        nb += float64(b[i]) * float64(b[i])
+    }
+    if na == 0 || nb == 0 {
+        return 0
+    }
+    return dot / math.Sqrt(na*nb)
+}
+
+// vectorFile holds the embeddings of the chunks of a knowledge base file
+type vectorFile struct {
+    Model   string               `json:"model"`
+    Vectors map[string][]float32 `json:"vectors"` // by chunk ID
+}
+
+func vectorsPath(knowledgeBase, name string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "vectors", name+".json")
+}
+
+// embedChunk embeds the text of a chunk together with its heading
+func (s *Server) embedChunk(c Chunk) []float32 {
+    return s.embedder.Embed(c.Heading + "\n" + c.Text)
+}
+
+func (s *Server) embedChunks(chunks []Chunk) vectorFile {
+    vectors := vectorFile{Model: s.embedder.Model(), Vectors: map[string][]float32{}}
+    for _, c := range chunks {
+        vectors.Vectors[c.ID] = s.embedChunk(c)
+    }
+    return vectors
+}
+
+// chunkVectors returns the stored embeddings of the chunks of a file, or
+// nil if there are none of the current model
+func (s *Server) chunkVectors(knowledgeBase, name string) map[string][]float32 {
+    data, err := s.store.ReadFile(vectorsPath(knowledgeBase, name))
+    if err != nil {
+        return nil
+    }
+    var vectors vectorFile
+    if json.Unmarshal(data, &vectors) != nil || vectors.Model != s.embedder.Model() {
+        return nil
+    }
+    return vectors.Vectors
+}
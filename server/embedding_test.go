@@ -0,0 +1,38 @@
+package server
+
+import (
+    "math"
+    "testing"
+)
+
+func TestHashEmbedder(t *testing.T) {
+    e := hashEmbedder{dimensions: 64}
+    printer := e.Embed("The printer prints invoices.")
+    if len(printer) != 64 || cosine(printer, e.Embed("The printer prints invoices.")) < 0.9999 {
+        t.Fatalf("embedding of %d dimensions is not deterministic", len(printer))
+    }
+    var norm float64
+    for _, v := range printer {
+        norm += float64(v) * float64(v)
+    }
+    if math.Abs(norm-1) > 1e-5 {
+        t.Errorf("squared norm = %f, want 1", norm)
+    }
+
+    // Shared word stems make texts similar
+    related := cosine(printer, e.Embed("printing an invoice"))
+    unrelated := cosine(printer, e.Embed("coffee machine"))
+    if related <= unrelated {
+        t.Errorf("similarity of related text %f <= unrelated text %f", related, unrelated)
+    }
+
+    if got := cosine(e.Embed("!!"), printer); got != 0 {
+        t.Errorf("similarity to text without words = %f, want 0", got)
+    }
+    if got := cosine(printer, printer[:10]); got != 0 {
+        t.Errorf("similarity of vectors of different sizes = %f, want 0", got)
+    }
+    if got := e.Model(); got != "hashed-ngrams-64" {
+        t.Errorf("model = %q", got)
+    }
+}
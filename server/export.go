@@ -0,0 +1,273 @@
+package server
+
+import (
+    "archive/zip"
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "html/template"
+    "io"
+    "io/fs"
+    "mime"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+)
+
+// exportFormatRules lists the formats conversations can be exported in
+const exportFormatRules = "oneof=markdown|text|html|jsonl"
+
+// exportFormat writes conversations in one format
+type exportFormat struct {
+    ext         string
+    contentType string
+    // write writes a conversation. roleSetting is the role setting of its
+    // assistant, if any.
+    write func(w io.Writer, c *Conversation, roleSetting string) error
+}
+
+var exportFormats = map[string]exportFormat{
+    "markdown": {ext: ".md", contentType: "text/markdown; charset=utf-8", write: writeMarkdown},
+    "text":     {ext: ".txt", contentType: "text/plain; charset=utf-8", write: writeText},
+    "html":     {ext: ".html", contentType: "text/html; charset=utf-8", write: writeHTML},
+    "jsonl":    {ext: ".jsonl", contentType: "application/jsonl", write: writeFineTuningJSONL},
+}
+
+// exportTimeLayout is how times are shown in exported transcripts
+const exportTimeLayout = "2006-01-02 15:04:05 UTC"
+
+// conversationTitle returns the title of a conversation, or a name made of
+// its ID if it has none
+func conversationTitle(c *Conversation) string {
+    if c.Title != "" {
+        return c.Title
+    }
+    return "Conversation " + c.ID
+}
+
+// roleName returns how the author of a message is shown in transcripts
+func roleName(role string) string {
+    switch role {
+    case RoleSystem:
+        return "System"
+    case RoleUser:
+        return "User"
+    case RoleAssistant:
+        return "Assistant"
+    case RoleTool:
+        return "Tool"
+    }
+    return role
+}
+
+func writeMarkdown(w io.Writer, c *Conversation, roleSetting string) error {
+    bw := bufio.NewWriter(w)
+    fmt.Fprintf(bw, "# %s\n\n", conversationTitle(c))
+    fmt.Fprintf(bw, "- Assistant: %s\n", c.Assistant)
+    fmt.Fprintf(bw, "- Created: %s\n", c.CreatedAt.UTC().Format(exportTimeLayout))
+    fmt.Fprintf(bw, "- Updated: %s\n", c.UpdatedAt.UTC().Format(exportTimeLayout))
+    for _, m := range c.Messages {
+        fmt.Fprintf(bw, "\n---\n\n**%s** · %s\n\n%s\n", roleName(m.Role), m.CreatedAt.UTC().Format(exportTimeLayout), m.Content)
+    }
+    return bw.Flush()
+}
+
+func writeText(w io.Writer, c *Conversation, roleSetting string) error {
+    bw := bufio.NewWriter(w)
+    title := conversationTitle(c)
+    fmt.Fprintf(bw, "%s\n%s\n", title, strings.Repeat("=", len([]rune(title))))
+    fmt.Fprintf(bw, "Assistant: %s\n", c.Assistant)
+    fmt.Fprintf(bw, "Created: %s\n", c.CreatedAt.UTC().Format(exportTimeLayout))
+    fmt.Fprintf(bw, "Updated: %s\n", c.UpdatedAt.UTC().Format(exportTimeLayout))
+    for _, m := range c.Messages {
+        fmt.Fprintf(bw, "\n[%s] %s:\n%s\n", m.CreatedAt.UTC().Format(exportTimeLayout), roleName(m.Role), m.Content)
+    }
+    return bw.Flush()
+}
+
+// htmlTranscript is a self-contained page, it loads no stylesheets or
+// scripts so it can be attached to bug reports as is
+var htmlTranscript = template.Must(template.New("transcript").Funcs(template.FuncMap{
+    "role": roleName,
+    "time": func(t time.Time) string { return t.UTC().Format(exportTimeLayout) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+header p { color: #666; margin: .25rem 0; }
+.message { border-radius: .5rem; padding: .75rem 1rem; margin: 1rem 0; background: #f4f4f5; }
+.message.user { background: #e0ecff; }
+.message.system, .message.tool { background: #fff7e0; }
+.meta { font-size: .85rem; color: #666; margin-bottom: .5rem; }
+.content { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Assistant: {{.Conversation.Assistant}}</p>
+<p>Created: {{time .Conversation.CreatedAt}} · Updated: {{time .Conversation.UpdatedAt}}</p>
+</header>
+<main>
+{{- range .Conversation.Messages}}
+<article class="message {{.Role}}" id="{{.ID}}">
+<div class="meta"><strong>{{role .Role}}</strong> · {{time .CreatedAt}}</div>
+<div class="content">{{.Content}}</div>
+</article>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, c *Conversation, roleSetting string) error {
+    return htmlTranscript.Execute(w, struct {
+        Title        string
+        Conversation *Conversation
+    }{conversationTitle(c), c})
+}
+
+// fineTuningMessage is a message of a fine-tuning example
+type fineTuningMessage struct {
+    Role    string `json:"role"`
+    Content string `json:"content"`
+}
+
+// writeFineTuningJSONL writes a conversation as a line of the OpenAI chat
+// fine-tuning format, with the role setting of the assistant as system
+// message. Tool messages are left out, the format requires the tool calls
+// they answer.
+func writeFineTuningJSONL(w io.Writer, c *Conversation, roleSetting string) error {
+    var example struct {
+        Messages []fineTuningMessage `json:"messages"`
+    }
+    example.Messages = []fineTuningMessage{}
+    if roleSetting != "" {
+        example.Messages = append(example.Messages, fineTuningMessage{Role: RoleSystem, Content: roleSetting})
+    }
+    for _, m := range c.Messages {
+        if m.Role != RoleTool {
+            example.Messages = append(example.Messages, fineTuningMessage{Role: m.Role, Content: m.Content})
+        }
+    }
+    return json.NewEncoder(w).Encode(example)
+}
+
+// roleSetting returns the role setting of an assistant, or "" if it has
+// none
+func (s *Server) roleSetting(assistant string) (string, error) {
+    if assistant == defaultAssistant {
+        return "", nil
+    }
+    data, err := s.store.ReadFile(path.Join("assistants", assistant, "roleSetting.txt"))
+    if errors.Is(err, fs.ErrNotExist) {
+        return "", nil
+    }
+    return strings.TrimSpace(string(data)), err
+}
+
+// setAttachment makes the response a download saved under name
+func setAttachment(w http.ResponseWriter, contentType, name string) {
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// Export History Handler
+func (s *Server) exportHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "assistant", titleRules) ||
+        !validateQuery(w, r, "historyID", historyIDRules) ||
+        !validateQuery(w, r, "format", exportFormatParam.Rules) {
+        return
+    }
+    query := r.URL.Query()
+    format := exportFormats[query.Get("format")]
+
+    conversation, err := s.loadConversation(query.Get("assistant"), query.Get("historyID"))
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+    roleSetting, err := s.roleSetting(conversation.Assistant)
+    if err != nil {
+        http.Error(w, "Failed to read roleSetting file", http.StatusInternalServerError)
+        return
+    }
+
+    setAttachment(w, format.contentType, conversation.ID+format.ext)
+    format.write(w, conversation, roleSetting)
+}
+
+// Export Histories Handler sends all histories of an assistant as a zip
+// archive with one file per history
+func (s *Server) exportHistoriesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "assistant", titleRules) ||
+        !validateQuery(w, r, "format", exportFormatParam.Rules) {
+        return
+    }
+    query := r.URL.Query()
+    assistant := query.Get("assistant")
+    format := exportFormats[query.Get("format")]
+
+    if assistant != defaultAssistant && !s.exists(path.Join("assistants", assistant)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    files, _, err := s.historyFiles(assistant)
+    if err != nil {
+        http.Error(w, "Failed to read History directory", http.StatusInternalServerError)
+        return
+    }
+    roleSetting, err := s.roleSetting(assistant)
+    if err != nil {
+        http.Error(w, "Failed to read roleSetting file", http.StatusInternalServerError)
+        return
+    }
+
+    // Read everything before answering, errors cannot be reported once the
+    // archive is being sent
+    var conversations []*Conversation
+    for _, file := range files {
+        c, err := s.loadConversation(file.Assistant, file.ID)
+        if err != nil {
+            http.Error(w, "Failed to read history file", http.StatusInternalServerError)
+            return
+        }
+        conversations = append(conversations, c)
+    }
+
+    setAttachment(w, "application/zip", assistant+" histories.zip")
+    zw := zip.NewWriter(w)
+    for _, c := range conversations {
+        fw, err := zw.CreateHeader(&zip.FileHeader{
+            Name:     c.ID + format.ext,
+            Method:   zip.Deflate,
+            Modified: c.UpdatedAt,
+        })
+        if err != nil {
+            return
+        }
+        if err := format.write(fw, c, roleSetting); err != nil {
+            return
+        }
+    }
+    zw.Close()
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/json"
+    "io"
+    "net/http"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+)
+
+// saveExportFixture stores a conversation of the Reviewer assistant, whose
+// role setting is "You review code"
+func saveExportFixture(t *testing.T, s *Server) *Conversation {
+    t.Helper()
+    c := s.newConversation("review", "Reviewer")
+    c.Title = "Code review"
+    c.Messages = []Message{
+        {ID: "m1", Role: RoleUser, Content: "Is <script>alert(1)</script> safe?", CreatedAt: s.now()},
+        {ID: "m2", Role: RoleTool, Content: `{"lint":"ok"}`, CreatedAt: s.now()},
+        {ID: "m3", Role: RoleAssistant, Content: "No.\nEscape it.", CreatedAt: s.now()},
+    }
+    if err := s.saveConversation(c); err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+func TestExportHistory(t *testing.T) {
+    tests := []struct {
+        format      string
+        contentType string
+        filename    string
+        contains    []string
+        excludes    []string
+    }{
+        {
+            format:      "markdown",
+            contentType: "text/markdown; charset=utf-8",
+            filename:    "review.md",
+            contains:    []string{"# Code review\n", "- Assistant: Reviewer\n", "**User** · 2024-01-02 03:04:05 UTC\n\nIs <script>", "**Assistant**", "No.\nEscape it."},
+        },
+        {
+            format:      "text",
+            contentType: "text/plain; charset=utf-8",
+            filename:    "review.txt",
+            contains:    []string{"Code review\n===========\n", "[2024-01-02 03:04:05 UTC] User:\nIs <script>", "Assistant:\nNo.\nEscape it."},
+        },
+        {
+            format:      "html",
+            contentType: "text/html; charset=utf-8",
+            filename:    "review.html",
+            contains:    []string{"<!DOCTYPE html>", "<title>Code review</title>", "Is &lt;script&gt;alert(1)&lt;/script&gt; safe?", `<article class="message assistant" id="m3">`},
+            excludes:    []string{"<script>", "<link", "src="},
+        },
+        {
+            format:      "jsonl",
+            contentType: "application/jsonl",
+            filename:    "review.jsonl",
+            contains:    []string{`{"messages":[{"role":"system","content":"You review code"},{"role":"user","content":"Is \u003cscript\u003ealert(1)\u003c/script\u003e safe?"},{"role":"assistant","content":"No.\nEscape it."}]}` + "\n"},
+            excludes:    []string{"lint"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.format, func(t *testing.T) {
+            s := newFixtureServer(t)
+            saveExportFixture(t, s)
+
+            rec := serve(s, http.MethodGet, "/export-history?assistant=Reviewer&historyID=review&format="+tt.format, "")
+            if rec.Code != http.StatusOK {
+                t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+            if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+                t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+            }
+            if got, want := rec.Header().Get("Content-Disposition"), "attachment; filename="+tt.filename; got != want {
+                t.Errorf("Content-Disposition = %q, want %q", got, want)
+            }
+            body := rec.Body.String()
+            for _, want := range tt.contains {
+                if !strings.Contains(body, want) {
+                    t.Errorf("export does not contain %q:\n%s", want, body)
+                }
+            }
+            for _, unwanted := range tt.excludes {
+                if strings.Contains(body, unwanted) {
+                    t.Errorf("export contains %q:\n%s", unwanted, body)
+                }
+            }
+        })
+    }
+}
+
+func TestExportHistoryJSONLWithoutRoleSetting(t *testing.T) {
+    s := newFixtureServer(t)
+    c := s.newConversation("plain", defaultAssistant)
+    c.Messages = []Message{{ID: "m1", Role: RoleUser, Content: "hi"}}
+    if err := s.saveConversation(c); err != nil {
+        t.Fatal(err)
+    }
+
+    rec := serve(s, http.MethodGet, "/export-history?assistant=Lets+Chat&historyID=plain&format=jsonl", "")
+    var example struct{ Messages []fineTuningMessage }
+    if err := json.Unmarshal(rec.Body.Bytes(), &example); err != nil {
+        t.Fatalf("invalid JSONL %q: %v", rec.Body.String(), err)
+    }
+    if want := []fineTuningMessage{{Role: RoleUser, Content: "hi"}}; !reflect.DeepEqual(example.Messages, want) {
+        t.Errorf("messages = %+v, want %+v", example.Messages, want)
+    }
+}
+
+func TestExportHistories(t *testing.T) {
+    s := newFixtureServer(t)
+    saveExportFixture(t, s)
+
+    rec := serve(s, http.MethodGet, "/export-histories?assistant=Reviewer&format=markdown", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if got := rec.Header().Get("Content-Type"); got != "application/zip" {
+        t.Errorf("Content-Type = %q", got)
+    }
+    if got, want := rec.Header().Get("Content-Disposition"), `attachment; filename="Reviewer histories.zip"`; got != want {
+        t.Errorf("Content-Disposition = %q, want %q", got, want)
+    }
+
+    zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+    if err != nil {
+        t.Fatalf("invalid zip: %v", err)
+    }
+    var names []string
+    for _, f := range zr.File {
+        names = append(names, f.Name)
+        if f.Name != "review.md" {
+            continue
+        }
+        rc, err := f.Open()
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, _ := io.ReadAll(rc)
+        rc.Close()
+        if !strings.HasPrefix(string(data), "# Code review\n") {
+            t.Errorf("review.md = %q", data)
+        }
+    }
+    sort.Strings(names)
+    if want := []string{reviewerHistoryID + ".md", "review.md"}; !reflect.DeepEqual(names, want) {
+        t.Errorf("archive holds %v, want %v", names, want)
+    }
+}
+
+func TestExportErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {name: "unknown history", method: http.MethodGet, target: "/export-history?assistant=Reviewer&historyID=missing&format=text", status: http.StatusNotFound},
+        {name: "unknown format", method: http.MethodGet, target: "/export-history?assistant=Reviewer&historyID=" + reviewerHistoryID + "&format=pdf", status: http.StatusBadRequest},
+        {name: "missing format", method: http.MethodGet, target: "/export-history?assistant=Reviewer&historyID=" + reviewerHistoryID, status: http.StatusBadRequest},
+        {name: "unknown assistant", method: http.MethodGet, target: "/export-histories?assistant=Nobody&format=text", status: http.StatusNotFound},
+    })
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "html"
+    "io"
+    "sort"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// extractor returns the plain text of a file. Compressed files may
+// decompress to at most maxDecoded bytes.
+type extractor func(data []byte, maxDecoded int64) (string, error)
+
+// uncompressed returns the extractor of files that are not compressed
+func uncompressed(extract func(data []byte) (string, error)) extractor {
+    return func(data []byte, _ int64) (string, error) { return extract(data) }
+}
+
+// extractors maps the file extensions text can be extracted from to their
+// extractor
+var extractors = map[string]extractor{
+    ".txt":  uncompressed(extractPlainText),
+    ".md":   uncompressed(extractPlainText),
+    ".html": uncompressed(extractHTML),
+    ".htm":  uncompressed(extractHTML),
+    ".csv":  uncompressed(extractCSV),
+    ".json": uncompressed(extractJSON),
+    ".docx": extractDOCX,
+    ".pdf":  extractPDF,
+}
+
+// errNoText is reported for files holding no text, such as scanned PDFs
+var errNoText = errors.New("the file contains no text")
+
+// extractText returns the plain text of a file, chosen by its extension.
+// Compressed files may decompress to at most maxDecoded bytes.
+func extractText(ext string, data []byte, maxDecoded int64) (string, error) {
+    extract, ok := extractors[strings.ToLower(ext)]
+    if !ok {
+        return "", fmt.Errorf("text extraction is not supported for %q files", ext)
+    }
+    text, err := extract(data, maxDecoded)
+    if err != nil {
+        return "", err
+    }
+    text = normalizeText(text)
+    if text == "" {
+        return "", errNoText
+    }
+    return text, nil
+}
+
+// normalizeText collapses runs of spaces and tabs within lines, trims the
+// lines and collapses runs of blank lines
+func normalizeText(text string) string {
+    var b strings.Builder
+    blank := 0
+    for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+        line = strings.Join(strings.Fields(line), " ")
+        if line == "" {
+            blank++
+            continue
+        }
+        if b.Len() > 0 {
+            b.WriteString("\n")
+            if blank > 0 {
+                b.WriteString("\n")
+            }
+        }
+        blank = 0
+        b.WriteString(line)
+    }
+    return b.String()
+}
+
+func extractPlainText(data []byte) (string, error) {
+    data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+    if !utf8.Valid(data) {
+        return "", errors.New("the file is not valid UTF-8 text")
+    }
+    return string(data), nil
+}
+
+// htmlBlockElements start a new line in the text of an HTML document
+var htmlBlockElements = map[string]bool{
+    "address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true,
+    "div": true, "dl": true, "dt": true, "figcaption": true, "footer": true, "h1": true, "h2": true,
+    "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true,
+    "nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true,
+    "th": true, "title": true, "tr": true, "ul": true,
+}
+
+// extractHTML returns the text of an HTML document, leaving out scripts,
+// styles and comments. It does not need well-formed markup.
+func extractHTML(data []byte) (string, error) {
+    src, err := extractPlainText(data)
+    if err != nil {
+        return "", err
+    }
+    // Only ASCII letters are lowered, so indexes into lower are valid in src
+    lower := strings.Map(func(r rune) rune {
+        if 'A' <= r && r <= 'Z' {
+            return r + 'a' - 'A'
+        }
+        return r
+    }, src)
+
+    var b strings.Builder
+    lineStart := true // no text since the last line break
+    for i := 0; i < len(src); {
+        if src[i] != '<' {
+            end := strings.IndexByte(src[i:], '<')
+            if end < 0 {
+                end = len(src) - i
+            }
+            // Line breaks of the source are insignificant
+            text := src[i : i+end]
+            if words := strings.Fields(html.UnescapeString(text)); len(words) > 0 {
+                b.WriteString(strings.Join(words, " "))
+                lineStart = false
+            }
+            if unicode.IsSpace(rune(text[len(text)-1])) {
+                b.WriteString(" ")
+            }
+            i += end
+            continue
+        }
+        if strings.HasPrefix(src[i:], "<!--") {
+            end := strings.Index(src[i+4:], "-->")
+            if end < 0 {
+                break
+            }
+            i += 4 + end + 3
+            continue
+        }
+        end := strings.IndexByte(src[i:], '>')
+        if end < 0 {
+            break
+        }
+        closing := lower[i+1] == '/'
+        tag := strings.TrimPrefix(lower[i+1:i+end], "/")
+        if n := strings.IndexAny(tag, " \t\r\n/"); n >= 0 {
+            tag = tag[:n]
+        }
+        i += end + 1
+        if !closing && (tag == "script" || tag == "style") {
+            // Skip the content up to the closing tag
+            close := strings.Index(lower[i:], "</"+tag)
+            if close < 0 {
+                break
+            }
+            i += close
+            continue
+        }
+        if htmlBlockElements[tag] {
+            if !lineStart {
+                b.WriteString("\n")
+                lineStart = true
+            }
+        } else {
+            b.WriteString(" ")
+        }
+    }
+    return b.String(), nil
+}
+
+// extractCSV returns the records of a CSV file, one per line with tabs
+// between the fields
+func extractCSV(data []byte) (string, error) {
+    src, err := extractPlainText(data)
+    if err != nil {
+        return "", err
+    }
+    r := csv.NewReader(strings.NewReader(src))
+    r.FieldsPerRecord = -1
+    r.LazyQuotes = true
+    var b strings.Builder
+    for {
+        record, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", fmt.Errorf("invalid CSV: %w", err)
+        }
+        b.WriteString(strings.Join(record, "\t"))
+        b.WriteString("\n")
+    }
+    return b.String(), nil
+}
+
+// extractJSON returns the values of a JSON document, one per line preceded
+// by their path, such as "items[0].name: Lamp"
+func extractJSON(data []byte) (string, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    var v interface{}
+    if err := dec.Decode(&v); err != nil {
+        return "", fmt.Errorf("invalid JSON: %w", err)
+    }
+
+    var b strings.Builder
+    var walk func(path string, v interface{})
+    walk = func(path string, v interface{}) {
+        switch v := v.(type) {
+        case map[string]interface{}:
+            keys := make([]string, 0, len(v))
+            for k := range v {
+                keys = append(keys, k)
+            }
+            sort.Strings(keys)
+            for _, k := range keys {
+                p := k
+                if path != "" {
+                    p = path + "." + k
+                }
+                walk(p, v[k])
+            }
+        case []interface{}:
+            for i, item := range v {
+                walk(fmt.Sprintf("%s[%d]", path, i), item)
+            }
+        case nil:
+        default:
+            if path != "" {
+                b.WriteString(path + ": ")
+            }
+            fmt.Fprintf(&b, "%v\n", v)
+        }
+    }
+    walk("", v)
+    return b.String(), nil
+}
+
+// extractDOCX returns the text of the main document of a Word file, one
+// paragraph per line
+func extractDOCX(data []byte, maxDecoded int64) (string, error) {
+    zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+    if err != nil {
+        return "", fmt.Errorf("invalid DOCX file: %w", err)
+    }
+    var document *zip.File
+    for _, f := range zr.File {
+        if f.Name == "word/document.xml" {
+            document = f
+        }
+    }
+    if document == nil {
+        return "", errors.New("invalid DOCX file: word/document.xml is missing")
+    }
+    // The zip reader fails on entries larger than they claim to be
+    if document.UncompressedSize64 > uint64(maxDecoded) {
+        return "", fmt.Errorf("the DOCX file decompresses to more than %d bytes", maxDecoded)
+    }
+    rc, err := document.Open()
+    if err != nil {
+        return "", fmt.Errorf("invalid DOCX file: %w", err)
+    }
+    defer rc.Close()
+
+    var b strings.Builder
+    dec := xml.NewDecoder(rc)
+    inText := false
+    for {
+        tok, err := dec.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", fmt.Errorf("invalid DOCX file: %w", err)
+        }
+        switch tok := tok.(type) {
+        case xml.StartElement:
+            switch tok.Name.Local {
+            case "t":
+                inText = true
+            case "tab":
+                b.WriteString("\t")
+            case "br", "cr":
+                b.WriteString("\n")
+            }
+        case xml.EndElement:
+            switch tok.Name.Local {
+            case "t":
+                inText = false
+            case "p":
+                b.WriteString("\n")
+            case "tc":
+                b.WriteString("\t")
+            }
+        case xml.CharData:
+            if inText {
+                b.Write(tok)
+            }
+        }
+    }
+    return b.String(), nil
+}
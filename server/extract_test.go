@@ -0,0 +1,129 @@
+package server
+
+import (
+    "archive/zip"
+    "bytes"
+    "compress/zlib"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// buildPDF returns a PDF file made of the given objects, numbered from 1.
+// Objects given as a []byte are streams, compressed with FlateDecode.
+func buildPDF(t *testing.T, objects ...interface{}) []byte {
+    t.Helper()
+    var b bytes.Buffer
+    b.WriteString("%PDF-1.4\n")
+    offsets := []int{}
+    for i, obj := range objects {
+        offsets = append(offsets, b.Len())
+        fmt.Fprintf(&b, "%d 0 obj\n", i+1)
+        switch obj := obj.(type) {
+        case string:
+            b.WriteString(obj)
+        case []byte:
+            var z bytes.Buffer
+            zw := zlib.NewWriter(&z)
+            zw.Write(obj)
+            zw.Close()
+            fmt.Fprintf(&b, "<< /Length %d /Filter /FlateDecode >>\nstream\n", z.Len())
+            b.Write(z.Bytes())
+            b.WriteString("\nendstream")
+        }
+        b.WriteString("\nendobj\n")
+    }
+    xref := b.Len()
+    fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+    for _, off := range offsets {
+        fmt.Fprintf(&b, "%010d 00000 n \n", off)
+    }
+    fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+    return b.Bytes()
+}
+
+func buildDOCX(t *testing.T, document string) []byte {
+    t.Helper()
+    var b bytes.Buffer
+    zw := zip.NewWriter(&b)
+    f, err := zw.Create("word/document.xml")
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + document + `</w:body></w:document>`))
+    zw.Close()
+    return b.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+    // A two page PDF: the first page uses a font with a ToUnicode map
+    // from two byte codes, the second a simple font
+    cmap := []byte(`/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <0048> <0002> <0069> endbfchar
+1 beginbfrange <0010> <0012> <0061> endbfrange
+endcmap`)
+    pdf := buildPDF(t,
+        "<< /Type /Catalog /Pages 2 0 R >>",
+        "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+        "<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+        "<< /Type /Page /Parent 2 0 R /Contents 8 0 R >>",
+        "<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 9 0 R >>",
+        "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+        []byte("BT /F1 12 Tf 72 700 Td <00010002> Tj 0 -14 Td [<0010> -300 <00110012>] TJ ET"),
+        []byte("BT /F2 12 Tf 72 700 Td (Second \\(page\\)) Tj T* (caf\\351) Tj ET"),
+        cmap,
+    )
+    // Streams and documents decompressing to more than maxDecoded bytes
+    const maxDecoded = 1 << 10
+    bomb := buildPDF(t,
+        "<< /Type /Catalog /Pages 2 0 R >>",
+        "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+        "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+        bytes.Repeat([]byte(" "), maxDecoded+1),
+    )
+
+    tests := []struct {
+        name    string
+        ext     string
+        data    []byte
+        want    string
+        wantErr string
+    }{
+        {"text", ".txt", []byte("\xef\xbb\xbfHello   world\r\n\n\n\nBye"), "Hello world\n\nBye", ""},
+        {"markdown", ".MD", []byte("# Title\n\nBody"), "# Title\n\nBody", ""},
+        {"invalid UTF-8", ".txt", []byte("caf\xe9"), "", "not valid UTF-8"},
+        {"html", ".html", []byte(`<html><head><title>T</title><style>p{}</style><script>var a = "<p>";</script></head><body><!-- note --><p>Fish &amp; <b>chips</b></p><ul><li>One</li><li>Two</li></ul></body></html>`), "T\nFish & chips\nOne\nTwo", ""},
+        {"csv", ".csv", []byte("name,price\n\"Lamp, red\",10\n"), "name price\nLamp, red 10", ""},
+        {"json", ".json", []byte(`{"name":"Lamp","tags":["red","new"],"stock":{"count":3,"ok":true,"note":null}}`), "name: Lamp\nstock.count: 3\nstock.ok: true\ntags[0]: red\ntags[1]: new", ""},
+        {"invalid json", ".json", []byte(`{"name":`), "", "invalid JSON"},
+        {"docx", ".docx", buildDOCX(t, `<w:p><w:r><w:t>Hello</w:t><w:tab/><w:t xml:space="preserve"> world</w:t></w:r></w:p><w:p><w:r><w:t>Second</w:t><w:br/><w:t>line</w:t></w:r></w:p>`), "Hello world\nSecond\nline", ""},
+        {"not a docx", ".docx", []byte("plain"), "", "invalid DOCX file"},
+        {"docx bomb", ".docx", buildDOCX(t, strings.Repeat(" ", maxDecoded)), "", "decompresses to more than 1024 bytes"},
+        {"pdf", ".pdf", pdf, "Hi\na bc\n\nSecond (page)\ncafé", ""},
+        {"pdf bomb", ".pdf", bomb, "", "decompresses to more than 1024 bytes"},
+        {"pdf without pages", ".pdf", []byte("%PDF-1.4"), "", "no pages"},
+        {"encrypted pdf", ".pdf", append(buildPDF(t, "<< /Type /Catalog >>"), "trailer << /Encrypt 5 0 R >>"...), "", "encrypted"},
+        {"not a pdf", ".pdf", []byte("hello"), "", "not a PDF file"},
+        {"no text", ".txt", []byte(" \n\t\n"), "", errNoText.Error()},
+        {"unsupported", ".png", []byte("png"), "", `not supported for ".png" files`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := extractText(tt.ext, tt.data, maxDecoded)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != tt.want {
+                t.Errorf("text = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+    "bytes"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "path"
+    "regexp"
+    "strings"
+)
+
+// sniffLength is how many bytes of a file its content type is detected
+// from, as many as http.DetectContentType considers
+const sniffLength = 512
+
+// maxFileTypes is the number of types a file type list may hold
+const maxFileTypes = 50
+
+// executableSignatures are the magic numbers of executables, which
+// http.DetectContentType does not know. Windows executables are checked by
+// hasPESignature.
+var executableSignatures = []struct {
+    magic       string
+    contentType string
+}{
+    {"\x7fELF", "application/x-elf"},
+    {"\xfe\xed\xfa\xce", "application/x-mach-binary"},
+    {"\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+    {"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+    {"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+    {"#!/", "text/x-shellscript"},
+}
+
+// peContentType is the content type of Windows executables
+const peContentType = "application/vnd.microsoft.portable-executable"
+
+// oleSignature starts the compound files of legacy Office documents and
+// Windows installers
+const oleSignature = "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"
+
+// executableExtensions are the extensions executables may honestly have.
+// Executable content under any other name is a disguised executable.
+var executableExtensions = map[string]bool{
+    ".exe": true, ".dll": true, ".com": true, ".msi": true, ".scr": true, ".sys": true,
+    ".so": true, ".dylib": true, ".bin": true, ".elf": true, ".out": true, ".app": true,
+    ".sh": true, ".bash": true, ".zsh": true, ".py": true, ".pl": true, ".rb": true,
+}
+
+// extensionTypes refine the generic types sniffed from text, ZIP archives
+// and compound files by the extension of the file name. The table is used
+// instead of mime.TypeByExtension, which depends on the system.
+var extensionTypes = map[string]string{
+    ".txt":      "text/plain",
+    ".md":       "text/markdown",
+    ".markdown": "text/markdown",
+    ".csv":      "text/csv",
+    ".json":     "application/json",
+    ".xml":      "application/xml",
+    ".yaml":     "application/yaml",
+    ".yml":      "application/yaml",
+    ".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+    ".xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+    ".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+    ".odt":      "application/vnd.oasis.opendocument.text",
+    ".epub":     "application/epub+zip",
+    ".doc":      "application/msword",
+    ".xls":      "application/vnd.ms-excel",
+    ".ppt":      "application/vnd.ms-powerpoint",
+}
+
+// detectContentType returns the MIME type of a file from the first
+// sniffLength bytes of its content, without parameters. The extension of
+// name only tells apart the formats sharing a generic container, such as
+// Markdown and plain text or Word and other ZIP archives.
+func detectContentType(name string, head []byte) string {
+    for _, sig := range executableSignatures {
+        if bytes.HasPrefix(head, []byte(sig.magic)) {
+            return sig.contentType
+        }
+    }
+    if hasPESignature(head) {
+        return peContentType
+    }
+
+    contentType := "application/x-ole-storage"
+    if !bytes.HasPrefix(head, []byte(oleSignature)) {
+        contentType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+    }
+    extType := extensionTypes[strings.ToLower(path.Ext(name))]
+    switch {
+    case contentType == "text/plain" && (strings.HasPrefix(extType, "text/") || isTextType(extType)),
+        contentType == "text/xml" && isTextType(extType),
+        contentType == "application/zip" && (strings.HasPrefix(extType, "application/vnd.") || extType == "application/epub+zip"),
+        contentType == "application/x-ole-storage" && strings.HasPrefix(extType, "application/"):
+        return extType
+    }
+    return contentType
+}
+
+// hasPESignature reports whether head starts a Windows executable: an MZ
+// header pointing at a PE header
+func hasPESignature(head []byte) bool {
+    if len(head) < 0x40 || !bytes.HasPrefix(head, []byte("MZ")) {
+        return false
+    }
+    offset := int(binary.LittleEndian.Uint32(head[0x3c:]))
+    return offset+4 <= len(head) && string(head[offset:offset+4]) == "PE\x00\x00"
+}
+
+// isTextType reports whether a type outside text/* holds text
+func isTextType(contentType string) bool {
+    switch contentType {
+    case "application/json", "application/xml", "application/yaml":
+        return true
+    }
+    return strings.HasSuffix(contentType, "+json") || strings.HasSuffix(contentType, "+xml")
+}
+
+// isExecutableType reports whether files of a type are programs
+func isExecutableType(contentType string) bool {
+    for _, sig := range executableSignatures {
+        if contentType == sig.contentType {
+            return true
+        }
+    }
+    return contentType == peContentType
+}
+
+// fileCategory groups a content type into image, video, audio, document or
+// unknown
+func fileCategory(contentType string) string {
+    switch {
+    case strings.HasPrefix(contentType, "image/"):
+        return "image"
+    case strings.HasPrefix(contentType, "video/"):
+        return "video"
+    case strings.HasPrefix(contentType, "audio/"):
+        return "audio"
+    case isExecutableType(contentType):
+        return "unknown"
+    case strings.HasPrefix(contentType, "text/"), isTextType(contentType),
+        contentType == "application/pdf", contentType == "application/msword", contentType == "application/epub+zip",
+        strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument."),
+        strings.HasPrefix(contentType, "application/vnd.oasis.opendocument."),
+        strings.HasPrefix(contentType, "application/vnd.ms-"):
+        return "document"
+    }
+    return "unknown"
+}
+
+// sniffFile detects the content type of a file of the store that is, or
+// will be, named name in its knowledge base
+func (s *Server) sniffFile(file, name string) (string, error) {
+    f, err := s.store.Open(file)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    head := make([]byte, sniffLength)
+    n, err := io.ReadFull(f, head)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return "", err
+    }
+    return detectContentType(name, head[:n]), nil
+}
+
+// FileTypePolicy limits the types of the files uploaded to a knowledge
+// base. Types are MIME types such as application/pdf, or families such as
+// image/*. A file is rejected if its type is denied, or if types are
+// allowed and its type is not one of them. Executables disguised by the
+// name of another type are always rejected.
+type FileTypePolicy struct {
+    AllowedTypes []string `json:"allowedTypes,omitempty"`
+    DeniedTypes  []string `json:"deniedTypes,omitempty"`
+}
+
+// fileTypePattern matches the entries of file type lists
+var fileTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9!#$&^_.+-]*/(\*|[a-z0-9][a-z0-9!#$&^_.+-]*)$`)
+
+// validateFileTypePolicy returns the problems of the type lists of a
+// policy, naming the fields after prefix
+func validateFileTypePolicy(prefix string, policy FileTypePolicy) []FieldError {
+    var errs []FieldError
+    lists := []struct {
+        field string
+        types []string
+    }{{"allowedTypes", policy.AllowedTypes}, {"deniedTypes", policy.DeniedTypes}}
+    for _, list := range lists {
+        if len(list.types) > maxFileTypes {
+            errs = append(errs, FieldError{Field: prefix + list.field, Message: fmt.Sprintf("must not hold more than %d types", maxFileTypes)})
+            continue
+        }
+        for i, t := range list.types {
+            if !fileTypePattern.MatchString(t) {
+                errs = append(errs, FieldError{Field: fmt.Sprintf("%s%s[%d]", prefix, list.field, i), Message: "must be a lowercase MIME type such as application/pdf or image/*"})
+            }
+        }
+    }
+    return errs
+}
+
+// matchesFileType reports whether contentType is one of types
+func matchesFileType(types []string, contentType string) bool {
+    for _, t := range types {
+        family, ok := strings.CutSuffix(t, "/*")
+        if t == contentType || ok && strings.HasPrefix(contentType, family+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// checkFileType returns why a file named name with content of contentType
+// may not be uploaded to a knowledge base, or "" if it may
+func checkFileType(knowledgeBase, name, contentType string, policy FileTypePolicy) string {
+    ext := strings.ToLower(path.Ext(name))
+    if isExecutableType(contentType) && !executableExtensions[ext] {
+        return fmt.Sprintf("File %q is an executable (%s) disguised by its name", name, contentType)
+    }
+    if matchesFileType(policy.DeniedTypes, contentType) ||
+        len(policy.AllowedTypes) > 0 && !matchesFileType(policy.AllowedTypes, contentType) {
+        return fmt.Sprintf("File %q has type %s, which knowledge base %q does not accept", name, contentType, knowledgeBase)
+    }
+    return ""
+}
+
+// FileTypePolicyResponse represents the structure of the response for the file type policy of a knowledge base
+type FileTypePolicyResponse struct {
+    KnowledgeBaseName string         `json:"knowledgeBaseName"`
+    Policy            FileTypePolicy `json:"policy"`
+}
+
+// Get File Type Policy Handler
+func (s *Server) getFileTypePolicyHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "knowledgeBaseName", titleRules) {
+        return
+    }
+    name := r.URL.Query().Get("knowledgeBaseName")
+
+    if !s.exists(knowledgeBaseDir(name)) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+    settings, err := s.knowledgeBaseSettings(name)
+    if err != nil {
+        http.Error(w, "Failed to read knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(FileTypePolicyResponse{KnowledgeBaseName: name, Policy: settings.FileTypes})
+}
+
+// UpdateFileTypePolicyRequest represents the structure of the incoming request for updating the file type policy of a knowledge base
+type UpdateFileTypePolicyRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    FileTypePolicy
+}
+
+// Update File Type Policy Handler. The policy applies to the files
+// uploaded from now on; files already in the knowledge base are kept.
+func (s *Server) updateFileTypePolicyHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var updateRequest UpdateFileTypePolicyRequest
+    if !decodeRequest(w, r, &updateRequest) {
+        return
+    }
+    if errs := validateFileTypePolicy("", updateRequest.FileTypePolicy); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+
+    name := updateRequest.KnowledgeBaseName
+    if !s.exists(knowledgeBaseDir(name)) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+    unlock := s.settingsLocks.Lock(name)
+    settings, err := s.knowledgeBaseSettings(name)
+    if err != nil {
+        unlock()
+        http.Error(w, "Failed to read knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+    settings.FileTypes = updateRequest.FileTypePolicy
+    data, _ := json.Marshal(settings)
+    err = s.writeMetaFile(knowledgeBaseSettingsPath(name), data)
+    unlock()
+    if err != nil {
+        http.Error(w, "Failed to write knowledge base settings", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(FileTypePolicyResponse{KnowledgeBaseName: name, Policy: settings.FileTypes})
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+    "encoding/binary"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// peHeader is the start of a Windows executable
+func peHeader() string {
+    head := make([]byte, 0x84)
+    copy(head, "MZ")
+    binary.LittleEndian.PutUint32(head[0x3c:], 0x80)
+    copy(head[0x80:], "PE\x00\x00")
+    return string(head)
+}
+
+func TestDetectContentType(t *testing.T) {
+    tests := []struct {
+        name    string
+        content string
+        want    string
+    }{
+        {"notes.txt", "plain words", "text/plain"},
+        {"notes.md", "# Heading", "text/markdown"},
+        {"data.json", `{"a":1}`, "application/json"},
+        {"guide.pdf", "%PDF-1.4", "application/pdf"},
+        {"diagram.png", "\x89PNG\r\n\x1a\n", "image/png"},
+        {"photo.txt", "\x89PNG\r\n\x1a\n", "image/png"},
+        {"report.docx", "PK\x03\x04rest of the archive", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+        {"archive.zip", "PK\x03\x04rest of the archive", "application/zip"},
+        {"legacy.doc", oleSignature, "application/msword"},
+        {"report.pdf", "\x7fELF\x02\x01\x01", "application/x-elf"},
+        {"setup.exe", peHeader(), peContentType},
+        {"MZ.txt", "MZ is not a program", "text/plain"},
+        {"run.txt", "#!/bin/sh\necho hi", "text/x-shellscript"},
+        {"blob", "\x00\x01\x02\x03", "application/octet-stream"},
+    }
+    for _, tt := range tests {
+        if got := detectContentType(tt.name, []byte(tt.content)); got != tt.want {
+            t.Errorf("detectContentType(%q, %q) = %q, want %q", tt.name, tt.content, got, tt.want)
+        }
+    }
+}
+
+func TestCheckFileType(t *testing.T) {
+    policy := FileTypePolicy{AllowedTypes: []string{"text/*", "application/pdf", peContentType}, DeniedTypes: []string{"text/csv"}}
+    tests := []struct {
+        name        string
+        contentType string
+        policy      FileTypePolicy
+        want        string
+    }{
+        {"notes.md", "text/markdown", policy, ""},
+        {"data.csv", "text/csv", policy, `File "data.csv" has type text/csv, which knowledge base "KB" does not accept`},
+        {"photo.png", "image/png", policy, `File "photo.png" has type image/png, which knowledge base "KB" does not accept`},
+        {"photo.png", "image/png", FileTypePolicy{}, ""},
+        {"setup.exe", peContentType, policy, ""},
+        {"report.pdf", peContentType, FileTypePolicy{}, `File "report.pdf" is an executable (` + peContentType + `) disguised by its name`},
+    }
+    for _, tt := range tests {
+        if got := checkFileType("KB", tt.name, tt.contentType, tt.policy); got != tt.want {
+            t.Errorf("checkFileType(%q, %q, %+v) = %q, want %q", tt.name, tt.contentType, tt.policy, got, tt.want)
+        }
+    }
+}
+
+func TestFileTypePolicy(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "update",
+            method: http.MethodPut,
+            target: "/update-file-type-policy",
+            body:   `{"knowledgeBaseName":"Reviewer","allowedTypes":["text/*","application/pdf"],"deniedTypes":["text/html"]}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                rec = serve(s, http.MethodGet, "/get-file-type-policy?knowledgeBaseName=Reviewer", "")
+                var got FileTypePolicyResponse
+                decodeBody(t, rec, &got)
+                if strings.Join(got.Policy.AllowedTypes, ",") != "text/*,application/pdf" || strings.Join(got.Policy.DeniedTypes, ",") != "text/html" {
+                    t.Errorf("policy = %+v", got.Policy)
+                }
+                // The chunking settings are kept
+                settings, _ := s.knowledgeBaseSettings("Reviewer")
+                if settings.Chunking != defaultChunkingSettings {
+                    t.Errorf("chunking settings = %+v", settings.Chunking)
+                }
+            },
+        },
+        {
+            name:   "invalid type",
+            method: http.MethodPut,
+            target: "/update-file-type-policy",
+            body:   `{"knowledgeBaseName":"Reviewer","allowedTypes":["text/*","PDF"]}`,
+            status: http.StatusBadRequest,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                if !strings.Contains(rec.Body.String(), `"field":"allowedTypes[1]"`) {
+                    t.Errorf("body = %s", rec.Body.String())
+                }
+            },
+        },
+        {name: "missing knowledge base", method: http.MethodPut, target: "/update-file-type-policy", body: `{"knowledgeBaseName":"Recipes"}`, status: http.StatusNotFound},
+        {name: "get default", method: http.MethodGet, target: "/get-file-type-policy?knowledgeBaseName=Manuals", status: http.StatusOK},
+    })
+}
+
+func TestUploadFileTypes(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := serve(s, http.MethodPut, "/update-file-type-policy", `{"knowledgeBaseName":"Reviewer","allowedTypes":["text/*"]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("update policy: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+
+    tests := []struct {
+        name    string
+        content string
+        status  int
+        body    string
+    }{
+        {"notes.md", "# Notes", http.StatusOK, `"contentType":"text/markdown"`},
+        {"photo.txt", "\x89PNG\r\n\x1a\n", http.StatusUnsupportedMediaType, `File "photo.txt" has type image/png, which knowledge base "Reviewer" does not accept`},
+        {"manual.txt", peHeader(), http.StatusUnsupportedMediaType, "is an executable (application/vnd.microsoft.portable-executable) disguised by its name"},
+    }
+    for _, tt := range tests {
+        rec := httptest.NewRecorder()
+        s.ServeHTTP(rec, filesUploadRequest(t, "/upload?title=Reviewer", tt.name, tt.content))
+        if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.body) {
+            t.Errorf("upload %s: got %d %q, want %d containing %q", tt.name, rec.Code, rec.Body.String(), tt.status, tt.body)
+        }
+        if tt.status != http.StatusOK {
+            wantMissing(t, s, knowledgeFile("Reviewer", tt.name))
+        }
+    }
+    wantNoUploads(t, s, "Reviewer")
+
+    // Resumable uploads are checked when they are finalized
+    session := createUpload(t, s, "manual.txt", peHeader())
+    sendChunk(s, session.UploadID, 0, peHeader())
+    if rec := finalizeUpload(s, session.UploadID); rec.Code != http.StatusUnsupportedMediaType {
+        t.Errorf("finalize disguised executable: status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+    }
+    wantMissing(t, s, knowledgeFile("Reviewer", "manual.txt"))
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestListFilesContentTypes(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := serve(s, http.MethodPost, "/list-files-knowledgebase", `{"knowledgeBaseName":"Manuals"}`)
+    var got ListFilesResponse
+    decodeBody(t, rec, &got)
+    want := map[string]FileInfoResponse{
+        "guide.pdf":   {Type: "document", ContentType: "application/pdf", Size: 8},
+        "diagram.png": {Type: "image", ContentType: "image/png", Size: 8},
+    }
+    if len(got.Files) != len(want) {
+        t.Fatalf("files = %+v", got.Files)
+    }
+    for _, f := range got.Files {
+        w := want[f.Name]
+        if f.Type != w.Type || f.ContentType != w.ContentType || f.Size != w.Size {
+            t.Errorf("%s = %s %s %d bytes, want %s %s %d bytes", f.Name, f.Type, f.ContentType, f.Size, w.Type, w.ContentType, w.Size)
+        }
+    }
+
+    // The detected type is kept with the file until the file changes
+    if _, err := s.store.ReadFile(fileMetadataPath("Manuals", "guide.pdf")); err != nil {
+        t.Errorf("metadata of guide.pdf: %v", err)
+    }
+    s.store.WriteFile(knowledgeFile("Manuals", "guide.pdf"), []byte("\x89PNG\r\n\x1a\n and more"))
+    meta, err := s.fileMetadata("Manuals", "guide.pdf")
+    if err != nil || meta.ContentType != "image/png" || meta.Size != 17 {
+        t.Errorf("metadata after change = %+v, %v", meta, err)
+    }
+}
+
+func TestUpdateSettingsConcurrently(t *testing.T) {
+    s := newFixtureServer(t)
+    var wg sync.WaitGroup
+    for range 4 {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            serve(s, http.MethodPut, "/update-file-type-policy", `{"knowledgeBaseName":"Reviewer","deniedTypes":["image/*"]}`)
+        }()
+        go func() {
+            defer wg.Done()
+            serve(s, http.MethodPut, "/update-chunking-settings", `{"knowledgeBaseName":"Reviewer","strategy":"sentence"}`)
+        }()
+    }
+    wg.Wait()
+
+    // Neither update loses the other's settings
+    settings, err := s.knowledgeBaseSettings("Reviewer")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(settings.FileTypes.DeniedTypes) != 1 || settings.Chunking.Strategy != "sentence" {
+        t.Errorf("settings = %+v", settings)
+    }
+}
@@ -0,0 +1,604 @@
+package server
+
+import (
+    "cmp"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net/http"
+    "path"
+    "slices"
+    "strconv"
+    "strings"
+)
+
+// ChatHistoryResponse represents the structure of the response for chat history
+type ChatHistoryResponse struct {
+    Files []string `json:"files"`
+}
+
+// Chat History Handler
+func (s *Server) chatHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    // Define the path to the History directory
+    historyDir := path.Join(".", "History")
+
+    // Read the directory
+    files, err := s.store.ReadDir(historyDir)
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, "Failed to read History directory", http.StatusInternalServerError)
+        return
+    }
+
+    jsonFiles := []string{}
+    for _, file := range files {
+        if !file.IsDir() && path.Ext(file.Name()) == ".json" { // Only process JSON files
+            jsonFiles = append(jsonFiles, file.Name())
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ChatHistoryResponse{Files: jsonFiles})
+}
+// Conversation listing parameters
+const (
+    defaultListLimit   = 50
+    listSortRules      = "oneof=updatedAt|createdAt|title"
+    listOrderRules     = "oneof=asc|desc"
+    listLimitRules     = "range=1|200"
+    listCursorRules    = "max=1000"
+    listAssistantRules = "max=100,charset=name"
+)
+
+// ListConversationsResponse represents the structure of the response for listing conversations
+type ListConversationsResponse struct {
+    Conversations []ConversationSummary `json:"conversations"`
+    // NextCursor is passed as cursor to fetch the next page, it is empty on
+    // the last page
+    NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// listCursor is the position after which the next page of a listing
+// starts. It is handed to clients base64 encoded and is only valid for the
+// sort and order it was created for.
+type listCursor struct {
+    Sort  string `json:"s"`
+    Order string `json:"o"`
+    Key   string `json:"k"`
+    ID    string `json:"i"`
+}
+
+func (c listCursor) String() string {
+    data, _ := json.Marshal(c)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseListCursor(s string) (listCursor, bool) {
+    var c listCursor
+    data, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil || json.Unmarshal(data, &c) != nil {
+        return c, false
+    }
+    return c, true
+}
+
+// listSortKey returns the value a conversation is sorted by, as a string
+// that sorts the same way
+func listSortKey(c ConversationSummary, sort string) string {
+    switch sort {
+    case "createdAt":
+        return c.CreatedAt.UTC().Format("20060102150405.000000000")
+    case "title":
+        return strings.ToLower(c.Title)
+    default:
+        return c.UpdatedAt.UTC().Format("20060102150405.000000000")
+    }
+}
+
+// listPosition orders conversations by sort key, and by assistant and ID
+// to keep pages stable when keys are equal
+type listPosition struct {
+    key, id string
+}
+
+func (p listPosition) compare(q listPosition, order string) int {
+    c := cmp.Or(cmp.Compare(p.key, q.key), cmp.Compare(p.id, q.id))
+    if order == "desc" {
+        return -c
+    }
+    return c
+}
+
+func positionOf(c ConversationSummary, sort string) listPosition {
+    return listPosition{key: listSortKey(c, sort), id: c.Assistant + "/" + c.ID}
+}
+
+// List Conversations Handler
+func (s *Server) listConversationsHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "assistant", listAssistantRules) ||
+        !validateQuery(w, r, "sort", listSortRules) ||
+        !validateQuery(w, r, "order", listOrderRules) ||
+        !validateQuery(w, r, "limit", listLimitRules) ||
+        !validateQuery(w, r, "cursor", listCursorRules) {
+        return
+    }
+
+    query := r.URL.Query()
+    sortBy := cmp.Or(query.Get("sort"), "updatedAt")
+    order := query.Get("order")
+    if order == "" {
+        // Newest first, titles alphabetically
+        order = "desc"
+        if sortBy == "title" {
+            order = "asc"
+        }
+    }
+    limit := defaultListLimit
+    if l := query.Get("limit"); l != "" {
+        limit, _ = strconv.Atoi(l)
+    }
+
+    var after *listPosition
+    if c := query.Get("cursor"); c != "" {
+        cursor, ok := parseListCursor(c)
+        if !ok || cursor.Sort != sortBy || cursor.Order != order {
+            writeJSONError(w, http.StatusBadRequest, ErrorResponse{
+                Error:  "Invalid request",
+                Fields: []FieldError{{Field: "cursor", Message: "is not a cursor of this listing"}},
+            })
+            return
+        }
+        after = &listPosition{key: cursor.Key, id: cursor.ID}
+    }
+
+    var assistants []string
+    if assistant := query.Get("assistant"); assistant != "" {
+        if assistant != defaultAssistant && !s.exists(path.Join("assistants", assistant)) {
+            http.Error(w, "Assistant not found", http.StatusNotFound)
+            return
+        }
+        assistants = append(assistants, assistant)
+    }
+
+    summaries, err := s.listConversations(assistants...)
+    if err != nil {
+        http.Error(w, "Failed to list conversations", http.StatusInternalServerError)
+        return
+    }
+    slices.SortFunc(summaries, func(a, b ConversationSummary) int {
+        return positionOf(a, sortBy).compare(positionOf(b, sortBy), order)
+    })
+
+    // Skip to the first conversation after the cursor
+    start := 0
+    if after != nil {
+        start, _ = slices.BinarySearchFunc(summaries, *after, func(c ConversationSummary, p listPosition) int {
+            if positionOf(c, sortBy).compare(p, order) <= 0 {
+                return -1
+            }
+            return 1
+        })
+    }
+    page := summaries[start:min(start+limit, len(summaries))]
+
+    resp := ListConversationsResponse{Conversations: page}
+    if start+limit < len(summaries) {
+        last := positionOf(page[len(page)-1], sortBy)
+        resp.NextCursor = listCursor{Sort: sortBy, Order: order, Key: last.key, ID: last.id}.String()
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// CreateHistoryRequest represents the structure of the incoming request for creating history
+type CreateHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+}
+
+// CreateHistoryResponse represents the structure of the response for creating history
+type CreateHistoryResponse struct {
+    Message string `json:"message"`
+    FileID  string `json:"fileID"`
+}
+
+// Create History Handler
+// Create History Handler
+func (s *Server) createHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var createRequest CreateHistoryRequest
+    if !decodeRequest(w, r, &createRequest) {
+        return
+    }
+
+    if createRequest.AssistantTitle != defaultAssistant && !s.exists(path.Join("assistants", createRequest.AssistantTitle)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+
+    // Create the History directory if it doesn't exist
+    err := s.store.MkdirAll(historyDir(createRequest.AssistantTitle))
+    if err != nil {
+        http.Error(w, "Failed to create History directory", http.StatusInternalServerError)
+        return
+    }
+
+    // Generate a unique ID for the JSON file
+    fileID := s.newID()
+
+    // Create an empty conversation
+    err = s.saveConversation(s.newConversation(fileID, createRequest.AssistantTitle))
+    if err != nil {
+        http.Error(w, "Failed to create JSON file", http.StatusInternalServerError)
+        return
+    }
+
+    // Respond with success message and file ID
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(CreateHistoryResponse{
+        Message: "History file created successfully",
+        FileID:  fileID,
+    })
+}
+
+// DeleteHistoryRequest represents the structure of the incoming request for deleting history
+type DeleteHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    ChatHistoryID  string `json:"chatHistoryID" validate:"required,max=64,charset=id"`
+}
+
+// DeleteHistoryResponse represents the structure of the response for deleting history
+type DeleteHistoryResponse struct {
+    Message string `json:"message"`
+}
+
+// Delete History Handler
+func (s *Server) deleteHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodDelete {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var deleteRequest DeleteHistoryRequest
+    if !decodeRequest(w, r, &deleteRequest) {
+        return
+    }
+
+    // Delete the JSON file, waiting for changes in progress so they do not
+    // write it back
+    unlock := s.lockConversation(deleteRequest.AssistantTitle, deleteRequest.ChatHistoryID)
+    err := s.store.Remove(historyPath(deleteRequest.AssistantTitle, deleteRequest.ChatHistoryID))
+    unlock()
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to delete history file")
+        return
+    }
+
+    // Respond with success message
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(DeleteHistoryResponse{Message: "History file deleted successfully"})
+}
+
+// UpdateChatContextRequest represents the structure of the incoming request for updating chat context
+type UpdateChatContextRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    Context        string `json:"context" validate:"required"` // JSON encoded Conversation
+}
+
+// UpdateChatContextResponse represents the structure of the response for updating chat context
+type UpdateChatContextResponse struct {
+    Message string `json:"message"`
+}
+
+// Update Chat Context Handler
+func (s *Server) updateChatContextHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    // Extract the history ID from the URL
+    historyID := strings.TrimPrefix(r.URL.Path, "/update-chat-context/")
+    if errs := validateValue("historyID", historyID, historyIDRules); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+
+    var updateRequest UpdateChatContextRequest
+    if !decodeRequest(w, r, &updateRequest) {
+        return
+    }
+
+    // The context must be a conversation document
+    update, errs := parseConversation(updateRequest.Context)
+    if len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid conversation", Fields: errs})
+        return
+    }
+
+    unlock := s.lockConversation(updateRequest.AssistantTitle, historyID)
+    defer unlock()
+
+    conversation, err := s.loadConversation(updateRequest.AssistantTitle, historyID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+
+    // Refuse to overwrite changes the client has not seen
+    if !etagMatches(r.Header.Get("If-Match"), conversationETag(conversation)) {
+        http.Error(w, "History was modified since it was fetched", http.StatusPreconditionFailed)
+        return
+    }
+
+    // The server owns the identity and timestamps of the conversation
+    s.completeMessages(update.Messages)
+    conversation.Version = conversationVersion
+    conversation.Title = update.Title
+    conversation.Messages = update.Messages
+    if update.Branches != nil {
+        conversation.Branches = update.Branches
+    }
+    conversation.Metadata = update.Metadata
+    conversation.UpdatedAt = s.now().UTC()
+
+    // Update the JSON file with the new context
+    err = s.saveConversation(conversation)
+    if err != nil {
+        http.Error(w, "Failed to update chat context", http.StatusInternalServerError)
+        return
+    }
+
+    // Respond with success message
+    w.Header().Set("ETag", conversationETag(conversation))
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(UpdateChatContextResponse{Message: "Chat context updated successfully"})
+}
+// FetchHistoryRequest represents the structure of the incoming request for fetching history data
+type FetchHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    HistoryID      string `json:"historyID" validate:"required,max=64,charset=id"`
+}
+
+// FetchHistoryResponse represents the structure of the response for fetching history data
+type FetchHistoryResponse struct {
+    Context      string        `json:"context"`
+    Conversation *Conversation `json:"conversation"`
+    // Siblings lists, for every message of the active branch that was
+    // edited, the IDs of all its versions in creation order
+    Siblings map[string][]string `json:"siblings,omitempty"`
+}
+
+// Fetch History Handler
+func (s *Server) fetchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var fetchRequest FetchHistoryRequest
+    if !decodeRequest(w, r, &fetchRequest) {
+        return
+    }
+
+    // Read the conversation
+    conversation, err := s.loadConversation(fetchRequest.AssistantTitle, fetchRequest.HistoryID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+    data, err := json.Marshal(conversation)
+    if err != nil {
+        http.Error(w, "Failed to encode history", http.StatusInternalServerError)
+        return
+    }
+
+    // Respond with the conversation, both as document and as string for
+    // clients written against the free-form history files
+    w.Header().Set("ETag", conversationETag(conversation))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(FetchHistoryResponse{
+        Context:      string(data),
+        Conversation: conversation,
+        Siblings:     messageSiblings(conversation),
+    })
+}
+
+// RenameHistoryRequest represents the structure of the incoming request for renaming a chat history
+type RenameHistoryRequest struct {
+    AssistantTitle string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    HistoryID      string `json:"historyID" validate:"required,max=64,charset=id"`
+    Title          string `json:"title" validate:"required,max=100"`
+}
+
+// Rename History Handler sets the title of a chat history. Manually set
+// titles are not replaced by generated ones.
+func (s *Server) renameHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var renameRequest RenameHistoryRequest
+    if !decodeRequest(w, r, &renameRequest) {
+        return
+    }
+
+    unlock := s.lockConversation(renameRequest.AssistantTitle, renameRequest.HistoryID)
+    defer unlock()
+
+    conversation, err := s.loadConversation(renameRequest.AssistantTitle, renameRequest.HistoryID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+
+    if !etagMatches(r.Header.Get("If-Match"), conversationETag(conversation)) {
+        http.Error(w, "History was modified since it was fetched", http.StatusPreconditionFailed)
+        return
+    }
+
+    conversation.Version = conversationVersion
+    conversation.Title = renameRequest.Title
+    if conversation.Metadata == nil {
+        conversation.Metadata = map[string]interface{}{}
+    }
+    conversation.Metadata["titleSource"] = titleSourceManual
+    conversation.UpdatedAt = s.now().UTC()
+
+    err = s.saveConversation(conversation)
+    if err != nil {
+        http.Error(w, "Failed to update history file", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("ETag", conversationETag(conversation))
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "History renamed successfully"})
+}
+
+// AppendMessagesRequest represents the structure of the incoming request for appending messages to a history
+type AppendMessagesRequest struct {
+    AssistantTitle string    `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    HistoryID      string    `json:"historyID" validate:"required,max=64,charset=id"`
+    Messages       []Message `json:"messages"`
+    // AfterMessageID, if set, must be the ID of the last message of the
+    // history, otherwise the messages are not appended
+    AfterMessageID string `json:"afterMessageID,omitempty" validate:"max=64,charset=id"`
+    // EditMessageID, if set, is the ID of a message of the active branch
+    // the messages replace. They start a new branch next to it, which
+    // becomes the active branch; the message and its replies are kept in
+    // the old branch.
+    EditMessageID string `json:"editMessageID,omitempty" validate:"max=64,charset=id"`
+}
+
+// AppendMessagesResponse represents the structure of the response for appending messages to a history
+type AppendMessagesResponse struct {
+    Message    string   `json:"message"`
+    MessageIDs []string `json:"messageIDs"`
+}
+
+// Append Messages Handler
+func (s *Server) appendMessagesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var appendRequest AppendMessagesRequest
+    if !decodeRequest(w, r, &appendRequest) {
+        return
+    }
+
+    var errs []FieldError
+    if len(appendRequest.Messages) == 0 {
+        errs = append(errs, FieldError{Field: "messages", Message: "must contain at least one message"})
+    }
+    seen := map[string]bool{}
+    for i, m := range appendRequest.Messages {
+        field := fmt.Sprintf("messages[%d]", i)
+        errs = append(errs, validateMessage(field, m)...)
+        if m.ID != "" && seen[m.ID] {
+            errs = append(errs, FieldError{Field: field + ".id", Message: "must be unique within the conversation"})
+        }
+        seen[m.ID] = true
+    }
+    if appendRequest.AfterMessageID != "" && appendRequest.EditMessageID != "" {
+        errs = append(errs, FieldError{Field: "editMessageID", Message: "cannot be combined with afterMessageID"})
+    }
+    if len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+
+    unlock := s.lockConversation(appendRequest.AssistantTitle, appendRequest.HistoryID)
+    defer unlock()
+
+    conversation, err := s.loadConversation(appendRequest.AssistantTitle, appendRequest.HistoryID)
+    if err != nil {
+        writeStoreError(w, err, "History not found", "Failed to read history file")
+        return
+    }
+
+    if !etagMatches(r.Header.Get("If-Match"), conversationETag(conversation)) {
+        http.Error(w, "History was modified since it was fetched", http.StatusPreconditionFailed)
+        return
+    }
+    if appendRequest.AfterMessageID != "" {
+        last := ""
+        if n := len(conversation.Messages); n > 0 {
+            last = conversation.Messages[n-1].ID
+        }
+        if last != appendRequest.AfterMessageID {
+            http.Error(w, "History has messages after "+appendRequest.AfterMessageID, http.StatusConflict)
+            return
+        }
+    }
+    for _, m := range appendRequest.Messages {
+        if m.ID != "" && hasMessage(conversation, m.ID) {
+            http.Error(w, "History already has a message with ID "+m.ID, http.StatusConflict)
+            return
+        }
+    }
+    if appendRequest.EditMessageID != "" {
+        linkMessages(conversation)
+        if !branchAt(conversation, appendRequest.EditMessageID) {
+            http.Error(w, "History has no message "+appendRequest.EditMessageID+" in its active branch", http.StatusConflict)
+            return
+        }
+    }
+
+    s.completeMessages(appendRequest.Messages)
+    messageIDs := make([]string, len(appendRequest.Messages))
+    for i, m := range appendRequest.Messages {
+        messageIDs[i] = m.ID
+    }
+    conversation.Version = conversationVersion
+    conversation.Messages = append(conversation.Messages, appendRequest.Messages...)
+    conversation.UpdatedAt = s.now().UTC()
+    s.autoTitle(conversation)
+
+    err = s.saveConversation(conversation)
+    if err != nil {
+        http.Error(w, "Failed to update history file", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("ETag", conversationETag(conversation))
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(AppendMessagesResponse{
+        Message:    "Messages appended successfully",
+        MessageIDs: messageIDs,
+    })
+}
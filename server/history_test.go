@@ -0,0 +1,604 @@
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+    "unicode/utf8"
+)
+
+const (
+    rootHistoryID     = "a16ba0d9-1e57-4db1-aa42-eec315130c8e"
+    reviewerHistoryID = "5d4c3b2a-1e57-4db1-aa42-eec315130c8e"
+)
+
+func TestHistoryHandlers(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "list",
+            method: http.MethodGet,
+            target: "/chat-history",
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got ChatHistoryResponse
+                decodeBody(t, rec, &got)
+                if want := []string{rootHistoryID + ".json"}; !reflect.DeepEqual(got.Files, want) {
+                    t.Errorf("files = %v, want %v", got.Files, want)
+                }
+            },
+        },
+        {
+            name:   "create for Lets Chat",
+            method: http.MethodPost,
+            target: "/create-history",
+            body:   `{"assistantTitle":"Lets Chat"}`,
+            status: http.StatusCreated,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got CreateHistoryResponse
+                decodeBody(t, rec, &got)
+                c := readConversation(t, s, "Lets Chat", got.FileID)
+                want := &Conversation{
+                    Version:   conversationVersion,
+                    ID:        got.FileID,
+                    Assistant: "Lets Chat",
+                    CreatedAt: s.now(),
+                    UpdatedAt: s.now(),
+                    Messages:  []Message{},
+                }
+                if !reflect.DeepEqual(c, want) {
+                    t.Errorf("conversation = %+v, want %+v", c, want)
+                }
+            },
+        },
+        {
+            name:   "create for assistant",
+            method: http.MethodPost,
+            target: "/create-history",
+            body:   `{"assistantTitle":"Writer"}`,
+            status: http.StatusCreated,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got CreateHistoryResponse
+                decodeBody(t, rec, &got)
+                if c := readConversation(t, s, "Writer", got.FileID); c.ID != got.FileID || c.Assistant != "Writer" {
+                    t.Errorf("conversation = %+v", c)
+                }
+            },
+        },
+        {
+            name:   "create for missing assistant",
+            method: http.MethodPost,
+            target: "/create-history",
+            body:   `{"assistantTitle":"Nobody"}`,
+            status: http.StatusNotFound,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "assistants/Nobody")
+            },
+        },
+        {
+            name:   "fetch",
+            method: http.MethodPost,
+            target: "/fetch-history",
+            body:   `{"assistantTitle":"Reviewer","historyID":"` + reviewerHistoryID + `"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got FetchHistoryResponse
+                decodeBody(t, rec, &got)
+                if got.Conversation == nil || got.Conversation.ID != reviewerHistoryID || got.Conversation.Version != conversationVersion {
+                    t.Fatalf("conversation = %+v", got.Conversation)
+                }
+                var fromContext Conversation
+                if err := json.Unmarshal([]byte(got.Context), &fromContext); err != nil || !reflect.DeepEqual(&fromContext, got.Conversation) {
+                    t.Errorf("context %q does not hold the conversation (%v)", got.Context, err)
+                }
+            },
+        },
+        {
+            name:   "fetch from the wrong assistant",
+            method: http.MethodPost,
+            target: "/fetch-history",
+            body:   `{"assistantTitle":"Lets Chat","historyID":"` + reviewerHistoryID + `"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "update",
+            method: http.MethodPut,
+            target: "/update-chat-context/" + rootHistoryID,
+            body:   `{"assistantTitle":"Lets Chat","context":"{\"title\":\"Greeting\",\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}]}"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                c := readConversation(t, s, "Lets Chat", rootHistoryID)
+                if c.Version != conversationVersion || c.ID != rootHistoryID || c.Title != "Greeting" || !c.UpdatedAt.Equal(s.now()) {
+                    t.Errorf("conversation = %+v", c)
+                }
+                if len(c.Messages) != 1 || c.Messages[0].ID == "" || c.Messages[0].CreatedAt.IsZero() || c.Messages[0].Content != "hi" {
+                    t.Errorf("messages = %+v, want one completed message", c.Messages)
+                }
+            },
+        },
+        {
+            name:   "update with invalid conversation",
+            method: http.MethodPut,
+            target: "/update-chat-context/" + rootHistoryID,
+            body:   `{"assistantTitle":"Lets Chat","context":"{\"messages\":[{\"role\":\"robot\",\"content\":\"hi\"}]}"}`,
+            status: http.StatusBadRequest,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var resp ErrorResponse
+                decodeBody(t, rec, &resp)
+                if len(resp.Fields) != 1 || resp.Fields[0].Field != "context.messages[0].role" {
+                    t.Errorf("fields = %+v", resp.Fields)
+                }
+                wantFile(t, s, "History/"+rootHistoryID+".json", "{}")
+            },
+        },
+        {
+            name:   "update with free-form context",
+            method: http.MethodPut,
+            target: "/update-chat-context/" + rootHistoryID,
+            body:   `{"assistantTitle":"Lets Chat","context":"hello"}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "update missing",
+            method: http.MethodPut,
+            target: "/update-chat-context/00000000-0000-0000-0000-000000000000",
+            body:   `{"assistantTitle":"Lets Chat","context":"{}"}`,
+            status: http.StatusNotFound,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "History/00000000-0000-0000-0000-000000000000.json")
+            },
+        },
+        {
+            name:   "delete",
+            method: http.MethodDelete,
+            target: "/delete-history",
+            body:   `{"assistantTitle":"Reviewer","chatHistoryID":"` + reviewerHistoryID + `"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "assistants/Reviewer/History/"+reviewerHistoryID+".json")
+            },
+        },
+        {
+            name:   "delete missing",
+            method: http.MethodDelete,
+            target: "/delete-history",
+            body:   `{"assistantTitle":"Writer","chatHistoryID":"` + reviewerHistoryID + `"}`,
+            status: http.StatusNotFound,
+        },
+    })
+}
+
+func TestChatHistoryEmpty(t *testing.T) {
+    rec := serve(newTestServer(t), http.MethodGet, "/chat-history", "")
+    if rec.Code != http.StatusOK || rec.Body.String() != `{"files":[]}`+"\n" {
+        t.Errorf("got %d %q, want an empty list", rec.Code, rec.Body.String())
+    }
+}
+
+// TestHistoryLifecycle walks a history through every endpoint in the order
+// a frontend uses them
+func TestHistoryLifecycle(t *testing.T) {
+    for _, assistant := range []string{"Lets Chat", "Reviewer"} {
+        t.Run(assistant, func(t *testing.T) {
+            s := newFixtureServer(t)
+
+            rec := serve(s, http.MethodPost, "/create-history", `{"assistantTitle":"`+assistant+`"}`)
+            if rec.Code != http.StatusCreated {
+                t.Fatalf("create: status = %d", rec.Code)
+            }
+            var created CreateHistoryResponse
+            decodeBody(t, rec, &created)
+            id := created.FileID
+
+            fetch := func() *httptest.ResponseRecorder {
+                return serve(s, http.MethodPost, "/fetch-history", `{"assistantTitle":"`+assistant+`","historyID":"`+id+`"}`)
+            }
+
+            rec = fetch()
+            var fetched FetchHistoryResponse
+            decodeBody(t, rec, &fetched)
+            if rec.Code != http.StatusOK || len(fetched.Conversation.Messages) != 0 {
+                t.Fatalf("fetch new history: %d %q", rec.Code, fetched.Context)
+            }
+
+            // Clients send back what they fetched with their changes applied
+            fetched.Conversation.Messages = append(fetched.Conversation.Messages, Message{Role: RoleUser, Content: "hi"})
+            context, _ := json.Marshal(fetched.Conversation)
+            update, _ := json.Marshal(UpdateChatContextRequest{AssistantTitle: assistant, Context: string(context)})
+            rec = serve(s, http.MethodPut, "/update-chat-context/"+id, string(update))
+            if rec.Code != http.StatusOK {
+                t.Fatalf("update: status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+
+            rec = fetch()
+            decodeBody(t, rec, &fetched)
+            if len(fetched.Conversation.Messages) != 1 || fetched.Conversation.Messages[0].Content != "hi" {
+                t.Fatalf("fetch after update = %q", fetched.Context)
+            }
+
+            rec = serve(s, http.MethodDelete, "/delete-history", `{"assistantTitle":"`+assistant+`","chatHistoryID":"`+id+`"}`)
+            if rec.Code != http.StatusOK {
+                t.Fatalf("delete: status = %d", rec.Code)
+            }
+            if rec = fetch(); rec.Code != http.StatusNotFound {
+                t.Errorf("fetch after delete: status = %d, want %d", rec.Code, http.StatusNotFound)
+            }
+        })
+    }
+}
+
+// readConversation reads a stored chat history
+func readConversation(t *testing.T, s *Server, assistant, id string) *Conversation {
+    t.Helper()
+    c, err := s.loadConversation(assistant, id)
+    if err != nil {
+        t.Fatalf("loadConversation(%s, %s): %v", assistant, id, err)
+    }
+    return c
+}
+
+// newConversationFixture stores a conversation with two messages as the
+// root history and returns its ETag
+func newConversationFixture(t *testing.T, s *Server) string {
+    t.Helper()
+    c := s.newConversation(rootHistoryID, "Lets Chat")
+    c.Messages = []Message{
+        {ID: "m1", Role: RoleUser, Content: "hi", CreatedAt: s.now()},
+        {ID: "m2", Role: RoleAssistant, Content: "hello", CreatedAt: s.now()},
+    }
+    if err := s.saveConversation(c); err != nil {
+        t.Fatal(err)
+    }
+    return conversationETag(c)
+}
+
+// serveWithHeader sends a JSON request with an extra header
+func serveWithHeader(s *Server, method, target, body, header, value string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, target, strings.NewReader(body))
+    req.Header.Set(header, value)
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    return rec
+}
+
+func TestAppendMessages(t *testing.T) {
+    appendBody := func(after, messages string) string {
+        return `{"assistantTitle":"Lets Chat","historyID":"` + rootHistoryID + `","afterMessageID":"` + after + `","messages":` + messages + `}`
+    }
+    tests := []struct {
+        name     string
+        body     string
+        ifMatch  string
+        status   int
+        messages int
+    }{
+        {"append", appendBody("", `[{"role":"user","content":"more"},{"role":"assistant","content":"sure"}]`), "", http.StatusOK, 4},
+        {"append after last message", appendBody("m2", `[{"role":"user","content":"more"}]`), "", http.StatusOK, 3},
+        {"append after earlier message", appendBody("m1", `[{"role":"user","content":"more"}]`), "", http.StatusConflict, 2},
+        {"duplicate message ID", appendBody("", `[{"id":"m1","role":"user","content":"more"}]`), "", http.StatusConflict, 2},
+        {"duplicate IDs in request", appendBody("", `[{"id":"x","role":"user"},{"id":"x","role":"user"}]`), "", http.StatusBadRequest, 2},
+        {"no messages", appendBody("", `[]`), "", http.StatusBadRequest, 2},
+        {"invalid role", appendBody("", `[{"role":"robot","content":"more"}]`), "", http.StatusBadRequest, 2},
+        {"stale ETag", appendBody("", `[{"role":"user","content":"more"}]`), `"stale"`, http.StatusPreconditionFailed, 2},
+        {"wildcard ETag", appendBody("", `[{"role":"user","content":"more"}]`), `*`, http.StatusOK, 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newFixtureServer(t)
+            newConversationFixture(t, s)
+
+            rec := serveWithHeader(s, http.MethodPost, "/append-messages", tt.body, "If-Match", tt.ifMatch)
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.status, rec.Body.String())
+            }
+            c := readConversation(t, s, "Lets Chat", rootHistoryID)
+            if len(c.Messages) != tt.messages {
+                t.Fatalf("history has %d messages, want %d", len(c.Messages), tt.messages)
+            }
+            if tt.status != http.StatusOK {
+                return
+            }
+
+            var resp AppendMessagesResponse
+            decodeBody(t, rec, &resp)
+            appended := c.Messages[2:]
+            if len(resp.MessageIDs) != len(appended) {
+                t.Fatalf("messageIDs = %v for %d appended messages", resp.MessageIDs, len(appended))
+            }
+            for i, m := range appended {
+                if m.ID != resp.MessageIDs[i] || m.CreatedAt.IsZero() {
+                    t.Errorf("appended message %d = %+v, reported ID %s", i, m, resp.MessageIDs[i])
+                }
+            }
+            if got := rec.Header().Get("ETag"); got != conversationETag(c) {
+                t.Errorf("ETag = %s, want %s", got, conversationETag(c))
+            }
+        })
+    }
+}
+
+func TestAppendMessagesToLegacyHistory(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Reviewer","historyID":"`+reviewerHistoryID+`","messages":[{"role":"user","content":"hi"}]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    data, _ := s.store.ReadFile(historyPath("Reviewer", reviewerHistoryID))
+    if !isConversationDocument(data) {
+        t.Errorf("legacy history was not migrated on write: %s", data)
+    }
+}
+
+func TestConcurrentAppendsAreSerialized(t *testing.T) {
+    s := newFixtureServer(t)
+    newConversationFixture(t, s)
+
+    const writers = 20
+    var wg sync.WaitGroup
+    for i := 0; i < writers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            body := fmt.Sprintf(`{"assistantTitle":"Lets Chat","historyID":"%s","messages":[{"role":"user","content":"message %d"}]}`, rootHistoryID, i)
+            if rec := serve(s, http.MethodPost, "/append-messages", body); rec.Code != http.StatusOK {
+                t.Errorf("append %d: status = %d", i, rec.Code)
+            }
+        }(i)
+    }
+    wg.Wait()
+
+    if c := readConversation(t, s, "Lets Chat", rootHistoryID); len(c.Messages) != 2+writers {
+        t.Errorf("history has %d messages, want %d", len(c.Messages), 2+writers)
+    }
+}
+
+func TestAppendAfterAssistantRename(t *testing.T) {
+    s := newFixtureServer(t)
+    s.store.MkdirAll(historyDir("Writer"))
+    if err := s.saveConversation(s.newConversation(rootHistoryID, "Writer")); err != nil {
+        t.Fatal(err)
+    }
+    if rec := serve(s, http.MethodPut, "/renameAssistant", `{"currentTitle":"Writer","newTitle":"Author"}`); rec.Code != http.StatusOK {
+        t.Fatalf("rename: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+
+    rec := serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Author","historyID":"`+rootHistoryID+`","messages":[{"role":"user","content":"hi"}]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("append: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var stored Conversation
+    data, _ := s.store.ReadFile(historyPath("Author", rootHistoryID))
+    if err := json.Unmarshal(data, &stored); err != nil || stored.Assistant != "Author" || len(stored.Messages) != 1 {
+        t.Errorf("stored history = %+v, %v", stored, err)
+    }
+
+    rec = serve(s, http.MethodGet, "/list-conversations?assistant=Author", "")
+    var list ListConversationsResponse
+    decodeBody(t, rec, &list)
+    if len(list.Conversations) != 1 || list.Conversations[0].Assistant != "Author" {
+        t.Errorf("conversations = %+v", list.Conversations)
+    }
+}
+
+func TestDeleteDuringAppends(t *testing.T) {
+    s := newFixtureServer(t)
+    newConversationFixture(t, s)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            body := fmt.Sprintf(`{"assistantTitle":"Lets Chat","historyID":"%s","messages":[{"role":"user","content":"message %d"}]}`, rootHistoryID, i)
+            serve(s, http.MethodPost, "/append-messages", body)
+        }(i)
+    }
+    rec := serve(s, http.MethodDelete, "/delete-history", `{"assistantTitle":"Lets Chat","chatHistoryID":"`+rootHistoryID+`"}`)
+    wg.Wait()
+
+    if rec.Code != http.StatusOK {
+        t.Fatalf("delete: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    // Appends either finished before the delete or found no history
+    wantMissing(t, s, historyPath("Lets Chat", rootHistoryID))
+}
+
+func TestUpdateChatContextIfMatch(t *testing.T) {
+    s := newFixtureServer(t)
+    etag := newConversationFixture(t, s)
+
+    rec := serve(s, http.MethodPost, "/fetch-history", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`"}`)
+    if got := rec.Header().Get("ETag"); got != etag {
+        t.Fatalf("fetch ETag = %s, want %s", got, etag)
+    }
+
+    target := "/update-chat-context/" + rootHistoryID
+    body := `{"assistantTitle":"Lets Chat","context":"{\"messages\":[]}"}`
+
+    // Another tab appends a message, the ETag the first tab holds is stale
+    serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","messages":[{"role":"user","content":"from tab 2"}]}`)
+    if rec := serveWithHeader(s, http.MethodPut, target, body, "If-Match", etag); rec.Code != http.StatusPreconditionFailed {
+        t.Fatalf("update with stale ETag: status = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+    }
+    if c := readConversation(t, s, "Lets Chat", rootHistoryID); len(c.Messages) != 3 {
+        t.Fatalf("stale update clobbered the history: %+v", c.Messages)
+    }
+
+    current := conversationETag(readConversation(t, s, "Lets Chat", rootHistoryID))
+    rec = serveWithHeader(s, http.MethodPut, target, body, "If-Match", current)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("update with current ETag: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if got, want := rec.Header().Get("ETag"), conversationETag(readConversation(t, s, "Lets Chat", rootHistoryID)); got != want {
+        t.Errorf("update ETag = %s, want %s", got, want)
+    }
+}
+
+// saveListFixtures stores conversations with distinct times and titles and
+// returns them in the order of their update time, oldest first
+func saveListFixtures(t *testing.T, s *Server) []*Conversation {
+    t.Helper()
+    base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    specs := []struct{ id, assistant, title string }{
+        {"c1", "Reviewer", "banana"},
+        {"c2", "Lets Chat", "Apple"},
+        {"c3", "Writer", "cherry"},
+        {"c4", "Reviewer", "apple pie"},
+        {"c5", "Lets Chat", "date"},
+    }
+    var conversations []*Conversation
+    for i, spec := range specs {
+        c := s.newConversation(spec.id, spec.assistant)
+        c.Title = spec.title
+        c.CreatedAt = base.Add(time.Duration(len(specs)-i) * time.Hour)
+        c.UpdatedAt = base.Add(time.Duration(i) * time.Minute)
+        c.Messages = []Message{{ID: "m1", Role: RoleUser, Content: "message\n of " + spec.id, CreatedAt: c.UpdatedAt}}
+        if err := s.store.MkdirAll(historyDir(spec.assistant)); err != nil {
+            t.Fatal(err)
+        }
+        if err := s.saveConversation(c); err != nil {
+            t.Fatal(err)
+        }
+        conversations = append(conversations, c)
+    }
+    return conversations
+}
+
+func listIDs(resp ListConversationsResponse) []string {
+    ids := []string{}
+    for _, c := range resp.Conversations {
+        ids = append(ids, c.ID)
+    }
+    return ids
+}
+
+func TestListConversations(t *testing.T) {
+    tests := []struct {
+        name  string
+        query string
+        want  []string
+    }{
+        {"default order", "", []string{"c5", "c4", "c3", "c2", "c1"}},
+        {"ascending", "?order=asc", []string{"c1", "c2", "c3", "c4", "c5"}},
+        {"created", "?sort=createdAt", []string{"c1", "c2", "c3", "c4", "c5"}},
+        {"title", "?sort=title", []string{"c2", "c4", "c1", "c3", "c5"}},
+        {"title descending", "?sort=title&order=desc", []string{"c5", "c3", "c1", "c4", "c2"}},
+        {"assistant", "?assistant=Reviewer", []string{"c4", "c1"}},
+        {"default assistant", "?assistant=Lets+Chat&order=asc", []string{"c2", "c5"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newTestServer(t)
+            saveListFixtures(t, s)
+
+            rec := serve(s, http.MethodGet, "/list-conversations"+tt.query, "")
+            if rec.Code != http.StatusOK {
+                t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+            var resp ListConversationsResponse
+            decodeBody(t, rec, &resp)
+            if got := listIDs(resp); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("conversations = %v, want %v", got, tt.want)
+            }
+            if resp.NextCursor != "" {
+                t.Errorf("nextCursor = %q on the only page", resp.NextCursor)
+            }
+        })
+    }
+}
+
+func TestListConversationsSummary(t *testing.T) {
+    s := newTestServer(t)
+    conversations := saveListFixtures(t, s)
+
+    rec := serve(s, http.MethodGet, "/list-conversations?assistant=Writer", "")
+    var resp ListConversationsResponse
+    decodeBody(t, rec, &resp)
+    c := conversations[2]
+    want := []ConversationSummary{{
+        ID:           "c3",
+        Assistant:    "Writer",
+        Title:        "cherry",
+        MessageCount: 1,
+        LastMessage:  "message of c3",
+        CreatedAt:    c.CreatedAt,
+        UpdatedAt:    c.UpdatedAt,
+    }}
+    if !reflect.DeepEqual(resp.Conversations, want) {
+        t.Errorf("conversations = %+v, want %+v", resp.Conversations, want)
+    }
+
+    // Changes are picked up although summaries are cached
+    serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Writer","historyID":"c3","messages":[{"role":"assistant","content":"`+strings.Repeat("long ", 30)+`"}]}`)
+    rec = serve(s, http.MethodGet, "/list-conversations?assistant=Writer", "")
+    decodeBody(t, rec, &resp)
+    got := resp.Conversations[0]
+    if got.MessageCount != 2 || utf8.RuneCountInString(got.LastMessage) != maxPreviewLength || !strings.HasSuffix(got.LastMessage, "…") {
+        t.Errorf("summary after append = %+v", got)
+    }
+
+    serve(s, http.MethodDelete, "/delete-history", `{"assistantTitle":"Writer","chatHistoryID":"c3"}`)
+    rec = serve(s, http.MethodGet, "/list-conversations?assistant=Writer", "")
+    decodeBody(t, rec, &resp)
+    if len(resp.Conversations) != 0 {
+        t.Errorf("deleted conversation still listed: %+v", resp.Conversations)
+    }
+}
+
+func TestListConversationsPagination(t *testing.T) {
+    s := newFixtureServer(t)
+    saveListFixtures(t, s)
+
+    for _, query := range []string{"", "&sort=title", "&sort=createdAt&order=asc"} {
+        all := serve(s, http.MethodGet, "/list-conversations?limit=200"+query, "")
+        var full ListConversationsResponse
+        decodeBody(t, all, &full)
+
+        var paged []string
+        cursor := ""
+        for pages := 0; ; pages++ {
+            if pages > len(full.Conversations) {
+                t.Fatalf("%s: pagination does not end", query)
+            }
+            rec := serve(s, http.MethodGet, "/list-conversations?limit=2&cursor="+cursor+query, "")
+            if rec.Code != http.StatusOK {
+                t.Fatalf("%s: status = %d; body: %s", query, rec.Code, rec.Body.String())
+            }
+            var page ListConversationsResponse
+            decodeBody(t, rec, &page)
+            if len(page.Conversations) > 2 {
+                t.Fatalf("%s: page has %d conversations", query, len(page.Conversations))
+            }
+            paged = append(paged, listIDs(page)...)
+            if page.NextCursor == "" {
+                break
+            }
+            cursor = page.NextCursor
+        }
+        if want := listIDs(full); !reflect.DeepEqual(paged, want) {
+            t.Errorf("%s: pages = %v, want %v", query, paged, want)
+        }
+    }
+}
+
+func TestListConversationsErrors(t *testing.T) {
+    s := newFixtureServer(t)
+    saveListFixtures(t, s)
+    rec := serve(s, http.MethodGet, "/list-conversations?limit=1", "")
+    var page ListConversationsResponse
+    decodeBody(t, rec, &page)
+
+    runHandlerTests(t, []handlerTest{
+        {name: "unknown assistant", method: http.MethodGet, target: "/list-conversations?assistant=Nobody", status: http.StatusNotFound},
+        {name: "unknown sort", method: http.MethodGet, target: "/list-conversations?sort=size", status: http.StatusBadRequest},
+        {name: "unknown order", method: http.MethodGet, target: "/list-conversations?order=up", status: http.StatusBadRequest},
+        {name: "limit too large", method: http.MethodGet, target: "/list-conversations?limit=201", status: http.StatusBadRequest},
+        {name: "malformed cursor", method: http.MethodGet, target: "/list-conversations?cursor=!!", status: http.StatusBadRequest},
+        {name: "cursor of another sort", method: http.MethodGet, target: "/list-conversations?sort=title&cursor=" + page.NextCursor, status: http.StatusBadRequest},
+    })
+}
@@ -0,0 +1,463 @@
+package server
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+)
+
+// maxImportSize is the largest file the import endpoint accepts
+const maxImportSize = 50 << 20
+
+// Import formats, detected from the content of the imported file
+const (
+    importFormatOpenAI  = "openai"  // {"messages":[...]}, [{"messages":[...]}] or [{"role":...}]
+    importFormatChatGPT = "chatgpt" // conversations.json of a ChatGPT data export
+    importFormatJSONL   = "jsonl"   // one conversation or one message per line
+)
+
+var errUnknownImportFormat = errors.New("content is neither OpenAI messages JSON, a ChatGPT conversations.json export nor JSONL")
+
+// ImportResult reports what happened to a single imported conversation
+type ImportResult struct {
+    Index     int    `json:"index"` // position of the conversation in the file
+    Title     string `json:"title"`
+    HistoryID string `json:"historyID,omitempty"`
+    Messages  int    `json:"messages"`
+    Error     string `json:"error,omitempty"`
+}
+
+// ImportHistoriesResponse represents the structure of the response for importing chat histories
+type ImportHistoriesResponse struct {
+    Format   string         `json:"format"`
+    Imported int            `json:"imported"`
+    Failed   int            `json:"failed"`
+    Results  []ImportResult `json:"results"`
+}
+
+// importedConversation is a conversation read from an import file, before
+// it is validated and stored
+type importedConversation struct {
+    title     string
+    sourceID  string
+    createdAt time.Time
+    messages  []Message
+    err       error // why the conversation cannot be imported
+}
+
+// parseImport detects the format of an import file and reads its
+// conversations
+func parseImport(data []byte) (string, []importedConversation, error) {
+    var raw interface{}
+    if err := json.Unmarshal(data, &raw); err != nil {
+        conversations, err := parseImportJSONL(data)
+        return importFormatJSONL, conversations, err
+    }
+
+    switch v := raw.(type) {
+    case map[string]interface{}:
+        if _, ok := v["mapping"]; ok {
+            return importFormatChatGPT, []importedConversation{parseChatGPTConversation(v)}, nil
+        }
+        if _, ok := v["messages"]; ok {
+            return importFormatOpenAI, []importedConversation{parseOpenAIConversation(v)}, nil
+        }
+    case []interface{}:
+        if len(v) == 0 {
+            return importFormatOpenAI, nil, nil
+        }
+        first, _ := v[0].(map[string]interface{})
+        switch {
+        case first["mapping"] != nil:
+            var conversations []importedConversation
+            for _, item := range v {
+                obj, _ := item.(map[string]interface{})
+                conversations = append(conversations, parseChatGPTConversation(obj))
+            }
+            return importFormatChatGPT, conversations, nil
+        case first["messages"] != nil:
+            var conversations []importedConversation
+            for _, item := range v {
+                obj, _ := item.(map[string]interface{})
+                conversations = append(conversations, parseOpenAIConversation(obj))
+            }
+            return importFormatOpenAI, conversations, nil
+        case first["role"] != nil:
+            return importFormatOpenAI, []importedConversation{parseOpenAIConversation(map[string]interface{}{"messages": v})}, nil
+        }
+    }
+    return "", nil, errUnknownImportFormat
+}
+
+// parseImportJSONL reads a file with a JSON object per line. Lines with a
+// messages field, as in fine-tuning files, are conversations of their own;
+// lines holding a single message, as in chat logs, are collected into one
+// conversation.
+func parseImportJSONL(data []byte) ([]importedConversation, error) {
+    var conversations []importedConversation
+    logIndex := -1
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    scanner.Buffer(nil, maxImportSize)
+    for line := 1; scanner.Scan(); line++ {
+        text := bytes.TrimSpace(scanner.Bytes())
+        if len(text) == 0 {
+            continue
+        }
+        var obj map[string]interface{}
+        if err := json.Unmarshal(text, &obj); err != nil {
+            if len(conversations) == 0 {
+                return nil, errUnknownImportFormat
+            }
+            conversations = append(conversations, importedConversation{err: fmt.Errorf("line %d: %w", line, err)})
+            continue
+        }
+        if _, ok := obj["messages"]; ok {
+            conversations = append(conversations, parseOpenAIConversation(obj))
+            continue
+        }
+        if logIndex < 0 {
+            logIndex = len(conversations)
+            conversations = append(conversations, importedConversation{})
+        }
+        chatLog := &conversations[logIndex]
+        m, err := parseImportMessage(obj)
+        if err != nil {
+            if chatLog.err == nil {
+                chatLog.err = fmt.Errorf("line %d: %w", line, err)
+            }
+            continue
+        }
+        chatLog.messages = append(chatLog.messages, m)
+    }
+    return conversations, scanner.Err()
+}
+
+// parseOpenAIConversation reads a conversation in the messages format of
+// the OpenAI chat API, optionally with a title and an ID
+func parseOpenAIConversation(obj map[string]interface{}) importedConversation {
+    c := importedConversation{}
+    c.title, _ = firstString(obj, "title", "name")
+    c.sourceID, _ = firstString(obj, "id")
+    c.createdAt = parseImportTime(obj, "createdAt", "created_at", "create_time", "created")
+
+    items, ok := obj["messages"].([]interface{})
+    if !ok {
+        c.err = errors.New("messages is not an array")
+        return c
+    }
+    for i, item := range items {
+        msg, _ := item.(map[string]interface{})
+        m, err := parseImportMessage(msg)
+        if err != nil {
+            c.err = fmt.Errorf("message %d: %w", i+1, err)
+            return c
+        }
+        c.messages = append(c.messages, m)
+    }
+    return c
+}
+
+// parseImportMessage reads a message with a role and a content that is a
+// string or an array of content parts, as in the OpenAI chat API
+func parseImportMessage(obj map[string]interface{}) (Message, error) {
+    if obj == nil {
+        return Message{}, errors.New("is not an object")
+    }
+    role, ok := obj["role"].(string)
+    if !ok {
+        return Message{}, errors.New("has no role")
+    }
+    content, ok := importContent(obj["content"])
+    if !ok {
+        return Message{}, errors.New("has no text content")
+    }
+    m := Message{Role: role, Content: content, CreatedAt: parseImportTime(obj, "createdAt", "created_at", "create_time", "timestamp")}
+    m.ID, _ = firstString(obj, "id")
+    return m, nil
+}
+
+// importContent returns the text of a message content: a string, an array
+// of strings (ChatGPT parts) or of content parts with a text field (OpenAI
+// multimodal messages). Images and other parts are left out.
+func importContent(v interface{}) (string, bool) {
+    switch content := v.(type) {
+    case string:
+        return content, true
+    case []interface{}:
+        var texts []string
+        for _, part := range content {
+            switch p := part.(type) {
+            case string:
+                texts = append(texts, p)
+            case map[string]interface{}:
+                if text, ok := p["text"].(string); ok {
+                    texts = append(texts, text)
+                }
+            }
+        }
+        return strings.Join(texts, "\n"), len(texts) > 0
+    case nil:
+        // Assistant messages that only call tools have no content
+        return "", true
+    }
+    return "", false
+}
+
+// parseImportTime reads a time given as RFC 3339 string or as Unix seconds
+func parseImportTime(obj map[string]interface{}, keys ...string) time.Time {
+    for _, key := range keys {
+        switch v := obj[key].(type) {
+        case string:
+            if t, err := time.Parse(time.RFC3339, v); err == nil {
+                return t.UTC()
+            }
+        case float64:
+            sec, frac := math.Modf(v)
+            return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+        }
+    }
+    return time.Time{}
+}
+
+// parseChatGPTConversation reads a conversation of a ChatGPT export. Its
+// messages form a tree, the branch shown last, ending at current_node, is
+// imported.
+func parseChatGPTConversation(obj map[string]interface{}) importedConversation {
+    c := importedConversation{}
+    c.title, _ = firstString(obj, "title")
+    c.sourceID, _ = firstString(obj, "conversation_id", "id")
+    c.createdAt = parseImportTime(obj, "create_time")
+
+    mapping, ok := obj["mapping"].(map[string]interface{})
+    if !ok {
+        c.err = errors.New("mapping is not an object")
+        return c
+    }
+    node, _ := firstString(obj, "current_node")
+    if node == "" {
+        // Without a current node follow the last child from the root
+        var roots []string
+        for id, n := range mapping {
+            m, ok := n.(map[string]interface{})
+            if !ok {
+                c.err = fmt.Errorf("message %s is not an object", id)
+                return c
+            }
+            if parent, _ := m["parent"].(string); parent == "" {
+                roots = append(roots, id)
+            }
+        }
+        if len(roots) != 1 {
+            c.err = fmt.Errorf("mapping has %d roots instead of one", len(roots))
+            return c
+        }
+        node = roots[0]
+        visited := map[string]bool{}
+        for {
+            if visited[node] {
+                c.err = fmt.Errorf("message %s is its own descendant", node)
+                return c
+            }
+            visited[node] = true
+            n, _ := mapping[node].(map[string]interface{})
+            children, _ := n["children"].([]interface{})
+            if len(children) == 0 {
+                break
+            }
+            node, _ = children[len(children)-1].(string)
+        }
+    }
+
+    var branch []Message
+    seen := map[string]bool{}
+    for node != "" {
+        if seen[node] {
+            c.err = fmt.Errorf("message %s is its own ancestor", node)
+            return c
+        }
+        seen[node] = true
+        n, ok := mapping[node].(map[string]interface{})
+        if !ok {
+            c.err = fmt.Errorf("message %s is missing from mapping", node)
+            return c
+        }
+        if msg, ok := n["message"].(map[string]interface{}); ok {
+            if m, ok := parseChatGPTMessage(msg); ok {
+                branch = append(branch, m)
+            }
+        }
+        node, _ = n["parent"].(string)
+    }
+    for i := len(branch) - 1; i >= 0; i-- {
+        c.messages = append(c.messages, branch[i])
+    }
+    return c
+}
+
+// parseChatGPTMessage reads a message of a ChatGPT export. Hidden and empty
+// messages, such as the empty system message starting every conversation,
+// are skipped.
+func parseChatGPTMessage(msg map[string]interface{}) (Message, bool) {
+    author, _ := msg["author"].(map[string]interface{})
+    role, _ := author["role"].(string)
+    metadata, _ := msg["metadata"].(map[string]interface{})
+    if hidden, _ := metadata["is_visually_hidden_from_conversation"].(bool); hidden {
+        return Message{}, false
+    }
+    content, _ := msg["content"].(map[string]interface{})
+    text, ok := importContent(content["parts"])
+    if !ok || strings.TrimSpace(text) == "" {
+        return Message{}, false
+    }
+    m := Message{Role: role, Content: text, CreatedAt: parseImportTime(msg, "create_time")}
+    m.ID, _ = firstString(msg, "id")
+    return m, true
+}
+
+// importConversations stores the conversations read from an import file
+// as histories of an assistant
+func (s *Server) importConversations(assistant, format string, conversations []importedConversation) (ImportHistoriesResponse, error) {
+    resp := ImportHistoriesResponse{Format: format, Results: []ImportResult{}}
+    if err := s.store.MkdirAll(historyDir(assistant)); err != nil {
+        return resp, err
+    }
+
+    for i, imported := range conversations {
+        result := ImportResult{Index: i, Title: imported.title, Messages: len(imported.messages)}
+        c, err := s.importConversation(assistant, format, imported)
+        if err == nil {
+            err = s.saveConversation(c)
+        }
+        if err != nil {
+            result.Error = err.Error()
+            resp.Failed++
+        } else {
+            result.HistoryID = c.ID
+            result.Title = c.Title
+            resp.Imported++
+        }
+        resp.Results = append(resp.Results, result)
+    }
+    return resp, nil
+}
+
+// importConversation turns an imported conversation into a new history.
+// Message IDs of the source are kept if they are valid, missing times are
+// taken from the previous message or the conversation.
+func (s *Server) importConversation(assistant, format string, imported importedConversation) (*Conversation, error) {
+    if imported.err != nil {
+        return nil, imported.err
+    }
+    if len(imported.messages) == 0 {
+        return nil, errors.New("conversation has no messages")
+    }
+
+    c := s.newConversation(s.newID(), assistant)
+    c.Title = imported.title
+    if !imported.createdAt.IsZero() {
+        c.CreatedAt = imported.createdAt
+    }
+    c.Metadata = map[string]interface{}{"importedFrom": format}
+    if imported.sourceID != "" {
+        c.Metadata["sourceID"] = imported.sourceID
+    }
+
+    seen := map[string]bool{}
+    last := c.CreatedAt
+    for _, m := range imported.messages {
+        m.Role = legacyRole(map[string]interface{}{"role": m.Role})
+        if len(validateValue("id", m.ID, "max=64,charset=id")) > 0 || seen[m.ID] {
+            m.ID = ""
+        }
+        seen[m.ID] = true
+        if m.CreatedAt.IsZero() {
+            m.CreatedAt = last
+        }
+        last = m.CreatedAt
+        c.Messages = append(c.Messages, m)
+    }
+    s.completeMessages(c.Messages)
+    c.UpdatedAt = last
+    if c.Title == "" {
+        s.autoTitle(c)
+    }
+
+    if errs := validateConversation(c); len(errs) > 0 {
+        return nil, fmt.Errorf("%s %s", errs[0].Field, errs[0].Message)
+    }
+    return c, nil
+}
+
+// ImportHistories imports the conversations of an OpenAI messages JSON,
+// ChatGPT conversations.json or JSONL file as histories of an assistant
+func ImportHistories(store Store, assistant string, data []byte) (ImportHistoriesResponse, error) {
+    s := NewServer(Options{Store: store})
+    format, conversations, err := parseImport(data)
+    if err != nil {
+        return ImportHistoriesResponse{}, err
+    }
+    return s.importConversations(assistant, format, conversations)
+}
+
+// Import Histories Handler
+func (s *Server) importHistoriesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "assistant", titleRules) {
+        return
+    }
+    assistant := r.URL.Query().Get("assistant")
+    if assistant != defaultAssistant && !s.exists(path.Join("assistants", assistant)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+
+    r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+    file, _, err := r.FormFile("file")
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+            return
+        }
+        http.Error(w, "Failed to get file from request", http.StatusBadRequest)
+        return
+    }
+    defer file.Close()
+    data, err := io.ReadAll(file)
+    if err != nil {
+        http.Error(w, "Failed to read file", http.StatusBadRequest)
+        return
+    }
+
+    format, conversations, err := parseImport(data)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{
+            Error:  "Invalid import file",
+            Fields: []FieldError{{Field: "file", Message: err.Error()}},
+        })
+        return
+    }
+
+    resp, err := s.importConversations(assistant, format, conversations)
+    if err != nil {
+        http.Error(w, "Failed to create History directory", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
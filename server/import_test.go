@@ -0,0 +1,216 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// importFile posts content to the import endpoint
+func importFile(t *testing.T, s *Server, assistant, content string) *httptest.ResponseRecorder {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, uploadRequest(t, "/import-histories?assistant="+assistant, "export.json", content))
+    return rec
+}
+
+// chatGPTExport is a conversations.json with one conversation whose user
+// edited the first message, so its mapping has two branches
+const chatGPTExport = `[{
+  "title": "Invoice questions",
+  "conversation_id": "c0ffee00-0000-4000-8000-000000000001",
+  "create_time": 1714557600.5,
+  "current_node": "a2",
+  "mapping": {
+    "root": {"id": "root", "message": null, "parent": null, "children": ["sys"]},
+    "sys": {"id": "sys", "parent": "root", "children": ["u1", "u2"], "message": {
+      "id": "sys", "author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]},
+      "metadata": {"is_visually_hidden_from_conversation": true}}},
+    "u1": {"id": "u1", "parent": "sys", "children": ["a1"], "message": {
+      "id": "u1", "author": {"role": "user"}, "create_time": 1714557601, "content": {"content_type": "text", "parts": ["Where is my invoce?"]}}},
+    "a1": {"id": "a1", "parent": "u1", "children": [], "message": {
+      "id": "a1", "author": {"role": "assistant"}, "create_time": 1714557602, "content": {"content_type": "text", "parts": ["What is an invoce?"]}}},
+    "u2": {"id": "u2", "parent": "sys", "children": ["a2"], "message": {
+      "id": "u2", "author": {"role": "user"}, "create_time": 1714557603, "content": {"content_type": "text", "parts": ["Where is my invoice?"]}}},
+    "a2": {"id": "a2", "parent": "u2", "children": [], "message": {
+      "id": "a2", "author": {"role": "assistant"}, "create_time": 1714557604, "content": {"content_type": "text", "parts": ["It was sent ", "yesterday."]}}}
+  }
+}]`
+
+func TestImportHistories(t *testing.T) {
+    type message struct{ ID, Role, Content string }
+    tests := []struct {
+        name     string
+        content  string
+        format   string
+        messages [][]message // of the imported conversations, nil for failed ones
+        titles   []string
+    }{
+        {
+            name:     "openai messages",
+            content:  `{"title":"Greeting","messages":[{"role":"developer","content":"Be brief"},{"role":"user","content":[{"type":"text","text":"Hi"},{"type":"image_url","image_url":{"url":"x"}}]},{"role":"assistant","content":"Hello"}]}`,
+            format:   importFormatOpenAI,
+            messages: [][]message{{{Role: RoleSystem, Content: "Be brief"}, {Role: RoleUser, Content: "Hi"}, {Role: RoleAssistant, Content: "Hello"}}},
+            titles:   []string{"Greeting"},
+        },
+        {
+            name:     "openai message array",
+            content:  `[{"role":"user","content":"What is a goroutine?"}]`,
+            format:   importFormatOpenAI,
+            messages: [][]message{{{Role: RoleUser, Content: "What is a goroutine?"}}},
+            titles:   []string{"What is a goroutine"},
+        },
+        {
+            name:     "openai conversations with a broken one",
+            content:  `[{"messages":[{"role":"user","content":"One"}],"title":"First"},{"messages":"nope"},{"messages":[]}]`,
+            format:   importFormatOpenAI,
+            messages: [][]message{{{Role: RoleUser, Content: "One"}}, nil, nil},
+            titles:   []string{"First", "", ""},
+        },
+        {
+            name:     "chatgpt export",
+            content:  chatGPTExport,
+            format:   importFormatChatGPT,
+            messages: [][]message{{{ID: "u2", Role: RoleUser, Content: "Where is my invoice?"}, {ID: "a2", Role: RoleAssistant, Content: "It was sent \nyesterday."}}},
+            titles:   []string{"Invoice questions"},
+        },
+        {
+            name:     "fine-tuning jsonl",
+            content:  `{"messages":[{"role":"user","content":"A"}]}` + "\n\n" + `{"messages":[{"role":"user","content":"B"}]}` + "\n",
+            format:   importFormatJSONL,
+            messages: [][]message{{{Role: RoleUser, Content: "A"}}, {{Role: RoleUser, Content: "B"}}},
+            titles:   []string{"", ""},
+        },
+        {
+            name:     "chat log jsonl",
+            content:  `{"role":"user","content":"Ping","id":"p1"}` + "\n" + `{"role":"assistant","content":"Pong","id":"p1"}` + "\n",
+            format:   importFormatJSONL,
+            messages: [][]message{{{ID: "p1", Role: RoleUser, Content: "Ping"}, {Role: RoleAssistant, Content: "Pong"}}},
+            titles:   []string{"Ping"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newFixtureServer(t)
+            rec := importFile(t, s, "Writer", tt.content)
+            if rec.Code != http.StatusOK {
+                t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+            var resp ImportHistoriesResponse
+            decodeBody(t, rec, &resp)
+            if resp.Format != tt.format {
+                t.Errorf("format = %q, want %q", resp.Format, tt.format)
+            }
+            if len(resp.Results) != len(tt.messages) {
+                t.Fatalf("results = %+v, want %d", resp.Results, len(tt.messages))
+            }
+
+            imported := 0
+            for i, result := range resp.Results {
+                if result.Index != i || result.Title != tt.titles[i] {
+                    t.Errorf("result %d = %+v, want title %q", i, result, tt.titles[i])
+                }
+                if tt.messages[i] == nil {
+                    if result.Error == "" || result.HistoryID != "" {
+                        t.Errorf("result %d = %+v, want an error", i, result)
+                    }
+                    continue
+                }
+                imported++
+                if result.Error != "" {
+                    t.Fatalf("result %d: %s", i, result.Error)
+                }
+                c := readConversation(t, s, "Writer", result.HistoryID)
+                var got []message
+                for _, m := range c.Messages {
+                    if m.ID == "" || m.CreatedAt.IsZero() {
+                        t.Errorf("message %+v lacks an ID or time", m)
+                    }
+                    got = append(got, message{Role: m.Role, Content: m.Content})
+                }
+                want := tt.messages[i]
+                for j := range want {
+                    if want[j].ID != "" && j < len(c.Messages) && c.Messages[j].ID != want[j].ID {
+                        t.Errorf("message %d has ID %q, want %q", j, c.Messages[j].ID, want[j].ID)
+                    }
+                    want[j].ID = ""
+                }
+                if !reflect.DeepEqual(got, want) {
+                    t.Errorf("messages = %+v, want %+v", got, want)
+                }
+                if c.Metadata["importedFrom"] != tt.format {
+                    t.Errorf("metadata = %v", c.Metadata)
+                }
+            }
+            if resp.Imported != imported || resp.Failed != len(tt.messages)-imported {
+                t.Errorf("imported %d and failed %d, want %d and %d", resp.Imported, resp.Failed, imported, len(tt.messages)-imported)
+            }
+        })
+    }
+}
+
+func TestImportChatGPTTimes(t *testing.T) {
+    _, conversations, err := parseImport([]byte(chatGPTExport))
+    if err != nil {
+        t.Fatal(err)
+    }
+    c := conversations[0]
+    if want := time.Unix(1714557600, 5e8).UTC(); !c.createdAt.Equal(want) {
+        t.Errorf("createdAt = %v, want %v", c.createdAt, want)
+    }
+    if c.sourceID != "c0ffee00-0000-4000-8000-000000000001" {
+        t.Errorf("sourceID = %q", c.sourceID)
+    }
+    if got := c.messages[1].CreatedAt; !got.Equal(time.Unix(1714557604, 0)) {
+        t.Errorf("message time = %v", got)
+    }
+}
+
+func TestImportChatGPTMalformed(t *testing.T) {
+    tests := map[string]string{
+        "node not an object": `[{"title":"t","mapping":{"a":null}}]`,
+        "cyclic children":    `[{"title":"t","mapping":{"r":{"children":["a"]},"a":{"parent":"r","children":["b"]},"b":{"parent":"a","children":["a"]}}}]`,
+        "cyclic parents":     `[{"title":"t","current_node":"a","mapping":{"a":{"parent":"b"},"b":{"parent":"a"}}}]`,
+        "several roots":      `[{"title":"t","mapping":{"a":{"children":[]},"b":{"children":[]}}}]`,
+    }
+    for name, export := range tests {
+        t.Run(name, func(t *testing.T) {
+            _, conversations, err := parseImport([]byte(export))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(conversations) != 1 || conversations[0].err == nil {
+                t.Errorf("conversations = %+v, want one failing", conversations)
+            }
+        })
+    }
+}
+
+func TestImportHistoriesErrors(t *testing.T) {
+    s := newFixtureServer(t)
+    if rec := importFile(t, s, "Nobody", `[]`); rec.Code != http.StatusNotFound {
+        t.Errorf("unknown assistant: status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+    if rec := importFile(t, s, "Writer", `{"hello":"world"}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("unknown format: status = %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+    if rec := importFile(t, s, "Writer", "plain text"); rec.Code != http.StatusBadRequest {
+        t.Errorf("text file: status = %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+}
+
+func TestImportHistoriesFunction(t *testing.T) {
+    store := NewDirStore(t.TempDir())
+    resp, err := ImportHistories(store, defaultAssistant, []byte(`[{"role":"user","content":"Hi"}]`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.Imported != 1 {
+        t.Fatalf("response = %+v", resp)
+    }
+    if _, err := store.Stat(historyPath(defaultAssistant, resp.Results[0].HistoryID)); err != nil {
+        t.Errorf("imported history not stored: %v", err)
+    }
+}
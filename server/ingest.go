@@ -0,0 +1,161 @@
+package server
+
+import (
+    "encoding/json"
+    "io/fs"
+    "path"
+    "time"
+    "unicode/utf8"
+)
+
+// Files uploaded to a knowledge base are ingested in the background: their
+// text is extracted and split into chunks, which are embedded. The text,
+// chunks and vectors are kept next to them in the .meta folder of the
+// knowledge base together with an ingestion record telling whether this is
+// pending, succeeded or failed. The .meta folder also holds the settings of
+// the knowledge base.
+
+// Ingestion statuses of knowledge base files
+const (
+    ingestionPending   = "pending"
+    ingestionProcessed = "processed"
+    ingestionFailed    = "failed"
+)
+
+// maxConcurrentIngestions bounds the number of files ingested at once
+const maxConcurrentIngestions = 2
+
+// metaDir is the folder of a knowledge base holding what was derived from
+// its files. listFilesHandler skips it like every folder.
+const metaDir = ".meta"
+
+// ingestionRecord is the ingestion state of a knowledge base file
+type ingestionRecord struct {
+    Status      string    `json:"status"`
+    Error       string    `json:"error,omitempty"`
+    Size        int64     `json:"size"`    // of the file the record is about
+    ModTime     time.Time `json:"modTime"` // of the file the record is about
+    ProcessedAt time.Time `json:"processedAt"`
+    TextLength  int       `json:"textLength"` // in characters
+    Chunks      int       `json:"chunks"`
+}
+
+// current reports whether the record is about the file as it is now
+func (rec *ingestionRecord) current(info fs.FileInfo) bool {
+    return rec.Size == info.Size() && rec.ModTime.Equal(info.ModTime())
+}
+
+func ingestionRecordPath(knowledgeBase, name string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "status", name+".json")
+}
+
+func extractedTextPath(knowledgeBase, name string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "text", name+".txt")
+}
+
+// writeMetaFile writes a file of the .meta folder of a knowledge base,
+// creating its folder if needed
+func (s *Server) writeMetaFile(name string, data []byte) error {
+    if err := s.store.MkdirAll(path.Dir(name)); err != nil {
+        return err
+    }
+    return writeFileAtomic(s.store, name, data)
+}
+
+// ingestionRecord returns the ingestion record of a file, or an error
+// wrapping fs.ErrNotExist if it was never queued
+func (s *Server) ingestionRecord(knowledgeBase, name string) (*ingestionRecord, error) {
+    data, err := s.store.ReadFile(ingestionRecordPath(knowledgeBase, name))
+    if err != nil {
+        return nil, err
+    }
+    var rec ingestionRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return nil, err
+    }
+    return &rec, nil
+}
+
+func (s *Server) saveIngestionRecord(knowledgeBase, name string, rec *ingestionRecord) error {
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    return s.writeMetaFile(ingestionRecordPath(knowledgeBase, name), data)
+}
+
+// extractedText returns the text extracted from a file
+func (s *Server) extractedText(knowledgeBase, name string) (string, error) {
+    data, err := s.store.ReadFile(extractedTextPath(knowledgeBase, name))
+    return string(data), err
+}
+
+// queueIngestion marks a file as pending and extracts and chunks its text
+// in the background. It returns the pending record.
+func (s *Server) queueIngestion(knowledgeBase, name string, info fs.FileInfo) (*ingestionRecord, error) {
+    rec := &ingestionRecord{Status: ingestionPending, Size: info.Size(), ModTime: info.ModTime().UTC()}
+    if err := s.saveIngestionRecord(knowledgeBase, name, rec); err != nil {
+        return nil, err
+    }
+
+    s.ingesting.Add(1)
+    go func() {
+        defer s.ingesting.Done()
+        s.ingestSlots <- struct{}{}
+        defer func() { <-s.ingestSlots }()
+        s.ingest(knowledgeBase, name)
+    }()
+    return rec, nil
+}
+
+// ingest extracts, chunks and embeds the text of a file and records the
+// outcome. Files changed while they are ingested are ingested again by the
+// next queueIngestion.
+func (s *Server) ingest(knowledgeBase, name string) {
+    unlock := s.ingestLocks.Lock(path.Join(knowledgeBase, name))
+    defer unlock()
+
+    file := path.Join(knowledgeBaseDir(knowledgeBase), name)
+    info, err := s.store.Stat(file)
+    if err != nil {
+        return // deleted in the meantime
+    }
+    rec := &ingestionRecord{Size: info.Size(), ModTime: info.ModTime().UTC()}
+
+    var text string
+    var chunks chunkFile
+    data, err := s.store.ReadFile(file)
+    if err == nil {
+        text, err = extractText(path.Ext(name), data, s.maxUploadSize)
+    }
+    if err == nil {
+        err = s.writeMetaFile(extractedTextPath(knowledgeBase, name), []byte(text))
+    }
+    if err == nil {
+        var settings knowledgeBaseSettings
+        settings, err = s.knowledgeBaseSettings(knowledgeBase)
+        chunks = chunkFile{Settings: settings.Chunking, Chunks: chunkText(name, text, settings.Chunking)}
+    }
+    if err == nil {
+        // The vectors are written first since the knowledge index reads
+        // them when the chunk file changes
+        data, _ = json.Marshal(s.embedChunks(chunks.Chunks))
+        err = s.writeMetaFile(vectorsPath(knowledgeBase, name), data)
+    }
+    if err == nil {
+        data, _ = json.Marshal(chunks)
+        err = s.writeMetaFile(chunksPath(knowledgeBase, name), data)
+    }
+    if err != nil {
+        rec.Status = ingestionFailed
+        rec.Error = err.Error()
+        // Remove what was derived from an earlier version
+        s.removeDerivedFiles(knowledgeBase, name)
+    } else {
+        rec.Status = ingestionProcessed
+        rec.TextLength = utf8.RuneCountInString(text)
+        rec.Chunks = len(chunks.Chunks)
+    }
+    rec.ProcessedAt = s.now().UTC()
+    s.saveIngestionRecord(knowledgeBase, name, rec)
+}
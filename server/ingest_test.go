@@ -0,0 +1,72 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestIngestion(t *testing.T) {
+    s := newFixtureServer(t)
+    listFiles := func(t *testing.T, knowledgeBase string) map[string]FileInfoResponse {
+        t.Helper()
+        rec := serve(s, http.MethodPost, "/list-files-knowledgebase", `{"knowledgeBaseName":"`+knowledgeBase+`"}`)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("list: status = %d; body: %s", rec.Code, rec.Body.String())
+        }
+        var got ListFilesResponse
+        decodeBody(t, rec, &got)
+        files := map[string]FileInfoResponse{}
+        for _, f := range got.Files {
+            files[f.Name] = f
+        }
+        return files
+    }
+
+    for name, content := range map[string]string{"notes.txt": "Remember   the milk", "photo.png": "png"} {
+        rec := httptest.NewRecorder()
+        s.ServeHTTP(rec, uploadRequest(t, "/upload?title=Writer", name, content))
+        if rec.Code != http.StatusOK {
+            t.Fatalf("upload %s: status = %d; body: %s", name, rec.Code, rec.Body.String())
+        }
+    }
+    s.Wait()
+
+    files := listFiles(t, "Writer")
+    if f := files["notes.txt"]; f.Status != ingestionProcessed || f.TextLength != len("Remember the milk") || f.Chunks != 1 || f.Error != "" {
+        t.Errorf("notes.txt = %+v, want processed", f)
+    }
+    if f := files["photo.png"]; f.Status != ingestionFailed || f.Error != `text extraction is not supported for ".png" files` {
+        t.Errorf("photo.png = %+v, want failed", f)
+    }
+    if _, ok := files[metaDir]; ok {
+        t.Errorf("listing has the %s folder", metaDir)
+    }
+    if text, err := s.extractedText("Writer", "notes.txt"); err != nil || text != "Remember the milk" {
+        t.Errorf("extracted text = %q, %v", text, err)
+    }
+    wantMissing(t, s, extractedTextPath("Writer", "photo.png"))
+
+    // Files added or changed without an upload are ingested when listed
+    if err := s.store.WriteFile("knowledgebases/Writer/notes.txt", []byte("")); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.store.WriteFile("knowledgebases/Writer/todo.md", []byte("# Todo")); err != nil {
+        t.Fatal(err)
+    }
+    files = listFiles(t, "Writer")
+    if files["todo.md"].Status != ingestionPending || files["notes.txt"].Status != ingestionPending {
+        t.Errorf("statuses after changes = %s, %s; want pending", files["todo.md"].Status, files["notes.txt"].Status)
+    }
+    s.Wait()
+
+    files = listFiles(t, "Writer")
+    if f := files["todo.md"]; f.Status != ingestionProcessed || f.TextLength != len("# Todo") {
+        t.Errorf("todo.md = %+v, want processed", f)
+    }
+    if f := files["notes.txt"]; f.Status != ingestionFailed || f.Error != errNoText.Error() {
+        t.Errorf("emptied notes.txt = %+v, want failed", f)
+    }
+    wantMissing(t, s, extractedTextPath("Writer", "notes.txt"))
+    wantMissing(t, s, chunksPath("Writer", "notes.txt"))
+}
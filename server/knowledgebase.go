@@ -0,0 +1,578 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net/http"
+    "path"
+    "slices"
+    "time"
+)
+
+// knowledgeBaseRoot is the folder holding one folder per knowledge base.
+// Knowledge bases are shared: any number of assistants can be attached to
+// the same knowledge base.
+const knowledgeBaseRoot = "knowledgebases"
+
+// knowledgeBaseDir returns the folder holding the files of a knowledge base
+func knowledgeBaseDir(name string) string {
+    return path.Join(knowledgeBaseRoot, name)
+}
+
+// attachmentsPath returns the file listing the knowledge bases attached to
+// an assistant
+func attachmentsPath(assistant string) string {
+    return path.Join("assistants", assistant, "knowledgeBases.json")
+}
+
+// attachedKnowledgeBases returns the names of the knowledge bases attached
+// to an assistant
+func (s *Server) attachedKnowledgeBases(assistant string) ([]string, error) {
+    data, err := s.store.ReadFile(attachmentsPath(assistant))
+    if errors.Is(err, fs.ErrNotExist) {
+        return []string{}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var names []string
+    if err := json.Unmarshal(data, &names); err != nil {
+        return nil, fmt.Errorf("%s: %w", attachmentsPath(assistant), err)
+    }
+    if names == nil {
+        names = []string{}
+    }
+    return names, nil
+}
+
+// updateAttachments changes the knowledge bases attached to an assistant
+// under its lock. The file is only written if change returns a different
+// list.
+func (s *Server) updateAttachments(assistant string, change func(names []string) []string) error {
+    unlock := s.assistantLocks.Lock(assistant)
+    defer unlock()
+
+    names, err := s.attachedKnowledgeBases(assistant)
+    if err != nil {
+        return err
+    }
+    updated := change(slices.Clone(names))
+    if slices.Equal(names, updated) {
+        return nil
+    }
+    data, err := json.MarshalIndent(updated, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(s.store, attachmentsPath(assistant), data)
+}
+
+// attaching returns the change attaching a knowledge base, if it is not
+// attached yet
+func attaching(name string) func(names []string) []string {
+    return func(names []string) []string {
+        if slices.Contains(names, name) {
+            return names
+        }
+        return append(names, name)
+    }
+}
+
+// updateAllAttachments applies change to the attachments of every assistant
+func (s *Server) updateAllAttachments(change func(names []string) []string) error {
+    assistants, err := s.store.ReadDir("assistants")
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    for _, a := range assistants {
+        if a.IsDir() {
+            if err := s.updateAttachments(a.Name(), change); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// DirectoryRequest represents the structure of the incoming request for directory creation
+type DirectoryRequest struct {
+    Name string `json:"name" validate:"required,max=100,charset=name"`
+}
+
+// DirectoryResponse represents the structure of the response for directory creation
+type DirectoryResponse struct {
+    Message string `json:"message"`
+}
+
+// Create Directory Handler
+func (s *Server) createDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var dirRequest DirectoryRequest
+    if !decodeRequest(w, r, &dirRequest) {
+        return
+    }
+
+    // Create the directory in the knowledge base registry
+    err := s.store.MkdirAll(knowledgeBaseRoot)
+    if err != nil {
+        http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+        return
+    }
+    err = s.store.Mkdir(knowledgeBaseDir(dirRequest.Name))
+    if errors.Is(err, fs.ErrExist) {
+        http.Error(w, "A knowledge base with this name already exists", http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+        return
+    }
+
+    // Respond with success message
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(DirectoryResponse{Message: "Directory created successfully"})
+}
+
+// ListDirectoriesResponse represents the structure of the response for listing directories
+type ListDirectoriesResponse struct {
+    Directories []string `json:"directories"`
+}
+
+// List Directories Handler
+func (s *Server) listDirectoriesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    // Read the knowledge base registry
+    files, err := s.store.ReadDir(knowledgeBaseRoot)
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, "Failed to read knowledge base directory", http.StatusInternalServerError)
+        return
+    }
+
+    directories := []string{}
+    for _, file := range files {
+        if file.IsDir() {
+            directories = append(directories, file.Name())
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ListDirectoriesResponse{Directories: directories})
+}
+// DeleteDirectoryRequest represents the structure of the incoming request for directory deletion
+type DeleteDirectoryRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+}
+
+// DeleteDirectoryResponse represents the structure of the response for directory deletion
+type DeleteDirectoryResponse struct {
+    Message string `json:"message"`
+}
+
+// Delete Directory Handler
+func (s *Server) deleteDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var deleteRequest DeleteDirectoryRequest
+    if !decodeRequest(w, r, &deleteRequest) {
+        return
+    }
+
+    // Wait for uploads being stored into the knowledge base
+    unlock := s.storeLocks.Lock(deleteRequest.KnowledgeBaseName)
+    defer unlock()
+
+    // Create the path to the directory to be deleted
+    dirPath := knowledgeBaseDir(deleteRequest.KnowledgeBaseName)
+
+    if !s.exists(dirPath) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+
+    // Detach it from all assistants, then remove the directory
+    err := s.updateAllAttachments(func(names []string) []string {
+        return slices.DeleteFunc(names, func(name string) bool { return name == deleteRequest.KnowledgeBaseName })
+    })
+    if err != nil {
+        http.Error(w, "Failed to detach knowledge base", http.StatusInternalServerError)
+        return
+    }
+    err = s.store.RemoveAll(dirPath)
+    if err != nil {
+        http.Error(w, "Failed to delete directory", http.StatusInternalServerError)
+        return
+    }
+    s.knowledge.dropKnowledgeBase(deleteRequest.KnowledgeBaseName)
+
+    // Respond with success message
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(DeleteDirectoryResponse{Message: "Directory deleted successfully"})
+}
+
+// RenameDirectoryRequest represents the structure of the incoming request for directory renaming
+type RenameDirectoryRequest struct {
+    CurrentName string `json:"currentName" validate:"required,max=100,charset=name"`
+    NewName     string `json:"newName" validate:"required,max=100,charset=name"`
+}
+
+// Rename Directory Handler
+func (s *Server) renameDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var renameRequest RenameDirectoryRequest
+    if !decodeRequest(w, r, &renameRequest) {
+        return
+    }
+
+    // Wait for uploads being stored into either knowledge base
+    unlock := s.storeLocks.LockAll(renameRequest.CurrentName, renameRequest.NewName)
+    defer unlock()
+
+    currentDir := knowledgeBaseDir(renameRequest.CurrentName)
+    newDir := knowledgeBaseDir(renameRequest.NewName)
+
+    if !s.exists(currentDir) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+    if s.exists(newDir) {
+        http.Error(w, "A knowledge base with this name already exists", http.StatusConflict)
+        return
+    }
+
+    err := s.store.Rename(currentDir, newDir)
+    if err != nil {
+        http.Error(w, "Failed to rename directory", http.StatusInternalServerError)
+        return
+    }
+    s.knowledge.dropKnowledgeBase(renameRequest.CurrentName) // indexed under the new name by the next search
+
+    // Assistants stay attached under the new name
+    err = s.updateAllAttachments(func(names []string) []string {
+        for i, name := range names {
+            if name == renameRequest.CurrentName {
+                names[i] = renameRequest.NewName
+            }
+        }
+        return names
+    })
+    if err != nil {
+        http.Error(w, "Failed to update attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Directory renamed successfully"})
+}
+// FileInfoResponse represents the structure of the response for file information
+type FileInfoResponse struct {
+    Name         string `json:"name"`
+    Type         string `json:"type"`        // image, video, audio, document or unknown
+    ContentType  string `json:"contentType"` // MIME type detected from the content
+    Size         int64  `json:"size"`        // in bytes
+    SHA256       string `json:"sha256"`
+    OriginalName string `json:"originalName"` // as uploaded
+    UploadedBy   string `json:"uploadedBy,omitempty"`
+    CreationTime string `json:"creationTime"` // when a file of the name was first uploaded
+    UpdatedTime  string `json:"updatedTime"`  // when the content last changed
+    // Status tells whether the text of the file was extracted: pending,
+    // processed or failed, with the reason in Error
+    Status     string `json:"status"`
+    Error      string `json:"error,omitempty"`
+    TextLength int    `json:"textLength"` // in characters of the extracted text
+    Chunks     int    `json:"chunks"`     // number of chunks the text was split into
+}
+
+// ListFilesRequest represents the structure of the incoming request for listing files
+type ListFilesRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    // Sort defaults to name; names and types sort ascending by default,
+    // sizes and times descending
+    Sort  string `json:"sort,omitempty" validate:"oneof=name|size|type|createdAt|updatedAt"`
+    Order string `json:"order,omitempty" validate:"oneof=asc|desc"`
+    // Filters, all of which must match
+    Type         string `json:"type,omitempty" validate:"oneof=image|video|audio|document|unknown"`
+    ContentType  string `json:"contentType,omitempty" validate:"max=255"` // such as application/pdf or image/*
+    Status       string `json:"status,omitempty" validate:"oneof=pending|processed|failed"`
+    UploadedBy   string `json:"uploadedBy,omitempty" validate:"max=100"`
+    NameContains string `json:"nameContains,omitempty" validate:"max=255"` // ignoring case
+    MinSize      int64  `json:"minSize,omitempty"`                         // in bytes
+    MaxSize      int64  `json:"maxSize,omitempty"`                         // in bytes
+}
+
+// ListFilesResponse represents the structure of the response for listing files
+type ListFilesResponse struct {
+    Files []FileInfoResponse `json:"files"`
+}
+
+// List Files Handler
+func (s *Server) listFilesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var listRequest ListFilesRequest
+    if !decodeRequest(w, r, &listRequest) {
+        return
+    }
+
+    // Define the path to the specified knowledge base directory
+    dir := knowledgeBaseDir(listRequest.KnowledgeBaseName)
+
+    // Read the directory
+    files, err := s.store.ReadDir(dir)
+    if err != nil {
+        writeStoreError(w, err, "Knowledge base not found", "Failed to read directory")
+        return
+    }
+
+    fileInfos := []FileInfoResponse{}
+    for _, file := range files {
+        if !file.IsDir() { // Only process files
+            fileInfo, err := file.Info()
+            if err != nil {
+                continue // Skip if we can't get file info
+            }
+
+            // Determine the file type and checksum based on the content
+            meta, err := s.fileMetadata(listRequest.KnowledgeBaseName, file.Name())
+            if err != nil {
+                continue // deleted in the meantime
+            }
+
+            // Files without an up to date ingestion record, e.g. copied
+            // into the folder by hand, are queued for ingestion
+            ingestion, err := s.ingestionRecord(listRequest.KnowledgeBaseName, file.Name())
+            if err != nil || !ingestion.current(fileInfo) {
+                ingestion, err = s.queueIngestion(listRequest.KnowledgeBaseName, file.Name(), fileInfo)
+                if err != nil {
+                    http.Error(w, "Failed to queue file for ingestion", http.StatusInternalServerError)
+                    return
+                }
+            }
+
+            fileInfos = append(fileInfos, FileInfoResponse{
+                Name:         file.Name(),
+                Type:         fileCategory(meta.ContentType),
+                ContentType:  meta.ContentType,
+                Size:         meta.Size,
+                SHA256:       meta.SHA256,
+                OriginalName: meta.OriginalName,
+                UploadedBy:   meta.UploadedBy,
+                CreationTime: meta.UploadedAt.UTC().Format(time.RFC3339),
+                UpdatedTime:  meta.UpdatedAt.UTC().Format(time.RFC3339),
+                Status:       ingestion.Status,
+                Error:        ingestion.Error,
+                TextLength:   ingestion.TextLength,
+                Chunks:       ingestion.Chunks,
+            })
+        }
+    }
+
+    fileInfos = slices.DeleteFunc(fileInfos, func(f FileInfoResponse) bool {
+        return !matchesFileFilters(f, listRequest)
+    })
+    sortFiles(fileInfos, listRequest.Sort, listRequest.Order)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(ListFilesResponse{Files: fileInfos})
+}
+
+// AttachKnowledgeBaseRequest represents the structure of the incoming request for attaching a knowledge base to an assistant, or detaching it
+type AttachKnowledgeBaseRequest struct {
+    AssistantTitle    string `json:"assistantTitle" validate:"required,max=100,charset=name"`
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+}
+
+// Attach Knowledge Base Handler. Attaching a knowledge base twice has no
+// effect.
+func (s *Server) attachKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var attachRequest AttachKnowledgeBaseRequest
+    if !decodeRequest(w, r, &attachRequest) {
+        return
+    }
+
+    if !s.exists(path.Join("assistants", attachRequest.AssistantTitle)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    if !s.exists(knowledgeBaseDir(attachRequest.KnowledgeBaseName)) {
+        http.Error(w, "Knowledge base not found", http.StatusNotFound)
+        return
+    }
+
+    err := s.updateAttachments(attachRequest.AssistantTitle, attaching(attachRequest.KnowledgeBaseName))
+    if err != nil {
+        http.Error(w, "Failed to update attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Knowledge base attached successfully"})
+}
+
+// Detach Knowledge Base Handler. The knowledge base itself is kept.
+func (s *Server) detachKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var detachRequest AttachKnowledgeBaseRequest
+    if !decodeRequest(w, r, &detachRequest) {
+        return
+    }
+
+    if !s.exists(path.Join("assistants", detachRequest.AssistantTitle)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+
+    attached := false
+    err := s.updateAttachments(detachRequest.AssistantTitle, func(names []string) []string {
+        attached = slices.Contains(names, detachRequest.KnowledgeBaseName)
+        return slices.DeleteFunc(names, func(name string) bool { return name == detachRequest.KnowledgeBaseName })
+    })
+    if err != nil {
+        http.Error(w, "Failed to update attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+    if !attached {
+        http.Error(w, "Knowledge base is not attached to the assistant", http.StatusNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Knowledge base detached successfully"})
+}
+
+// AssistantKnowledgeBasesResponse represents the structure of the response for listing the knowledge bases of an assistant
+type AssistantKnowledgeBasesResponse struct {
+    Title          string   `json:"title"`
+    KnowledgeBases []string `json:"knowledgeBases"`
+}
+
+// List Assistant Knowledge Bases Handler
+func (s *Server) listAssistantKnowledgeBasesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "title", titleRules) {
+        return
+    }
+    title := r.URL.Query().Get("title")
+
+    if !s.exists(path.Join("assistants", title)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    names, err := s.attachedKnowledgeBases(title)
+    if err != nil {
+        http.Error(w, "Failed to read attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(AssistantKnowledgeBasesResponse{Title: title, KnowledgeBases: names})
+}
+
+// MigrateKnowledgeBases moves knowledge bases kept in the layout of earlier
+// versions into the registry and returns how many were moved. The
+// KnowledgeBase folder of every assistant becomes a knowledge base named
+// after the assistant, attached to it. Top-level folders, which used to be
+// listed as knowledge bases, are only moved if named in folders, since the
+// data directory may hold unrelated folders.
+func MigrateKnowledgeBases(store Store, folders ...string) (int, error) {
+    s := &Server{store: store}
+    if err := store.MkdirAll(knowledgeBaseRoot); err != nil {
+        return 0, err
+    }
+    move := func(from, name string) (bool, error) {
+        if _, err := store.Stat(from); errors.Is(err, fs.ErrNotExist) {
+            return false, nil
+        }
+        if _, err := store.Stat(knowledgeBaseDir(name)); err == nil {
+            return false, fmt.Errorf("cannot move %s: knowledge base %q already exists", from, name)
+        }
+        return true, store.Rename(from, knowledgeBaseDir(name))
+    }
+
+    moved := 0
+    assistants, err := store.ReadDir("assistants")
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return 0, err
+    }
+    for _, a := range assistants {
+        if !a.IsDir() {
+            continue
+        }
+        ok, err := move(path.Join("assistants", a.Name(), "KnowledgeBase"), a.Name())
+        if err != nil {
+            return moved, err
+        }
+        if !ok {
+            continue
+        }
+        moved++
+        if err := s.updateAttachments(a.Name(), attaching(a.Name())); err != nil {
+            return moved, err
+        }
+    }
+
+    for _, folder := range folders {
+        if errs := validateValue("folder", folder, titleRules); len(errs) > 0 || folder == "assistants" || folder == "History" || folder == knowledgeBaseRoot {
+            return moved, fmt.Errorf("%q is not a knowledge base folder", folder)
+        }
+        ok, err := move(folder, folder)
+        if err != nil {
+            return moved, err
+        }
+        if ok {
+            moved++
+        }
+    }
+    return moved, nil
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sort"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+func TestKnowledgeBaseHandlers(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "create",
+            method: http.MethodPost,
+            target: "/create-knowledgebase",
+            body:   `{"name":"Recipes"}`,
+            status: http.StatusCreated,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                if !s.exists("knowledgebases/Recipes") {
+                    t.Error("knowledge base directory was not created")
+                }
+            },
+        },
+        {
+            name:   "create existing",
+            method: http.MethodPost,
+            target: "/create-knowledgebase",
+            body:   `{"name":"Manuals"}`,
+            status: http.StatusConflict,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "knowledgebases/Manuals/guide.pdf", "%PDF-1.4")
+            },
+        },
+        {
+            name:   "list",
+            method: http.MethodGet,
+            target: "/list-knowledgebase",
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got ListDirectoriesResponse
+                decodeBody(t, rec, &got)
+                sort.Strings(got.Directories)
+                want := []string{"Archive", "Manuals", "Reviewer"}
+                if !reflect.DeepEqual(got.Directories, want) {
+                    t.Errorf("directories = %v, want %v", got.Directories, want)
+                }
+            },
+        },
+        {
+            name:   "delete",
+            method: http.MethodPost,
+            target: "/delete-knowledgebase",
+            body:   `{"knowledgeBaseName":"Manuals"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "knowledgebases/Manuals")
+                wantFile(t, s, "assistants/Reviewer/knowledgeBases.json", "[\n  \"Reviewer\"\n]")
+            },
+        },
+        {
+            name:   "delete missing",
+            method: http.MethodPost,
+            target: "/delete-knowledgebase",
+            body:   `{"knowledgeBaseName":"Recipes"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "delete outside the data directory",
+            method: http.MethodPost,
+            target: "/delete-knowledgebase",
+            body:   `{"knowledgeBaseName":".."}`,
+            status: http.StatusBadRequest,
+        },
+        {
+            name:   "rename",
+            method: http.MethodPut,
+            target: "/rename-knowledgebase",
+            body:   `{"currentName":"Manuals","newName":"Guides"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantMissing(t, s, "knowledgebases/Manuals")
+                wantFile(t, s, "knowledgebases/Guides/guide.pdf", "%PDF-1.4")
+                wantFile(t, s, "assistants/Reviewer/knowledgeBases.json", "[\n  \"Reviewer\",\n  \"Guides\"\n]")
+            },
+        },
+        {
+            name:   "rename missing",
+            method: http.MethodPut,
+            target: "/rename-knowledgebase",
+            body:   `{"currentName":"Recipes","newName":"Cooking"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "rename onto existing knowledge base",
+            method: http.MethodPut,
+            target: "/rename-knowledgebase",
+            body:   `{"currentName":"Manuals","newName":"Archive"}`,
+            status: http.StatusConflict,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                wantFile(t, s, "knowledgebases/Manuals/guide.pdf", "%PDF-1.4")
+            },
+        },
+        {
+            name:   "list files",
+            method: http.MethodPost,
+            target: "/list-files-knowledgebase",
+            body:   `{"knowledgeBaseName":"Manuals"}`,
+            status: http.StatusOK,
+            check: func(t *testing.T, s *Server, rec *httptest.ResponseRecorder) {
+                var got ListFilesResponse
+                decodeBody(t, rec, &got)
+                types := map[string]string{}
+                for _, f := range got.Files {
+                    types[f.Name] = f.Type
+                    if f.CreationTime == "" || f.UpdatedTime == "" {
+                        t.Errorf("%s has no times: %+v", f.Name, f)
+                    }
+                }
+                want := map[string]string{"guide.pdf": "document", "diagram.png": "image"}
+                if !reflect.DeepEqual(types, want) {
+                    t.Errorf("file types = %v, want %v", types, want)
+                }
+            },
+        },
+        {
+            name:   "list files of missing knowledge base",
+            method: http.MethodPost,
+            target: "/list-files-knowledgebase",
+            body:   `{"knowledgeBaseName":"Recipes"}`,
+            status: http.StatusNotFound,
+        },
+    })
+}
+
+func TestKnowledgeBaseChangesWaitForUploads(t *testing.T) {
+    tests := []struct {
+        name, method, target, body, locked string
+    }{
+        {"delete", http.MethodPost, "/delete-knowledgebase", `{"knowledgeBaseName":"Manuals"}`, "Manuals"},
+        {"rename from", http.MethodPut, "/rename-knowledgebase", `{"currentName":"Manuals","newName":"Guides"}`, "Manuals"},
+        {"rename to", http.MethodPut, "/rename-knowledgebase", `{"currentName":"Manuals","newName":"Guides"}`, "Guides"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newFixtureServer(t)
+            // As if an upload were being stored
+            unlock := s.storeLocks.Lock(tt.locked)
+            done := make(chan *httptest.ResponseRecorder)
+            go func() { done <- serve(s, tt.method, tt.target, tt.body) }()
+            select {
+            case <-done:
+                t.Fatalf("changed %s while an upload was stored", tt.locked)
+            case <-time.After(50 * time.Millisecond):
+            }
+            unlock()
+            if rec := <-done; rec.Code != http.StatusOK {
+                t.Errorf("status = %d; body: %s", rec.Code, rec.Body.String())
+            }
+        })
+    }
+}
+
+func TestAttachKnowledgeBases(t *testing.T) {
+    attached := func(t *testing.T, s *Server, title string) []string {
+        t.Helper()
+        rec := serve(s, http.MethodGet, "/list-assistant-knowledgebases?title="+title, "")
+        if rec.Code != http.StatusOK {
+            t.Fatalf("list: status = %d; body: %s", rec.Code, rec.Body.String())
+        }
+        var got AssistantKnowledgeBasesResponse
+        decodeBody(t, rec, &got)
+        return got.KnowledgeBases
+    }
+
+    s := newFixtureServer(t)
+    if got := attached(t, s, "Writer"); len(got) != 0 {
+        t.Errorf("Writer has %v attached, want none", got)
+    }
+
+    // The same knowledge base can be attached to several assistants
+    for i := 0; i < 2; i++ {
+        rec := serve(s, http.MethodPost, "/attach-knowledgebase", `{"assistantTitle":"Writer","knowledgeBaseName":"Manuals"}`)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("attach: status = %d; body: %s", rec.Code, rec.Body.String())
+        }
+    }
+    if got, want := attached(t, s, "Writer"), []string{"Manuals"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Writer has %v attached, want %v", got, want)
+    }
+    if got, want := attached(t, s, "Reviewer"), []string{"Reviewer", "Manuals"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Reviewer has %v attached, want %v", got, want)
+    }
+
+    rec := serve(s, http.MethodPost, "/detach-knowledgebase", `{"assistantTitle":"Reviewer","knowledgeBaseName":"Manuals"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("detach: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if got, want := attached(t, s, "Reviewer"), []string{"Reviewer"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Reviewer has %v attached, want %v", got, want)
+    }
+    wantFile(t, s, "knowledgebases/Manuals/guide.pdf", "%PDF-1.4")
+}
+
+func TestAttachKnowledgeBaseErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {name: "attach to unknown assistant", method: http.MethodPost, target: "/attach-knowledgebase", body: `{"assistantTitle":"Nobody","knowledgeBaseName":"Manuals"}`, status: http.StatusNotFound},
+        {name: "attach unknown knowledge base", method: http.MethodPost, target: "/attach-knowledgebase", body: `{"assistantTitle":"Writer","knowledgeBaseName":"Recipes"}`, status: http.StatusNotFound},
+        {name: "detach knowledge base not attached", method: http.MethodPost, target: "/detach-knowledgebase", body: `{"assistantTitle":"Writer","knowledgeBaseName":"Manuals"}`, status: http.StatusNotFound},
+        {name: "list of unknown assistant", method: http.MethodGet, target: "/list-assistant-knowledgebases?title=Nobody", status: http.StatusNotFound},
+    })
+}
+
+func TestMigrateKnowledgeBases(t *testing.T) {
+    s := newTestServer(t)
+    err := LoadFixtures(s.store, fstest.MapFS{
+        "assistants/Reviewer/roleSetting.txt":               {Data: []byte("You review code")},
+        "assistants/Reviewer/KnowledgeBase/style.md":        {Data: []byte("# Style")},
+        "assistants/Writer/roleSetting.txt":                 {Data: []byte("You write docs")},
+        "Manuals/guide.pdf":                                 {Data: []byte("%PDF-1.4")},
+        "History/a16ba0d9-1e57-4db1-aa42-eec315130c8e.json": {Data: []byte("{}")},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    n, err := MigrateKnowledgeBases(s.store, "Manuals")
+    if err != nil || n != 2 {
+        t.Fatalf("MigrateKnowledgeBases() = %d, %v; want 2", n, err)
+    }
+    wantFile(t, s, "knowledgebases/Reviewer/style.md", "# Style")
+    wantFile(t, s, "knowledgebases/Manuals/guide.pdf", "%PDF-1.4")
+    wantMissing(t, s, "assistants/Reviewer/KnowledgeBase")
+    if names, _ := s.attachedKnowledgeBases("Reviewer"); !reflect.DeepEqual(names, []string{"Reviewer"}) {
+        t.Errorf("Reviewer has %v attached", names)
+    }
+
+    // Migrating again finds nothing to move
+    if n, err := MigrateKnowledgeBases(s.store, "Manuals"); err != nil || n != 0 {
+        t.Errorf("second migration = %d, %v; want 0", n, err)
+    }
+    if _, err := MigrateKnowledgeBases(s.store, "History"); err == nil {
+        t.Error("migrating the History folder succeeded")
+    }
+}
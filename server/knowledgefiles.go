@@ -0,0 +1,253 @@
+package server
+
+import (
+    "cmp"
+    "encoding/json"
+    "errors"
+    "io/fs"
+    "mime"
+    "net/http"
+    "path"
+    "unicode/utf8"
+)
+
+// fileNameRules validates the name of a knowledge base file
+const fileNameRules = "required,max=255,charset=name"
+
+// defaultPreviewLength is the length of a file preview in characters
+const defaultPreviewLength = 1000
+
+// knowledgeFile returns the path of a file of a knowledge base
+func knowledgeFile(knowledgeBase, name string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), name)
+}
+
+// removeDerivedFiles removes the text, chunks and vectors derived from a
+// knowledge base file
+func (s *Server) removeDerivedFiles(knowledgeBase, name string) {
+    s.store.Remove(extractedTextPath(knowledgeBase, name))
+    s.store.Remove(chunksPath(knowledgeBase, name))
+    s.store.Remove(vectorsPath(knowledgeBase, name))
+}
+
+// isKnowledgeFile reports whether name is a file, not a folder, of a
+// knowledge base
+func (s *Server) isKnowledgeFile(knowledgeBase, name string) bool {
+    info, err := s.store.Stat(knowledgeFile(knowledgeBase, name))
+    return err == nil && !info.IsDir()
+}
+
+// readExtractedText returns the text extracted from a knowledge base file.
+// Files that are missing, or whose text was not extracted, are answered
+// with 404 and 409 and ok is false.
+func (s *Server) readExtractedText(w http.ResponseWriter, knowledgeBase, name string) (text string, ok bool) {
+    if !s.isKnowledgeFile(knowledgeBase, name) {
+        http.Error(w, "File not found", http.StatusNotFound)
+        return "", false
+    }
+    ingestion, err := s.ingestionRecord(knowledgeBase, name)
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, "Failed to read ingestion status", http.StatusInternalServerError)
+        return "", false
+    }
+    if ingestion == nil || ingestion.Status == ingestionPending {
+        http.Error(w, "The text of the file has not been extracted yet", http.StatusConflict)
+        return "", false
+    }
+    if ingestion.Status == ingestionFailed {
+        http.Error(w, "Text extraction failed: "+ingestion.Error, http.StatusConflict)
+        return "", false
+    }
+    text, err = s.extractedText(knowledgeBase, name)
+    if err != nil {
+        http.Error(w, "Failed to read extracted text", http.StatusInternalServerError)
+        return "", false
+    }
+    return text, true
+}
+
+// inlineTypes are the content types shown inline on request. Files of
+// other types, such as HTML or SVG that could run scripts from the API's
+// origin, are always downloaded as attachments.
+var inlineTypes = map[string]bool{
+    "text/plain": true, "text/markdown": true, "text/csv": true, "application/json": true,
+    "application/pdf": true, "image/png": true, "image/jpeg": true, "image/gif": true,
+    "image/webp": true, "image/bmp": true,
+}
+
+// Download File Handler streams a knowledge base file with the content
+// type recorded in its metadata. Range and conditional requests are
+// answered by http.ServeContent.
+func (s *Server) downloadFileHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "knowledgeBaseName", titleRules) ||
+        !validateQuery(w, r, "fileName", fileNameRules) ||
+        !validateQuery(w, r, "disposition", "oneof=attachment|inline") {
+        return
+    }
+    query := r.URL.Query()
+    kb, name := query.Get("knowledgeBaseName"), query.Get("fileName")
+
+    f, err := s.store.Open(knowledgeFile(kb, name))
+    if err != nil {
+        writeStoreError(w, err, "File not found", "Failed to open file")
+        return
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        http.Error(w, "Failed to open file", http.StatusInternalServerError)
+        return
+    }
+    if info.IsDir() {
+        http.Error(w, "File not found", http.StatusNotFound)
+        return
+    }
+
+    meta, err := s.fileMetadata(kb, name)
+    if err != nil {
+        writeStoreError(w, err, "File not found", "Failed to open file")
+        return
+    }
+
+    disposition := cmp.Or(query.Get("disposition"), "attachment")
+    if !inlineTypes[meta.ContentType] {
+        disposition = "attachment"
+    }
+    w.Header().Set("Content-Type", meta.ContentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Set("Content-Security-Policy", "sandbox")
+    w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+    http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// FilePreviewRequest represents the structure of the incoming request for previewing a knowledge base file
+type FilePreviewRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    FileName          string `json:"fileName" validate:"required,max=255,charset=name"`
+    MaxLength         int    `json:"maxLength,omitempty" validate:"range=1|100000"` // in characters, 1000 by default
+}
+
+// FilePreviewResponse represents the structure of the response for previewing a knowledge base file
+type FilePreviewResponse struct {
+    FileName   string `json:"fileName"`
+    Preview    string `json:"preview"`    // start of the extracted text
+    TextLength int    `json:"textLength"` // in characters of the whole extracted text
+    Truncated  bool   `json:"truncated"`
+}
+
+// Preview File Handler returns the start of the text extracted from a
+// knowledge base file
+func (s *Server) previewFileHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var previewRequest FilePreviewRequest
+    if !decodeRequest(w, r, &previewRequest) {
+        return
+    }
+
+    text, ok := s.readExtractedText(w, previewRequest.KnowledgeBaseName, previewRequest.FileName)
+    if !ok {
+        return
+    }
+
+    resp := FilePreviewResponse{FileName: previewRequest.FileName, Preview: text, TextLength: utf8.RuneCountInString(text)}
+    maxLength := cmp.Or(previewRequest.MaxLength, defaultPreviewLength)
+    if resp.TextLength > maxLength {
+        resp.Preview = string([]rune(text)[:maxLength])
+        resp.Truncated = true
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteFileRequest represents the structure of the incoming request for deleting a knowledge base file
+type DeleteFileRequest struct {
+    KnowledgeBaseName string `json:"knowledgeBaseName" validate:"required,max=100,charset=name"`
+    FileName          string `json:"fileName" validate:"required,max=255,charset=name"`
+}
+
+// Delete File Handler removes a file from a knowledge base together with
+// what was derived from it
+func (s *Server) deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var deleteRequest DeleteFileRequest
+    if !decodeRequest(w, r, &deleteRequest) {
+        return
+    }
+    kb, name := deleteRequest.KnowledgeBaseName, deleteRequest.FileName
+
+    // Wait for a running ingestion, which would write its results after
+    // they were removed
+    unlock := s.ingestLocks.Lock(path.Join(kb, name))
+    defer unlock()
+
+    if !s.isKnowledgeFile(kb, name) {
+        http.Error(w, "File not found", http.StatusNotFound)
+        return
+    }
+    if err := s.store.Remove(knowledgeFile(kb, name)); err != nil {
+        http.Error(w, "Failed to delete file", http.StatusInternalServerError)
+        return
+    }
+    s.store.Remove(ingestionRecordPath(kb, name))
+    s.store.Remove(fileMetadataPath(kb, name))
+    s.removeDerivedFiles(kb, name)
+    s.knowledge.dropFile(kb, name)
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "File deleted successfully"})
+}
+
+// Replace File Handler overwrites a knowledge base file with an uploaded
+// one and ingests it again. The new content is written to the uploads
+// folder first, so the file is never seen half written.
+func (s *Server) replaceFileHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPut {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "knowledgeBaseName", titleRules) ||
+        !validateQuery(w, r, "fileName", fileNameRules) {
+        return
+    }
+    kb, name := r.URL.Query().Get("knowledgeBaseName"), r.URL.Query().Get("fileName")
+
+    if !s.isKnowledgeFile(kb, name) {
+        http.Error(w, "File not found", http.StatusNotFound)
+        return
+    }
+
+    uploads, ok := s.receiveUploads(w, r, kb, name)
+    if !ok {
+        return
+    }
+    results, ok := s.storeUploads(w, kb, uploads)
+    if !ok {
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(UploadResponse{Message: "File replaced successfully", Files: results})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestDownloadFile(t *testing.T) {
+    s := newFixtureServer(t)
+    download := func(target, rangeHeader string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, target, nil)
+        if rangeHeader != "" {
+            req.Header.Set("Range", rangeHeader)
+        }
+        rec := httptest.NewRecorder()
+        s.ServeHTTP(rec, req)
+        return rec
+    }
+
+    rec := download("/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=guide.pdf", "")
+    if rec.Code != http.StatusOK || rec.Body.String() != "%PDF-1.4" {
+        t.Fatalf("download: status = %d, body = %q", rec.Code, rec.Body.String())
+    }
+    for header, want := range map[string]string{
+        "Content-Type":        "application/pdf",
+        "Content-Disposition": `attachment; filename=guide.pdf`,
+        "Accept-Ranges":       "bytes",
+    } {
+        if got := rec.Header().Get(header); got != want {
+            t.Errorf("%s = %q, want %q", header, got, want)
+        }
+    }
+
+    rec = download("/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=guide.pdf&disposition=inline", "bytes=1-3")
+    if rec.Code != http.StatusPartialContent || rec.Body.String() != "PDF" || rec.Header().Get("Content-Range") != "bytes 1-3/8" {
+        t.Errorf("range: status = %d, body = %q, Content-Range = %q", rec.Code, rec.Body.String(), rec.Header().Get("Content-Range"))
+    }
+    if got := rec.Header().Get("Content-Disposition"); got != "inline; filename=guide.pdf" {
+        t.Errorf("Content-Disposition = %q, want inline", got)
+    }
+    // Files that could run scripts are never shown inline
+    s.store.WriteFile(knowledgeFile("Manuals", "page.html"), []byte("<html><script>alert(1)</script></html>"))
+    rec = download("/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=page.html&disposition=inline", "")
+    for header, want := range map[string]string{
+        "Content-Type":            "text/html",
+        "Content-Disposition":     `attachment; filename=page.html`,
+        "X-Content-Type-Options":  "nosniff",
+        "Content-Security-Policy": "sandbox",
+    } {
+        if got := rec.Header().Get(header); got != want {
+            t.Errorf("HTML file: %s = %q, want %q", header, got, want)
+        }
+    }
+    if rec = download("/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=guide.pdf", "bytes=100-"); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+        t.Errorf("range past the end: status = %d, want %d", rec.Code, http.StatusRequestedRangeNotSatisfiable)
+    }
+
+    runHandlerTests(t, []handlerTest{
+        {name: "missing file", method: http.MethodGet, target: "/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=missing.pdf", status: http.StatusNotFound},
+        {name: "folder", method: http.MethodGet, target: "/download-file-knowledgebase?knowledgeBaseName=Reviewer&fileName=" + metaDir, status: http.StatusNotFound},
+        {name: "path in file name", method: http.MethodGet, target: "/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=../Reviewer", status: http.StatusBadRequest},
+        {name: "unknown disposition", method: http.MethodGet, target: "/download-file-knowledgebase?knowledgeBaseName=Manuals&fileName=guide.pdf&disposition=popup", status: http.StatusBadRequest},
+    })
+}
+
+func TestPreviewFile(t *testing.T) {
+    s := newKnowledgeServer(t)
+    tests := []struct {
+        name   string
+        body   string
+        status int
+        want   FilePreviewResponse
+    }{
+        {
+            name:   "whole text",
+            body:   `{"knowledgeBaseName":"Manuals","fileName":"coffee.txt"}`,
+            status: http.StatusOK,
+            want:   FilePreviewResponse{FileName: "coffee.txt", Preview: "The coffee machine needs descaling. Use the blue button.", TextLength: 56},
+        },
+        {
+            name:   "truncated",
+            body:   `{"knowledgeBaseName":"Manuals","fileName":"coffee.txt","maxLength":10}`,
+            status: http.StatusOK,
+            want:   FilePreviewResponse{FileName: "coffee.txt", Preview: "The coffee", TextLength: 56, Truncated: true},
+        },
+        {name: "extraction failed", body: `{"knowledgeBaseName":"Manuals","fileName":"guide.pdf"}`, status: http.StatusConflict},
+        {name: "missing file", body: `{"knowledgeBaseName":"Manuals","fileName":"missing.txt"}`, status: http.StatusNotFound},
+        {name: "length too large", body: `{"knowledgeBaseName":"Manuals","fileName":"coffee.txt","maxLength":100001}`, status: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rec := serve(s, http.MethodPost, "/preview-file-knowledgebase", tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.status, rec.Body.String())
+            }
+            if tt.status != http.StatusOK {
+                return
+            }
+            var got FilePreviewResponse
+            decodeBody(t, rec, &got)
+            if got != tt.want {
+                t.Errorf("preview = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestDeleteFile(t *testing.T) {
+    s := newKnowledgeServer(t)
+    searchKnowledgeBases(t, s, `{"query":"coffee"}`)
+
+    rec := serve(s, http.MethodPost, "/delete-file-knowledgebase", `{"knowledgeBaseName":"Manuals","fileName":"coffee.txt"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    for _, name := range []string{
+        "knowledgebases/Manuals/coffee.txt",
+        ingestionRecordPath("Manuals", "coffee.txt"),
+        fileMetadataPath("Manuals", "coffee.txt"),
+        extractedTextPath("Manuals", "coffee.txt"),
+        chunksPath("Manuals", "coffee.txt"),
+        vectorsPath("Manuals", "coffee.txt"),
+    } {
+        wantMissing(t, s, name)
+    }
+    if _, ok := s.knowledge.knowledgeBases["Manuals"]["coffee.txt"]; ok {
+        t.Error("deleted file is still indexed")
+    }
+    if got := searchKnowledgeBases(t, s, `{"query":"coffee"}`); len(got) != 0 {
+        t.Errorf("search after delete = %v", resultChunks(got))
+    }
+
+    runHandlerTests(t, []handlerTest{
+        {name: "missing file", method: http.MethodPost, target: "/delete-file-knowledgebase", body: `{"knowledgeBaseName":"Manuals","fileName":"coffee.txt"}`, status: http.StatusNotFound},
+        {name: "folder", method: http.MethodPost, target: "/delete-file-knowledgebase", body: `{"knowledgeBaseName":"Manuals","fileName":".meta"}`, status: http.StatusNotFound},
+    })
+}
+
+func TestReplaceFile(t *testing.T) {
+    s := newKnowledgeServer(t)
+    searchKnowledgeBases(t, s, `{"query":"coffee"}`)
+
+    req := uploadRequest(t, "/replace-file-knowledgebase?knowledgeBaseName=Manuals&fileName=coffee.txt", "new.txt", "The tea kettle whistles.")
+    req.Method = http.MethodPut
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    s.Wait()
+
+    // The file keeps its name and is ingested again
+    wantFile(t, s, "knowledgebases/Manuals/coffee.txt", "The tea kettle whistles.")
+    wantMissing(t, s, "knowledgebases/Manuals/new.txt")
+    wantNoUploads(t, s, "Manuals")
+    if got := resultChunks(searchKnowledgeBases(t, s, `{"query":"kettle coffee"}`)); len(got) != 1 || got[0] != "Manuals/coffee.txt" {
+        t.Errorf("search after replace = %v", got)
+    }
+    if text, _ := s.extractedText("Manuals", "coffee.txt"); text != "The tea kettle whistles." {
+        t.Errorf("extracted text = %q", text)
+    }
+
+    req = uploadRequest(t, "/replace-file-knowledgebase?knowledgeBaseName=Manuals&fileName=missing.txt", "new.txt", "x")
+    req.Method = http.MethodPut
+    rec = httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("missing file: status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+}
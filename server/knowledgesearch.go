@@ -0,0 +1,483 @@
+package server
+
+import (
+    "cmp"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "maps"
+    "math"
+    "net/http"
+    "path"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Knowledge base search modes
+const (
+    searchLexical  = "lexical"  // BM25 ranking of the words of the query
+    searchSemantic = "semantic" // cosine similarity of the embeddings
+    searchHybrid   = "hybrid"   // both rankings fused by reciprocal rank
+)
+
+// Knowledge base search parameters
+const (
+    defaultKnowledgeTopK = 5
+    bm25K1               = 1.2  // saturation of the term frequency
+    bm25B                = 0.75 // weight of the chunk length normalization
+    rrfK                 = 60   // damping of the ranks in reciprocal rank fusion
+)
+
+// indexedChunk is a chunk as kept in the knowledge index
+type indexedChunk struct {
+    Chunk
+    knowledgeBase string
+    tokens        []token        // of the text, for snippets
+    terms         map[string]int // frequency of the words of the heading and text
+    length        int            // number of words of the heading and text
+    vector        []float32      // embedding of the heading and text
+}
+
+// indexedChunkFile holds the chunks of a knowledge base file
+type indexedChunkFile struct {
+    size    int64
+    modTime time.Time
+    chunks  []*indexedChunk
+}
+
+// knowledgeIndex is an inverted index of the words of the chunks of all
+// knowledge bases, which also holds their embeddings. Like the history
+// search index it is brought up to date before every search, reading only
+// the chunk files that changed since. Deleted and renamed knowledge bases
+// are dropped right away.
+type knowledgeIndex struct {
+    mu             sync.Mutex
+    knowledgeBases map[string]map[string]*indexedChunkFile // by knowledge base and file name
+    postings       map[string]map[*indexedChunk]bool       // chunks by word
+}
+
+// dropKnowledgeBase removes the chunks of a knowledge base from the index
+func (idx *knowledgeIndex) dropKnowledgeBase(name string) {
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+    for file := range idx.knowledgeBases[name] {
+        idx.remove(name, file)
+    }
+    delete(idx.knowledgeBases, name)
+}
+
+// dropFile removes the chunks of a knowledge base file from the index
+func (idx *knowledgeIndex) dropFile(knowledgeBase, name string) {
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+    idx.remove(knowledgeBase, name)
+}
+
+func (idx *knowledgeIndex) add(knowledgeBase, file string, info fs.FileInfo, chunks []Chunk, vectors map[string][]float32) {
+    if idx.knowledgeBases == nil {
+        idx.knowledgeBases = map[string]map[string]*indexedChunkFile{}
+        idx.postings = map[string]map[*indexedChunk]bool{}
+    }
+    if idx.knowledgeBases[knowledgeBase] == nil {
+        idx.knowledgeBases[knowledgeBase] = map[string]*indexedChunkFile{}
+    }
+
+    f := &indexedChunkFile{size: info.Size(), modTime: info.ModTime()}
+    for _, c := range chunks {
+        ic := &indexedChunk{Chunk: c, knowledgeBase: knowledgeBase, tokens: tokenize(c.Text), terms: map[string]int{}, vector: vectors[c.ID]}
+        for _, t := range slices.Concat(tokenize(c.Heading), ic.tokens) {
+            ic.terms[t.term]++
+            ic.length++
+        }
+        for term := range ic.terms {
+            if idx.postings[term] == nil {
+                idx.postings[term] = map[*indexedChunk]bool{}
+            }
+            idx.postings[term][ic] = true
+        }
+        f.chunks = append(f.chunks, ic)
+    }
+    idx.knowledgeBases[knowledgeBase][file] = f
+}
+
+func (idx *knowledgeIndex) remove(knowledgeBase, file string) {
+    f, ok := idx.knowledgeBases[knowledgeBase][file]
+    if !ok {
+        return
+    }
+    for _, c := range f.chunks {
+        for term := range c.terms {
+            delete(idx.postings[term], c)
+            if len(idx.postings[term]) == 0 {
+                delete(idx.postings, term)
+            }
+        }
+    }
+    delete(idx.knowledgeBases[knowledgeBase], file)
+}
+
+// refreshKnowledgeIndex indexes the new and changed chunk files of the
+// given knowledge bases and drops deleted ones. Chunks without a stored
+// vector of the current embedding model are embedded on the fly. The
+// caller holds s.knowledge.mu.
+func (s *Server) refreshKnowledgeIndex(knowledgeBases []string) error {
+    idx := &s.knowledge
+    for _, kb := range knowledgeBases {
+        entries, err := s.store.ReadDir(chunksDir(kb))
+        if err != nil && !errors.Is(err, fs.ErrNotExist) {
+            return err
+        }
+
+        seen := map[string]bool{}
+        for _, entry := range entries {
+            file, ok := strings.CutSuffix(entry.Name(), ".json")
+            if entry.IsDir() || !ok {
+                continue // temporary files of writes in progress
+            }
+            info, err := entry.Info()
+            if err != nil {
+                continue
+            }
+            seen[file] = true
+            if old, ok := idx.knowledgeBases[kb][file]; ok && old.size == info.Size() && old.modTime.Equal(info.ModTime()) {
+                continue
+            }
+            idx.remove(kb, file)
+            chunks, err := s.chunks(kb, file)
+            if err != nil {
+                continue // unreadable files are not searchable
+            }
+            vectors := s.chunkVectors(kb, file)
+            if vectors == nil {
+                vectors = map[string][]float32{}
+            }
+            for _, c := range chunks.Chunks {
+                if _, ok := vectors[c.ID]; !ok {
+                    vectors[c.ID] = s.embedChunk(c)
+                }
+            }
+            idx.add(kb, file, info, chunks.Chunks, vectors)
+        }
+        for file := range idx.knowledgeBases[kb] {
+            if !seen[file] {
+                idx.remove(kb, file)
+            }
+        }
+    }
+    return nil
+}
+
+// KnowledgeSearchFilters narrows a knowledge base search
+type KnowledgeSearchFilters struct {
+    Files      []string `json:"files,omitempty"`      // names of the files to search
+    Extensions []string `json:"extensions,omitempty"` // of the files to search, such as .md
+    Heading    string   `json:"heading,omitempty" validate:"max=200"`
+    MinScore   float64  `json:"minScore,omitempty"` // of the returned chunks
+}
+
+// SearchKnowledgeBasesRequest represents the structure of the incoming request for searching knowledge bases
+type SearchKnowledgeBasesRequest struct {
+    // Query is a list of words, "quoted phrases" and prefixes such as
+    // invoi*. In lexical searches chunks match if they contain any of the
+    // words or prefixes and all of the phrases. Semantic searches rank the
+    // chunks by the similarity of their embedding to that of the query.
+    // Hybrid searches fuse both rankings. The mode defaults to lexical.
+    Query          string                  `json:"query" validate:"required,max=500"`
+    Mode           string                  `json:"mode,omitempty" validate:"oneof=lexical|semantic|hybrid"`
+    KnowledgeBases []string                `json:"knowledgeBases,omitempty"` // all knowledge bases if empty
+    TopK           int                     `json:"topK,omitempty" validate:"range=1|100"`
+    Filters        *KnowledgeSearchFilters `json:"filters,omitempty"`
+}
+
+// KnowledgeSearchResult is a chunk matching a knowledge base search. The
+// snippet is HTML escaped and the matching words are wrapped in <mark>
+// elements.
+type KnowledgeSearchResult struct {
+    KnowledgeBase string  `json:"knowledgeBase"`
+    Score         float64 `json:"score"`
+    Snippet       string  `json:"snippet"`
+    Chunk
+}
+
+// SearchKnowledgeBasesResponse represents the structure of the response for searching knowledge bases
+type SearchKnowledgeBasesResponse struct {
+    Results []KnowledgeSearchResult `json:"results"`
+}
+
+// knowledgeSearch is a validated knowledge base search
+type knowledgeSearch struct {
+    mode           string
+    clauses        []searchClause
+    vector         []float32 // embedding of the query for semantic searches
+    knowledgeBases []string
+    topK           int
+    filters        KnowledgeSearchFilters
+}
+
+// accepts reports whether the filters let a chunk through
+func (f KnowledgeSearchFilters) accepts(c *indexedChunk) bool {
+    if len(f.Files) > 0 && !slices.Contains(f.Files, c.File) {
+        return false
+    }
+    if len(f.Extensions) > 0 && !slices.ContainsFunc(f.Extensions, func(ext string) bool {
+        return strings.EqualFold(ext, path.Ext(c.File))
+    }) {
+        return false
+    }
+    return f.Heading == "" || strings.Contains(strings.ToLower(c.Heading), strings.ToLower(f.Heading))
+}
+
+// searchKnowledge ranks the chunks of the searched knowledge bases by the
+// mode of the search
+func (s *Server) searchKnowledge(search knowledgeSearch) ([]KnowledgeSearchResult, error) {
+    s.knowledge.mu.Lock()
+    defer s.knowledge.mu.Unlock()
+    if err := s.refreshKnowledgeIndex(search.knowledgeBases); err != nil {
+        return nil, err
+    }
+    idx := &s.knowledge
+
+    var chunks []*indexedChunk
+    for _, kb := range search.knowledgeBases {
+        for _, f := range idx.knowledgeBases[kb] {
+            chunks = append(chunks, f.chunks...)
+        }
+    }
+
+    var scores map[*indexedChunk]float64
+    switch search.mode {
+    case searchSemantic:
+        scores = semanticScores(search, chunks)
+    case searchHybrid:
+        scores = fuseRankings(idx.lexicalScores(search, chunks), semanticScores(search, chunks))
+    default:
+        scores = idx.lexicalScores(search, chunks)
+    }
+
+    results := []KnowledgeSearchResult{}
+    for c, score := range scores {
+        score = math.Round(score*1e4) / 1e4
+        if score < search.filters.MinScore {
+            continue
+        }
+        var spans []span
+        for _, clause := range search.clauses {
+            spans = append(spans, clause.match(c.tokens)...)
+        }
+        results = append(results, KnowledgeSearchResult{
+            KnowledgeBase: c.knowledgeBase,
+            Score:         score,
+            Snippet:       snippet(c.Text, spans), // no spans if only the heading or the embedding matched
+            Chunk:         c.Chunk,
+        })
+    }
+
+    slices.SortFunc(results, func(a, b KnowledgeSearchResult) int {
+        return cmp.Or(
+            cmp.Compare(b.Score, a.Score),
+            cmp.Compare(a.KnowledgeBase, b.KnowledgeBase),
+            cmp.Compare(a.File, b.File),
+            cmp.Compare(a.Index, b.Index),
+        )
+    })
+    return results[:min(search.topK, len(results))], nil
+}
+
+// lexicalScores scores the chunks accepted by the filters with BM25. The
+// collection statistics are those of all given chunks, before the filters
+// are applied. Chunks missing a phrase of the query are left out.
+func (idx *knowledgeIndex) lexicalScores(search knowledgeSearch, chunks []*indexedChunk) map[*indexedChunk]float64 {
+    scores := map[*indexedChunk]float64{}
+    if len(chunks) == 0 {
+        return scores
+    }
+    searched := map[*indexedChunk]bool{}
+    totalLength := 0
+    for _, c := range chunks {
+        searched[c] = true
+        totalLength += c.length
+    }
+    n := float64(len(chunks))
+    avgLength := float64(totalLength) / n
+
+    // The words to score: the words of all clauses, with prefixes expanded
+    // to the indexed words they start
+    terms := map[string]bool{}
+    for _, clause := range search.clauses {
+        for i, term := range clause.terms {
+            if clause.prefix && i == len(clause.terms)-1 {
+                for indexed := range idx.postings {
+                    if strings.HasPrefix(indexed, term) {
+                        terms[indexed] = true
+                    }
+                }
+            } else {
+                terms[term] = true
+            }
+        }
+    }
+
+    for term := range terms {
+        df := 0
+        for c := range idx.postings[term] {
+            if searched[c] {
+                df++
+            }
+        }
+        idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+        for c := range idx.postings[term] {
+            if !searched[c] || !search.filters.accepts(c) {
+                continue
+            }
+            tf := float64(c.terms[term])
+            scores[c] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(c.length)/avgLength))
+        }
+    }
+
+    for c := range scores {
+        for _, clause := range search.clauses {
+            if len(clause.terms) > 1 && !clause.prefix && len(clause.match(c.tokens)) == 0 {
+                delete(scores, c)
+                break
+            }
+        }
+    }
+    return scores
+}
+
+// semanticScores scores the chunks accepted by the filters with the cosine
+// similarity of their embedding to that of the query. Chunks that are not
+// similar at all are left out.
+func semanticScores(search knowledgeSearch, chunks []*indexedChunk) map[*indexedChunk]float64 {
+    scores := map[*indexedChunk]float64{}
+    for _, c := range chunks {
+        if !search.filters.accepts(c) {
+            continue
+        }
+        if similarity := cosine(search.vector, c.vector); similarity > 0 {
+            scores[c] = similarity
+        }
+    }
+    return scores
+}
+
+// fuseRankings combines rankings with reciprocal rank fusion: a chunk
+// scores 1/(rrfK+rank) for every ranking it is in. The sum is scaled so
+// that a chunk ranked first by all rankings scores 1.
+func fuseRankings(rankings ...map[*indexedChunk]float64) map[*indexedChunk]float64 {
+    fused := map[*indexedChunk]float64{}
+    for _, scores := range rankings {
+        ranked := slices.Collect(maps.Keys(scores))
+        slices.SortFunc(ranked, func(a, b *indexedChunk) int {
+            return cmp.Or(
+                cmp.Compare(scores[b], scores[a]),
+                cmp.Compare(a.knowledgeBase, b.knowledgeBase),
+                cmp.Compare(a.File, b.File),
+                cmp.Compare(a.Index, b.Index),
+            )
+        })
+        for i, c := range ranked {
+            fused[c] += 1 / float64(rrfK+i+1)
+        }
+    }
+    best := float64(len(rankings)) / (rrfK + 1)
+    for c := range fused {
+        fused[c] /= best
+    }
+    return fused
+}
+
+// knowledgeBaseNames returns the names of all knowledge bases
+func (s *Server) knowledgeBaseNames() ([]string, error) {
+    entries, err := s.store.ReadDir(knowledgeBaseRoot)
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, err
+    }
+    var names []string
+    for _, entry := range entries {
+        if entry.IsDir() {
+            names = append(names, entry.Name())
+        }
+    }
+    return names, nil
+}
+
+// Search Knowledge Bases Handler
+func (s *Server) searchKnowledgeBasesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var searchRequest SearchKnowledgeBasesRequest
+    if !decodeRequest(w, r, &searchRequest) {
+        return
+    }
+
+    search := knowledgeSearch{
+        mode:           cmp.Or(searchRequest.Mode, searchLexical),
+        clauses:        parseSearchQuery(searchRequest.Query),
+        knowledgeBases: searchRequest.KnowledgeBases,
+        topK:           cmp.Or(searchRequest.TopK, defaultKnowledgeTopK),
+    }
+    var errs []FieldError
+    if len(search.clauses) == 0 {
+        errs = append(errs, FieldError{Field: "query", Message: "must contain at least one word"})
+    }
+    for i, name := range searchRequest.KnowledgeBases {
+        errs = append(errs, validateValue(fmt.Sprintf("knowledgeBases[%d]", i), name, titleRules)...)
+    }
+    if searchRequest.Filters != nil {
+        search.filters = *searchRequest.Filters
+        for _, fe := range validateStruct(search.filters) {
+            fe.Field = "filters." + fe.Field
+            errs = append(errs, fe)
+        }
+        for i, name := range search.filters.Files {
+            errs = append(errs, validateValue(fmt.Sprintf("filters.files[%d]", i), name, fileNameRules)...)
+        }
+        for i, ext := range search.filters.Extensions {
+            if !strings.HasPrefix(ext, ".") || len(ext) > 20 {
+                errs = append(errs, FieldError{Field: fmt.Sprintf("filters.extensions[%d]", i), Message: "must be a file extension such as .md"})
+            }
+        }
+    }
+    if len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+
+    slices.Sort(search.knowledgeBases)
+    search.knowledgeBases = slices.Compact(search.knowledgeBases)
+    if len(search.knowledgeBases) == 0 {
+        names, err := s.knowledgeBaseNames()
+        if err != nil {
+            http.Error(w, "Failed to read knowledge base directory", http.StatusInternalServerError)
+            return
+        }
+        search.knowledgeBases = names
+    }
+    for _, name := range search.knowledgeBases {
+        if !s.exists(knowledgeBaseDir(name)) {
+            http.Error(w, "Knowledge base not found", http.StatusNotFound)
+            return
+        }
+    }
+
+    if search.mode != searchLexical {
+        search.vector = s.embedder.Embed(searchRequest.Query)
+    }
+    results, err := s.searchKnowledge(search)
+    if err != nil {
+        http.Error(w, "Failed to search knowledge bases", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(SearchKnowledgeBasesResponse{Results: results})
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "sync/atomic"
+    "testing"
+)
+
+// newKnowledgeServer returns a fixture server whose Manuals knowledge
+// base holds a few ingested text files
+func newKnowledgeServer(t *testing.T, opts ...func(*Options)) *Server {
+    t.Helper()
+    s := newFixtureServer(t, opts...)
+    files := map[string]string{
+        "printer.md":   "# Printer\n\nThe printer prints invoices. Refill the printer toner monthly.\n\n# Network\n\nConnect the printer to the office network.",
+        "invoices.txt": "Invoices are sent on the first day of the month. Late invoices cost a fee.",
+        "coffee.txt":   "The coffee machine needs descaling. Use the blue button.",
+    }
+    for name, content := range files {
+        if err := s.store.WriteFile("knowledgebases/Manuals/"+name, []byte(content)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := s.store.WriteFile("knowledgebases/Reviewer/review.txt", []byte("Review invoices twice.")); err != nil {
+        t.Fatal(err)
+    }
+    serve(s, http.MethodPut, "/update-chunking-settings", `{"knowledgeBaseName":"Manuals","strategy":"markdown","chunkSize":100}`)
+    serve(s, http.MethodPost, "/list-files-knowledgebase", `{"knowledgeBaseName":"Reviewer"}`)
+    s.Wait()
+    return s
+}
+
+func searchKnowledgeBases(t *testing.T, s *Server, body string) []KnowledgeSearchResult {
+    t.Helper()
+    rec := serve(s, http.MethodPost, "/search-knowledgebases", body)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var resp SearchKnowledgeBasesResponse
+    decodeBody(t, rec, &resp)
+    return resp.Results
+}
+
+// resultChunks returns the knowledge base, file and heading of the results
+func resultChunks(results []KnowledgeSearchResult) []string {
+    got := []string{}
+    for _, r := range results {
+        got = append(got, strings.TrimSuffix(r.KnowledgeBase+"/"+r.File+"#"+r.Heading, "#"))
+    }
+    return got
+}
+
+func TestSearchKnowledgeBases(t *testing.T) {
+    s := newKnowledgeServer(t)
+    tests := []struct {
+        name string
+        body string
+        want []string
+    }{
+        {"ranked by BM25", `{"query":"printer invoices","knowledgeBases":["Manuals"]}`, []string{"Manuals/printer.md#Printer", "Manuals/invoices.txt", "Manuals/printer.md#Network"}},
+        {"all knowledge bases", `{"query":"invoices"}`, []string{"Reviewer/review.txt", "Manuals/invoices.txt", "Manuals/printer.md#Printer"}},
+        {"top k", `{"query":"invoices","topK":1}`, []string{"Reviewer/review.txt"}},
+        {"prefix", `{"query":"descal*"}`, []string{"Manuals/coffee.txt"}},
+        {"phrase required", `{"query":"\"office network\" invoices"}`, []string{"Manuals/printer.md#Network"}},
+        {"heading matches", `{"query":"network","knowledgeBases":["Manuals"]}`, []string{"Manuals/printer.md#Network"}},
+        {"no match", `{"query":"espresso"}`, []string{}},
+        {"file filter", `{"query":"invoices","filters":{"files":["invoices.txt"]}}`, []string{"Manuals/invoices.txt"}},
+        {"extension filter", `{"query":"invoices","filters":{"extensions":[".MD"]}}`, []string{"Manuals/printer.md#Printer"}},
+        {"heading filter", `{"query":"printer","filters":{"heading":"netw"}}`, []string{"Manuals/printer.md#Network"}},
+        {"minimum score", `{"query":"invoices","knowledgeBases":["Manuals"],"filters":{"minScore":0.8}}`, []string{"Manuals/invoices.txt"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := resultChunks(searchKnowledgeBases(t, s, tt.body)); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("results = %v, want %v", got, tt.want)
+            }
+        })
+    }
+
+    // Reviewer has two chunks of 3 and 1 words, the word occurs once in
+    // the first
+    results := searchKnowledgeBases(t, s, `{"query":"review","knowledgeBases":["Reviewer"]}`)
+    idf := math.Log(1 + (2-1+0.5)/(1+0.5))
+    want := idf * (bm25K1 + 1) / (1 + bm25K1*(1-bm25B+bm25B*3/2.0))
+    if len(results) != 1 || results[0].Score != math.Round(want*1e4)/1e4 {
+        t.Errorf("results = %+v, want one with score %.4f", results, want)
+    }
+    if want := "<mark>Review</mark> invoices twice."; results[0].Snippet != want || results[0].Text != "Review invoices twice." || results[0].ID == "" {
+        t.Errorf("result = %+v, want snippet %q", results[0], want)
+    }
+}
+
+func TestSearchKnowledgeBasesModes(t *testing.T) {
+    s := newKnowledgeServer(t)
+    tests := []struct {
+        name string
+        body string
+        want []string
+    }{
+        {"lexical needs the words", `{"query":"printing invoice","mode":"lexical"}`, []string{}},
+        {"semantic matches word stems", `{"query":"printing invoice","mode":"semantic","topK":1}`, []string{"Manuals/printer.md#Printer"}},
+        {"semantic with filters", `{"query":"printing invoice","mode":"semantic","filters":{"files":["coffee.txt","invoices.txt"]}}`, []string{"Manuals/invoices.txt"}},
+        {"hybrid", `{"query":"printer invoices","mode":"hybrid","knowledgeBases":["Manuals"],"topK":2}`, []string{"Manuals/printer.md#Printer", "Manuals/invoices.txt"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := resultChunks(searchKnowledgeBases(t, s, tt.body)); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("results = %v, want %v", got, tt.want)
+            }
+        })
+    }
+
+    // The chunk ranked first by both rankings has the highest fused score
+    results := searchKnowledgeBases(t, s, `{"query":"printer invoices","mode":"hybrid","knowledgeBases":["Manuals"],"topK":1}`)
+    if len(results) != 1 || results[0].Score != 1 {
+        t.Errorf("results = %+v, want one with score 1", results)
+    }
+
+    if rec := serve(s, http.MethodPost, "/search-knowledgebases", `{"query":"a","mode":"fuzzy"}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("unknown mode: status = %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+}
+
+// countingEmbedder embeds every text as the same vector and counts the
+// embedded texts
+type countingEmbedder struct {
+    model string
+    count *atomic.Int32
+}
+
+func (e countingEmbedder) Model() string { return e.model }
+
+func (e countingEmbedder) Embed(string) []float32 {
+    e.count.Add(1)
+    return []float32{1, 0}
+}
+
+func TestChunkVectors(t *testing.T) {
+    var count atomic.Int32
+    s := newKnowledgeServer(t, func(o *Options) { o.Embedder = countingEmbedder{model: "constant", count: &count} })
+
+    // Ingestion stores the vectors of every chunk
+    chunks, err := s.chunks("Reviewer", "review.txt")
+    if err != nil {
+        t.Fatal(err)
+    }
+    vectors := s.chunkVectors("Reviewer", "review.txt")
+    if len(vectors) != 1 || !reflect.DeepEqual(vectors[chunks.Chunks[0].ID], []float32{1, 0}) {
+        t.Errorf("stored vectors = %v", vectors)
+    }
+
+    // Searches use the stored vectors
+    count.Store(0)
+    if results := searchKnowledgeBases(t, s, `{"query":"anything","mode":"semantic","topK":100}`); len(results) != 6 || results[0].Score != 1 {
+        t.Errorf("results = %+v, want all chunks with score 1", results)
+    }
+    if n := count.Load(); n != 1 {
+        t.Errorf("embedded %d texts, want only the query", n)
+    }
+
+    // Vectors of another model are not used
+    s.embedder = countingEmbedder{model: "other", count: &count}
+    s.knowledge.dropKnowledgeBase("Reviewer")
+    count.Store(0)
+    searchKnowledgeBases(t, s, `{"query":"anything","mode":"semantic","knowledgeBases":["Reviewer"]}`)
+    if n := count.Load(); n != 1+2 {
+        t.Errorf("embedded %d texts, want the query and both chunks of Reviewer", n)
+    }
+
+    // Failed ingestions leave no vectors behind
+    if err := s.store.WriteFile("knowledgebases/Reviewer/review.txt", nil); err != nil {
+        t.Fatal(err)
+    }
+    serve(s, http.MethodPost, "/list-files-knowledgebase", `{"knowledgeBaseName":"Reviewer"}`)
+    s.Wait()
+    wantMissing(t, s, vectorsPath("Reviewer", "review.txt"))
+}
+
+func TestSearchKnowledgeBasesFollowsChanges(t *testing.T) {
+    s := newKnowledgeServer(t)
+    searchKnowledgeBases(t, s, `{"query":"invoices"}`)
+
+    // Uploads are searchable once ingested
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, uploadRequest(t, "/upload?title=Writer", "billing.txt", "Invoices go to billing."))
+    s.Wait()
+    if got := resultChunks(searchKnowledgeBases(t, s, `{"query":"billing"}`)); !reflect.DeepEqual(got, []string{"Writer/billing.txt"}) {
+        t.Errorf("after upload = %v", got)
+    }
+
+    // Renamed knowledge bases are found under their new name only
+    serve(s, http.MethodPut, "/rename-knowledgebase", `{"currentName":"Writer","newName":"Billing"}`)
+    if got := resultChunks(searchKnowledgeBases(t, s, `{"query":"billing"}`)); !reflect.DeepEqual(got, []string{"Billing/billing.txt"}) {
+        t.Errorf("after rename = %v", got)
+    }
+    if rec := serve(s, http.MethodPost, "/search-knowledgebases", `{"query":"billing","knowledgeBases":["Writer"]}`); rec.Code != http.StatusNotFound {
+        t.Errorf("old name: status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+
+    // Deleted knowledge bases are gone
+    serve(s, http.MethodPost, "/delete-knowledgebase", `{"knowledgeBaseName":"Billing"}`)
+    if got := resultChunks(searchKnowledgeBases(t, s, `{"query":"billing"}`)); len(got) != 0 {
+        t.Errorf("after delete = %v", got)
+    }
+    if _, ok := s.knowledge.knowledgeBases["Billing"]; ok {
+        t.Error("deleted knowledge base is still indexed")
+    }
+}
+
+func TestSearchKnowledgeBasesErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {name: "no words", method: http.MethodPost, target: "/search-knowledgebases", body: `{"query":"!!"}`, status: http.StatusBadRequest},
+        {name: "invalid knowledge base", method: http.MethodPost, target: "/search-knowledgebases", body: `{"query":"a","knowledgeBases":["../x"]}`, status: http.StatusBadRequest},
+        {name: "invalid extension", method: http.MethodPost, target: "/search-knowledgebases", body: `{"query":"a","filters":{"extensions":["md"]}}`, status: http.StatusBadRequest},
+        {name: "top k too large", method: http.MethodPost, target: "/search-knowledgebases", body: `{"query":"a","topK":101}`, status: http.StatusBadRequest},
+        {name: "missing knowledge base", method: http.MethodPost, target: "/search-knowledgebases", body: `{"query":"a","knowledgeBases":["Recipes"]}`, status: http.StatusNotFound},
+    })
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+    "slices"
+    "sync"
+)
+
+// keyedMutex provides one mutex per key, e.g. per chat history. Mutexes
+// are dropped once nobody holds or waits for them.
+type keyedMutex struct {
+    mu    sync.Mutex
+    locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+    sync.Mutex
+    refs int
+}
+
+// Lock locks the mutex of key and returns the function unlocking it
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+    k.mu.Lock()
+    if k.locks == nil {
+        k.locks = map[string]*keyedLock{}
+    }
+    l, ok := k.locks[key]
+    if !ok {
+        l = &keyedLock{}
+        k.locks[key] = l
+    }
+    l.refs++
+    k.mu.Unlock()
+
+    l.Lock()
+    return func() {
+        l.Unlock()
+        k.mu.Lock()
+        l.refs--
+        if l.refs == 0 {
+            delete(k.locks, key)
+        }
+        k.mu.Unlock()
+    }
+}
+
+// LockAll locks the mutexes of several keys and returns the function
+// unlocking them. The keys are locked in sorted order, so callers locking
+// overlapping keys cannot deadlock.
+func (k *keyedMutex) LockAll(keys ...string) (unlock func()) {
+    keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+    unlocks := make([]func(), len(keys))
+    for i, key := range keys {
+        unlocks[i] = k.Lock(key)
+    }
+    return func() {
+        for _, unlock := range slices.Backward(unlocks) {
+            unlock()
+        }
+    }
+}
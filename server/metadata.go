@@ -0,0 +1,136 @@
+package server
+
+import (
+    "cmp"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "path"
+    "slices"
+    "strings"
+    "time"
+)
+
+// uploaderHeader carries the identity of the user uploading files, as set
+// by a proxy authenticating the users in front of the API
+const uploaderHeader = "X-User"
+
+// uploaderRules validates the identity of an uploader
+const uploaderRules = "max=100,charset=name"
+
+// fileMetadata is kept next to each knowledge base file. UploadedAt is when
+// a file of the name was first stored, UpdatedAt when its content last
+// changed; UploadedBy and OriginalName are about the current content.
+type fileMetadata struct {
+    ContentType  string    `json:"contentType"` // detected from the content
+    Size         int64     `json:"size"`
+    SHA256       string    `json:"sha256"`
+    OriginalName string    `json:"originalName"` // as uploaded
+    UploadedBy   string    `json:"uploadedBy,omitempty"`
+    UploadedAt   time.Time `json:"uploadedAt"`
+    UpdatedAt    time.Time `json:"updatedAt"`
+    ModTime      time.Time `json:"modTime"` // of the file the metadata is about
+}
+
+// current reports whether the metadata is about the file as it is now
+func (meta *fileMetadata) current(size int64, modTime time.Time) bool {
+    return meta.Size == size && meta.ModTime.Equal(modTime)
+}
+
+func fileMetadataPath(knowledgeBase, name string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "metadata", name+".json")
+}
+
+func (s *Server) saveFileMetadata(knowledgeBase, name string, meta *fileMetadata) error {
+    data, err := json.Marshal(meta)
+    if err != nil {
+        return err
+    }
+    return s.writeMetaFile(fileMetadataPath(knowledgeBase, name), data)
+}
+
+// fileMetadata returns the metadata of a knowledge base file. Files
+// without metadata about their current content, e.g. copied into the
+// folder or changed by hand, are described again from their content and
+// modification time.
+func (s *Server) fileMetadata(knowledgeBase, name string) (*fileMetadata, error) {
+    file := knowledgeFile(knowledgeBase, name)
+    info, err := s.store.Stat(file)
+    if err != nil {
+        return nil, err
+    }
+    var meta fileMetadata
+    data, err := s.store.ReadFile(fileMetadataPath(knowledgeBase, name))
+    known := err == nil && json.Unmarshal(data, &meta) == nil
+    if known && meta.current(info.Size(), info.ModTime()) {
+        return &meta, nil
+    }
+
+    contentType, err := s.sniffFile(file, name)
+    if err != nil {
+        return nil, err
+    }
+    hash := sha256.New()
+    if err := s.copyFile(hash, file); err != nil {
+        return nil, err
+    }
+    modTime := info.ModTime().UTC()
+    if !known {
+        meta = fileMetadata{OriginalName: name, UploadedAt: modTime}
+    }
+    meta.ContentType = contentType
+    meta.Size = info.Size()
+    meta.SHA256 = hex.EncodeToString(hash.Sum(nil))
+    meta.UpdatedAt = modTime
+    meta.ModTime = modTime
+    return &meta, s.saveFileMetadata(knowledgeBase, name, &meta)
+}
+
+// matchesFileFilters reports whether a listed file passes the filters of a
+// listing request
+func matchesFileFilters(f FileInfoResponse, req ListFilesRequest) bool {
+    switch {
+    case req.Type != "" && f.Type != req.Type,
+        req.ContentType != "" && !matchesFileType([]string{req.ContentType}, f.ContentType),
+        req.Status != "" && f.Status != req.Status,
+        req.UploadedBy != "" && f.UploadedBy != req.UploadedBy,
+        req.NameContains != "" && !strings.Contains(strings.ToLower(f.Name), strings.ToLower(req.NameContains)),
+        req.MinSize > 0 && f.Size < req.MinSize,
+        req.MaxSize > 0 && f.Size > req.MaxSize:
+        return false
+    }
+    return true
+}
+
+// sortFiles orders listed files by a sort key of ListFilesRequest, and by
+// ascending name when keys are equal. Names and types sort ascending by
+// default, sizes and times descending.
+func sortFiles(files []FileInfoResponse, sortBy, order string) {
+    sortBy = cmp.Or(sortBy, "name")
+    if order == "" {
+        order = "desc"
+        if sortBy == "name" || sortBy == "type" {
+            order = "asc"
+        }
+    }
+    slices.SortFunc(files, func(a, b FileInfoResponse) int {
+        byName := cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.Name, b.Name))
+        var c int
+        switch sortBy {
+        case "name":
+            c = byName
+        case "size":
+            c = cmp.Compare(a.Size, b.Size)
+        case "type":
+            c = cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.ContentType, b.ContentType))
+        case "createdAt":
+            c = cmp.Compare(a.CreationTime, b.CreationTime) // UTC RFC 3339 times sort as strings
+        case "updatedAt":
+            c = cmp.Compare(a.UpdatedTime, b.UpdatedTime)
+        }
+        if order == "desc" {
+            c = -c
+        }
+        return cmp.Or(c, byName)
+    })
+}
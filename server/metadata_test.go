@@ -0,0 +1,180 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strings"
+    "testing"
+    "time"
+)
+
+// uploadAs uploads files to the knowledge base of the Reviewer assistant
+// as a user
+func uploadAs(t *testing.T, s *Server, user string, files ...string) *httptest.ResponseRecorder {
+    t.Helper()
+    req := filesUploadRequest(t, "/upload?title=Reviewer", files...)
+    req.Header.Set(uploaderHeader, user)
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    return rec
+}
+
+// listFiles returns the files of a knowledge base listed by a request
+func listFiles(t *testing.T, s *Server, body string) []FileInfoResponse {
+    t.Helper()
+    rec := serve(s, http.MethodPost, "/list-files-knowledgebase", body)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("list files: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var got ListFilesResponse
+    decodeBody(t, rec, &got)
+    return got.Files
+}
+
+func sha256Hex(content string) string {
+    sum := sha256.Sum256([]byte(content))
+    return hex.EncodeToString(sum[:])
+}
+
+func TestFileMetadata(t *testing.T) {
+    now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    s := newFixtureServer(t, func(o *Options) { o.Clock = func() time.Time { return now } })
+    created := now.Format(time.RFC3339)
+    if rec := uploadAs(t, s, "alice", "notes.md", "# Notes"); rec.Code != http.StatusOK {
+        t.Fatalf("upload: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+
+    files := listFiles(t, s, `{"knowledgeBaseName":"Reviewer","nameContains":"notes"}`)
+    want := FileInfoResponse{SHA256: sha256Hex("# Notes"), Size: 7, OriginalName: "notes.md", UploadedBy: "alice", CreationTime: created, UpdatedTime: created}
+    if len(files) != 1 {
+        t.Fatalf("files = %+v", files)
+    }
+    if f := files[0]; f.SHA256 != want.SHA256 || f.Size != want.Size || f.OriginalName != want.OriginalName ||
+        f.UploadedBy != want.UploadedBy || f.CreationTime != want.CreationTime || f.UpdatedTime != want.UpdatedTime {
+        t.Errorf("notes.md = %+v, want %+v", f, want)
+    }
+
+    // A replaced file keeps its creation time and takes the uploader and
+    // name of the new content
+    now = now.Add(time.Hour)
+    req := filesUploadRequest(t, "/replace-file-knowledgebase?knowledgeBaseName=Reviewer&fileName=notes.md", "draft.md", "# Draft notes")
+    req.Method = http.MethodPut
+    req.Header.Set(uploaderHeader, "bob")
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("replace: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    files = listFiles(t, s, `{"knowledgeBaseName":"Reviewer","nameContains":"notes"}`)
+    want = FileInfoResponse{SHA256: sha256Hex("# Draft notes"), Size: 13, OriginalName: "draft.md", UploadedBy: "bob", CreationTime: created, UpdatedTime: now.Format(time.RFC3339)}
+    if f := files[0]; f.SHA256 != want.SHA256 || f.Size != want.Size || f.OriginalName != want.OriginalName ||
+        f.UploadedBy != want.UploadedBy || f.CreationTime != want.CreationTime || f.UpdatedTime != want.UpdatedTime {
+        t.Errorf("replaced notes.md = %+v, want %+v", f, want)
+    }
+
+    // Files put in place by hand are described from their content
+    files = listFiles(t, s, `{"knowledgeBaseName":"Reviewer","nameContains":"style"}`)
+    if len(files) != 1 || files[0].SHA256 != sha256Hex("# Style") || files[0].OriginalName != "style.md" || files[0].UploadedBy != "" {
+        t.Errorf("style.md = %+v", files)
+    }
+
+    // Resumable uploads record their uploader too
+    sum := sha256Hex("hello")
+    req = httptest.NewRequest(http.MethodPost, "/create-upload", strings.NewReader(fmt.Sprintf(`{"title":"Reviewer","fileName":"hello.txt","size":5,"sha256":%q}`, sum)))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(uploaderHeader, "carol")
+    rec = httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    var session UploadSession
+    decodeBody(t, rec, &session)
+    sendChunk(s, session.UploadID, 0, "hello")
+    if rec := finalizeUpload(s, session.UploadID); rec.Code != http.StatusOK {
+        t.Fatalf("finalize: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    files = listFiles(t, s, `{"knowledgeBaseName":"Reviewer","uploadedBy":"carol"}`)
+    if len(files) != 1 || files[0].Name != "hello.txt" || files[0].SHA256 != sum {
+        t.Errorf("files uploaded by carol = %+v", files)
+    }
+}
+
+func TestListFilesSortAndFilter(t *testing.T) {
+    // Later than the fixtures were written
+    now := time.Now().UTC().Add(time.Hour)
+    s := newFixtureServer(t, func(o *Options) { o.Clock = func() time.Time { return now } })
+    uploads := []struct{ user, name, content string }{
+        {"alice", "b.txt", "bbb"},
+        {"bob", "A.md", "# A longer note"},
+        {"alice", "c.png", "\x89PNG\r\n\x1a\nxx"},
+    }
+    for _, u := range uploads {
+        now = now.Add(time.Minute)
+        if rec := uploadAs(t, s, u.user, u.name, u.content); rec.Code != http.StatusOK {
+            t.Fatalf("upload %s: status = %d; body: %s", u.name, rec.Code, rec.Body.String())
+        }
+    }
+
+    tests := []struct {
+        name    string
+        options string
+        want    []string
+    }{
+        {"by name", ``, []string{"A.md", "b.txt", "c.png", "style.md"}},
+        {"by size", `"sort":"size"`, []string{"A.md", "c.png", "style.md", "b.txt"}},
+        {"by size ascending", `"sort":"size","order":"asc"`, []string{"b.txt", "style.md", "c.png", "A.md"}},
+        {"by creation time", `"sort":"createdAt"`, []string{"c.png", "A.md", "b.txt", "style.md"}},
+        {"by type", `"sort":"type"`, []string{"A.md", "style.md", "b.txt", "c.png"}},
+        {"type", `"type":"image"`, []string{"c.png"}},
+        {"content type family", `"contentType":"text/*"`, []string{"A.md", "b.txt", "style.md"}},
+        {"uploader", `"uploadedBy":"alice"`, []string{"b.txt", "c.png"}},
+        {"name", `"nameContains":"A"`, []string{"A.md"}},
+        {"size range", `"minSize":5,"maxSize":10`, []string{"c.png", "style.md"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            body := `{"knowledgeBaseName":"Reviewer"`
+            if tt.options != "" {
+                body += "," + tt.options
+            }
+            var names []string
+            for _, f := range listFiles(t, s, body+"}") {
+                names = append(names, f.Name)
+            }
+            if !slices.Equal(names, tt.want) {
+                t.Errorf("files = %q, want %q", names, tt.want)
+            }
+        })
+    }
+
+    if rec := uploadAs(t, s, "a/b", "d.txt", "ddd"); rec.Code != http.StatusBadRequest {
+        t.Errorf("upload by invalid user: status = %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+    wantMissing(t, s, knowledgeFile("Reviewer", "d.txt"))
+
+    runHandlerTests(t, []handlerTest{
+        {name: "unknown sort", method: http.MethodPost, target: "/list-files-knowledgebase", body: `{"knowledgeBaseName":"Reviewer","sort":"owner"}`, status: http.StatusBadRequest},
+        {name: "unknown order", method: http.MethodPost, target: "/list-files-knowledgebase", body: `{"knowledgeBaseName":"Reviewer","order":"up"}`, status: http.StatusBadRequest},
+        {name: "unknown type", method: http.MethodPost, target: "/list-files-knowledgebase", body: `{"knowledgeBaseName":"Reviewer","type":"spreadsheet"}`, status: http.StatusBadRequest},
+    })
+}
+
+func TestSortFilesTies(t *testing.T) {
+    files := []FileInfoResponse{{Name: "b.md", Size: 1}, {Name: "c.md", Size: 2}, {Name: "a.md", Size: 1}}
+    for order, want := range map[string][]string{
+        "desc": {"c.md", "a.md", "b.md"},
+        "asc":  {"a.md", "b.md", "c.md"},
+    } {
+        sortFiles(files, "size", order)
+        var names []string
+        for _, f := range files {
+            names = append(names, f.Name)
+        }
+        // Equal sizes stay in ascending name order either way
+        if !slices.Equal(names, want) {
+            t.Errorf("%s: files = %q, want %q", order, names, want)
+        }
+    }
+}
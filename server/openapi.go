@@ -0,0 +1,378 @@
+package server
+
+import (
+    _ "embed"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// docsPage is the interactive API documentation served at /docs
+//
+//go:embed docs.html
+var docsPage []byte
+
+// openAPIGenerator builds an OpenAPI 3.1 document from the route table,
+// deriving the schemas from the Go request and response types
+type openAPIGenerator struct {
+    schemas map[string]interface{}
+}
+
+// buildOpenAPI returns the OpenAPI document describing the given routes
+func buildOpenAPI(routes []route) map[string]interface{} {
+    g := &openAPIGenerator{schemas: map[string]interface{}{}}
+
+    paths := map[string]interface{}{}
+    for _, rt := range routes {
+        item, ok := paths[rt.Path].(map[string]interface{})
+        if !ok {
+            item = map[string]interface{}{}
+            paths[rt.Path] = item
+        }
+        item[strings.ToLower(rt.Method)] = g.operation(rt)
+    }
+
+    return map[string]interface{}{
+        "openapi": "3.1.0",
+        "info": map[string]interface{}{
+            "title":       "AI Chatbot API",
+            "version":     "1.0.0",
+            "description": "Mock API for building and testing chatbot frontends.",
+        },
+        "paths": paths,
+        "components": map[string]interface{}{
+            "schemas": g.schemas,
+        },
+    }
+}
+
+func (g *openAPIGenerator) operation(rt route) map[string]interface{} {
+    op := map[string]interface{}{
+        "operationId": operationID(rt.Path),
+        "summary":     rt.Summary,
+    }
+
+    var parameters []interface{}
+    for _, p := range rt.PathParams {
+        parameters = append(parameters, parameterObject(p, "path"))
+    }
+    for _, p := range rt.QueryParams {
+        parameters = append(parameters, parameterObject(p, "query"))
+    }
+    for _, p := range rt.Headers {
+        parameters = append(parameters, parameterObject(p, "header"))
+    }
+    if len(parameters) > 0 {
+        op["parameters"] = parameters
+    }
+
+    if rt.Request != nil {
+        op["requestBody"] = map[string]interface{}{
+            "required": true,
+            "content": map[string]interface{}{
+                "application/json": map[string]interface{}{
+                    "schema": g.schemaFor(reflect.TypeOf(rt.Request)),
+                },
+            },
+        }
+    } else if len(rt.Consumes) > 0 {
+        content := map[string]interface{}{}
+        for _, mediaType := range rt.Consumes {
+            content[mediaType] = map[string]interface{}{
+                "schema": map[string]interface{}{"type": "string", "format": "binary"},
+            }
+        }
+        op["requestBody"] = map[string]interface{}{"required": true, "content": content}
+    } else if len(rt.Multipart) > 0 {
+        properties := map[string]interface{}{}
+        var required []string
+        for _, p := range rt.Multipart {
+            properties[p.Name] = map[string]interface{}{
+                "type":        "string",
+                "format":      "binary",
+                "description": p.Description,
+            }
+            if p.Required {
+                required = append(required, p.Name)
+            }
+        }
+        schema := map[string]interface{}{"type": "object", "properties": properties}
+        if len(required) > 0 {
+            schema["required"] = required
+        }
+        op["requestBody"] = map[string]interface{}{
+            "required": true,
+            "content": map[string]interface{}{
+                "multipart/form-data": map[string]interface{}{"schema": schema},
+            },
+        }
+    }
+
+    responses := map[string]interface{}{}
+    success := map[string]interface{}{"description": http.StatusText(rt.Status)}
+    if rt.Response != nil {
+        contentType := "application/json"
+        if rt.Stream {
+            contentType = "text/event-stream"
+        }
+        success["content"] = map[string]interface{}{
+            contentType: map[string]interface{}{
+                "schema": g.schemaFor(reflect.TypeOf(rt.Response)),
+            },
+        }
+    }
+    if len(rt.Produces) > 0 {
+        content := map[string]interface{}{}
+        for _, mediaType := range rt.Produces {
+            content[mediaType] = map[string]interface{}{
+                "schema": map[string]interface{}{"type": "string", "format": "binary"},
+            }
+        }
+        success["content"] = content
+    }
+    responses[strconv.Itoa(rt.Status)] = success
+    errorStatuses := []int{http.StatusBadRequest}
+    if rt.Request != nil {
+        errorStatuses = append(errorStatuses, http.StatusRequestEntityTooLarge)
+    }
+    for _, status := range errorStatuses {
+        responses[strconv.Itoa(status)] = map[string]interface{}{
+            "description": http.StatusText(status),
+            "content": map[string]interface{}{
+                "application/json": map[string]interface{}{
+                    "schema": g.schemaFor(reflect.TypeOf(ErrorResponse{})),
+                },
+            },
+        }
+    }
+    plainErrors := append([]int{}, rt.Errors...)
+    plainErrors = append(plainErrors, http.StatusMethodNotAllowed, http.StatusInternalServerError)
+    for _, status := range plainErrors {
+        responses[strconv.Itoa(status)] = map[string]interface{}{
+            "description": http.StatusText(status),
+            "content": map[string]interface{}{
+                "text/plain": map[string]interface{}{
+                    "schema": map[string]interface{}{"type": "string"},
+                },
+            },
+        }
+    }
+    op["responses"] = responses
+
+    return op
+}
+
+func parameterObject(p param, in string) map[string]interface{} {
+    schema := map[string]interface{}{"type": "string"}
+    addConstraints(schema, p.Rules)
+    return map[string]interface{}{
+        "name":        p.Name,
+        "in":          in,
+        "description": p.Description,
+        "required":    p.Required || in == "path",
+        "schema":      schema,
+    }
+}
+
+// addConstraints translates the rules of a validate tag into JSON schema
+// keywords
+func addConstraints(schema map[string]interface{}, tag string) {
+    rules := parseRules(tag)
+    for _, rule := range rules {
+        if rule.name == "range" {
+            // Only used for integer parameters and fields
+            schema["type"] = "integer"
+        }
+    }
+    // Length rules apply to strings, bounds to integers
+    lengths := schema["type"] == "string"
+    for _, rule := range rules {
+        switch rule.name {
+        case "required":
+            if lengths {
+                schema["minLength"] = 1
+            }
+        case "min":
+            n, _ := strconv.Atoi(rule.arg)
+            if lengths {
+                schema["minLength"] = n
+            } else {
+                schema["minimum"] = n
+            }
+        case "max":
+            n, _ := strconv.Atoi(rule.arg)
+            if lengths {
+                schema["maxLength"] = n
+            } else {
+                schema["maximum"] = n
+            }
+        case "charset":
+            if cs, ok := charsets[rule.arg]; ok {
+                schema["pattern"] = cs.pattern
+            }
+        case "oneof":
+            schema["enum"] = strings.Split(rule.arg, "|")
+        case "range":
+            lo, hi := rangeBounds(rule.arg)
+            schema["minimum"] = lo
+            schema["maximum"] = hi
+        }
+    }
+}
+
+// schemaFor returns the JSON schema of t. Named struct types are added to
+// the components section and referenced from the returned schema.
+func (g *openAPIGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+    if t == reflect.TypeOf(time.Time{}) {
+        return map[string]interface{}{"type": "string", "format": "date-time"}
+    }
+
+    switch t.Kind() {
+    case reflect.Ptr:
+        return g.schemaFor(t.Elem())
+    case reflect.String:
+        return map[string]interface{}{"type": "string"}
+    case reflect.Bool:
+        return map[string]interface{}{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return map[string]interface{}{"type": "integer"}
+    case reflect.Float32, reflect.Float64:
+        return map[string]interface{}{"type": "number"}
+    case reflect.Slice, reflect.Array:
+        return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+    case reflect.Map:
+        return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+    case reflect.Struct:
+        if t.Name() == "" {
+            return g.structSchema(t)
+        }
+        if _, ok := g.schemas[t.Name()]; !ok {
+            // Reserve the name first so recursive types terminate
+            g.schemas[t.Name()] = nil
+            g.schemas[t.Name()] = g.structSchema(t)
+        }
+        return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+    }
+    return map[string]interface{}{}
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]interface{} {
+    properties := map[string]interface{}{}
+    required := []string{}
+    for _, field := range jsonFields(t) {
+        schema := g.schemaFor(field.Type)
+        if rules := field.Tag.Get("validate"); rules != "" {
+            addConstraints(schema, rules)
+        }
+        properties[field.Name] = schema
+        if !field.OmitEmpty {
+            required = append(required, field.Name)
+        }
+    }
+    schema := map[string]interface{}{
+        "type":       "object",
+        "properties": properties,
+    }
+    if len(required) > 0 {
+        schema["required"] = required
+    }
+    return schema
+}
+
+// jsonField is a struct field as seen by encoding/json
+type jsonField struct {
+    Name      string
+    Type      reflect.Type
+    OmitEmpty bool
+    Index     []int
+    Tag       reflect.StructTag
+}
+
+// jsonFields returns the fields of t that encoding/json marshals, in
+// declaration order, with embedded structs flattened
+func jsonFields(t reflect.Type) []jsonField {
+    var fields []jsonField
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        tag := f.Tag.Get("json")
+        if tag == "-" {
+            continue
+        }
+        name, opts, _ := strings.Cut(tag, ",")
+        if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+            for _, inner := range jsonFields(f.Type) {
+                inner.Index = append([]int{i}, inner.Index...)
+                fields = append(fields, inner)
+            }
+            continue
+        }
+        if !f.IsExported() {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        fields = append(fields, jsonField{
+            Name:      name,
+            Type:      f.Type,
+            OmitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+            Index:     []int{i},
+            Tag:       f.Tag,
+        })
+    }
+    return fields
+}
+
+// operationID turns a route path such as /update-chat-context/{historyID}
+// into a camel case identifier such as updateChatContext
+func operationID(path string) string {
+    var b strings.Builder
+    upper := false
+    for _, r := range path {
+        switch {
+        case r == '{':
+            return b.String()
+        case r == '/' || r == '-' || r == '_':
+            upper = b.Len() > 0
+        case upper:
+            b.WriteRune(unicode.ToUpper(r))
+            upper = false
+        default:
+            b.WriteRune(r)
+        }
+    }
+    return b.String()
+}
+
+// OpenAPI Handler
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    s.openAPIOnce.Do(func() {
+        s.openAPIDoc, _ = json.MarshalIndent(buildOpenAPI(s.routes()), "", "  ")
+    })
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(s.openAPIDoc)
+}
+
+// Docs Handler
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Write(docsPage)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// roundTrip marshals the generated document to JSON and back so the tests
+// look at exactly what clients receive
+func roundTrip(t *testing.T, v interface{}) map[string]interface{} {
+    t.Helper()
+    data, err := json.Marshal(v)
+    if err != nil {
+        t.Fatalf("marshal: %v", err)
+    }
+    var out map[string]interface{}
+    if err := json.Unmarshal(data, &out); err != nil {
+        t.Fatalf("unmarshal: %v", err)
+    }
+    return out
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+    routes := newTestServer(t).routes()
+    doc := roundTrip(t, buildOpenAPI(routes))
+    paths := doc["paths"].(map[string]interface{})
+
+    seen := map[string]string{}
+    for _, rt := range routes {
+        item, ok := paths[rt.Path].(map[string]interface{})
+        if !ok {
+            t.Errorf("path %s missing from document", rt.Path)
+            continue
+        }
+        op, ok := item[strings.ToLower(rt.Method)].(map[string]interface{})
+        if !ok {
+            t.Errorf("%s %s missing from document", rt.Method, rt.Path)
+            continue
+        }
+        id := op["operationId"].(string)
+        if other, dup := seen[id]; dup {
+            t.Errorf("operationId %q used by both %s and %s", id, other, rt.Path)
+        }
+        seen[id] = rt.Path
+
+        responses := op["responses"].(map[string]interface{})
+        if _, ok := responses[strconv.Itoa(rt.Status)]; !ok {
+            t.Errorf("%s %s does not document its %d response", rt.Method, rt.Path, rt.Status)
+        }
+        if rt.Request != nil || len(rt.Multipart) > 0 {
+            if _, ok := op["requestBody"]; !ok {
+                t.Errorf("%s %s does not document its request body", rt.Method, rt.Path)
+            }
+        }
+    }
+}
+
+func TestOpenAPISchemasMatchGoTypes(t *testing.T) {
+    routes := newTestServer(t).routes()
+    doc := roundTrip(t, buildOpenAPI(routes))
+    schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+    types := map[string]reflect.Type{}
+    for _, rt := range routes {
+        for _, v := range []interface{}{rt.Request, rt.Response} {
+            if v == nil {
+                continue
+            }
+            typ := reflect.TypeOf(v)
+            for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+                typ = typ.Elem()
+            }
+            types[typ.Name()] = typ
+        }
+    }
+
+    for name, typ := range types {
+        schema, ok := schemas[name].(map[string]interface{})
+        if !ok {
+            t.Errorf("schema %s missing from components", name)
+            continue
+        }
+
+        // A zero value marshals exactly the fields that are always present
+        data, err := json.Marshal(reflect.New(typ).Interface())
+        if err != nil {
+            t.Fatalf("marshal %s: %v", name, err)
+        }
+        var zero map[string]interface{}
+        json.Unmarshal(data, &zero)
+
+        var wantRequired []string
+        for key := range zero {
+            wantRequired = append(wantRequired, key)
+        }
+        var gotRequired []string
+        required, _ := schema["required"].([]interface{})
+        for _, key := range required {
+            gotRequired = append(gotRequired, key.(string))
+        }
+        sort.Strings(wantRequired)
+        sort.Strings(gotRequired)
+        if !reflect.DeepEqual(gotRequired, wantRequired) {
+            t.Errorf("%s: required = %v, want %v", name, gotRequired, wantRequired)
+        }
+
+        // Fields of embedded structs are marshaled as if they were fields
+        // of the outer struct
+        tags := map[string]bool{}
+        var addTags func(typ reflect.Type)
+        addTags = func(typ reflect.Type) {
+            for i := 0; i < typ.NumField(); i++ {
+                f := typ.Field(i)
+                tag := strings.Split(f.Tag.Get("json"), ",")[0]
+                if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+                    addTags(f.Type)
+                } else if tag != "" && tag != "-" {
+                    tags[tag] = true
+                }
+            }
+        }
+        addTags(typ)
+        properties := schema["properties"].(map[string]interface{})
+        for tag := range tags {
+            if _, ok := properties[tag]; !ok {
+                t.Errorf("%s: property %q missing from schema", name, tag)
+            }
+        }
+        for property := range properties {
+            if !tags[property] {
+                t.Errorf("%s: schema documents unknown property %q", name, property)
+            }
+        }
+    }
+}
+
+func TestOpenAPIConstraints(t *testing.T) {
+    doc := roundTrip(t, buildOpenAPI(newTestServer(t).routes()))
+    schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+    properties := schemas["CreateUploadRequest"].(map[string]interface{})["properties"].(map[string]interface{})
+
+    // Length rules only apply to strings, bounds only to integers
+    size := properties["size"].(map[string]interface{})
+    if size["type"] != "integer" || size["minimum"] != float64(1) || size["minLength"] != nil {
+        t.Errorf("size schema = %v", size)
+    }
+    sum := properties["sha256"].(map[string]interface{})
+    if sum["minLength"] != float64(64) || sum["maxLength"] != float64(64) || sum["minimum"] != nil {
+        t.Errorf("sha256 schema = %v", sum)
+    }
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+    rec := httptest.NewRecorder()
+    newTestServer(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+    }
+    if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+        t.Errorf("Content-Type = %q", ct)
+    }
+    var doc map[string]interface{}
+    if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+        t.Fatalf("invalid JSON: %v", err)
+    }
+    if doc["openapi"] != "3.1.0" {
+        t.Errorf("openapi = %v, want 3.1.0", doc["openapi"])
+    }
+}
+
+func TestDocsHandler(t *testing.T) {
+    rec := httptest.NewRecorder()
+    newTestServer(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+    }
+    if !strings.Contains(rec.Body.String(), "/openapi.json") {
+        t.Error("docs page does not load /openapi.json")
+    }
+}
+
+func TestOperationID(t *testing.T) {
+    tests := map[string]string{
+        "/chat":                            "chat",
+        "/createAssistant":                 "createAssistant",
+        "/list-files-knowledgebase":        "listFilesKnowledgebase",
+        "/update-chat-context/{historyID}": "updateChatContext",
+    }
+    for path, want := range tests {
+        if got := operationID(path); got != want {
+            t.Errorf("operationID(%q) = %q, want %q", path, got, want)
+        }
+    }
+}
@@ -0,0 +1,904 @@
+package server
+
+import (
+    "bytes"
+    "compress/flate"
+    "compress/zlib"
+    "encoding/ascii85"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf16"
+)
+
+// The PDF reader below extracts the text of a document without rendering
+// it. Objects are found by scanning the file for "n g obj" headers rather
+// than through the cross-reference table, which also reads files whose
+// table is damaged. Text is decoded with the ToUnicode maps of the fonts
+// when they have one, otherwise as Latin-1. Encrypted files and text drawn
+// as images are not supported.
+
+// PDF object types besides numbers (float64), booleans, nil and arrays
+// ([]interface{})
+type (
+    pdfName     string
+    pdfString   string // raw bytes of a literal or hex string
+    pdfOperator string // keyword or delimiter
+    pdfDict     map[pdfName]interface{}
+    pdfRef      struct{ num, gen int }
+    pdfStream   struct {
+        dict pdfDict
+        data []byte // still encoded
+    }
+)
+
+// maxPDFDepth bounds the nesting of objects and form XObjects
+const maxPDFDepth = 32
+
+var errPDFSyntax = errors.New("invalid PDF syntax")
+
+// pdfLexer splits PDF data into tokens and objects
+type pdfLexer struct {
+    data []byte
+    pos  int
+}
+
+func isPDFSpace(c byte) bool {
+    return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+    return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+    for l.pos < len(l.data) {
+        c := l.data[l.pos]
+        if c == '%' {
+            for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+                l.pos++
+            }
+            continue
+        }
+        if !isPDFSpace(c) {
+            return
+        }
+        l.pos++
+    }
+}
+
+// token returns the next token, or io.EOF at the end of the data
+func (l *pdfLexer) token() (interface{}, error) {
+    l.skipSpace()
+    if l.pos >= len(l.data) {
+        return nil, io.EOF
+    }
+    c := l.data[l.pos]
+    switch {
+    case c == '/':
+        l.pos++
+        return l.name(), nil
+    case c == '(':
+        l.pos++
+        return l.literal(), nil
+    case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+        l.pos += 2
+        return pdfOperator("<<"), nil
+    case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+        l.pos += 2
+        return pdfOperator(">>"), nil
+    case c == '<':
+        l.pos++
+        return l.hexString(), nil
+    case strings.IndexByte("[]{}>)", c) >= 0:
+        l.pos++
+        return pdfOperator(c), nil
+    }
+
+    start := l.pos
+    for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+        l.pos++
+    }
+    word := string(l.data[start:l.pos])
+    if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+        if n, err := strconv.ParseFloat(word, 64); err == nil {
+            return n, nil
+        }
+    }
+    return pdfOperator(word), nil
+}
+
+func (l *pdfLexer) name() pdfName {
+    var b []byte
+    for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+        c := l.data[l.pos]
+        if c == '#' && l.pos+2 < len(l.data) {
+            if v, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+                b = append(b, v[0])
+                l.pos += 3
+                continue
+            }
+        }
+        b = append(b, c)
+        l.pos++
+    }
+    return pdfName(b)
+}
+
+func (l *pdfLexer) literal() pdfString {
+    var b []byte
+    depth := 1
+    for l.pos < len(l.data) {
+        c := l.data[l.pos]
+        l.pos++
+        switch c {
+        case '(':
+            depth++
+        case ')':
+            depth--
+            if depth == 0 {
+                return pdfString(b)
+            }
+        case '\\':
+            if l.pos >= len(l.data) {
+                return pdfString(b)
+            }
+            c = l.data[l.pos]
+            l.pos++
+            switch c {
+            case 'n':
+                c = '\n'
+            case 'r':
+                c = '\r'
+            case 't':
+                c = '\t'
+            case 'b':
+                c = '\b'
+            case 'f':
+                c = '\f'
+            case '\r':
+                if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+                    l.pos++
+                }
+                continue
+            case '\n':
+                continue
+            case '0', '1', '2', '3', '4', '5', '6', '7':
+                v := int(c - '0')
+                for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+                    v = v*8 + int(l.data[l.pos]-'0')
+                    l.pos++
+                }
+                c = byte(v)
+            }
+        }
+        b = append(b, c)
+    }
+    return pdfString(b)
+}
+
+func (l *pdfLexer) hexString() pdfString {
+    var digits []byte
+    for l.pos < len(l.data) && l.data[l.pos] != '>' {
+        if c := l.data[l.pos]; strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+            digits = append(digits, c)
+        }
+        l.pos++
+    }
+    l.pos++
+    if len(digits)%2 == 1 {
+        digits = append(digits, '0')
+    }
+    b, _ := hex.DecodeString(string(digits))
+    return pdfString(b)
+}
+
+// object reads the next object: a token, or an array, dictionary or
+// reference made of several tokens. Keywords are returned as operators.
+func (l *pdfLexer) object(depth int) (interface{}, error) {
+    if depth > maxPDFDepth {
+        return nil, errPDFSyntax
+    }
+    tok, err := l.token()
+    if err != nil {
+        return nil, err
+    }
+    switch tok := tok.(type) {
+    case float64:
+        // A reference is two integers followed by R
+        save := l.pos
+        if gen, err := l.token(); err == nil {
+            if g, ok := gen.(float64); ok && g == math.Trunc(g) && tok == math.Trunc(tok) {
+                if r, err := l.token(); err == nil && r == pdfOperator("R") {
+                    return pdfRef{num: int(tok), gen: int(g)}, nil
+                }
+            }
+        }
+        l.pos = save
+        return tok, nil
+    case pdfOperator:
+        switch tok {
+        case "<<":
+            dict := pdfDict{}
+            for {
+                key, err := l.object(depth + 1)
+                if err != nil {
+                    return nil, err
+                }
+                if key == pdfOperator(">>") {
+                    return dict, nil
+                }
+                name, ok := key.(pdfName)
+                if !ok {
+                    return nil, errPDFSyntax
+                }
+                value, err := l.object(depth + 1)
+                if err != nil {
+                    return nil, err
+                }
+                dict[name] = value
+            }
+        case "[":
+            array := []interface{}{}
+            for {
+                item, err := l.object(depth + 1)
+                if err != nil {
+                    return nil, err
+                }
+                if item == pdfOperator("]") {
+                    return array, nil
+                }
+                array = append(array, item)
+            }
+        case "true":
+            return true, nil
+        case "false":
+            return false, nil
+        case "null":
+            return nil, nil
+        }
+    }
+    return tok, nil
+}
+
+// pdfDocument holds the objects of a PDF file by object number
+type pdfDocument struct {
+    objects  map[int]interface{}
+    trailers []pdfDict
+
+    // The streams of a document decompress to at most maxDecoded bytes in
+    // all, guarding against compression bombs. err is set once they would
+    // decompress to more.
+    maxDecoded int64
+    decoded    int64
+    err        error
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+func parsePDF(data []byte, maxDecoded int64) (*pdfDocument, error) {
+    if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+        return nil, errors.New("not a PDF file")
+    }
+    d := &pdfDocument{objects: map[int]interface{}{}, maxDecoded: maxDecoded}
+
+    end := 0
+    for _, m := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+        if m[0] < end {
+            continue // inside the previous object's stream
+        }
+        num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+        l := &pdfLexer{data: data, pos: m[1]}
+        obj, err := l.object(0)
+        if err != nil {
+            continue
+        }
+        if dict, ok := obj.(pdfDict); ok {
+            save := l.pos
+            if tok, err := l.token(); err == nil && tok == pdfOperator("stream") {
+                obj = &pdfStream{dict: dict, data: l.streamData(dict)}
+            } else {
+                l.pos = save
+            }
+        }
+        d.objects[num] = obj // later objects replace earlier ones
+        end = l.pos
+    }
+
+    for i := 0; ; {
+        n := bytes.Index(data[i:], []byte("trailer"))
+        if n < 0 {
+            break
+        }
+        l := &pdfLexer{data: data, pos: i + n + len("trailer")}
+        if dict, ok := l.mustObject().(pdfDict); ok {
+            d.trailers = append(d.trailers, dict)
+        }
+        i += n + len("trailer")
+    }
+
+    // Objects compressed into object streams
+    nums := make([]int, 0, len(d.objects))
+    for num := range d.objects {
+        nums = append(nums, num)
+    }
+    sort.Ints(nums)
+    for _, num := range nums {
+        st, ok := d.objects[num].(*pdfStream)
+        if !ok {
+            continue
+        }
+        switch st.dict["Type"] {
+        case pdfName("XRef"):
+            d.trailers = append(d.trailers, st.dict)
+        case pdfName("ObjStm"):
+            d.readObjectStream(st)
+        }
+    }
+    if d.err != nil {
+        return nil, d.err
+    }
+
+    for _, t := range d.trailers {
+        if _, ok := t["Encrypt"]; ok {
+            return nil, errors.New("encrypted PDF files are not supported")
+        }
+    }
+    return d, nil
+}
+
+func (l *pdfLexer) mustObject() interface{} {
+    obj, _ := l.object(0)
+    return obj
+}
+
+// streamData returns the data of a stream whose keyword was just read
+func (l *pdfLexer) streamData(dict pdfDict) []byte {
+    if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+        l.pos++
+    }
+    if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+        l.pos++
+    }
+    start := l.pos
+    if n, ok := dict["Length"].(float64); ok && n >= 0 && start+int(n) <= len(l.data) {
+        rest := bytes.TrimLeft(l.data[start+int(n):], " \t\r\n")
+        if bytes.HasPrefix(rest, []byte("endstream")) {
+            l.pos = start + int(n)
+            return l.data[start:l.pos]
+        }
+    }
+    // The length is indirect or wrong, search for the end of the stream
+    n := bytes.Index(l.data[start:], []byte("endstream"))
+    if n < 0 {
+        l.pos = len(l.data)
+        return l.data[start:]
+    }
+    l.pos = start + n + len("endstream")
+    return bytes.TrimRight(l.data[start:start+n], "\r\n")
+}
+
+func (d *pdfDocument) readObjectStream(st *pdfStream) {
+    data, err := d.decode(st)
+    if err != nil {
+        return
+    }
+    n, _ := d.resolve(st.dict["N"]).(float64)
+    first, _ := d.resolve(st.dict["First"]).(float64)
+    l := &pdfLexer{data: data}
+    for i := 0; i < int(n); i++ {
+        num, _ := l.mustObject().(float64)
+        offset, _ := l.mustObject().(float64)
+        if _, ok := d.objects[int(num)]; ok || int(first+offset) >= len(data) {
+            continue
+        }
+        ol := &pdfLexer{data: data, pos: int(first + offset)}
+        d.objects[int(num)] = ol.mustObject()
+    }
+}
+
+// resolve follows references to the object they point to
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+    for i := 0; i < maxPDFDepth; i++ {
+        ref, ok := v.(pdfRef)
+        if !ok {
+            return v
+        }
+        v = d.objects[ref.num]
+    }
+    return nil
+}
+
+func (d *pdfDocument) dict(v interface{}) pdfDict {
+    switch v := d.resolve(v).(type) {
+    case pdfDict:
+        return v
+    case *pdfStream:
+        return v.dict
+    }
+    return nil
+}
+
+// decode returns the decoded data of a stream
+func (d *pdfDocument) decode(st *pdfStream) ([]byte, error) {
+    if d.err != nil {
+        return nil, d.err
+    }
+    var filters []interface{}
+    switch f := d.resolve(st.dict["Filter"]).(type) {
+    case pdfName:
+        filters = []interface{}{f}
+    case []interface{}:
+        filters = f
+    }
+
+    data := st.data
+    for _, f := range filters {
+        var err error
+        switch d.resolve(f) {
+        case pdfName("FlateDecode"), pdfName("Fl"):
+            data, err = d.inflate(data)
+        case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+            l := &pdfLexer{data: append(bytes.TrimSpace(data), '>')}
+            data = []byte(l.hexString())
+        case pdfName("ASCII85Decode"), pdfName("A85"):
+            data, err = decodeASCII85(data)
+        default:
+            err = fmt.Errorf("unsupported PDF filter %v", f)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    return data, nil
+}
+
+// inflate decompresses zlib data, keeping what could be read from
+// truncated streams
+func (d *pdfDocument) inflate(data []byte) ([]byte, error) {
+    var r io.ReadCloser
+    r, err := zlib.NewReader(bytes.NewReader(data))
+    if err != nil {
+        r = flate.NewReader(bytes.NewReader(data))
+    }
+    defer r.Close()
+    left := d.maxDecoded - d.decoded
+    out, err := io.ReadAll(io.LimitReader(r, left+1))
+    if int64(len(out)) > left {
+        d.err = fmt.Errorf("the PDF file decompresses to more than %d bytes", d.maxDecoded)
+        return nil, d.err
+    }
+    d.decoded += int64(len(out))
+    if err != nil && len(out) == 0 {
+        return nil, err
+    }
+    return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+    data = bytes.Map(func(r rune) rune {
+        if isPDFSpace(byte(r)) {
+            return -1
+        }
+        return r
+    }, data)
+    data = bytes.TrimPrefix(data, []byte("<~"))
+    if i := bytes.Index(data, []byte("~>")); i >= 0 {
+        data = data[:i]
+    }
+    out := make([]byte, 4*len(data)/5+4)
+    n, _, err := ascii85.Decode(out, data, true)
+    return out[:n], err
+}
+
+// pdfPage is a page of a document with the resources it uses
+type pdfPage struct {
+    dict      pdfDict
+    resources pdfDict
+}
+
+// pages returns the pages of the document in order
+func (d *pdfDocument) pages() []pdfPage {
+    var root pdfDict
+    for _, t := range d.trailers {
+        if r := d.dict(t["Root"]); r != nil {
+            root = r
+        }
+    }
+    if root == nil {
+        for _, obj := range d.objects {
+            if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+                root = dict
+            }
+        }
+    }
+
+    var pages []pdfPage
+    visited := map[int]bool{}
+    var walk func(node interface{}, resources pdfDict, depth int)
+    walk = func(node interface{}, resources pdfDict, depth int) {
+        if ref, ok := node.(pdfRef); ok {
+            if visited[ref.num] {
+                return
+            }
+            visited[ref.num] = true
+        }
+        dict := d.dict(node)
+        if dict == nil || depth > maxPDFDepth {
+            return
+        }
+        if r := d.dict(dict["Resources"]); r != nil {
+            resources = r
+        }
+        kids, ok := d.resolve(dict["Kids"]).([]interface{})
+        if !ok {
+            pages = append(pages, pdfPage{dict: dict, resources: resources})
+            return
+        }
+        for _, kid := range kids {
+            walk(kid, resources, depth+1)
+        }
+    }
+    if root != nil {
+        walk(root["Pages"], nil, 0)
+    }
+
+    if len(pages) == 0 {
+        // No usable page tree, take the page objects in file order
+        nums := make([]int, 0, len(d.objects))
+        for num := range d.objects {
+            nums = append(nums, num)
+        }
+        sort.Ints(nums)
+        for _, num := range nums {
+            if dict, ok := d.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Page") {
+                pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+            }
+        }
+    }
+    return pages
+}
+
+// contents returns the decoded content streams of a page
+func (d *pdfDocument) contents(page pdfDict) []byte {
+    var streams []interface{}
+    switch c := d.resolve(page["Contents"]).(type) {
+    case *pdfStream:
+        streams = []interface{}{c}
+    case []interface{}:
+        streams = c
+    }
+    var data []byte
+    for _, s := range streams {
+        if st, ok := d.resolve(s).(*pdfStream); ok {
+            if decoded, err := d.decode(st); err == nil {
+                data = append(data, decoded...)
+                data = append(data, '\n')
+            }
+        }
+    }
+    return data
+}
+
+// pdfFont decodes the strings shown with a font
+type pdfFont struct {
+    toUnicode map[string]string // text of the character codes
+    widths    []int             // byte lengths of the character codes, longest first
+    composite bool              // Type0 font with two byte codes
+}
+
+func (d *pdfDocument) font(dict pdfDict) *pdfFont {
+    f := &pdfFont{composite: dict["Subtype"] == pdfName("Type0")}
+    if st, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+        if data, err := d.decode(st); err == nil {
+            f.parseCMap(data)
+        }
+    }
+    return f
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func (f *pdfFont) parseCMap(data []byte) {
+    f.toUnicode = map[string]string{}
+    widths := map[int]bool{}
+    add := func(code, text string) {
+        f.toUnicode[code] = text
+        widths[len(code)] = true
+    }
+
+    l := &pdfLexer{data: data}
+    var operands []interface{}
+    for {
+        obj, err := l.object(0)
+        if err != nil {
+            break
+        }
+        op, ok := obj.(pdfOperator)
+        if !ok {
+            operands = append(operands, obj)
+            continue
+        }
+        switch op {
+        case "endbfchar":
+            for i := 0; i+1 < len(operands); i += 2 {
+                src, ok1 := operands[i].(pdfString)
+                dst, ok2 := operands[i+1].(pdfString)
+                if ok1 && ok2 {
+                    add(string(src), utf16BE(string(dst)))
+                }
+            }
+        case "endbfrange":
+            for i := 0; i+2 < len(operands); i += 3 {
+                lo, ok1 := operands[i].(pdfString)
+                hi, ok2 := operands[i+1].(pdfString)
+                if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+                    continue
+                }
+                from, to := codeValue(string(lo)), codeValue(string(hi))
+                for code := from; code <= to && code-from < 1<<16; code++ {
+                    offset := code - from
+                    switch dst := operands[i+2].(type) {
+                    case pdfString:
+                        add(codeString(code, len(lo)), utf16BE(incrementLast(string(dst), offset)))
+                    case []interface{}:
+                        if offset < len(dst) {
+                            if s, ok := dst[offset].(pdfString); ok {
+                                add(codeString(code, len(lo)), utf16BE(string(s)))
+                            }
+                        }
+                    }
+                }
+            }
+        }
+        operands = operands[:0]
+    }
+    for w := range widths {
+        f.widths = append(f.widths, w)
+    }
+    sort.Sort(sort.Reverse(sort.IntSlice(f.widths)))
+}
+
+func codeValue(s string) int {
+    v := 0
+    for i := 0; i < len(s); i++ {
+        v = v<<8 | int(s[i])
+    }
+    return v
+}
+
+func codeString(v, n int) string {
+    b := make([]byte, n)
+    for i := n - 1; i >= 0; i-- {
+        b[i] = byte(v)
+        v >>= 8
+    }
+    return string(b)
+}
+
+// incrementLast adds n to the last UTF-16 code unit of s
+func incrementLast(s string, n int) string {
+    if len(s) < 2 {
+        return s
+    }
+    last := codeValue(s[len(s)-2:]) + n
+    return s[:len(s)-2] + codeString(last, 2)
+}
+
+// utf16BE decodes UTF-16 big endian text
+func utf16BE(s string) string {
+    units := make([]uint16, 0, len(s)/2)
+    for i := 0; i+1 < len(s); i += 2 {
+        units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+    }
+    return string(utf16.Decode(units))
+}
+
+// winAnsi holds the characters of the Windows-1252 code points that differ
+// from Latin-1
+var winAnsi = map[byte]rune{
+    0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// decode returns the text of a string shown with the font
+func (f *pdfFont) decode(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); {
+        matched := false
+        for _, w := range f.widths {
+            if i+w <= len(s) {
+                if text, ok := f.toUnicode[s[i:i+w]]; ok {
+                    b.WriteString(text)
+                    i += w
+                    matched = true
+                    break
+                }
+            }
+        }
+        if matched {
+            continue
+        }
+        if f.composite {
+            i += 2 // the text of the glyph is unknown
+            continue
+        }
+        c := s[i]
+        if r, ok := winAnsi[c]; ok {
+            b.WriteRune(r)
+        } else if c >= 0x20 && c != 0x7f {
+            b.WriteRune(rune(c))
+        }
+        i++
+    }
+    return b.String()
+}
+
+// pdfText collects the text of the content streams of a document
+type pdfText struct {
+    doc   *pdfDocument
+    b     strings.Builder
+    fonts map[interface{}]*pdfFont
+}
+
+func (t *pdfText) newline() {
+    t.b.WriteString("\n")
+}
+
+func (t *pdfText) space() {
+    s := t.b.String()
+    if len(s) > 0 && s[len(s)-1] != ' ' && s[len(s)-1] != '\n' {
+        t.b.WriteString(" ")
+    }
+}
+
+// fontOf returns the font a resource name refers to
+func (t *pdfText) fontOf(resources pdfDict, name pdfName) *pdfFont {
+    fonts := t.doc.dict(resources["Font"])
+    ref := fonts[name]
+    key := ref
+    if _, ok := ref.(pdfRef); !ok {
+        key = fmt.Sprintf("%p/%s", fonts, name)
+    }
+    if f, ok := t.fonts[key]; ok {
+        return f
+    }
+    f := &pdfFont{}
+    if dict := t.doc.dict(ref); dict != nil {
+        f = t.doc.font(dict)
+    }
+    t.fonts[key] = f
+    return f
+}
+
+// content interprets the text operators of a content stream
+func (t *pdfText) content(data []byte, resources pdfDict, depth int) {
+    if depth > maxPDFDepth/4 {
+        return
+    }
+    font := &pdfFont{}
+    lastY, hasY := 0.0, false
+    show := func(v interface{}) {
+        if s, ok := v.(pdfString); ok {
+            t.b.WriteString(font.decode(string(s)))
+        }
+    }
+    number := func(v interface{}) float64 {
+        n, _ := v.(float64)
+        return n
+    }
+
+    l := &pdfLexer{data: data}
+    var operands []interface{}
+    for {
+        obj, err := l.object(0)
+        if err != nil {
+            return
+        }
+        op, ok := obj.(pdfOperator)
+        if !ok {
+            operands = append(operands, obj)
+            continue
+        }
+        last := func() interface{} {
+            if len(operands) == 0 {
+                return nil
+            }
+            return operands[len(operands)-1]
+        }
+        switch op {
+        case "BI":
+            // Skip inline image data
+            n := bytes.Index(data[l.pos:], []byte("EI"))
+            for n >= 0 && l.pos+n+2 < len(data) && !isPDFSpace(data[l.pos+n+2]) {
+                next := bytes.Index(data[l.pos+n+2:], []byte("EI"))
+                if next < 0 {
+                    n = -1
+                    break
+                }
+                n += 2 + next
+            }
+            if n < 0 {
+                return
+            }
+            l.pos += n + 2
+        case "Tf":
+            if len(operands) >= 2 {
+                if name, ok := operands[len(operands)-2].(pdfName); ok {
+                    font = t.fontOf(resources, name)
+                }
+            }
+        case "Tj":
+            show(last())
+        case "'", "\"":
+            t.newline()
+            show(last())
+        case "TJ":
+            items, _ := last().([]interface{})
+            for _, item := range items {
+                if n, ok := item.(float64); ok && n < -200 {
+                    t.space()
+                }
+                show(item)
+            }
+        case "Td", "TD":
+            if len(operands) >= 2 && number(operands[1]) != 0 {
+                t.newline()
+            } else {
+                t.space()
+            }
+        case "T*":
+            t.newline()
+        case "Tm":
+            if len(operands) >= 6 {
+                y := number(operands[5])
+                if hasY && y != lastY {
+                    t.newline()
+                } else {
+                    t.space()
+                }
+                lastY, hasY = y, true
+            }
+        case "Do":
+            if name, ok := last().(pdfName); ok {
+                xobjects := t.doc.dict(resources["XObject"])
+                if st, ok := t.doc.resolve(xobjects[name]).(*pdfStream); ok && st.dict["Subtype"] == pdfName("Form") {
+                    if decoded, err := t.doc.decode(st); err == nil {
+                        formResources := t.doc.dict(st.dict["Resources"])
+                        if formResources == nil {
+                            formResources = resources
+                        }
+                        t.content(decoded, formResources, depth+1)
+                        t.newline()
+                    }
+                }
+            }
+        }
+        operands = operands[:0]
+    }
+}
+
+// extractPDF returns the text of a PDF document, one paragraph per page
+func extractPDF(data []byte, maxDecoded int64) (string, error) {
+    doc, err := parsePDF(data, maxDecoded)
+    if err != nil {
+        return "", err
+    }
+    pages := doc.pages()
+    if len(pages) == 0 {
+        return "", errors.New("the PDF file has no pages")
+    }
+    t := &pdfText{doc: doc, fonts: map[interface{}]*pdfFont{}}
+    for _, page := range pages {
+        t.content(doc.contents(page.dict), page.resources, 0)
+        t.b.WriteString("\n\n")
+    }
+    if doc.err != nil {
+        return "", doc.err
+    }
+    return t.b.String(), nil
+}
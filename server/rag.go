@@ -0,0 +1,145 @@
+package server
+
+import (
+    "cmp"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Retrieval parameters of chat replies
+const (
+    defaultRetrievalTopK = 3
+    maxGroundedSentences = 3 // sentences of a reply composed from sources
+)
+
+// noSourcesReply is the grounded reply when the knowledge bases hold
+// nothing about the message
+const noSourcesReply = "I could not find anything about that in the knowledge base."
+
+// RetrievalOptions makes a chat reply draw on the knowledge bases attached
+// to the assistant. The chunks are found as by /search-knowledgebases.
+type RetrievalOptions struct {
+    Mode string `json:"mode,omitempty" validate:"oneof=lexical|semantic|hybrid"` // defaults to lexical
+    TopK int    `json:"topK,omitempty" validate:"range=1|20"`
+}
+
+// Citation points at the knowledge base chunk behind a footnote such as
+// [1] of a reply. Start and End are byte offsets in the extracted text of
+// the file.
+type Citation struct {
+    Footnote      int     `json:"footnote"`
+    KnowledgeBase string  `json:"knowledgeBase"`
+    FileName      string  `json:"fileName"`
+    ChunkID       string  `json:"chunkID"`
+    Heading       string  `json:"heading,omitempty"`
+    Start         int     `json:"start"`
+    End           int     `json:"end"`
+    Score         float64 `json:"score"`
+}
+
+// retrieve returns the chunks of the knowledge bases attached to assistant
+// that are most relevant to message, best first
+func (s *Server) retrieve(assistant, message string, opts RetrievalOptions) ([]KnowledgeSearchResult, error) {
+    attached, err := s.attachedKnowledgeBases(assistant)
+    if err != nil {
+        return nil, err
+    }
+    search := knowledgeSearch{
+        mode:    cmp.Or(opts.Mode, searchLexical),
+        clauses: parseSearchQuery(message),
+        topK:    cmp.Or(opts.TopK, defaultRetrievalTopK),
+    }
+    for _, name := range attached {
+        if s.exists(knowledgeBaseDir(name)) {
+            search.knowledgeBases = append(search.knowledgeBases, name)
+        }
+    }
+    if len(search.clauses) == 0 || len(search.knowledgeBases) == 0 {
+        return []KnowledgeSearchResult{}, nil
+    }
+    if search.mode != searchLexical {
+        search.vector = s.embedder.Embed(message)
+    }
+    return s.searchKnowledge(search)
+}
+
+// footnotePattern matches the footnotes of a reply such as [1]
+var footnotePattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// citeSources returns the citations of the sources the footnotes of reply
+// refer to, in the order they first occur. Replies cite sources[i] as
+// [i+1]; other numbers are left alone.
+func citeSources(reply string, sources []KnowledgeSearchResult) []Citation {
+    var citations []Citation
+    cited := map[int]bool{}
+    for _, match := range footnotePattern.FindAllStringSubmatch(reply, -1) {
+        n, err := strconv.Atoi(match[1])
+        if err != nil || n < 1 || n > len(sources) || cited[n] {
+            continue
+        }
+        cited[n] = true
+        source := sources[n-1]
+        citations = append(citations, Citation{
+            Footnote:      n,
+            KnowledgeBase: source.KnowledgeBase,
+            FileName:      source.File,
+            ChunkID:       source.ID,
+            Heading:       source.Heading,
+            Start:         source.Start,
+            End:           source.End,
+            Score:         source.Score,
+        })
+    }
+    return citations
+}
+
+// groundedReply composes a reply from the sources of a prompt: for each of
+// the best sources the sentence sharing the most keywords with the message,
+// followed by the footnote of the source
+func groundedReply(prompt Prompt) string {
+    keywords := map[string]bool{}
+    for _, t := range tokenize(prompt.Message) {
+        if !stopWords[t.term] {
+            keywords[t.term] = true
+        }
+    }
+
+    var sentences []string
+    seen := map[string]bool{}
+    for i, source := range prompt.Sources {
+        if len(sentences) == maxGroundedSentences {
+            break
+        }
+        sentence := bestSentence(source.Text, keywords)
+        if sentence == "" || seen[sentence] {
+            continue
+        }
+        seen[sentence] = true
+        sentences = append(sentences, fmt.Sprintf("%s [%d]", sentence, i+1))
+    }
+    if len(sentences) == 0 {
+        return noSourcesReply
+    }
+    return "Here is what I found in the knowledge base: " + strings.Join(sentences, " ")
+}
+
+// bestSentence returns the first of the sentences of text with the most
+// keywords, with its white space collapsed
+func bestSentence(text string, keywords map[string]bool) string {
+    c := chunker{text: text}
+    best, bestCount := "", -1
+    for _, sp := range c.sentences(span{0, len(text)}) {
+        count := 0
+        for _, t := range tokenize(text[sp.start:sp.end]) {
+            if keywords[t.term] {
+                count++
+            }
+        }
+        if count > bestCount {
+            best, bestCount = text[sp.start:sp.end], count
+        }
+    }
+    return strings.Join(strings.Fields(best), " ")
+}
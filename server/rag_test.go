@@ -0,0 +1,113 @@
+package server
+
+import (
+    "bufio"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestChatRetrieval(t *testing.T) {
+    s := newKnowledgeServer(t)
+
+    rec := serve(s, http.MethodPost, "/chat", `{"context":"How often do I refill the toner?","assistantTitle":"Reviewer","retrieval":{"topK":1}}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var resp ChatResponse
+    decodeBody(t, rec, &resp)
+    if want := "Here is what I found in the knowledge base: Refill the printer toner monthly. [1]"; resp.Response != want {
+        t.Errorf("response = %q, want %q", resp.Response, want)
+    }
+    chunks, err := s.chunks("Manuals", "printer.md")
+    if err != nil {
+        t.Fatal(err)
+    }
+    chunk := chunks.Chunks[0]
+    if len(resp.Citations) != 1 {
+        t.Fatalf("citations = %+v, want one", resp.Citations)
+    }
+    want := Citation{Footnote: 1, KnowledgeBase: "Manuals", FileName: "printer.md", ChunkID: chunk.ID, Heading: "Printer", Start: chunk.Start, End: chunk.End, Score: resp.Citations[0].Score}
+    if resp.Citations[0] != want || want.Score <= 0 {
+        t.Errorf("citation = %+v, want %+v", resp.Citations[0], want)
+    }
+
+    // The citations are stored with the reply
+    c := readConversation(t, s, "Reviewer", resp.HistoryID)
+    var stored []Citation
+    data, _ := json.Marshal(c.Messages[1].Metadata["citations"])
+    if err := json.Unmarshal(data, &stored); err != nil || !reflect.DeepEqual(stored, resp.Citations) {
+        t.Errorf("stored citations = %s, want %+v", data, resp.Citations)
+    }
+
+    // Assistants without knowledge bases find nothing
+    rec = serve(s, http.MethodPost, "/chat", `{"context":"How often do I refill the toner?","assistantTitle":"Writer","retrieval":{}}`)
+    resp = ChatResponse{}
+    decodeBody(t, rec, &resp)
+    if resp.Response != noSourcesReply || resp.Citations != nil {
+        t.Errorf("response = %+v, want nothing found", resp)
+    }
+
+    runHandlerTests(t, []handlerTest{
+        {name: "retrieval without assistant", method: http.MethodPost, target: "/chat", body: `{"context":"hi","retrieval":{}}`, status: http.StatusBadRequest},
+        {name: "unknown retrieval mode", method: http.MethodPost, target: "/chat", body: `{"context":"hi","assistantTitle":"Reviewer","retrieval":{"mode":"fuzzy"}}`, status: http.StatusBadRequest},
+        {name: "retrieval top k too large", method: http.MethodPost, target: "/chat-stream", body: `{"context":"hi","assistantTitle":"Reviewer","retrieval":{"topK":21}}`, status: http.StatusBadRequest},
+    })
+}
+
+func TestChatRetrievalCitesFootnotes(t *testing.T) {
+    var got Prompt
+    s := newKnowledgeServer(t, func(o *Options) {
+        o.Responder = ResponderFunc(func(p Prompt) string {
+            got = p
+            return "See [2], [2] again, [7] and [1]."
+        })
+    })
+
+    rec := serve(s, http.MethodPost, "/chat-stream", `{"context":"invoices","assistantTitle":"Reviewer","retrieval":{"mode":"hybrid"}}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if !got.Grounded || len(got.Sources) != 3 {
+        t.Fatalf("responder got %d sources, want 3", len(got.Sources))
+    }
+
+    var last ChatStreamChunk
+    scanner := bufio.NewScanner(rec.Body)
+    for scanner.Scan() {
+        data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+        if ok && data != "[DONE]" {
+            last = ChatStreamChunk{}
+            json.Unmarshal([]byte(data), &last)
+        }
+    }
+    var cited []string
+    for _, c := range last.Citations {
+        source := got.Sources[c.Footnote-1]
+        if c.ChunkID != source.ID || c.Score != source.Score {
+            t.Errorf("citation %+v does not match source %+v", c, source)
+        }
+        cited = append(cited, c.FileName)
+    }
+    if want := []string{got.Sources[1].File, got.Sources[0].File}; !reflect.DeepEqual(cited, want) {
+        t.Errorf("cited files = %v, want %v", cited, want)
+    }
+}
+
+func TestGroundedReply(t *testing.T) {
+    sources := []KnowledgeSearchResult{
+        {Chunk: Chunk{Text: "Invoices are sent monthly.  Late invoices   cost a fee."}},
+        {Chunk: Chunk{Text: "Late invoices cost a fee."}},
+        {Chunk: Chunk{Text: "The fee is ten euros."}},
+    }
+    got := groundedReply(Prompt{Message: "What is the fee for late invoices?", Grounded: true, Sources: sources})
+    // The second source repeats the sentence of the first
+    if want := "Here is what I found in the knowledge base: Late invoices cost a fee. [1] The fee is ten euros. [3]"; got != want {
+        t.Errorf("reply = %q, want %q", got, want)
+    }
+    if got := groundedReply(Prompt{Message: "fee", Grounded: true}); got != noSourcesReply {
+        t.Errorf("reply without sources = %q", got)
+    }
+}
@@ -0,0 +1,488 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "net/http"
+    "path"
+    "strconv"
+    "time"
+)
+
+// Resumable uploads send a large file in chunks over several requests: the
+// upload is created with the size and checksum of the file, its chunks are
+// sent in order with the offset they start at, and once complete the upload
+// is finalized, which verifies the checksum and stores the file like
+// /upload. A client whose connection dropped asks for the offset received
+// so far and carries on from there.
+//
+// The upload of a file lives in a folder of the uploads folder of the
+// knowledge base, holding the session and a part file per chunk named by
+// its offset.
+
+// uploadSessionTTL is how long a resumable upload is kept after it was
+// created or last received a chunk
+const uploadSessionTTL = 24 * time.Hour
+
+// uploadIDRules validates the ID of a resumable upload
+const uploadIDRules = "required,max=64,charset=id"
+
+// uploadOffsetHeader carries the offset a chunk starts at
+const uploadOffsetHeader = "Upload-Offset"
+
+// CreateUploadRequest represents the structure of the incoming request for creating a resumable upload
+type CreateUploadRequest struct {
+    Title    string `json:"title" validate:"required,max=100,charset=name"`
+    FileName string `json:"fileName" validate:"required,max=255,charset=name"`
+    Size     int64  `json:"size" validate:"required,min=1"`                       // in bytes
+    SHA256   string `json:"sha256" validate:"required,min=64,max=64,charset=hex"` // of the whole file
+}
+
+// UploadSessionRequest names a resumable upload
+type UploadSessionRequest struct {
+    Title    string `json:"title" validate:"required,max=100,charset=name"`
+    UploadID string `json:"uploadID" validate:"required,max=64,charset=id"`
+}
+
+// UploadSession describes a resumable upload to the knowledge base named
+// after an assistant. Offset is the number of bytes received so far.
+type UploadSession struct {
+    UploadID   string    `json:"uploadID"`
+    Title      string    `json:"title"`
+    FileName   string    `json:"fileName"`
+    Size       int64     `json:"size"`
+    SHA256     string    `json:"sha256"`
+    UploadedBy string    `json:"uploadedBy,omitempty"`
+    Offset     int64     `json:"offset"`
+    ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+func uploadSessionDir(knowledgeBase, id string) string {
+    return path.Join(uploadsDir(knowledgeBase), id)
+}
+
+func uploadSessionPath(knowledgeBase, id string) string {
+    return path.Join(uploadSessionDir(knowledgeBase, id), "session.json")
+}
+
+func uploadPartsDir(knowledgeBase, id string) string {
+    return path.Join(uploadSessionDir(knowledgeBase, id), "parts")
+}
+
+// uploadPartPath names a chunk by its offset, padded so the parts sort in
+// order
+func uploadPartPath(knowledgeBase, id string, offset int64) string {
+    return path.Join(uploadPartsDir(knowledgeBase, id), fmt.Sprintf("%020d", offset))
+}
+
+// readUploadSession returns a resumable upload with the offset received so
+// far. Expired uploads are removed and reported as not existing.
+func (s *Server) readUploadSession(knowledgeBase, id string) (*UploadSession, error) {
+    data, err := s.store.ReadFile(uploadSessionPath(knowledgeBase, id))
+    if err != nil {
+        return nil, err
+    }
+    var session UploadSession
+    if err := json.Unmarshal(data, &session); err != nil {
+        return nil, err
+    }
+    if !s.now().Before(session.ExpiresAt) {
+        s.store.RemoveAll(uploadSessionDir(knowledgeBase, id))
+        return nil, fs.ErrNotExist
+    }
+
+    // The parts are what was received, whatever the stored offset says
+    parts, err := s.store.ReadDir(uploadPartsDir(knowledgeBase, id))
+    if err != nil {
+        return nil, err
+    }
+    session.Offset = 0
+    for _, part := range parts {
+        info, err := part.Info()
+        if err != nil {
+            return nil, err
+        }
+        session.Offset += info.Size()
+    }
+    return &session, nil
+}
+
+// writeUploadSession stores a resumable upload, keeping it for another
+// uploadSessionTTL
+func (s *Server) writeUploadSession(session *UploadSession) error {
+    session.ExpiresAt = s.now().Add(uploadSessionTTL).UTC()
+    data, err := json.Marshal(session)
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(s.store, uploadSessionPath(session.Title, session.UploadID), data)
+}
+
+// removeExpiredUploads removes the resumable uploads to a knowledge base
+// that have expired, and the files of other uploads left behind by a crash
+// that have not changed for uploadSessionTTL
+func (s *Server) removeExpiredUploads(knowledgeBase string) {
+    entries, _ := s.store.ReadDir(uploadsDir(knowledgeBase))
+    for _, entry := range entries {
+        if entry.IsDir() {
+            s.readUploadSession(knowledgeBase, entry.Name())
+            continue
+        }
+        info, err := entry.Info()
+        if err == nil && s.now().Sub(info.ModTime()) > uploadSessionTTL {
+            s.store.Remove(path.Join(uploadsDir(knowledgeBase), entry.Name()))
+        }
+    }
+}
+
+// removeAllExpiredUploads removes the expired resumable uploads to every
+// knowledge base. It runs when the server starts and whenever an upload is
+// created, so uploads abandoned in quiet knowledge bases do not stay.
+func (s *Server) removeAllExpiredUploads() {
+    entries, _ := s.store.ReadDir(knowledgeBaseRoot)
+    for _, entry := range entries {
+        if entry.IsDir() {
+            s.removeExpiredUploads(entry.Name())
+        }
+    }
+}
+
+// loadUploadSession reads the resumable upload named by a request. On
+// failure the error response has already been written and ok is false.
+func (s *Server) loadUploadSession(w http.ResponseWriter, title, id string) (session *UploadSession, ok bool) {
+    session, err := s.readUploadSession(title, id)
+    if err != nil {
+        writeStoreError(w, err, "Upload not found", "Failed to read upload")
+        return nil, false
+    }
+    return session, true
+}
+
+// checkUploadQuota answers 413 and returns false if a file of size bytes
+// does not fit in the upload limits
+func (s *Server) checkUploadQuota(w http.ResponseWriter, knowledgeBase, name string, size int64) bool {
+    if size > s.maxUploadSize {
+        http.Error(w, fmt.Sprintf("File %q is larger than the limit of %d bytes", name, s.maxUploadSize), http.StatusRequestEntityTooLarge)
+        return false
+    }
+    sizes, err := s.knowledgeBaseSizes(knowledgeBase)
+    if err != nil {
+        http.Error(w, "Failed to read knowledge base directory", http.StatusInternalServerError)
+        return false
+    }
+    // The file replaces the one of the same name, if any
+    total := size - sizes[name]
+    for _, size := range sizes {
+        total += size
+    }
+    if total > s.maxKnowledgeBaseSize {
+        http.Error(w, fmt.Sprintf("Knowledge base %q would be larger than the limit of %d bytes", knowledgeBase, s.maxKnowledgeBaseSize), http.StatusRequestEntityTooLarge)
+        return false
+    }
+    return true
+}
+
+// Create Upload Handler starts a resumable upload of a file to the
+// knowledge base named after an assistant, by the user named in the
+// uploader header
+func (s *Server) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateHeader(w, r, uploaderHeader, uploaderRules) {
+        return
+    }
+
+    var createRequest CreateUploadRequest
+    if !decodeRequest(w, r, &createRequest) {
+        return
+    }
+    title := createRequest.Title
+
+    if !s.exists(path.Join("assistants", title)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    if !s.checkUploadQuota(w, title, createRequest.FileName, createRequest.Size) {
+        return
+    }
+
+    s.removeAllExpiredUploads()
+    session := &UploadSession{
+        UploadID:   s.newID(),
+        Title:      title,
+        FileName:   createRequest.FileName,
+        Size:       createRequest.Size,
+        SHA256:     createRequest.SHA256,
+        UploadedBy: r.Header.Get(uploaderHeader),
+    }
+    err := s.store.MkdirAll(uploadPartsDir(title, session.UploadID))
+    if err == nil {
+        err = s.writeUploadSession(session)
+    }
+    if err != nil {
+        http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(session)
+}
+
+// Get Upload Handler returns a resumable upload with the offset to send
+// the next chunk at
+func (s *Server) getUploadHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "title", titleRules) || !validateQuery(w, r, "uploadID", uploadIDRules) {
+        return
+    }
+    session, ok := s.loadUploadSession(w, r.URL.Query().Get("title"), r.URL.Query().Get("uploadID"))
+    if !ok {
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(session)
+}
+
+// Upload Chunk Handler appends the request body to a resumable upload. The
+// chunk must start at the offset received so far and is stored completely
+// or not at all, so a chunk cut off by a dropped connection is sent again.
+func (s *Server) uploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPatch {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "title", titleRules) || !validateQuery(w, r, "uploadID", uploadIDRules) {
+        return
+    }
+    title, id := r.URL.Query().Get("title"), r.URL.Query().Get("uploadID")
+    offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+    if err != nil || offset < 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: []FieldError{{Field: uploadOffsetHeader, Message: "must be a number of bytes"}}})
+        return
+    }
+
+    unlock := s.uploadLocks.Lock(path.Join(title, id))
+    defer unlock()
+
+    session, ok := s.loadUploadSession(w, title, id)
+    if !ok {
+        return
+    }
+    if offset != session.Offset {
+        http.Error(w, fmt.Sprintf("Upload offset is %d, not %d", session.Offset, offset), http.StatusConflict)
+        return
+    }
+
+    // Receive the chunk next to the parts and only add it once complete
+    remaining := session.Size - session.Offset
+    incoming := path.Join(uploadSessionDir(title, id), "incoming")
+    dst, err := s.store.Create(incoming)
+    if err != nil {
+        http.Error(w, "Failed to save chunk", http.StatusInternalServerError)
+        return
+    }
+    n, err := io.Copy(dst, io.LimitReader(r.Body, remaining+1))
+    if closeErr := dst.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        s.store.Remove(incoming)
+        http.Error(w, "Failed to save chunk", http.StatusInternalServerError)
+        return
+    }
+    if n > remaining {
+        s.store.Remove(incoming)
+        http.Error(w, fmt.Sprintf("Chunk goes beyond the upload size of %d bytes", session.Size), http.StatusRequestEntityTooLarge)
+        return
+    }
+    if n > 0 {
+        err = s.store.Rename(incoming, uploadPartPath(title, id, offset))
+    } else {
+        err = s.store.Remove(incoming)
+    }
+    if err == nil {
+        session.Offset += n
+        err = s.writeUploadSession(session)
+    }
+    if err != nil {
+        http.Error(w, "Failed to save chunk", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(session)
+}
+
+// Finalize Upload Handler joins the chunks of a complete resumable upload,
+// verifies its checksum and type and stores the file like /upload. An
+// upload whose checksum or type is refused is discarded.
+func (s *Server) finalizeUploadHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var finalizeRequest UploadSessionRequest
+    if !decodeRequest(w, r, &finalizeRequest) {
+        return
+    }
+    title, id := finalizeRequest.Title, finalizeRequest.UploadID
+
+    unlock := s.uploadLocks.Lock(path.Join(title, id))
+    defer unlock()
+
+    session, ok := s.loadUploadSession(w, title, id)
+    if !ok {
+        return
+    }
+    if session.Offset < session.Size {
+        http.Error(w, fmt.Sprintf("Upload is incomplete: %d of %d bytes received", session.Offset, session.Size), http.StatusConflict)
+        return
+    }
+    if !s.exists(path.Join("assistants", title)) {
+        http.Error(w, "Assistant not found", http.StatusNotFound)
+        return
+    }
+    // The knowledge base may have grown since the upload was created
+    if !s.checkUploadQuota(w, title, session.FileName, session.Size) {
+        return
+    }
+
+    u := upload{name: session.FileName, tmp: path.Join(uploadsDir(title), s.newID()), size: session.Size, originalName: session.FileName, uploadedBy: session.UploadedBy}
+    sum, err := s.joinUploadParts(session, u.tmp)
+    if err != nil {
+        s.store.Remove(u.tmp)
+        http.Error(w, "Failed to save file", http.StatusInternalServerError)
+        return
+    }
+    u.sha256 = sum
+    if sum != session.SHA256 {
+        s.store.Remove(u.tmp)
+        s.store.RemoveAll(uploadSessionDir(title, id))
+        http.Error(w, fmt.Sprintf("Checksum mismatch: the file has SHA-256 %s, not %s; the upload was discarded", sum, session.SHA256), http.StatusUnprocessableEntity)
+        return
+    }
+
+    settings, err := s.knowledgeBaseSettings(title)
+    if err == nil {
+        u.contentType, err = s.sniffFile(u.tmp, u.name)
+    }
+    if err != nil {
+        s.store.Remove(u.tmp)
+        http.Error(w, "Failed to save file", http.StatusInternalServerError)
+        return
+    }
+    if reason := checkFileType(title, u.name, u.contentType, settings.FileTypes); reason != "" {
+        s.store.Remove(u.tmp)
+        s.store.RemoveAll(uploadSessionDir(title, id))
+        http.Error(w, reason, http.StatusUnsupportedMediaType)
+        return
+    }
+
+    err = s.updateAttachments(title, attaching(title))
+    if err != nil {
+        s.store.Remove(u.tmp)
+        http.Error(w, "Failed to update attached knowledge bases", http.StatusInternalServerError)
+        return
+    }
+    results, ok := s.storeUploads(w, title, []upload{u})
+    if !ok {
+        return
+    }
+    s.store.RemoveAll(uploadSessionDir(title, id))
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(UploadResponse{Message: "File uploaded successfully", Files: results})
+}
+
+// joinUploadParts writes the parts of an upload to name in order and
+// returns the hex SHA-256 of the content
+func (s *Server) joinUploadParts(session *UploadSession, name string) (string, error) {
+    parts, err := s.store.ReadDir(uploadPartsDir(session.Title, session.UploadID))
+    if err != nil {
+        return "", err
+    }
+    dst, err := s.store.Create(name)
+    if err != nil {
+        return "", err
+    }
+    hash := sha256.New()
+    out := io.MultiWriter(dst, hash)
+    for _, part := range parts {
+        err = s.copyFile(out, path.Join(uploadPartsDir(session.Title, session.UploadID), part.Name()))
+        if err != nil {
+            break
+        }
+    }
+    if closeErr := dst.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyFile copies a file of the store to w
+func (s *Server) copyFile(w io.Writer, name string) error {
+    f, err := s.store.Open(name)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    _, err = io.Copy(w, f)
+    return err
+}
+
+// Cancel Upload Handler discards a resumable upload
+func (s *Server) cancelUploadHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var cancelRequest UploadSessionRequest
+    if !decodeRequest(w, r, &cancelRequest) {
+        return
+    }
+    title, id := cancelRequest.Title, cancelRequest.UploadID
+
+    unlock := s.uploadLocks.Lock(path.Join(title, id))
+    defer unlock()
+
+    if _, ok := s.loadUploadSession(w, title, id); !ok {
+        return
+    }
+    if err := s.store.RemoveAll(uploadSessionDir(title, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, "Failed to cancel upload", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Upload cancelled"})
+}
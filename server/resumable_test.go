@@ -0,0 +1,200 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "path"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// createUpload starts a resumable upload of content to the knowledge base
+// of the Reviewer assistant
+func createUpload(t *testing.T, s *Server, fileName, content string) UploadSession {
+    t.Helper()
+    sum := sha256.Sum256([]byte(content))
+    body := fmt.Sprintf(`{"title":"Reviewer","fileName":%q,"size":%d,"sha256":%q}`, fileName, len(content), hex.EncodeToString(sum[:]))
+    rec := serve(s, http.MethodPost, "/create-upload", body)
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("create upload: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var session UploadSession
+    decodeBody(t, rec, &session)
+    return session
+}
+
+// sendChunk sends a chunk of a resumable upload starting at offset
+func sendChunk(s *Server, id string, offset int64, chunk string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPatch, "/upload-chunk?title=Reviewer&uploadID="+id, strings.NewReader(chunk))
+    req.Header.Set("Content-Type", "application/offset+octet-stream")
+    req.Header.Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    return rec
+}
+
+func finalizeUpload(s *Server, id string) *httptest.ResponseRecorder {
+    return serve(s, http.MethodPost, "/finalize-upload", fmt.Sprintf(`{"title":"Reviewer","uploadID":%q}`, id))
+}
+
+func TestResumableUpload(t *testing.T) {
+    s := newFixtureServer(t)
+    session := createUpload(t, s, "report.txt", "hello world")
+    if session.Offset != 0 || session.Size != 11 || !session.ExpiresAt.After(s.now()) {
+        t.Fatalf("created session = %+v", session)
+    }
+
+    if rec := sendChunk(s, session.UploadID, 0, "hello "); rec.Code != http.StatusOK {
+        t.Fatalf("first chunk: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    // A chunk sent again after a dropped connection is refused with the
+    // offset to resume at
+    rec := sendChunk(s, session.UploadID, 0, "hello ")
+    if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "Upload offset is 6") {
+        t.Errorf("repeated chunk: got %d %q", rec.Code, rec.Body.String())
+    }
+    rec = serve(s, http.MethodGet, "/get-upload?title=Reviewer&uploadID="+session.UploadID, "")
+    decodeBody(t, rec, &session)
+    if session.Offset != 6 {
+        t.Errorf("offset = %d, want 6", session.Offset)
+    }
+    if rec := finalizeUpload(s, session.UploadID); rec.Code != http.StatusConflict {
+        t.Errorf("finalize incomplete upload: status = %d, want %d", rec.Code, http.StatusConflict)
+    }
+
+    if rec := sendChunk(s, session.UploadID, 6, "world"); rec.Code != http.StatusOK {
+        t.Fatalf("second chunk: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    rec = finalizeUpload(s, session.UploadID)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("finalize: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var resp UploadResponse
+    decodeBody(t, rec, &resp)
+    if len(resp.Files) != 1 || resp.Files[0] != (UploadResult{FileName: "report.txt", Size: 11, ContentType: "text/plain", Status: ingestionPending}) {
+        t.Errorf("files = %+v", resp.Files)
+    }
+    wantFile(t, s, "knowledgebases/Reviewer/report.txt", "hello world")
+    wantNoUploads(t, s, "Reviewer")
+    s.Wait()
+    if text, _ := s.extractedText("Reviewer", "report.txt"); text != "hello world" {
+        t.Errorf("extracted text = %q", text)
+    }
+}
+
+func TestResumableUploadChecksumMismatch(t *testing.T) {
+    s := newFixtureServer(t)
+    session := createUpload(t, s, "report.txt", "hello")
+    sendChunk(s, session.UploadID, 0, "jello")
+
+    rec := finalizeUpload(s, session.UploadID)
+    if rec.Code != http.StatusUnprocessableEntity {
+        t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+    }
+    wantMissing(t, s, "knowledgebases/Reviewer/report.txt")
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestResumableUploadExpires(t *testing.T) {
+    now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    s := newFixtureServer(t, func(o *Options) { o.Clock = func() time.Time { return now } })
+    session := createUpload(t, s, "report.txt", "hello")
+
+    // Every chunk keeps the upload for another day
+    now = now.Add(uploadSessionTTL - time.Minute)
+    if rec := sendChunk(s, session.UploadID, 0, "he"); rec.Code != http.StatusOK {
+        t.Fatalf("chunk: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    now = now.Add(uploadSessionTTL - time.Minute)
+    if rec := sendChunk(s, session.UploadID, 2, "llo"); rec.Code != http.StatusOK {
+        t.Fatalf("chunk: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+
+    now = now.Add(uploadSessionTTL)
+    if rec := finalizeUpload(s, session.UploadID); rec.Code != http.StatusNotFound {
+        t.Errorf("finalize expired upload: status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestAbandonedUploadsAreRemoved(t *testing.T) {
+    now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    clock := func() time.Time { return now }
+    s := newFixtureServer(t, func(o *Options) { o.Clock = clock })
+    session := createUpload(t, s, "report.txt", "hello")
+    sendChunk(s, session.UploadID, 0, "he")
+    now = now.Add(uploadSessionTTL + time.Minute)
+
+    // Starting the server removes expired uploads of every knowledge base
+    NewServer(Options{Store: s.store, Clock: clock})
+    wantNoUploads(t, s, "Reviewer")
+
+    // So does creating an upload to another knowledge base
+    createUpload(t, s, "report.txt", "hello")
+    now = now.Add(uploadSessionTTL + time.Minute)
+    sum := sha256.Sum256([]byte("hi"))
+    rec := serve(s, http.MethodPost, "/create-upload", fmt.Sprintf(`{"title":"Writer","fileName":"a.txt","size":2,"sha256":%q}`, hex.EncodeToString(sum[:])))
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("create upload: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestStaleUploadFilesAreRemoved(t *testing.T) {
+    now := time.Now()
+    clock := func() time.Time { return now }
+    s := newFixtureServer(t, func(o *Options) { o.Clock = clock })
+    stray := path.Join(uploadsDir("Reviewer"), "upload.tmp")
+    s.store.MkdirAll(uploadsDir("Reviewer"))
+    if err := s.store.WriteFile(stray, []byte("partial")); err != nil {
+        t.Fatal(err)
+    }
+
+    // Files of uploads that may still be in progress stay
+    NewServer(Options{Store: s.store, Clock: clock})
+    wantFile(t, s, stray, "partial")
+
+    now = now.Add(uploadSessionTTL + time.Minute)
+    NewServer(Options{Store: s.store, Clock: clock})
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestResumableUploadRejected(t *testing.T) {
+    s := newFixtureServer(t)
+    session := createUpload(t, s, "report.txt", "hello")
+
+    rec := sendChunk(s, session.UploadID, 0, "hello world")
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("chunk beyond the size: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+    }
+    rec = serve(s, http.MethodGet, "/get-upload?title=Reviewer&uploadID="+session.UploadID, "")
+    decodeBody(t, rec, &session)
+    if session.Offset != 0 {
+        t.Errorf("offset after refused chunk = %d, want 0", session.Offset)
+    }
+
+    sum := strings.Repeat("0", 64)
+    runHandlerTests(t, []handlerTest{
+        {name: "file too large", method: http.MethodPost, target: "/create-upload", body: `{"title":"Reviewer","fileName":"a.txt","size":1073741824,"sha256":"` + sum + `"}`, status: http.StatusRequestEntityTooLarge},
+        {name: "missing assistant", method: http.MethodPost, target: "/create-upload", body: `{"title":"Nobody","fileName":"a.txt","size":1,"sha256":"` + sum + `"}`, status: http.StatusNotFound},
+        {name: "invalid checksum", method: http.MethodPost, target: "/create-upload", body: `{"title":"Reviewer","fileName":"a.txt","size":1,"sha256":"xyz"}`, status: http.StatusBadRequest},
+        {name: "negative size", method: http.MethodPost, target: "/create-upload", body: `{"title":"Reviewer","fileName":"a.txt","size":-5,"sha256":"` + sum + `"}`, status: http.StatusBadRequest},
+        {name: "missing size", method: http.MethodPost, target: "/create-upload", body: `{"title":"Reviewer","fileName":"a.txt","sha256":"` + sum + `"}`, status: http.StatusBadRequest},
+        {name: "missing offset", method: http.MethodPatch, target: "/upload-chunk?title=Reviewer&uploadID=" + session.UploadID, body: "x", status: http.StatusBadRequest},
+        {name: "unknown upload", method: http.MethodGet, target: "/get-upload?title=Reviewer&uploadID=unknown", status: http.StatusNotFound},
+    })
+
+    rec = serve(s, http.MethodPost, "/cancel-upload", `{"title":"Reviewer","uploadID":"`+session.UploadID+`"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("cancel: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    wantNoUploads(t, s, "Reviewer")
+    if rec := finalizeUpload(s, session.UploadID); rec.Code != http.StatusNotFound {
+        t.Errorf("finalize cancelled upload: status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+}
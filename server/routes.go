@@ -0,0 +1,561 @@
+package server
+
+import "net/http"
+
+// route describes a single API endpoint. The table below is used both to
+// register the handlers and to generate the OpenAPI document, so every
+// endpoint only needs to be declared once.
+type route struct {
+    Path        string
+    Method      string
+    Summary     string
+    Handler     http.HandlerFunc
+    PathParams  []param
+    QueryParams []param
+    Request     interface{} // JSON request body, nil if the endpoint takes none
+    Consumes    []string    // media types of a raw request body, instead of Request
+    Headers     []param     // request headers
+    Multipart   []param     // multipart/form-data file fields
+    Status      int
+    Response    interface{} // JSON response body, or event payload if Stream is set
+    Stream      bool        // respond with a text/event-stream
+    Produces    []string    // media types of a file download, instead of Response
+    Errors      []int       // plain text error statuses besides 400, 405 and 500
+}
+
+// param describes a path, query or form parameter of a route
+type param struct {
+    Name        string
+    Description string
+    Required    bool
+    Rules       string // validate tag applied to the value
+}
+
+// uploadSessionParams name a resumable upload
+var uploadSessionParams = []param{
+    {Name: "title", Description: "Assistant title", Required: true, Rules: titleRules},
+    {Name: "uploadID", Description: "Upload ID", Required: true, Rules: uploadIDRules},
+}
+
+// ifMatchParam is the header carrying the ETag a change is based on
+var ifMatchParam = param{Name: "If-Match", Description: "ETag of the chat history as last fetched; the request fails with 412 if it has changed since"}
+
+// uploaderParam is the header naming the user uploading files
+var uploaderParam = param{Name: uploaderHeader, Description: "User uploading the files, recorded in their metadata", Rules: uploaderRules}
+
+// exportFormatParam selects the format of exported chat histories
+var exportFormatParam = param{Name: "format", Description: "markdown, text, html or jsonl (OpenAI fine-tuning format with the role setting as system message)", Required: true, Rules: "required," + exportFormatRules}
+
+// routes lists every endpoint served by the API
+func (s *Server) routes() []route {
+    return []route{
+        {
+            Path:     "/chat",
+            Method:   http.MethodPost,
+            Summary:  "Send a chat message and receive a reply",
+            Handler:  s.chatHandler,
+            Request:  ChatRequest{},
+            Status:   http.StatusOK,
+            Response: ChatResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/chat-stream",
+            Method:   http.MethodPost,
+            Summary:  "Send a chat message and stream the reply as server-sent events",
+            Handler:  s.chatStreamHandler,
+            Request:  ChatRequest{},
+            Status:   http.StatusOK,
+            Response: ChatStreamChunk{},
+            Stream:   true,
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/createAssistant",
+            Method:   http.MethodPost,
+            Summary:  "Create an assistant",
+            Handler:  s.createAssistantHandler,
+            Request:  AssistantRequest{},
+            Status:   http.StatusCreated,
+            Response: MessageResponse{},
+        },
+        {
+            Path:        "/deleteAssistant",
+            Method:      http.MethodDelete,
+            Summary:     "Delete an assistant",
+            Handler:     s.deleteAssistantHandler,
+            QueryParams: []param{{Name: "title", Description: "Assistant title", Required: true, Rules: titleRules}},
+            Status:      http.StatusOK,
+            Response:    MessageResponse{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/updateAssistant",
+            Method:   http.MethodPut,
+            Summary:  "Update the role setting of an assistant",
+            Handler:  s.updateAssistantHandler,
+            Request:  AssistantRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/renameAssistant",
+            Method:   http.MethodPut,
+            Summary:  "Rename an assistant",
+            Handler:  s.renameAssistantHandler,
+            Request:  RenameRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/listAssistants",
+            Method:   http.MethodGet,
+            Summary:  "List assistants",
+            Handler:  s.listAssistantsHandler,
+            Status:   http.StatusOK,
+            Response: []AssistantResponse{},
+        },
+        {
+            Path:        "/getRoleSetting",
+            Method:      http.MethodGet,
+            Summary:     "Get the role setting of an assistant",
+            Handler:     s.getRoleSettingHandler,
+            QueryParams: []param{{Name: "title", Description: "Assistant title", Required: true, Rules: titleRules}},
+            Status:      http.StatusOK,
+            Response:    RoleSettingResponse{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/upload",
+            Method:      http.MethodPost,
+            Summary:     "Upload up to 20 files to the knowledge base named after an assistant, attaching it if needed",
+            Handler:     s.uploadFileHandler,
+            QueryParams: []param{{Name: "title", Description: "Assistant title", Required: true, Rules: titleRules}},
+            Headers:     []param{uploaderParam},
+            Multipart:   []param{{Name: "file", Description: "File to upload, repeated for each file", Required: true}},
+            Status:      http.StatusOK,
+            Response:    UploadResponse{},
+            Errors:      []int{http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+        },
+        {
+            Path:     "/create-upload",
+            Method:   http.MethodPost,
+            Summary:  "Start a resumable upload of a file to the knowledge base named after an assistant",
+            Handler:  s.createUploadHandler,
+            Request:  CreateUploadRequest{},
+            Headers:  []param{uploaderParam},
+            Status:   http.StatusCreated,
+            Response: UploadSession{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/get-upload",
+            Method:      http.MethodGet,
+            Summary:     "Get a resumable upload with the offset to send the next chunk at",
+            Handler:     s.getUploadHandler,
+            QueryParams: uploadSessionParams,
+            Status:      http.StatusOK,
+            Response:    UploadSession{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/upload-chunk",
+            Method:      http.MethodPatch,
+            Summary:     "Append a chunk to a resumable upload; it is stored completely or not at all",
+            Handler:     s.uploadChunkHandler,
+            QueryParams: uploadSessionParams,
+            Headers:     []param{{Name: uploadOffsetHeader, Description: "Offset of the chunk in the file, which must be the offset received so far; 409 otherwise", Required: true}},
+            Consumes:    []string{"application/offset+octet-stream"},
+            Status:      http.StatusOK,
+            Response:    UploadSession{},
+            Errors:      []int{http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge},
+        },
+        {
+            Path:     "/finalize-upload",
+            Method:   http.MethodPost,
+            Summary:  "Verify the checksum of a complete resumable upload and store the file, attaching the knowledge base if needed",
+            Handler:  s.finalizeUploadHandler,
+            Request:  UploadSessionRequest{},
+            Status:   http.StatusOK,
+            Response: UploadResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+        },
+        {
+            Path:     "/cancel-upload",
+            Method:   http.MethodPost,
+            Summary:  "Discard a resumable upload",
+            Handler:  s.cancelUploadHandler,
+            Request:  UploadSessionRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/create-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Create a knowledge base",
+            Handler:  s.createDirectoryHandler,
+            Request:  DirectoryRequest{},
+            Status:   http.StatusCreated,
+            Response: DirectoryResponse{},
+            Errors:   []int{http.StatusConflict},
+        },
+        {
+            Path:     "/list-knowledgebase",
+            Method:   http.MethodGet,
+            Summary:  "List knowledge bases",
+            Handler:  s.listDirectoriesHandler,
+            Status:   http.StatusOK,
+            Response: ListDirectoriesResponse{},
+        },
+        {
+            Path:     "/delete-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Delete a knowledge base",
+            Handler:  s.deleteDirectoryHandler,
+            Request:  DeleteDirectoryRequest{},
+            Status:   http.StatusOK,
+            Response: DeleteDirectoryResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/rename-knowledgebase",
+            Method:   http.MethodPut,
+            Summary:  "Rename a knowledge base",
+            Handler:  s.renameDirectoryHandler,
+            Request:  RenameDirectoryRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/list-files-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "List the files of a knowledge base with their metadata and ingestion status, sorted and filtered",
+            Handler:  s.listFilesHandler,
+            Request:  ListFilesRequest{},
+            Status:   http.StatusOK,
+            Response: ListFilesResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:    "/download-file-knowledgebase",
+            Method:  http.MethodGet,
+            Summary: "Download a knowledge base file, or a byte range of it",
+            Handler: s.downloadFileHandler,
+            QueryParams: []param{
+                {Name: "knowledgeBaseName", Description: "Knowledge base name", Required: true, Rules: titleRules},
+                {Name: "fileName", Description: "File name", Required: true, Rules: fileNameRules},
+                {Name: "disposition", Description: "attachment (default) to save the file, inline to display it if its type is safe to display", Rules: "oneof=attachment|inline"},
+            },
+            Headers:  []param{{Name: "Range", Description: "Byte ranges to download, such as bytes=0-1023; answered with 206"}},
+            Status:   http.StatusOK,
+            Produces: []string{"application/octet-stream"},
+            Errors:   []int{http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable},
+        },
+        {
+            Path:     "/preview-file-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Get the start of the text extracted from a knowledge base file",
+            Handler:  s.previewFileHandler,
+            Request:  FilePreviewRequest{},
+            Status:   http.StatusOK,
+            Response: FilePreviewResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/delete-file-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Delete a file of a knowledge base and what was derived from it",
+            Handler:  s.deleteFileHandler,
+            Request:  DeleteFileRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:    "/replace-file-knowledgebase",
+            Method:  http.MethodPut,
+            Summary: "Replace the content of a knowledge base file and ingest it again",
+            Handler: s.replaceFileHandler,
+            QueryParams: []param{
+                {Name: "knowledgeBaseName", Description: "Knowledge base name", Required: true, Rules: titleRules},
+                {Name: "fileName", Description: "File name", Required: true, Rules: fileNameRules},
+            },
+            Headers:   []param{uploaderParam},
+            Multipart: []param{{Name: "file", Description: "New content of the file", Required: true}},
+            Status:    http.StatusOK,
+            Response:  UploadResponse{},
+            Errors:    []int{http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+        },
+        {
+            Path:        "/get-chunking-settings",
+            Method:      http.MethodGet,
+            Summary:     "Get how the files of a knowledge base are split into chunks",
+            Handler:     s.getChunkingSettingsHandler,
+            QueryParams: []param{{Name: "knowledgeBaseName", Description: "Knowledge base name", Required: true, Rules: titleRules}},
+            Status:      http.StatusOK,
+            Response:    ChunkingSettingsResponse{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/update-chunking-settings",
+            Method:   http.MethodPut,
+            Summary:  "Change how the files of a knowledge base are split into chunks and chunk them again",
+            Handler:  s.updateChunkingSettingsHandler,
+            Request:  UpdateChunkingSettingsRequest{},
+            Status:   http.StatusOK,
+            Response: ChunkingSettingsResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/get-file-type-policy",
+            Method:      http.MethodGet,
+            Summary:     "Get the MIME types of the files a knowledge base accepts",
+            Handler:     s.getFileTypePolicyHandler,
+            QueryParams: []param{{Name: "knowledgeBaseName", Description: "Knowledge base name", Required: true, Rules: titleRules}},
+            Status:      http.StatusOK,
+            Response:    FileTypePolicyResponse{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/update-file-type-policy",
+            Method:   http.MethodPut,
+            Summary:  "Change the MIME types of the files a knowledge base accepts from now on",
+            Handler:  s.updateFileTypePolicyHandler,
+            Request:  UpdateFileTypePolicyRequest{},
+            Status:   http.StatusOK,
+            Response: FileTypePolicyResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/preview-chunks",
+            Method:   http.MethodPost,
+            Summary:  "Split the text of a knowledge base file into chunks without storing them",
+            Handler:  s.previewChunksHandler,
+            Request:  PreviewChunksRequest{},
+            Status:   http.StatusOK,
+            Response: PreviewChunksResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict},
+        },
+        {
+            Path:     "/search-knowledgebases",
+            Method:   http.MethodPost,
+            Summary:  "Search the chunks of knowledge bases by their words, their embeddings or both",
+            Handler:  s.searchKnowledgeBasesHandler,
+            Request:  SearchKnowledgeBasesRequest{},
+            Status:   http.StatusOK,
+            Response: SearchKnowledgeBasesResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/attach-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Attach a knowledge base to an assistant",
+            Handler:  s.attachKnowledgeBaseHandler,
+            Request:  AttachKnowledgeBaseRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/detach-knowledgebase",
+            Method:   http.MethodPost,
+            Summary:  "Detach a knowledge base from an assistant",
+            Handler:  s.detachKnowledgeBaseHandler,
+            Request:  AttachKnowledgeBaseRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/list-assistant-knowledgebases",
+            Method:      http.MethodGet,
+            Summary:     "List the knowledge bases attached to an assistant",
+            Handler:     s.listAssistantKnowledgeBasesHandler,
+            QueryParams: []param{{Name: "title", Description: "Assistant title", Required: true, Rules: titleRules}},
+            Status:      http.StatusOK,
+            Response:    AssistantKnowledgeBasesResponse{},
+            Errors:      []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/chat-history",
+            Method:   http.MethodGet,
+            Summary:  "List chat history files",
+            Handler:  s.chatHistoryHandler,
+            Status:   http.StatusOK,
+            Response: ChatHistoryResponse{},
+        },
+        {
+            Path:    "/list-conversations",
+            Method:  http.MethodGet,
+            Summary: "List the conversations of all or one assistant, one page at a time",
+            Handler: s.listConversationsHandler,
+            QueryParams: []param{
+                {Name: "assistant", Description: "Only list the conversations of this assistant", Rules: listAssistantRules},
+                {Name: "sort", Description: "Field to sort by, defaults to updatedAt", Rules: listSortRules},
+                {Name: "order", Description: "Sort order, defaults to desc for times and asc for titles", Rules: listOrderRules},
+                {Name: "limit", Description: "Maximum number of conversations per page, defaults to 50", Rules: listLimitRules},
+                {Name: "cursor", Description: "nextCursor of the previous page", Rules: listCursorRules},
+            },
+            Status:   http.StatusOK,
+            Response: ListConversationsResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:    "/search-histories",
+            Method:  http.MethodGet,
+            Summary: "Search the messages of all chat histories",
+            Handler: s.searchHistoriesHandler,
+            QueryParams: []param{
+                {Name: "q", Description: `Words that must all occur in a conversation. "Quoted phrases" must occur as written, words ending in * match every word they start.`, Required: true, Rules: searchQueryRules},
+                {Name: "assistant", Description: "Only search the conversations of this assistant", Rules: listAssistantRules},
+                {Name: "from", Description: "Only match messages created at or after this date (2024-01-02) or time (RFC 3339)", Rules: searchDateRules},
+                {Name: "to", Description: "Only match messages created up to this date, inclusive, or time", Rules: searchDateRules},
+                {Name: "limit", Description: "Maximum number of conversations returned, defaults to 20", Rules: searchLimitRules},
+            },
+            Status:   http.StatusOK,
+            Response: SearchHistoriesResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:    "/export-history",
+            Method:  http.MethodGet,
+            Summary: "Download a chat history as Markdown, text, HTML or fine-tuning JSONL",
+            Handler: s.exportHistoryHandler,
+            QueryParams: []param{
+                {Name: "assistant", Description: "Assistant title", Required: true, Rules: titleRules},
+                {Name: "historyID", Description: "Chat history ID", Required: true, Rules: historyIDRules},
+                exportFormatParam,
+            },
+            Status:   http.StatusOK,
+            Produces: []string{"text/markdown", "text/plain", "text/html", "application/jsonl"},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:    "/export-histories",
+            Method:  http.MethodGet,
+            Summary: "Download all chat histories of an assistant as a zip archive",
+            Handler: s.exportHistoriesHandler,
+            QueryParams: []param{
+                {Name: "assistant", Description: "Assistant title", Required: true, Rules: titleRules},
+                exportFormatParam,
+            },
+            Status:   http.StatusOK,
+            Produces: []string{"application/zip"},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:        "/import-histories",
+            Method:      http.MethodPost,
+            Summary:     "Import conversations from OpenAI messages JSON, a ChatGPT conversations.json export or JSONL",
+            Handler:     s.importHistoriesHandler,
+            QueryParams: []param{{Name: "assistant", Description: "Assistant the conversations are imported for", Required: true, Rules: titleRules}},
+            Multipart:   []param{{Name: "file", Description: "File to import", Required: true}},
+            Status:      http.StatusOK,
+            Response:    ImportHistoriesResponse{},
+            Errors:      []int{http.StatusNotFound, http.StatusRequestEntityTooLarge},
+        },
+        {
+            Path:     "/create-history",
+            Method:   http.MethodPost,
+            Summary:  "Create a chat history",
+            Handler:  s.createHistoryHandler,
+            Request:  CreateHistoryRequest{},
+            Status:   http.StatusCreated,
+            Response: CreateHistoryResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/delete-history",
+            Method:   http.MethodDelete,
+            Summary:  "Delete a chat history",
+            Handler:  s.deleteHistoryHandler,
+            Request:  DeleteHistoryRequest{},
+            Status:   http.StatusOK,
+            Response: DeleteHistoryResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:       "/update-chat-context/{historyID}",
+            Method:     http.MethodPut,
+            Summary:    "Replace the content of a chat history",
+            Handler:    s.updateChatContextHandler,
+            PathParams: []param{{Name: "historyID", Description: "Chat history ID", Required: true, Rules: historyIDRules}},
+            Headers:    []param{ifMatchParam},
+            Request:    UpdateChatContextRequest{},
+            Status:     http.StatusOK,
+            Response:   UpdateChatContextResponse{},
+            Errors:     []int{http.StatusNotFound, http.StatusPreconditionFailed},
+        },
+        {
+            Path:     "/rename-history",
+            Method:   http.MethodPut,
+            Summary:  "Set the title of a chat history",
+            Handler:  s.renameHistoryHandler,
+            Headers:  []param{ifMatchParam},
+            Request:  RenameHistoryRequest{},
+            Status:   http.StatusOK,
+            Response: MessageResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusPreconditionFailed},
+        },
+        {
+            Path:     "/append-messages",
+            Method:   http.MethodPost,
+            Summary:  "Append messages to a chat history",
+            Handler:  s.appendMessagesHandler,
+            Headers:  []param{ifMatchParam},
+            Request:  AppendMessagesRequest{},
+            Status:   http.StatusOK,
+            Response: AppendMessagesResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+        },
+        {
+            Path:     "/fork-history",
+            Method:   http.MethodPost,
+            Summary:  "Copy a chat history up to a message into a new history",
+            Handler:  s.forkHistoryHandler,
+            Request:  ForkHistoryRequest{},
+            Status:   http.StatusCreated,
+            Response: ForkHistoryResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+        {
+            Path:     "/switch-branch",
+            Method:   http.MethodPut,
+            Summary:  "Make the branch holding a message the active branch of a chat history",
+            Handler:  s.switchBranchHandler,
+            Headers:  []param{ifMatchParam},
+            Request:  SwitchBranchRequest{},
+            Status:   http.StatusOK,
+            Response: SwitchBranchResponse{},
+            Errors:   []int{http.StatusNotFound, http.StatusPreconditionFailed},
+        },
+        {
+            Path:     "/fetch-history",
+            Method:   http.MethodPost,
+            Summary:  "Fetch the content of a chat history",
+            Handler:  s.fetchHistoryHandler,
+            Request:  FetchHistoryRequest{},
+            Status:   http.StatusOK,
+            Response: FetchHistoryResponse{},
+            Errors:   []int{http.StatusNotFound},
+        },
+    }
+}
+
+// muxPattern returns the pattern the route is registered under. Path
+// parameters are matched by prefix, the handlers extract them themselves.
+func (rt route) muxPattern() string {
+    if len(rt.PathParams) == 0 {
+        return rt.Path
+    }
+    for i := 0; i < len(rt.Path); i++ {
+        if rt.Path[i] == '{' {
+            return rt.Path[:i]
+        }
+    }
+    return rt.Path
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// targetFor returns a request target for rt with its parameters filled in
+func targetFor(rt route) string {
+    target := rt.Path
+    for _, p := range rt.PathParams {
+        target = strings.Replace(target, "{"+p.Name+"}", "a16ba0d9-1e57-4db1-aa42-eec315130c8e", 1)
+    }
+    if len(rt.QueryParams) > 0 {
+        target += "?" + rt.QueryParams[0].Name + "=Reviewer"
+    }
+    return target
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+    s := newFixtureServer(t)
+    methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+    for _, rt := range s.routes() {
+        for _, method := range methods {
+            if method == rt.Method {
+                continue
+            }
+            rec := serve(s, method, targetFor(rt), "")
+            if rec.Code != http.StatusMethodNotAllowed {
+                t.Errorf("%s %s: status = %d, want %d", method, rt.Path, rec.Code, http.StatusMethodNotAllowed)
+            }
+        }
+    }
+}
+
+func TestMalformedJSON(t *testing.T) {
+    s := newFixtureServer(t)
+    for _, rt := range s.routes() {
+        if rt.Request == nil {
+            continue
+        }
+        for _, body := range []string{`{"`, `not json`, `[]`, `{} {}`} {
+            rec := serve(s, rt.Method, targetFor(rt), body)
+            if rec.Code != http.StatusBadRequest {
+                t.Errorf("%s %s with %q: status = %d, want %d", rt.Method, rt.Path, body, rec.Code, http.StatusBadRequest)
+                continue
+            }
+            var resp ErrorResponse
+            if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == "" {
+                t.Errorf("%s %s with %q: error response %q is not an ErrorResponse", rt.Method, rt.Path, body, rec.Body.String())
+            }
+        }
+    }
+}
+
+func TestMissingFields(t *testing.T) {
+    s := newFixtureServer(t)
+    for _, rt := range s.routes() {
+        if rt.Request == nil {
+            continue
+        }
+
+        var want []string
+        typ := reflect.TypeOf(rt.Request)
+        for _, field := range jsonFields(typ) {
+            if strings.Contains(field.Tag.Get("validate"), "required") {
+                want = append(want, field.Name)
+            }
+        }
+        if len(want) == 0 {
+            continue
+        }
+
+        rec := serve(s, rt.Method, targetFor(rt), `{}`)
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("%s %s: status = %d, want %d", rt.Method, rt.Path, rec.Code, http.StatusBadRequest)
+            continue
+        }
+        var resp ErrorResponse
+        decodeBody(t, rec, &resp)
+        var got []string
+        for _, f := range resp.Fields {
+            if f.Message == "is required" {
+                got = append(got, f.Field)
+            }
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("%s %s: missing fields reported = %v, want %v", rt.Method, rt.Path, got, want)
+        }
+    }
+}
+
+func TestCORS(t *testing.T) {
+    s := newFixtureServer(t)
+    for _, rt := range s.routes() {
+        rec := serve(s, http.MethodOptions, targetFor(rt), "")
+        if rec.Code != http.StatusNoContent {
+            t.Errorf("OPTIONS %s: status = %d, want %d", rt.Path, rec.Code, http.StatusNoContent)
+        }
+        if rec.Body.Len() != 0 {
+            t.Errorf("OPTIONS %s: unexpected body %q", rt.Path, rec.Body.String())
+        }
+        if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+            t.Errorf("OPTIONS %s: Access-Control-Allow-Origin = %q", rt.Path, got)
+        }
+        if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, rt.Method) {
+            t.Errorf("OPTIONS %s: Access-Control-Allow-Methods = %q does not allow %s", rt.Path, got, rt.Method)
+        }
+    }
+
+    rec := serve(s, http.MethodGet, "/listAssistants", "")
+    if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+        t.Errorf("GET /listAssistants: Access-Control-Allow-Origin = %q", got)
+    }
+}
+
+func TestUnknownRoute(t *testing.T) {
+    rec := serve(newFixtureServer(t), http.MethodGet, "/does-not-exist", "")
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+    }
+}
@@ -0,0 +1,454 @@
+package server
+
+import (
+    "cmp"
+    "encoding/json"
+    "html"
+    "io/fs"
+    "net/http"
+    "path"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Search parameters
+const (
+    defaultSearchLimit   = 20
+    searchQueryRules     = "required,max=500"
+    searchLimitRules     = "range=1|100"
+    searchDateRules      = "max=40"
+    maxSnippetsPerResult = 3
+    snippetContext       = 60  // characters shown before the first match
+    snippetLength        = 200 // characters of a snippet
+)
+
+// SearchHistoriesResponse represents the structure of the response for searching chat histories
+type SearchHistoriesResponse struct {
+    Results []SearchResult `json:"results"`
+}
+
+// SearchResult is a conversation matching a search
+type SearchResult struct {
+    HistoryID string        `json:"historyID"`
+    Assistant string        `json:"assistant"`
+    Title     string        `json:"title"`
+    UpdatedAt time.Time     `json:"updatedAt"`
+    Matches   []SearchMatch `json:"matches"`
+}
+
+// SearchMatch is a message matching a search. The snippet is HTML escaped
+// and the matching words are wrapped in <mark> elements.
+type SearchMatch struct {
+    MessageID string    `json:"messageID"`
+    Role      string    `json:"role"`
+    CreatedAt time.Time `json:"createdAt"`
+    Snippet   string    `json:"snippet"`
+}
+
+// token is a word of a message, lower cased, with its byte offsets
+type token struct {
+    term       string
+    start, end int
+}
+
+// tokenize splits text into words of letters and digits
+func tokenize(text string) []token {
+    var tokens []token
+    start := -1
+    for i, r := range text {
+        word := unicode.IsLetter(r) || unicode.IsDigit(r)
+        switch {
+        case word && start < 0:
+            start = i
+        case !word && start >= 0:
+            tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+            start = -1
+        }
+    }
+    if start >= 0 {
+        tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+    }
+    return tokens
+}
+
+// searchClause is a word or phrase of a search query. If prefix is set the
+// last word only needs to start with the given term.
+type searchClause struct {
+    terms  []string
+    prefix bool
+}
+
+// parseSearchQuery splits a query into clauses: "quoted phrases", prefix
+// queries such as invoi* and single words. Words joined by punctuation,
+// such as e-mail, are matched as a phrase.
+func parseSearchQuery(q string) []searchClause {
+    var clauses []searchClause
+    add := func(text string, prefix bool) {
+        var terms []string
+        for _, t := range tokenize(text) {
+            terms = append(terms, t.term)
+        }
+        if len(terms) > 0 {
+            clauses = append(clauses, searchClause{terms: terms, prefix: prefix})
+        }
+    }
+
+    for q != "" {
+        q = strings.TrimLeftFunc(q, unicode.IsSpace)
+        if rest, ok := strings.CutPrefix(q, `"`); ok {
+            phrase, after, _ := strings.Cut(rest, `"`)
+            add(phrase, false)
+            q = after
+            continue
+        }
+        word, after, _ := strings.Cut(q, " ")
+        add(word, strings.HasSuffix(word, "*"))
+        q = after
+    }
+    return clauses
+}
+
+// span is a byte range of a text, such as a match in a message
+type span struct {
+    start, end int
+}
+
+// match returns where the clause occurs in the tokens of a message
+func (c searchClause) match(tokens []token) []span {
+    var spans []span
+    n := len(c.terms)
+    for i := 0; i+n <= len(tokens); i++ {
+        ok := true
+        for j, term := range c.terms {
+            t := tokens[i+j].term
+            if c.prefix && j == n-1 {
+                ok = strings.HasPrefix(t, term)
+            } else {
+                ok = t == term
+            }
+            if !ok {
+                break
+            }
+        }
+        if ok {
+            spans = append(spans, span{start: tokens[i].start, end: tokens[i+n-1].end})
+        }
+    }
+    return spans
+}
+
+// indexedConversation is a conversation as kept in the search index
+type indexedConversation struct {
+    size     int64
+    modTime  time.Time
+    summary  ConversationSummary
+    messages []indexedMessage
+}
+
+type indexedMessage struct {
+    Message
+    tokens []token
+}
+
+// searchIndex is an inverted index of the words of all chat histories. It
+// is brought up to date before every search: only history files whose size
+// or modification time changed are read again.
+type searchIndex struct {
+    mu            sync.Mutex
+    conversations map[string]*indexedConversation // by history path
+    postings      map[string]map[string]bool      // history paths by word
+}
+
+// refreshSearchIndex indexes new and changed history files and drops
+// deleted ones. The caller holds s.search.mu.
+func (s *Server) refreshSearchIndex(files []historyFile, dirs []string) {
+    idx := &s.search
+    if idx.conversations == nil {
+        idx.conversations = map[string]*indexedConversation{}
+        idx.postings = map[string]map[string]bool{}
+    }
+
+    seen := map[string]bool{}
+    for _, file := range files {
+        name := historyPath(file.Assistant, file.ID)
+        seen[name] = true
+        if old, ok := idx.conversations[name]; ok && old.size == file.Info.Size() && old.modTime.Equal(file.Info.ModTime()) {
+            continue
+        }
+        idx.remove(name)
+        c, err := s.loadConversation(file.Assistant, file.ID)
+        if err != nil {
+            continue // unreadable files are not searchable
+        }
+        idx.add(name, c, file.Info)
+    }
+    for name := range idx.conversations {
+        if slices.Contains(dirs, path.Dir(name)) && !seen[name] {
+            idx.remove(name)
+        }
+    }
+}
+
+func (idx *searchIndex) add(name string, c *Conversation, info fs.FileInfo) {
+    doc := &indexedConversation{size: info.Size(), modTime: info.ModTime(), summary: summarizeConversation(c)}
+    for _, m := range c.Messages {
+        tokens := tokenize(m.Content)
+        doc.messages = append(doc.messages, indexedMessage{Message: m, tokens: tokens})
+        for _, t := range tokens {
+            if idx.postings[t.term] == nil {
+                idx.postings[t.term] = map[string]bool{}
+            }
+            idx.postings[t.term][name] = true
+        }
+    }
+    idx.conversations[name] = doc
+}
+
+func (idx *searchIndex) remove(name string) {
+    doc, ok := idx.conversations[name]
+    if !ok {
+        return
+    }
+    for _, m := range doc.messages {
+        for _, t := range m.tokens {
+            delete(idx.postings[t.term], name)
+            if len(idx.postings[t.term]) == 0 {
+                delete(idx.postings, t.term)
+            }
+        }
+    }
+    delete(idx.conversations, name)
+}
+
+// candidates returns the histories containing the first word of a clause
+func (idx *searchIndex) candidates(c searchClause) map[string]bool {
+    if !c.prefix || len(c.terms) > 1 {
+        return idx.postings[c.terms[0]]
+    }
+    found := map[string]bool{}
+    for term, names := range idx.postings {
+        if strings.HasPrefix(term, c.terms[0]) {
+            for name := range names {
+                found[name] = true
+            }
+        }
+    }
+    return found
+}
+
+// searchHistories returns the conversations in which every clause occurs
+// in a message created between from and to (if not zero), the conversations
+// with the most matches first
+func (s *Server) searchHistories(clauses []searchClause, assistants []string, from, to time.Time, limit int) ([]SearchResult, error) {
+    files, dirs, err := s.historyFiles()
+    if err != nil {
+        return nil, err
+    }
+
+    s.search.mu.Lock()
+    defer s.search.mu.Unlock()
+    s.refreshSearchIndex(files, dirs)
+
+    var names []string
+    for i, clause := range clauses {
+        found := s.search.candidates(clause)
+        if i == 0 {
+            for name := range found {
+                names = append(names, name)
+            }
+        } else {
+            names = slices.DeleteFunc(names, func(name string) bool { return !found[name] })
+        }
+    }
+
+    type scored struct {
+        result SearchResult
+        hits   int
+    }
+    var matches []scored
+    for _, name := range names {
+        doc := s.search.conversations[name]
+        if len(assistants) > 0 && !slices.Contains(assistants, doc.summary.Assistant) {
+            continue
+        }
+
+        matched := make([]bool, len(clauses))
+        result := SearchResult{
+            HistoryID: doc.summary.ID,
+            Assistant: doc.summary.Assistant,
+            Title:     doc.summary.Title,
+            UpdatedAt: doc.summary.UpdatedAt,
+        }
+        hits := 0
+        for _, m := range doc.messages {
+            if !from.IsZero() && m.CreatedAt.Before(from) || !to.IsZero() && m.CreatedAt.After(to) {
+                continue
+            }
+            var spans []span
+            for i, clause := range clauses {
+                found := clause.match(m.tokens)
+                matched[i] = matched[i] || len(found) > 0
+                spans = append(spans, found...)
+            }
+            if len(spans) == 0 {
+                continue
+            }
+            hits += len(spans)
+            if len(result.Matches) < maxSnippetsPerResult {
+                result.Matches = append(result.Matches, SearchMatch{
+                    MessageID: m.ID,
+                    Role:      m.Role,
+                    CreatedAt: m.CreatedAt,
+                    Snippet:   snippet(m.Content, spans),
+                })
+            }
+        }
+        if !slices.Contains(matched, false) {
+            matches = append(matches, scored{result: result, hits: hits})
+        }
+    }
+
+    slices.SortFunc(matches, func(a, b scored) int {
+        return cmp.Or(
+            cmp.Compare(b.hits, a.hits),
+            b.result.UpdatedAt.Compare(a.result.UpdatedAt),
+            cmp.Compare(a.result.Assistant, b.result.Assistant),
+            cmp.Compare(a.result.HistoryID, b.result.HistoryID),
+        )
+    })
+    results := []SearchResult{}
+    for _, m := range matches[:min(limit, len(matches))] {
+        results = append(results, m.result)
+    }
+    return results, nil
+}
+
+// snippet returns the part of content around the first match, or its
+// beginning if there are none, HTML escaped, with all matches in it
+// wrapped in <mark> elements
+func snippet(content string, spans []span) string {
+    slices.SortFunc(spans, func(a, b span) int { return cmp.Compare(a.start, b.start) })
+
+    // Start a few words before the first match, at a word boundary
+    first := 0
+    if len(spans) > 0 {
+        first = spans[0].start
+    }
+    start := first
+    for n := 0; start > 0 && n < snippetContext; n++ {
+        _, size := utf8.DecodeLastRuneInString(content[:start])
+        start -= size
+    }
+    if start > 0 {
+        if i := strings.IndexFunc(content[start:first], unicode.IsSpace); i >= 0 {
+            start += i + 1
+        }
+    }
+    end := start
+    for n := 0; end < len(content) && n < snippetLength; n++ {
+        _, size := utf8.DecodeRuneInString(content[end:])
+        end += size
+    }
+
+    var b strings.Builder
+    if start > 0 {
+        b.WriteString("…")
+    }
+    pos := start
+    for _, sp := range spans {
+        if sp.start < pos || sp.end > end {
+            continue // overlapping or cut off
+        }
+        b.WriteString(html.EscapeString(content[pos:sp.start]))
+        b.WriteString("<mark>" + html.EscapeString(content[sp.start:sp.end]) + "</mark>")
+        pos = sp.end
+    }
+    b.WriteString(html.EscapeString(content[pos:end]))
+    if end < len(content) {
+        b.WriteString("…")
+    }
+    return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// parseSearchDate parses a date such as 2024-01-02 or a RFC 3339 time. Dates
+// mean the start of the day, or its end if endOfDay is set.
+func parseSearchDate(value string, endOfDay bool) (time.Time, bool) {
+    if value == "" {
+        return time.Time{}, true
+    }
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, true
+    }
+    t, err := time.Parse(time.DateOnly, value)
+    if err != nil {
+        return time.Time{}, false
+    }
+    if endOfDay {
+        t = t.Add(24*time.Hour - time.Nanosecond)
+    }
+    return t, true
+}
+
+// Search Histories Handler
+func (s *Server) searchHistoriesHandler(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+
+    if r.Method != http.MethodGet {
+        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !validateQuery(w, r, "q", searchQueryRules) ||
+        !validateQuery(w, r, "assistant", listAssistantRules) ||
+        !validateQuery(w, r, "from", searchDateRules) ||
+        !validateQuery(w, r, "to", searchDateRules) ||
+        !validateQuery(w, r, "limit", searchLimitRules) {
+        return
+    }
+
+    query := r.URL.Query()
+    var errs []FieldError
+    clauses := parseSearchQuery(query.Get("q"))
+    if len(clauses) == 0 {
+        errs = append(errs, FieldError{Field: "q", Message: "must contain at least one word"})
+    }
+    from, ok := parseSearchDate(query.Get("from"), false)
+    if !ok {
+        errs = append(errs, FieldError{Field: "from", Message: "must be a date such as 2024-01-02 or a RFC 3339 time"})
+    }
+    to, ok := parseSearchDate(query.Get("to"), true)
+    if !ok {
+        errs = append(errs, FieldError{Field: "to", Message: "must be a date such as 2024-01-02 or a RFC 3339 time"})
+    }
+    if len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return
+    }
+    limit := defaultSearchLimit
+    if l := query.Get("limit"); l != "" {
+        limit, _ = strconv.Atoi(l)
+    }
+
+    var assistants []string
+    if assistant := query.Get("assistant"); assistant != "" {
+        if assistant != defaultAssistant && !s.exists(path.Join("assistants", assistant)) {
+            http.Error(w, "Assistant not found", http.StatusNotFound)
+            return
+        }
+        assistants = append(assistants, assistant)
+    }
+
+    results, err := s.searchHistories(clauses, assistants, from, to, limit)
+    if err != nil {
+        http.Error(w, "Failed to search histories", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(SearchHistoriesResponse{Results: results})
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+    "net/http"
+    "net/url"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+    "unicode/utf8"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+    tests := []struct {
+        query string
+        want  []searchClause
+    }{
+        {"Invoices", []searchClause{{terms: []string{"invoices"}}}},
+        {"invoi* march", []searchClause{{terms: []string{"invoi"}, prefix: true}, {terms: []string{"march"}}}},
+        {`"overdue  Invoice" paid`, []searchClause{{terms: []string{"overdue", "invoice"}}, {terms: []string{"paid"}}}},
+        {"e-mail", []searchClause{{terms: []string{"e", "mail"}}}},
+        {`"unterminated phrase`, []searchClause{{terms: []string{"unterminated", "phrase"}}}},
+        {`*** ""`, nil},
+    }
+    for _, tt := range tests {
+        if got := parseSearchQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+        }
+    }
+}
+
+func TestSnippet(t *testing.T) {
+    content := "Please pay the <b>overdue</b> invoice by Friday."
+    spans := searchClause{terms: []string{"invoice"}}.match(tokenize(content))
+    want := "Please pay the &lt;b&gt;overdue&lt;/b&gt; <mark>invoice</mark> by Friday."
+    if got := snippet(content, spans); got != want {
+        t.Errorf("snippet = %q, want %q", got, want)
+    }
+
+    long := "lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore " +
+        "magna aliqua invoice ut enim ad minim veniam quis nostrud exercitation ullamco laboris nisi ut aliquip " +
+        "ex ea commodo consequat duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu"
+    spans = searchClause{terms: []string{"invoice"}}.match(tokenize(long))
+    got := snippet(long, spans)
+    if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+        t.Errorf("shortened snippet %q is not marked as such", got)
+    }
+    if !strings.Contains(got, "<mark>invoice</mark>") {
+        t.Errorf("snippet %q does not highlight the match", got)
+    }
+    if n := utf8.RuneCountInString(strings.NewReplacer("<mark>", "", "</mark>", "", "…", "").Replace(got)); n > snippetLength {
+        t.Errorf("snippet has %d characters", n)
+    }
+}
+
+// saveSearchFixtures stores conversations to search in
+func saveSearchFixtures(t *testing.T, s *Server) {
+    t.Helper()
+    day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+    conversations := []struct {
+        id, assistant string
+        messages      []Message
+    }{
+        {"billing", "Reviewer", []Message{
+            {ID: "b1", Role: RoleUser, Content: "Can you check the overdue invoice from March?", CreatedAt: day(1)},
+            {ID: "b2", Role: RoleAssistant, Content: "The invoice was paid on April 2nd.", CreatedAt: day(1)},
+        }},
+        {"invoicing", defaultAssistant, []Message{
+            {ID: "i1", Role: RoleUser, Content: "How does invoicing work?", CreatedAt: day(10)},
+        }},
+        {"holiday", "Writer", []Message{
+            {ID: "h1", Role: RoleUser, Content: "Write a poem about the sea.", CreatedAt: day(20)},
+        }},
+    }
+    for _, spec := range conversations {
+        c := s.newConversation(spec.id, spec.assistant)
+        c.Messages = spec.messages
+        if err := s.store.MkdirAll(historyDir(spec.assistant)); err != nil {
+            t.Fatal(err)
+        }
+        if err := s.saveConversation(c); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func search(t *testing.T, s *Server, query string) SearchHistoriesResponse {
+    t.Helper()
+    rec := serve(s, http.MethodGet, "/search-histories?"+query, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("search %s: status = %d; body: %s", query, rec.Code, rec.Body.String())
+    }
+    var resp SearchHistoriesResponse
+    decodeBody(t, rec, &resp)
+    return resp
+}
+
+func resultIDs(resp SearchHistoriesResponse) []string {
+    ids := []string{}
+    for _, r := range resp.Results {
+        ids = append(ids, r.HistoryID)
+    }
+    return ids
+}
+
+func TestSearchHistories(t *testing.T) {
+    tests := []struct {
+        name  string
+        query url.Values
+        want  []string
+    }{
+        {"word", url.Values{"q": {"Invoice"}}, []string{"billing"}},
+        {"prefix", url.Values{"q": {"invoic*"}}, []string{"billing", "invoicing"}},
+        {"phrase", url.Values{"q": {`"overdue invoice"`}}, []string{"billing"}},
+        {"phrase in wrong order", url.Values{"q": {`"invoice overdue"`}}, []string{}},
+        {"all words must occur", url.Values{"q": {"invoice poem"}}, []string{}},
+        {"words in different messages", url.Values{"q": {"march paid"}}, []string{"billing"}},
+        {"assistant", url.Values{"q": {"invoic*"}, "assistant": {"Lets Chat"}}, []string{"invoicing"}},
+        {"from date", url.Values{"q": {"invoic*"}, "from": {"2024-05-02"}}, []string{"invoicing"}},
+        {"to date is inclusive", url.Values{"q": {"invoic*"}, "to": {"2024-05-01"}}, []string{"billing"}},
+        {"time range", url.Values{"q": {"invoic*"}, "from": {"2024-05-10T00:00:00Z"}, "to": {"2024-05-10T12:59:00+01:00"}}, []string{}},
+        {"limit", url.Values{"q": {"invoic*"}, "limit": {"1"}}, []string{"billing"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newTestServer(t)
+            saveSearchFixtures(t, s)
+            if got := resultIDs(search(t, s, tt.query.Encode())); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("results = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestSearchHistoriesResult(t *testing.T) {
+    s := newTestServer(t)
+    saveSearchFixtures(t, s)
+
+    resp := search(t, s, "q=invoice")
+    want := []SearchResult{{
+        HistoryID: "billing",
+        Assistant: "Reviewer",
+        UpdatedAt: s.now().UTC(),
+        Matches: []SearchMatch{
+            {MessageID: "b1", Role: RoleUser, CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Snippet: "Can you check the overdue <mark>invoice</mark> from March?"},
+            {MessageID: "b2", Role: RoleAssistant, CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Snippet: "The <mark>invoice</mark> was paid on April 2nd."},
+        },
+    }}
+    if !reflect.DeepEqual(resp.Results, want) {
+        t.Errorf("results = %+v, want %+v", resp.Results, want)
+    }
+}
+
+func TestSearchIndexIsUpdated(t *testing.T) {
+    s := newFixtureServer(t)
+    saveSearchFixtures(t, s)
+    if got := resultIDs(search(t, s, "q=sea")); !reflect.DeepEqual(got, []string{"holiday"}) {
+        t.Fatalf("results = %v", got)
+    }
+
+    // Appended messages are found
+    serve(s, http.MethodPost, "/chat", `{"context":"Tell me about the sea","assistantTitle":"Lets Chat","historyID":"invoicing"}`)
+    if got := resultIDs(search(t, s, "q=sea")); len(got) != 2 {
+        t.Errorf("results after append = %v, want both conversations about the sea", got)
+    }
+
+    // Replaced messages are no longer found
+    rec := serveWithHeader(s, http.MethodPut, "/update-chat-context/holiday", `{"assistantTitle":"Writer","context":"{\"messages\":[{\"role\":\"user\",\"content\":\"A poem about mountains\"}]}"}`, "If-Match", "*")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("update: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if got := resultIDs(search(t, s, "q=sea")); !reflect.DeepEqual(got, []string{"invoicing"}) {
+        t.Errorf("results after update = %v, want [invoicing]", got)
+    }
+
+    // Deleted histories are no longer found
+    serve(s, http.MethodDelete, "/delete-history", `{"assistantTitle":"Lets Chat","chatHistoryID":"invoicing"}`)
+    if got := resultIDs(search(t, s, "q=sea")); len(got) != 0 {
+        t.Errorf("results after delete = %v, want none", got)
+    }
+    for term, names := range s.search.postings {
+        for name := range names {
+            if name == historyPath(defaultAssistant, "invoicing") {
+                t.Errorf("deleted history still indexed under %q", term)
+            }
+        }
+    }
+}
+
+func TestSearchHistoriesErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {name: "missing query", method: http.MethodGet, target: "/search-histories", status: http.StatusBadRequest},
+        {name: "query without words", method: http.MethodGet, target: "/search-histories?q=%2A%2A", status: http.StatusBadRequest},
+        {name: "invalid date", method: http.MethodGet, target: "/search-histories?q=a&from=yesterday", status: http.StatusBadRequest},
+        {name: "invalid limit", method: http.MethodGet, target: "/search-histories?q=a&limit=0", status: http.StatusBadRequest},
+        {name: "unknown assistant", method: http.MethodGet, target: "/search-histories?q=a&assistant=Nobody", status: http.StatusNotFound},
+    })
+}
@@ -0,0 +1,197 @@
+// Package server implements the AI chatbot mock API as an http.Handler so
+// it can be embedded in other programs and test suites:
+//
+//	handler := server.NewServer(server.Options{DataDir: t.TempDir()})
+//	defer handler.Wait() // for the ingestions of uploaded files
+//	srv := httptest.NewServer(handler)
+//	defer srv.Close()
+package server
+
+import (
+    "cmp"
+    "errors"
+    "io/fs"
+    "math/rand"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Options configures a server. The zero value serves the data in the
+// current directory with randomly chosen replies.
+type Options struct {
+    // DataDir is the directory holding the assistants, knowledge bases and
+    // chat histories. It is ignored if Store is set and defaults to ".".
+    DataDir string
+
+    // Store overrides where the data is kept. Use LoadFixtures to preload it.
+    Store Store
+
+    // Responder generates chat replies. It defaults to picking one of a few
+    // canned replies at random.
+    Responder Responder
+
+    // Clock returns the current time. It defaults to time.Now.
+    Clock func() time.Time
+
+    // Rand is the source of randomness for generated IDs and the default
+    // responder. It defaults to a source seeded with the current time.
+    Rand rand.Source
+
+    // MaxUploadSize and MaxKnowledgeBaseSize limit the bytes of a single
+    // uploaded knowledge base file and of all files of a knowledge base.
+    // They default to 32 MiB and 256 MiB.
+    MaxUploadSize        int64
+    MaxKnowledgeBaseSize int64
+
+    // Embedder embeds knowledge base chunks for semantic searches. It
+    // defaults to hashing the words and character trigrams of the text.
+    Embedder Embedder
+
+    // StreamDelay is the pause between two chunks of a streamed chat reply
+    StreamDelay time.Duration
+}
+
+// Server serves the API
+type Server struct {
+    store       Store
+    responder   Responder
+    embedder    Embedder
+    now         func() time.Time
+    streamDelay time.Duration
+
+    maxUploadSize        int64 // bytes of an uploaded knowledge base file
+    maxKnowledgeBaseSize int64 // bytes of all files of a knowledge base
+
+    mu  sync.Mutex // guards rng
+    rng *rand.Rand
+
+    historyLocks   keyedMutex     // serializes changes to a chat history
+    assistantLocks keyedMutex     // serializes changes to the knowledge bases attached to an assistant
+    summaries      summaryCache   // summaries of the history files for listings
+    search         searchIndex    // words of the history files for searches
+    knowledge      knowledgeIndex // words of the knowledge base chunks for searches
+    settingsLocks  keyedMutex     // serializes changes to the settings of a knowledge base
+
+    ingestLocks keyedMutex     // serializes the ingestion of a knowledge base file
+    uploadLocks keyedMutex     // serializes the chunks of a resumable upload
+    storeLocks  keyedMutex     // serializes storing uploads into a knowledge base
+    ingestSlots chan struct{}  // bounds the number of concurrent ingestions
+    ingesting   sync.WaitGroup // running ingestions
+
+    mux         *http.ServeMux
+    openAPIOnce sync.Once
+    openAPIDoc  []byte
+}
+
+// NewServer returns a handler serving the API with the given options
+func NewServer(opts Options) *Server {
+    s := &Server{
+        store:       opts.Store,
+        responder:   opts.Responder,
+        embedder:    opts.Embedder,
+        now:         opts.Clock,
+        streamDelay: opts.StreamDelay,
+        ingestSlots: make(chan struct{}, maxConcurrentIngestions),
+
+        maxUploadSize:        cmp.Or(opts.MaxUploadSize, defaultMaxUploadSize),
+        maxKnowledgeBaseSize: cmp.Or(opts.MaxKnowledgeBaseSize, defaultMaxKnowledgeBaseSize),
+    }
+
+    if s.store == nil {
+        dir := opts.DataDir
+        if dir == "" {
+            dir = "."
+        }
+        s.store = NewDirStore(dir)
+    }
+    if s.now == nil {
+        s.now = time.Now
+    }
+    source := opts.Rand
+    if source == nil {
+        source = rand.NewSource(time.Now().UnixNano())
+    }
+    s.rng = rand.New(source)
+    if s.responder == nil {
+        s.responder = randomResponder{mu: &s.mu, rng: s.rng}
+    }
+
+    if s.embedder == nil {
+        s.embedder = hashEmbedder{dimensions: defaultEmbeddingDimensions}
+    }
+
+    s.removeAllExpiredUploads()
+
+    s.mux = http.NewServeMux()
+    for _, rt := range s.routes() {
+        s.mux.HandleFunc(rt.muxPattern(), rt.Handler)
+    }
+    s.mux.HandleFunc("/openapi.json", s.openAPIHandler)
+    s.mux.HandleFunc("/docs", s.docsHandler)
+
+    return s
+}
+
+// Wait blocks until the text of the uploaded knowledge base files is
+// extracted. Uploads return before their files are ingested, so callers
+// that remove the data directory or inspect ingestion results wait first.
+func (s *Server) Wait() {
+    s.ingesting.Wait()
+}
+
+// ServeHTTP answers CORS preflight requests and dispatches all other
+// requests to the handler of their endpoint
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method == http.MethodOptions {
+        enableCORS(w, r)
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+    s.mux.ServeHTTP(w, r)
+}
+
+// newID generates a random UUID from the server's source of randomness
+func (s *Server) newID() string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return uuid.Must(uuid.NewRandomFromReader(s.rng)).String()
+}
+
+// MessageResponse represents the structure of a generic success response
+type MessageResponse struct {
+    Message string `json:"message"`
+}
+
+// Validation rules shared by query and path parameters
+const (
+    titleRules     = "required,max=100,charset=name"
+    historyIDRules = "required,max=64,charset=id"
+)
+
+// CORS middleware to enable CORS. Preflight requests are answered by
+// ServeHTTP before they reach the handlers.
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Access-Control-Allow-Origin", "*")
+    w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, DELETE, PUT, PATCH, GET")
+    w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Range, Upload-Offset, X-User")
+    w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition, Content-Range, Accept-Ranges")
+}
+
+// exists reports whether a file or directory exists in the store
+func (s *Server) exists(name string) bool {
+    _, err := s.store.Stat(name)
+    return err == nil
+}
+
+// writeStoreError reports a failed store operation, answering 404 with the
+// notFound message if the file or directory does not exist
+func writeStoreError(w http.ResponseWriter, err error, notFound, failed string) {
+    if errors.Is(err, fs.ErrNotExist) {
+        http.Error(w, notFound, http.StatusNotFound)
+        return
+    }
+    http.Error(w, failed, http.StatusInternalServerError)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "io/fs"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+
+    "ai-chatbot-api/client"
+)
+
+// newTestServer returns a server on an empty temporary data directory with
+// deterministic randomness
+func newTestServer(t *testing.T, opts ...func(*Options)) *Server {
+    t.Helper()
+    o := Options{
+        DataDir: t.TempDir(),
+        Rand:    rand.NewSource(1),
+        Clock:   func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+    }
+    for _, opt := range opts {
+        opt(&o)
+    }
+    s := NewServer(o)
+    t.Cleanup(s.Wait) // before the data directory is removed
+    return s
+}
+
+// fixtures is the data every handler test starts from
+var fixtures = fstest.MapFS{
+    "assistants/Reviewer/roleSetting.txt":                                   {Data: []byte("You review code")},
+    "assistants/Reviewer/knowledgeBases.json":                               {Data: []byte(`["Reviewer","Manuals"]`)},
+    "assistants/Reviewer/History/5d4c3b2a-1e57-4db1-aa42-eec315130c8e.json": {Data: []byte(`{"messages":[]}`)},
+    "assistants/Writer/roleSetting.txt":                                     {Data: []byte("You write docs")},
+    "History/a16ba0d9-1e57-4db1-aa42-eec315130c8e.json":                     {Data: []byte("{}")},
+    "knowledgebases/Reviewer/style.md":                                      {Data: []byte("# Style")},
+    "knowledgebases/Manuals/guide.pdf":                                      {Data: []byte("%PDF-1.4")},
+    "knowledgebases/Manuals/diagram.png":                                    {Data: []byte("\x89PNG\r\n\x1a\n")},
+    "knowledgebases/Archive/.keep":                                          {Data: []byte("")},
+}
+
+// newFixtureServer returns a test server whose data directory holds the
+// fixtures
+func newFixtureServer(t *testing.T, opts ...func(*Options)) *Server {
+    t.Helper()
+    s := newTestServer(t, opts...)
+    if err := LoadFixtures(s.store, fixtures); err != nil {
+        t.Fatalf("LoadFixtures: %v", err)
+    }
+    return s
+}
+
+// serve sends a request to the server and returns the recorded response
+func serve(s http.Handler, method, target, body string) *httptest.ResponseRecorder {
+    var reader io.Reader
+    if body != "" {
+        reader = strings.NewReader(body)
+    }
+    req := httptest.NewRequest(method, target, reader)
+    if body != "" {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, req)
+    return rec
+}
+
+// handlerTest is a single request against a server loaded with the fixtures
+type handlerTest struct {
+    name   string
+    method string
+    target string
+    body   string
+    status int
+    // check inspects the response and the data left behind, if set
+    check func(t *testing.T, s *Server, rec *httptest.ResponseRecorder)
+}
+
+func runHandlerTests(t *testing.T, tests []handlerTest) {
+    t.Helper()
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newFixtureServer(t)
+            rec := serve(s, tt.method, tt.target, tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.status, rec.Body.String())
+            }
+            if tt.check != nil {
+                tt.check(t, s, rec)
+            }
+        })
+    }
+}
+
+// decodeBody decodes the JSON response body into v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+    t.Helper()
+    if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+        t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+    }
+}
+
+// wantFile fails the test unless the store holds name with the given content
+func wantFile(t *testing.T, s *Server, name, content string) {
+    t.Helper()
+    data, err := s.store.ReadFile(name)
+    if err != nil {
+        t.Fatalf("%s: %v", name, err)
+    }
+    if string(data) != content {
+        t.Errorf("%s = %q, want %q", name, data, content)
+    }
+}
+
+// wantMissing fails the test if the store holds name
+func wantMissing(t *testing.T, s *Server, name string) {
+    t.Helper()
+    if _, err := s.store.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+        t.Errorf("%s exists, want it removed (err = %v)", name, err)
+    }
+}
+
+func TestEmbeddedServer(t *testing.T) {
+    store := NewDirStore(t.TempDir())
+    if err := LoadFixtures(store, fixtures); err != nil {
+        t.Fatalf("LoadFixtures: %v", err)
+    }
+    handler := NewServer(Options{
+        Store: store,
+        Responder: ResponderFunc(func(p Prompt) string {
+            return "echo: " + p.Message
+        }),
+    })
+    t.Cleanup(handler.Wait) // before the data directory is removed
+    srv := httptest.NewServer(handler)
+    defer srv.Close()
+
+    ctx := context.Background()
+    c := client.New(srv.URL)
+
+    assistants, err := c.ListAssistants(ctx)
+    if err != nil || len(assistants) != 2 || assistants[0].Title != "Reviewer" {
+        t.Fatalf("ListAssistants() = %v, %v", assistants, err)
+    }
+    role, err := c.GetRoleSetting(ctx, "Reviewer")
+    if err != nil || role.RoleSetting != "You review code" {
+        t.Errorf("GetRoleSetting() = %v, %v", role, err)
+    }
+    histories, err := c.ListHistories(ctx)
+    if err != nil || len(histories) != 1 {
+        t.Errorf("ListHistories() = %v, %v", histories, err)
+    }
+
+    reply, err := c.Chat(ctx, client.ChatRequest{Context: "ping"})
+    if err != nil || reply.Response != "echo: ping" {
+        t.Errorf("Chat() = %v, %v", reply, err)
+    }
+    stream, err := c.ChatStream(ctx, client.ChatRequest{Context: "ping pong"})
+    if err != nil {
+        t.Fatalf("ChatStream() error: %v", err)
+    }
+    defer stream.Close()
+    if streamed, err := stream.Collect(); err != nil || streamed != "echo: ping pong" {
+        t.Errorf("streamed reply = %q, %v", streamed, err)
+    }
+
+    if err := c.CreateAssistant(ctx, client.AssistantRequest{Title: "Writer"}); err != nil {
+        t.Fatalf("CreateAssistant() error: %v", err)
+    }
+    if _, err := store.Stat("assistants/Writer/roleSetting.txt"); err != nil {
+        t.Errorf("assistant was not created in the injected store: %v", err)
+    }
+
+    var apiErr *client.APIError
+    if err := c.CreateAssistant(ctx, client.AssistantRequest{Title: "../escape"}); !errors.As(err, &apiErr) || len(apiErr.Fields) != 1 {
+        t.Errorf("CreateAssistant(../escape) error = %v, want field error", err)
+    }
+}
+
+func TestRandDeterminesIDs(t *testing.T) {
+    a := newTestServer(t)
+    b := newTestServer(t)
+    for i := 0; i < 3; i++ {
+        if idA, idB := a.newID(), b.newID(); idA != idB {
+            t.Fatalf("IDs from equally seeded servers differ: %s != %s", idA, idB)
+        }
+    }
+}
+
+func TestRandDeterminesDefaultResponses(t *testing.T) {
+    chat := func(s *Server) string {
+        rec := httptest.NewRecorder()
+        s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"context":"hi"}`)))
+        return rec.Body.String()
+    }
+    a := newTestServer(t)
+    b := newTestServer(t)
+    for i := 0; i < 5; i++ {
+        if ra, rb := chat(a), chat(b); ra != rb {
+            t.Fatalf("replies from equally seeded servers differ: %s != %s", ra, rb)
+        }
+    }
+}
+
+func TestDirStoreRejectsEscapingNames(t *testing.T) {
+    store := NewDirStore(t.TempDir())
+    for _, name := range []string{"../x", "/etc/passwd", "a/../../x"} {
+        if _, err := store.ReadFile(name); !errors.Is(err, errInvalidPath) {
+            t.Errorf("ReadFile(%q) error = %v, want errInvalidPath", name, err)
+        }
+    }
+    if err := store.WriteFile("ok.txt", []byte("x")); err != nil {
+        t.Fatalf("WriteFile(ok.txt) error: %v", err)
+    }
+    if _, err := store.ReadFile("ok.txt"); err != nil {
+        t.Errorf("ReadFile(ok.txt) error: %v", err)
+    }
+}
+
+func TestLoadFixtures(t *testing.T) {
+    store := NewDirStore(t.TempDir())
+    if err := LoadFixtures(store, fixtures); err != nil {
+        t.Fatalf("LoadFixtures: %v", err)
+    }
+    for name, file := range fixtures {
+        data, err := store.ReadFile(name)
+        if err != nil || string(data) != string(file.Data) {
+            t.Errorf("%s = %q, %v; want %q", name, data, err, file.Data)
+        }
+    }
+    if _, err := store.Stat("assistants/Missing"); !errors.Is(err, fs.ErrNotExist) {
+        t.Errorf("Stat of missing directory = %v, want fs.ErrNotExist", err)
+    }
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+
+    "github.com/google/uuid"
+)
+
+// File is an open file of a Store
+type File interface {
+    io.Reader
+    io.Seeker
+    io.Closer
+    Stat() (fs.FileInfo, error)
+}
+
+// Store persists the assistants, knowledge bases and chat histories. Names
+// are slash-separated paths relative to the root of the store.
+type Store interface {
+    Open(name string) (File, error)
+    Create(name string) (io.WriteCloser, error)
+    ReadFile(name string) ([]byte, error)
+    WriteFile(name string, data []byte) error
+    ReadDir(name string) ([]fs.DirEntry, error)
+    Stat(name string) (fs.FileInfo, error)
+    Mkdir(name string) error
+    MkdirAll(name string) error
+    Remove(name string) error
+    RemoveAll(name string) error
+    Rename(oldname, newname string) error
+}
+
+// errInvalidPath is returned by DirStore for names outside its root
+var errInvalidPath = errors.New("invalid path")
+
+// DirStore is a Store keeping its data in a directory of the local file system
+type DirStore struct {
+    Root string
+}
+
+// NewDirStore returns a Store rooted at dir
+func NewDirStore(dir string) *DirStore {
+    return &DirStore{Root: dir}
+}
+
+// path maps a store name to a path on disk, refusing names that would
+// escape the root
+func (d *DirStore) path(name string) (string, error) {
+    if name != "." && !filepath.IsLocal(filepath.FromSlash(name)) {
+        return "", &fs.PathError{Op: "open", Path: name, Err: errInvalidPath}
+    }
+    return filepath.Join(d.Root, filepath.FromSlash(name)), nil
+}
+
+func (d *DirStore) Open(name string) (File, error) {
+    p, err := d.path(name)
+    if err != nil {
+        return nil, err
+    }
+    return os.Open(p)
+}
+
+func (d *DirStore) Create(name string) (io.WriteCloser, error) {
+    p, err := d.path(name)
+    if err != nil {
+        return nil, err
+    }
+    return os.Create(p)
+}
+
+func (d *DirStore) ReadFile(name string) ([]byte, error) {
+    p, err := d.path(name)
+    if err != nil {
+        return nil, err
+    }
+    return os.ReadFile(p)
+}
+
+func (d *DirStore) WriteFile(name string, data []byte) error {
+    p, err := d.path(name)
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(p, data, os.ModePerm)
+}
+
+func (d *DirStore) ReadDir(name string) ([]fs.DirEntry, error) {
+    p, err := d.path(name)
+    if err != nil {
+        return nil, err
+    }
+    return os.ReadDir(p)
+}
+
+func (d *DirStore) Stat(name string) (fs.FileInfo, error) {
+    p, err := d.path(name)
+    if err != nil {
+        return nil, err
+    }
+    return os.Stat(p)
+}
+
+func (d *DirStore) Mkdir(name string) error {
+    p, err := d.path(name)
+    if err != nil {
+        return err
+    }
+    return os.Mkdir(p, os.ModePerm)
+}
+
+func (d *DirStore) MkdirAll(name string) error {
+    p, err := d.path(name)
+    if err != nil {
+        return err
+    }
+    return os.MkdirAll(p, os.ModePerm)
+}
+
+func (d *DirStore) Remove(name string) error {
+    p, err := d.path(name)
+    if err != nil {
+        return err
+    }
+    return os.Remove(p)
+}
+
+func (d *DirStore) RemoveAll(name string) error {
+    p, err := d.path(name)
+    if err != nil {
+        return err
+    }
+    return os.RemoveAll(p)
+}
+
+func (d *DirStore) Rename(oldname, newname string) error {
+    oldp, err := d.path(oldname)
+    if err != nil {
+        return err
+    }
+    newp, err := d.path(newname)
+    if err != nil {
+        return err
+    }
+    return os.Rename(oldp, newp)
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames
+// it into place, so readers never see a partially written file. Each write
+// has its own temporary file, so concurrent writers do not collide.
+func writeFileAtomic(store Store, name string, data []byte) error {
+    tmp := name + "." + uuid.NewString() + ".tmp"
+    if err := store.WriteFile(tmp, data); err != nil {
+        return err
+    }
+    if err := store.Rename(tmp, name); err != nil {
+        store.Remove(tmp)
+        return err
+    }
+    return nil
+}
+
+// LoadFixtures copies every file of fixtures into the store, e.g. a
+// testdata directory or an embed.FS with preloaded assistants and histories
+func LoadFixtures(store Store, fixtures fs.FS) error {
+    return fs.WalkDir(fixtures, ".", func(name string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            return store.MkdirAll(name)
+        }
+        data, err := fs.ReadFile(fixtures, name)
+        if err != nil {
+            return err
+        }
+        if err := store.MkdirAll(path.Dir(name)); err != nil {
+            return err
+        }
+        return store.WriteFile(name, data)
+    })
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+    "slices"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Titler is implemented by responders that can name a conversation. It is
+// given the first user messages of the conversation.
+type Titler interface {
+    Title(messages []Message) string
+}
+
+// Sources of a conversation title, stored in the titleSource metadata entry
+const (
+    titleSourceGenerated = "generated"
+    titleSourceManual    = "manual"
+)
+
+// Title generation parameters
+const (
+    titleMessages  = 3  // user messages a generated title is based on
+    titleKeywords  = 4  // keywords of a generated title
+    titleMaxLength = 60 // characters of a generated title
+    titleMaxWords  = 6  // first messages up to this length are used as they are
+)
+
+// stopWords are left out of generated titles
+var stopWords = func() map[string]bool {
+    words := map[string]bool{}
+    for _, w := range strings.Fields(`
+        a about above after again all also am an and any are as at be because been before being
+        below between both but by can could did do does doing down during each few for from
+        further had has have having he her here hers him his how i if in into is it its itself
+        just me more most my no nor not now of off on once only or other our ours out over own
+        please same she should so some such than thank thanks that the their theirs them then there
+        these they this those through to too under until up very was we were what when where
+        which while who whom why will with would you your yours hi hello hey tell know want
+        need like get help make let use using`) {
+        words[w] = true
+    }
+    return words
+}()
+
+// isKeyword reports whether a word of a message may be part of a title
+func isKeyword(term string) bool {
+    return !stopWords[term] && utf8.RuneCountInString(term) >= 3
+}
+
+// heuristicTitle names a conversation after its first user message if it
+// is short, otherwise after the most frequent keywords of the messages.
+// Messages without keywords, such as greetings, give no title.
+func heuristicTitle(messages []Message) string {
+    if len(messages) == 0 {
+        return ""
+    }
+    first := strings.Fields(messages[0].Content)
+    if len(first) > 0 && len(first) <= titleMaxWords && slices.ContainsFunc(tokenize(messages[0].Content), func(t token) bool { return isKeyword(t.term) }) {
+        title := strings.TrimRightFunc(strings.Join(first, " "), unicode.IsPunct)
+        return shortenTitle(capitalize(title))
+    }
+
+    type keyword struct {
+        word  string
+        count int
+        first int
+    }
+    var keywords []*keyword
+    byWord := map[string]*keyword{}
+    for _, m := range messages {
+        for _, t := range tokenize(m.Content) {
+            if !isKeyword(t.term) {
+                continue
+            }
+            k, ok := byWord[t.term]
+            if !ok {
+                // Keep the case the word first appears in, e.g. of names
+                k = &keyword{word: m.Content[t.start:t.end], first: len(keywords)}
+                byWord[t.term] = k
+                keywords = append(keywords, k)
+            }
+            k.count++
+        }
+    }
+    if len(keywords) == 0 {
+        return ""
+    }
+
+    // The most frequent keywords, earlier ones first on ties, in the order
+    // they appear in
+    top := slices.Clone(keywords)
+    slices.SortStableFunc(top, func(a, b *keyword) int { return b.count - a.count })
+    top = top[:min(titleKeywords, len(top))]
+    slices.SortFunc(top, func(a, b *keyword) int { return a.first - b.first })
+
+    words := make([]string, len(top))
+    for i, k := range top {
+        words[i] = k.word
+    }
+    return shortenTitle(capitalize(strings.Join(words, " ")))
+}
+
+func capitalize(s string) string {
+    r, size := utf8.DecodeRuneInString(s)
+    return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// shortenTitle cuts a title at a word boundary to at most titleMaxLength
+// characters
+func shortenTitle(s string) string {
+    if utf8.RuneCountInString(s) <= titleMaxLength {
+        return s
+    }
+    runes := []rune(s)[:titleMaxLength-1]
+    cut := string(runes)
+    if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+        cut = cut[:i]
+    }
+    return strings.TrimRightFunc(cut, unicode.IsPunct) + "…"
+}
+
+// autoTitle names a conversation after its first user messages, unless it
+// was named manually. Generated titles are refined until the conversation
+// has more than titleMessages user messages.
+func (s *Server) autoTitle(c *Conversation) {
+    if c.Title != "" && c.Metadata["titleSource"] != titleSourceGenerated {
+        return
+    }
+    var users []Message
+    for _, m := range c.Messages {
+        if m.Role == RoleUser {
+            users = append(users, m)
+        }
+    }
+    if len(users) == 0 || len(users) > titleMessages && c.Title != "" {
+        return
+    }
+    users = users[:min(titleMessages, len(users))]
+
+    titler, ok := s.responder.(Titler)
+    if !ok {
+        titler = titlerFunc(heuristicTitle)
+    }
+    title := titler.Title(users)
+    if title == "" {
+        return
+    }
+    c.Title = title
+    if c.Metadata == nil {
+        c.Metadata = map[string]interface{}{}
+    }
+    c.Metadata["titleSource"] = titleSourceGenerated
+}
+
+// titlerFunc adapts a function to the Titler interface
+type titlerFunc func(messages []Message) string
+
+func (f titlerFunc) Title(messages []Message) string {
+    return f(messages)
+}
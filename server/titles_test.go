@@ -0,0 +1,130 @@
+package server
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+    "unicode/utf8"
+)
+
+func TestHeuristicTitle(t *testing.T) {
+    user := func(contents ...string) []Message {
+        var messages []Message
+        for _, c := range contents {
+            messages = append(messages, Message{Role: RoleUser, Content: c})
+        }
+        return messages
+    }
+    tests := []struct {
+        name     string
+        messages []Message
+        want     string
+    }{
+        {"no messages", nil, ""},
+        {"greeting", user("Hi!"), ""},
+        {"short question", user("what is a goroutine?"), "What is a goroutine"},
+        {"keywords", user("Could you please help me to reconcile the invoices from March with the bank statement?"), "Reconcile invoices March bank"},
+        {"most frequent keywords", user(
+            "I have a question about my garden and the roses and the weather this spring in the north",
+            "The roses have black spots on their leaves, are the roses sick?",
+        ), "Question garden roses weather"},
+        {"greeting first", user("hello", "my printer prints only blank pages"), "Printer prints blank pages"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := heuristicTitle(tt.messages); got != tt.want {
+                t.Errorf("heuristicTitle() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestShortenTitle(t *testing.T) {
+    long := strings.Repeat("word ", 30)
+    got := shortenTitle(long)
+    if n := utf8.RuneCountInString(got); n > titleMaxLength {
+        t.Errorf("shortened title has %d characters", n)
+    }
+    if !strings.HasSuffix(got, "word…") {
+        t.Errorf("shortenTitle() = %q, want it cut after a word", got)
+    }
+}
+
+func TestConversationsAreTitled(t *testing.T) {
+    s := newFixtureServer(t)
+    chat := func(content, historyID string) ChatResponse {
+        t.Helper()
+        rec := serve(s, http.MethodPost, "/chat", `{"context":"`+content+`","assistantTitle":"Writer","historyID":"`+historyID+`"}`)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+        }
+        var resp ChatResponse
+        decodeBody(t, rec, &resp)
+        return resp
+    }
+
+    resp := chat("Hello there", "")
+    if resp.Title != "" {
+        t.Errorf("greeting gave the title %q", resp.Title)
+    }
+    id := resp.HistoryID
+
+    resp = chat("Draft a short story about a lighthouse keeper", id)
+    c := readConversation(t, s, "Writer", id)
+    if c.Title == "" || c.Title != resp.Title || c.Metadata["titleSource"] != titleSourceGenerated {
+        t.Fatalf("title = %q (source %v), response title %q", c.Title, c.Metadata["titleSource"], resp.Title)
+    }
+
+    // Manual titles are kept
+    rec := serve(s, http.MethodPut, "/rename-history", `{"assistantTitle":"Writer","historyID":"`+id+`","title":"Lighthouse story"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("rename: status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    c = readConversation(t, s, "Writer", id)
+    if got := rec.Header().Get("ETag"); got != conversationETag(c) {
+        t.Errorf("ETag = %s, want %s", got, conversationETag(c))
+    }
+    chat("Make the keeper a retired sailor", id)
+    c = readConversation(t, s, "Writer", id)
+    if c.Title != "Lighthouse story" || c.Metadata["titleSource"] != titleSourceManual {
+        t.Errorf("title = %q (source %v), want the manual title", c.Title, c.Metadata["titleSource"])
+    }
+}
+
+func TestResponderTitles(t *testing.T) {
+    s := newFixtureServer(t, func(o *Options) {
+        o.Responder = struct {
+            Responder
+            Titler
+        }{
+            ResponderFunc(func(Prompt) string { return "ok" }),
+            titlerFunc(func(messages []Message) string { return "Custom " + messages[0].Content }),
+        }
+    })
+    rec := serve(s, http.MethodPost, "/append-messages", `{"assistantTitle":"Lets Chat","historyID":"`+rootHistoryID+`","messages":[{"role":"user","content":"title"}]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    if c := readConversation(t, s, "Lets Chat", rootHistoryID); c.Title != "Custom title" {
+        t.Errorf("title = %q, want the responder's title", c.Title)
+    }
+}
+
+func TestRenameHistoryErrors(t *testing.T) {
+    runHandlerTests(t, []handlerTest{
+        {
+            name:   "unknown history",
+            method: http.MethodPut,
+            target: "/rename-history",
+            body:   `{"assistantTitle":"Writer","historyID":"missing","title":"x"}`,
+            status: http.StatusNotFound,
+        },
+        {
+            name:   "empty title",
+            method: http.MethodPut,
+            target: "/rename-history",
+            body:   `{"assistantTitle":"Lets Chat","historyID":"` + rootHistoryID + `","title":""}`,
+            status: http.StatusBadRequest,
+        },
+    })
+}
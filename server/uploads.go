@@ -0,0 +1,302 @@
+package server
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "net/http"
+    "path"
+    "time"
+)
+
+// Upload limits. The sizes are used when Options leaves them zero.
+const (
+    defaultMaxUploadSize        = 32 << 20  // bytes of a single uploaded file
+    defaultMaxKnowledgeBaseSize = 256 << 20 // bytes of all files of a knowledge base
+    maxUploadFiles              = 20        // files of a single upload request
+)
+
+// UploadResult describes a file stored by an upload
+type UploadResult struct {
+    FileName    string `json:"fileName"`
+    Size        int64  `json:"size"`
+    ContentType string `json:"contentType"` // detected from the content
+    Status      string `json:"status"`      // ingestion status, pending until the text is extracted
+}
+
+// UploadResponse represents the structure of the response for uploading files
+type UploadResponse struct {
+    Message string         `json:"message"`
+    Files   []UploadResult `json:"files"`
+}
+
+// upload is a file received into the uploads folder of a knowledge base,
+// waiting to be moved in place
+type upload struct {
+    name         string
+    tmp          string
+    size         int64
+    contentType  string
+    sha256       string
+    originalName string // as uploaded
+    uploadedBy   string
+}
+
+// uploadsDir is where uploads to a knowledge base are written before they
+// take the place of the files
+func uploadsDir(knowledgeBase string) string {
+    return path.Join(knowledgeBaseDir(knowledgeBase), metaDir, "uploads")
+}
+
+// knowledgeBaseSizes returns the sizes of the files of a knowledge base
+func (s *Server) knowledgeBaseSizes(knowledgeBase string) (map[string]int64, error) {
+    entries, err := s.store.ReadDir(knowledgeBaseDir(knowledgeBase))
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, err
+    }
+    sizes := map[string]int64{}
+    for _, entry := range entries {
+        if entry.IsDir() {
+            continue
+        }
+        info, err := entry.Info()
+        if err != nil {
+            continue // deleted in the meantime
+        }
+        sizes[entry.Name()] = info.Size()
+    }
+    return sizes, nil
+}
+
+// receiveUploads streams the files of the file fields of a multipart
+// request into the uploads folder of a knowledge base, without buffering
+// them in memory. Files replace files of the same name. Each file must fit
+// in the upload size limit, and all files together with the rest of the
+// knowledge base in the knowledge base size limit, and its content type
+// must be accepted by the file type policy of the knowledge base. If name
+// is set, a single file is received and stored under that name instead of
+// its own.
+//
+// Nothing is received unless every file is: on failure the received files
+// are removed, the error response is written and ok is false. Files are
+// recorded as uploaded by the user named in the uploader header.
+func (s *Server) receiveUploads(w http.ResponseWriter, r *http.Request, knowledgeBase, name string) (uploads []upload, ok bool) {
+    fail := func(status int, message string) ([]upload, bool) {
+        for _, u := range uploads {
+            s.store.Remove(u.tmp)
+        }
+        http.Error(w, message, status)
+        return nil, false
+    }
+    invalid := func(field, message string) ([]upload, bool) {
+        for _, u := range uploads {
+            s.store.Remove(u.tmp)
+        }
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: []FieldError{{Field: field, Message: message}}})
+        return nil, false
+    }
+
+    if !validateHeader(w, r, uploaderHeader, uploaderRules) {
+        return nil, false
+    }
+    uploadedBy := r.Header.Get(uploaderHeader)
+    mr, err := r.MultipartReader()
+    if err != nil {
+        return fail(http.StatusBadRequest, "Failed to get file from request")
+    }
+    sizes, err := s.knowledgeBaseSizes(knowledgeBase)
+    if err != nil {
+        return fail(http.StatusInternalServerError, "Failed to read knowledge base directory")
+    }
+    settings, err := s.knowledgeBaseSettings(knowledgeBase)
+    if err != nil {
+        return fail(http.StatusInternalServerError, "Failed to read knowledge base settings")
+    }
+    var total int64
+    for _, size := range sizes {
+        total += size
+    }
+    if err := s.store.MkdirAll(uploadsDir(knowledgeBase)); err != nil {
+        return fail(http.StatusInternalServerError, "Failed to save file")
+    }
+
+    maxFiles := maxUploadFiles
+    if name != "" {
+        maxFiles = 1
+    }
+    received := map[string]bool{}
+    for {
+        part, err := mr.NextPart()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return fail(http.StatusBadRequest, "Failed to read multipart request")
+        }
+        if part.FormName() != "file" || part.FileName() == "" {
+            continue // other form fields
+        }
+
+        field := fmt.Sprintf("file[%d]", len(uploads))
+        if len(uploads) == maxFiles {
+            return invalid("file", fmt.Sprintf("must not hold more than %d files", maxFiles))
+        }
+        u := upload{name: name, tmp: path.Join(uploadsDir(knowledgeBase), s.newID()), originalName: part.FileName(), uploadedBy: uploadedBy}
+        if u.name == "" {
+            u.name = part.FileName()
+            if errs := validateValue(field, u.name, fileNameRules); len(errs) > 0 {
+                return invalid(errs[0].Field, errs[0].Message)
+            }
+            if received[u.name] {
+                return invalid(field, "is uploaded twice")
+            }
+        }
+
+        // Check the type before receiving the rest of the file
+        content := bufio.NewReaderSize(part, sniffLength)
+        head, err := content.Peek(sniffLength)
+        if err != nil && err != io.EOF {
+            return fail(http.StatusBadRequest, "Failed to read multipart request")
+        }
+        u.contentType = detectContentType(u.name, head)
+        if reason := checkFileType(knowledgeBase, u.name, u.contentType, settings.FileTypes); reason != "" {
+            return fail(http.StatusUnsupportedMediaType, reason)
+        }
+
+        // The file replaces the one of the same name, if any
+        quota := s.maxKnowledgeBaseSize - (total - sizes[u.name])
+        limit := max(min(s.maxUploadSize, quota), 0)
+        dst, err := s.store.Create(u.tmp)
+        if err != nil {
+            return fail(http.StatusInternalServerError, "Failed to save file")
+        }
+        uploads = append(uploads, u) // removed on failure from here on
+        hash := sha256.New()
+        u.size, err = io.Copy(io.MultiWriter(dst, hash), io.LimitReader(content, limit+1))
+        if closeErr := dst.Close(); err == nil {
+            err = closeErr
+        }
+        if err != nil {
+            return fail(http.StatusInternalServerError, "Failed to save file")
+        }
+        if u.size > limit {
+            if limit == s.maxUploadSize {
+                return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("File %q is larger than the limit of %d bytes", u.name, s.maxUploadSize))
+            }
+            return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Knowledge base %q would be larger than the limit of %d bytes", knowledgeBase, s.maxKnowledgeBaseSize))
+        }
+        u.sha256 = hex.EncodeToString(hash.Sum(nil))
+        uploads[len(uploads)-1] = u
+        total += u.size - sizes[u.name]
+        sizes[u.name] = u.size
+        received[u.name] = true
+    }
+    if len(uploads) == 0 {
+        return invalid("file", "is required")
+    }
+    return uploads, true
+}
+
+// storeUploads moves received uploads in place, records their metadata and
+// queues them for ingestion. Replaced files keep the time they were first
+// uploaded at. The knowledge base is locked while the size limit is
+// checked again, since other uploads may have been stored after these
+// were received, and while the files are moved.
+//
+// Either every upload is stored or none is: on failure the uploads are
+// removed, the replaced files restored, the error response is written and
+// ok is false.
+func (s *Server) storeUploads(w http.ResponseWriter, knowledgeBase string, uploads []upload) (results []UploadResult, ok bool) {
+    unlock := s.storeLocks.Lock(knowledgeBase)
+    defer unlock()
+
+    fail := func(status int, message string) ([]UploadResult, bool) {
+        for _, u := range uploads {
+            s.store.Remove(u.tmp)
+        }
+        http.Error(w, message, status)
+        return nil, false
+    }
+    sizes, err := s.knowledgeBaseSizes(knowledgeBase)
+    if err != nil {
+        return fail(http.StatusInternalServerError, "Failed to read knowledge base directory")
+    }
+    var total int64
+    for _, size := range sizes {
+        total += size
+    }
+    for _, u := range uploads {
+        total += u.size - sizes[u.name]
+    }
+    if total > s.maxKnowledgeBaseSize {
+        return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Knowledge base %q would be larger than the limit of %d bytes", knowledgeBase, s.maxKnowledgeBaseSize))
+    }
+
+    now := s.now().UTC()
+    uploadedAt := make([]time.Time, len(uploads))
+    for i, u := range uploads {
+        uploadedAt[i] = now
+        if prev, err := s.fileMetadata(knowledgeBase, u.name); err == nil {
+            uploadedAt[i] = prev.UploadedAt
+        }
+    }
+
+    // Replaced files are kept aside until every upload is in place
+    backups := make([]string, len(uploads))
+    for i, u := range uploads {
+        file := knowledgeFile(knowledgeBase, u.name)
+        err := s.store.Rename(file, u.tmp+".old")
+        if err == nil {
+            backups[i] = u.tmp + ".old"
+        }
+        if err == nil || errors.Is(err, fs.ErrNotExist) {
+            err = s.store.Rename(u.tmp, file)
+        }
+        if err != nil {
+            for j, placed := range uploads[:i+1] {
+                if j < i {
+                    s.store.Remove(knowledgeFile(knowledgeBase, placed.name))
+                }
+                if backups[j] != "" {
+                    s.store.Rename(backups[j], knowledgeFile(knowledgeBase, placed.name))
+                }
+            }
+            return fail(http.StatusInternalServerError, "Failed to save file")
+        }
+    }
+    for _, backup := range backups {
+        if backup != "" {
+            s.store.Remove(backup)
+        }
+    }
+    for i, u := range uploads {
+        info, err := s.store.Stat(knowledgeFile(knowledgeBase, u.name))
+        if err == nil {
+            err = s.saveFileMetadata(knowledgeBase, u.name, &fileMetadata{
+                ContentType:  u.contentType,
+                Size:         info.Size(),
+                SHA256:       u.sha256,
+                OriginalName: u.originalName,
+                UploadedBy:   u.uploadedBy,
+                UploadedAt:   uploadedAt[i],
+                UpdatedAt:    now,
+                ModTime:      info.ModTime().UTC(),
+            })
+        }
+        if err != nil {
+            http.Error(w, "Failed to save file metadata", http.StatusInternalServerError)
+            return nil, false
+        }
+        ingestion, err := s.queueIngestion(knowledgeBase, u.name, info)
+        if err != nil {
+            http.Error(w, "Failed to queue file for ingestion", http.StatusInternalServerError)
+            return nil, false
+        }
+        results = append(results, UploadResult{FileName: u.name, Size: u.size, ContentType: u.contentType, Status: ingestion.Status})
+    }
+    return results, true
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+    "bytes"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "path"
+    "strings"
+    "testing"
+)
+
+// filesUploadRequest builds a multipart upload of the files given as
+// alternating names and contents
+func filesUploadRequest(t *testing.T, target string, files ...string) *http.Request {
+    t.Helper()
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    mw.WriteField("comment", "not a file")
+    for i := 0; i+1 < len(files); i += 2 {
+        part, err := mw.CreateFormFile("file", files[i])
+        if err != nil {
+            t.Fatal(err)
+        }
+        part.Write([]byte(files[i+1]))
+    }
+    mw.Close()
+    req := httptest.NewRequest(http.MethodPost, target, &body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    return req
+}
+
+// wantNoUploads fails the test if uploads to a knowledge base were left
+// behind
+func wantNoUploads(t *testing.T, s *Server, knowledgeBase string) {
+    t.Helper()
+    entries, _ := s.store.ReadDir(uploadsDir(knowledgeBase))
+    for _, entry := range entries {
+        t.Errorf("upload %s was left behind", entry.Name())
+    }
+}
+
+// withUploadLimits sets the upload size limits of a test server
+func withUploadLimits(file, knowledgeBase int64) func(*Options) {
+    return func(o *Options) {
+        o.MaxUploadSize = file
+        o.MaxKnowledgeBaseSize = knowledgeBase
+    }
+}
+
+func TestUploadFiles(t *testing.T) {
+    s := newFixtureServer(t)
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, filesUploadRequest(t, "/upload?title=Reviewer", "a.txt", "alpha", "b.md", "# Beta"))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+    }
+    var resp UploadResponse
+    decodeBody(t, rec, &resp)
+    want := []UploadResult{
+        {FileName: "a.txt", Size: 5, ContentType: "text/plain", Status: ingestionPending},
+        {FileName: "b.md", Size: 6, ContentType: "text/markdown", Status: ingestionPending},
+    }
+    if len(resp.Files) != len(want) {
+        t.Fatalf("files = %+v, want %+v", resp.Files, want)
+    }
+    for i := range want {
+        if resp.Files[i] != want[i] {
+            t.Errorf("files[%d] = %+v, want %+v", i, resp.Files[i], want[i])
+        }
+    }
+    wantFile(t, s, "knowledgebases/Reviewer/a.txt", "alpha")
+    wantFile(t, s, "knowledgebases/Reviewer/b.md", "# Beta")
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestUploadFilesRejected(t *testing.T) {
+    tests := []struct {
+        name   string
+        limits func(*Options)
+        files  []string
+        status int
+        body   string
+    }{
+        {
+            name:   "file too large",
+            limits: withUploadLimits(8, 100),
+            files:  []string{"a.txt", "small", "b.txt", "far too large"},
+            status: http.StatusRequestEntityTooLarge,
+            body:   `File "b.txt" is larger than the limit of 8 bytes`,
+        },
+        {
+            name:   "knowledge base too large",
+            limits: withUploadLimits(8, 20), // style.md takes 7 bytes
+            files:  []string{"a.txt", "12345678", "b.txt", "123456"},
+            status: http.StatusRequestEntityTooLarge,
+            body:   `Knowledge base "Reviewer" would be larger than the limit of 20 bytes`,
+        },
+        {
+            name:   "invalid name",
+            files:  []string{"a.txt", "alpha", "b?.txt", "beta"},
+            status: http.StatusBadRequest,
+            body:   `"field":"file[1]"`,
+        },
+        {
+            name:   "uploaded twice",
+            files:  []string{"a.txt", "alpha", "a.txt", "beta"},
+            status: http.StatusBadRequest,
+            body:   "is uploaded twice",
+        },
+        {
+            name:   "no files",
+            status: http.StatusBadRequest,
+            body:   `"field":"file"`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var opts []func(*Options)
+            if tt.limits != nil {
+                opts = append(opts, tt.limits)
+            }
+            s := newFixtureServer(t, opts...)
+            rec := httptest.NewRecorder()
+            s.ServeHTTP(rec, filesUploadRequest(t, "/upload?title=Reviewer", tt.files...))
+            if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.body) {
+                t.Fatalf("got %d %q, want %d containing %q", rec.Code, rec.Body.String(), tt.status, tt.body)
+            }
+
+            // Nothing is stored unless every file is
+            wantMissing(t, s, "knowledgebases/Reviewer/a.txt")
+            wantNoUploads(t, s, "Reviewer")
+        })
+    }
+}
+
+func TestUploadReplacesWithinLimit(t *testing.T) {
+    // Replacing a file only counts the growth against the knowledge base
+    // limit. style.md takes 7 of its bytes.
+    s := newFixtureServer(t, withUploadLimits(10, 17))
+    for _, content := range []string{"1234567890", "abcdefghij"} {
+        rec := httptest.NewRecorder()
+        s.ServeHTTP(rec, filesUploadRequest(t, "/upload?title=Reviewer", "a.txt", content))
+        if rec.Code != http.StatusOK {
+            t.Fatalf("upload %q: status = %d; body: %s", content, rec.Code, rec.Body.String())
+        }
+    }
+    wantFile(t, s, "knowledgebases/Reviewer/a.txt", "abcdefghij")
+
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, filesUploadRequest(t, "/upload?title=Reviewer", "b.txt", "x"))
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("upload beyond the limit: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+    }
+}
+
+// receivedUpload writes content to the uploads folder of the Reviewer
+// knowledge base as if it was received for name
+func receivedUpload(t *testing.T, s *Server, name, content string) upload {
+    t.Helper()
+    u := upload{name: name, tmp: path.Join(uploadsDir("Reviewer"), s.newID()), size: int64(len(content)), contentType: "text/plain"}
+    s.store.MkdirAll(uploadsDir("Reviewer"))
+    if err := s.store.WriteFile(u.tmp, []byte(content)); err != nil {
+        t.Fatal(err)
+    }
+    return u
+}
+
+func TestStoreUploadsChecksLimitAgain(t *testing.T) {
+    s := newFixtureServer(t, withUploadLimits(100, 20))
+    u := receivedUpload(t, s, "notes.txt", "0123456789")
+    // Another upload was stored since this one was received
+    s.store.WriteFile(knowledgeFile("Reviewer", "other.txt"), []byte("0123456789"))
+
+    rec := httptest.NewRecorder()
+    if _, ok := s.storeUploads(rec, "Reviewer", []upload{u}); ok || rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("store beyond the limit: ok = %v, status = %d", ok, rec.Code)
+    }
+    wantMissing(t, s, knowledgeFile("Reviewer", "notes.txt"))
+    wantNoUploads(t, s, "Reviewer")
+}
+
+func TestStoreUploadsRollsBack(t *testing.T) {
+    s := newFixtureServer(t)
+    replacing := receivedUpload(t, s, "style.md", "# New style")
+    added := receivedUpload(t, s, "added.md", "# Added")
+    broken := upload{name: "broken.md", tmp: path.Join(uploadsDir("Reviewer"), "missing")}
+
+    rec := httptest.NewRecorder()
+    if _, ok := s.storeUploads(rec, "Reviewer", []upload{replacing, added, broken}); ok || rec.Code != http.StatusInternalServerError {
+        t.Errorf("store with a failing upload: ok = %v, status = %d", ok, rec.Code)
+    }
+    wantFile(t, s, knowledgeFile("Reviewer", "style.md"), "# Style")
+    wantMissing(t, s, knowledgeFile("Reviewer", "added.md"))
+    wantNoUploads(t, s, "Reviewer")
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "reflect"
+    "slices"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// maxRequestBodySize is the largest JSON request body the API accepts
+const maxRequestBodySize = 1 << 20
+
+var errSingleValue = errors.New("request body must contain a single JSON value")
+
+// FieldError describes what is wrong with a single request field
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// ErrorResponse represents the structure of the response for rejected requests
+type ErrorResponse struct {
+    Error  string       `json:"error"`
+    Fields []FieldError `json:"fields,omitempty"`
+}
+
+// charsets lists the character sets usable with the charset validation rule
+var charsets = map[string]struct {
+    valid       func(string) bool
+    pattern     string
+    description string
+}{
+    // name is used for titles that end up as directory names
+    "name": {
+        valid: func(s string) bool {
+            if s == "." || s == ".." || strings.TrimSpace(s) != s {
+                return false
+            }
+            return !strings.ContainsFunc(s, func(r rune) bool {
+                return unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r)
+            })
+        },
+        pattern:     `^[^\s/\\:*?"<>|\x00-\x1f](?:[^/\\:*?"<>|\x00-\x1f]*[^\s/\\:*?"<>|\x00-\x1f])?$`,
+        description: `must not contain / \ : * ? " < > | or control characters, start or end with a space, or be "." or ".."`,
+    },
+    // id is used for generated identifiers such as chat history IDs
+    "id": {
+        valid: func(s string) bool {
+            return !strings.ContainsFunc(s, func(r rune) bool {
+                return !(r == '-' || r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+            })
+        },
+        pattern:     `^[A-Za-z0-9_-]+$`,
+        description: "must only contain letters, digits, - and _",
+    },
+    // hex is used for checksums
+    "hex": {
+        valid: func(s string) bool {
+            return !strings.ContainsFunc(s, func(r rune) bool {
+                return !strings.ContainsRune("0123456789abcdef", r)
+            })
+        },
+        pattern:     `^[0-9a-f]+$`,
+        description: "must only contain the lowercase hex digits 0-9 and a-f",
+    },
+}
+
+// validationRule is a single rule of a validate struct tag
+type validationRule struct {
+    name string
+    arg  string
+}
+
+func parseRules(tag string) []validationRule {
+    var rules []validationRule
+    for _, part := range strings.Split(tag, ",") {
+        if part == "" {
+            continue
+        }
+        name, arg, _ := strings.Cut(part, "=")
+        rules = append(rules, validationRule{name: name, arg: arg})
+    }
+    return rules
+}
+
+// rangeBounds parses the argument of a range rule such as "1|200"
+func rangeBounds(arg string) (lo, hi int) {
+    a, b, _ := strings.Cut(arg, "|")
+    lo, _ = strconv.Atoi(a)
+    hi, _ = strconv.Atoi(b)
+    return lo, hi
+}
+
+// validateValue checks value against the rules of a validate tag such as
+// "required,max=100,charset=name", "oneof=asc|desc" or "range=1|200" and
+// returns the problems found
+func validateValue(field, value, tag string) []FieldError {
+    var errs []FieldError
+    rules := parseRules(tag)
+    for _, rule := range rules {
+        if rule.name == "required" && value == "" {
+            return []FieldError{{Field: field, Message: "is required"}}
+        }
+    }
+    if value == "" {
+        return nil
+    }
+    for _, rule := range rules {
+        switch rule.name {
+        case "min":
+            n, _ := strconv.Atoi(rule.arg)
+            if utf8.RuneCountInString(value) < n {
+                errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at least %d characters long", n)})
+            }
+        case "max":
+            n, _ := strconv.Atoi(rule.arg)
+            if utf8.RuneCountInString(value) > n {
+                errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters long", n)})
+            }
+        case "charset":
+            if cs, ok := charsets[rule.arg]; ok && !cs.valid(value) {
+                errs = append(errs, FieldError{Field: field, Message: cs.description})
+            }
+        case "oneof":
+            options := strings.Split(rule.arg, "|")
+            if !slices.Contains(options, value) {
+                errs = append(errs, FieldError{Field: field, Message: "must be one of " + strings.Join(options, ", ")})
+            }
+        case "range":
+            lo, hi := rangeBounds(rule.arg)
+            if n, err := strconv.Atoi(value); err != nil || n < lo || n > hi {
+                errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be a number between %d and %d", lo, hi)})
+            }
+        }
+    }
+    return errs
+}
+
+// validateInt checks an integer against the required, min and range rules
+// of a validate tag, zero counting as unset
+func validateInt(field string, n int64, tag string) []FieldError {
+    var errs []FieldError
+    rules := parseRules(tag)
+    for _, rule := range rules {
+        if rule.name == "required" && n == 0 {
+            return []FieldError{{Field: field, Message: "is required"}}
+        }
+    }
+    if n == 0 {
+        return nil
+    }
+    for _, rule := range rules {
+        switch rule.name {
+        case "min":
+            lo, _ := strconv.ParseInt(rule.arg, 10, 64)
+            if n < lo {
+                errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at least %d", lo)})
+            }
+        case "range":
+            lo, hi := rangeBounds(rule.arg)
+            if n < int64(lo) || n > int64(hi) {
+                errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be a number between %d and %d", lo, hi)})
+            }
+        }
+    }
+    return errs
+}
+
+// validateStruct applies the validate tags of the string and integer
+// fields of v
+func validateStruct(v interface{}) []FieldError {
+    rv := reflect.Indirect(reflect.ValueOf(v))
+    var errs []FieldError
+    for _, field := range jsonFields(rv.Type()) {
+        tag := rv.Type().FieldByIndex(field.Index).Tag.Get("validate")
+        if tag == "" {
+            continue
+        }
+        value := rv.FieldByIndex(field.Index)
+        switch field.Type.Kind() {
+        case reflect.String:
+            errs = append(errs, validateValue(field.Name, value.String(), tag)...)
+        case reflect.Int, reflect.Int64:
+            errs = append(errs, validateInt(field.Name, value.Int(), tag)...)
+        }
+    }
+    return errs
+}
+
+// decodeRequest strictly decodes the JSON body of r into dst and validates
+// it. On failure the error response has already been written and false is
+// returned.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+    dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+    dec.DisallowUnknownFields()
+
+    err := dec.Decode(dst)
+    if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+        err = errSingleValue
+    }
+    if err != nil {
+        status, resp := decodeError(err)
+        writeJSONError(w, status, resp)
+        return false
+    }
+
+    if errs := validateStruct(dst); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return false
+    }
+    return true
+}
+
+// decodeError maps a JSON decoding error to a response
+func decodeError(err error) (int, ErrorResponse) {
+    var maxBytesErr *http.MaxBytesError
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+
+    switch {
+    case errors.As(err, &maxBytesErr):
+        return http.StatusRequestEntityTooLarge, ErrorResponse{
+            Error: fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit),
+        }
+    case errors.Is(err, io.EOF):
+        return http.StatusBadRequest, ErrorResponse{Error: "Request body is empty"}
+    case errors.Is(err, io.ErrUnexpectedEOF):
+        return http.StatusBadRequest, ErrorResponse{Error: "Request body contains malformed JSON"}
+    case errors.As(err, &syntaxErr):
+        return http.StatusBadRequest, ErrorResponse{
+            Error: fmt.Sprintf("Request body contains malformed JSON at offset %d", syntaxErr.Offset),
+        }
+    case errors.As(err, &typeErr):
+        if typeErr.Field == "" {
+            return http.StatusBadRequest, ErrorResponse{Error: "Request body must be a JSON object"}
+        }
+        return http.StatusBadRequest, ErrorResponse{
+            Error:  "Invalid request",
+            Fields: []FieldError{{Field: fieldPath(typeErr.Field), Message: "must be of type " + jsonTypeName(typeErr.Type)}},
+        }
+    case errors.Is(err, errSingleValue):
+        return http.StatusBadRequest, ErrorResponse{Error: "Request body must contain a single JSON value"}
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+        return http.StatusBadRequest, ErrorResponse{
+            Error:  "Invalid request",
+            Fields: []FieldError{{Field: field, Message: "is not a known field"}},
+        }
+    }
+    return http.StatusBadRequest, ErrorResponse{Error: "Bad request: " + err.Error()}
+}
+
+// fieldPath turns a dotted field path reported by encoding/json such as
+// messages.0.content into the form used by the validators, messages[0].content
+func fieldPath(field string) string {
+    parts := strings.Split(field, ".")
+    var b strings.Builder
+    for i, part := range parts {
+        if _, err := strconv.Atoi(part); err == nil && i > 0 {
+            b.WriteString("[" + part + "]")
+            continue
+        }
+        if i > 0 {
+            b.WriteString(".")
+        }
+        b.WriteString(part)
+    }
+    return b.String()
+}
+
+func jsonTypeName(t reflect.Type) string {
+    switch t.Kind() {
+    case reflect.String:
+        return "string"
+    case reflect.Bool:
+        return "boolean"
+    case reflect.Slice, reflect.Array:
+        return "array"
+    case reflect.Map, reflect.Struct:
+        return "object"
+    case reflect.Float32, reflect.Float64:
+        return "number"
+    }
+    return "integer"
+}
+
+// validateQuery validates the query parameter name of r against a validate
+// tag, writing the error response and returning false on failure
+func validateQuery(w http.ResponseWriter, r *http.Request, name, tag string) bool {
+    if errs := validateValue(name, r.URL.Query().Get(name), tag); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return false
+    }
+    return true
+}
+
+func validateHeader(w http.ResponseWriter, r *http.Request, name, tag string) bool {
+    if errs := validateValue(name, r.Header.Get(name), tag); len(errs) > 0 {
+        writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+        return false
+    }
+    return true
+}
+
+func writeJSONError(w http.ResponseWriter, status int, resp ErrorResponse) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+    tests := []struct {
+        name       string
+        body       string
+        wantStatus int
+        wantFields []FieldError
+    }{
+        {
+            name:       "valid",
+            body:       `{"title":"Assistant 4","roleSetting":"I am a perf engineer"}`,
+            wantStatus: http.StatusOK,
+        },
+        {
+            name:       "empty body",
+            body:       ``,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name:       "malformed",
+            body:       `{"title":`,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name:       "not an object",
+            body:       `["Assistant 4"]`,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name:       "multiple values",
+            body:       `{"title":"a"}{"title":"b"}`,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name:       "unknown field",
+            body:       `{"title":"a","name":"b"}`,
+            wantStatus: http.StatusBadRequest,
+            wantFields: []FieldError{{Field: "name", Message: "is not a known field"}},
+        },
+        {
+            name:       "wrong type",
+            body:       `{"title":42}`,
+            wantStatus: http.StatusBadRequest,
+            wantFields: []FieldError{{Field: "title", Message: "must be of type string"}},
+        },
+        {
+            name:       "missing required field",
+            body:       `{"roleSetting":"x"}`,
+            wantStatus: http.StatusBadRequest,
+            wantFields: []FieldError{{Field: "title", Message: "is required"}},
+        },
+        {
+            name:       "path traversal",
+            body:       `{"title":"../etc"}`,
+            wantStatus: http.StatusBadRequest,
+            wantFields: []FieldError{{Field: "title", Message: charsets["name"].description}},
+        },
+        {
+            name:       "too long",
+            body:       `{"title":"` + strings.Repeat("a", 101) + `"}`,
+            wantStatus: http.StatusBadRequest,
+            wantFields: []FieldError{{Field: "title", Message: "must be at most 100 characters long"}},
+        },
+        {
+            name:       "too large",
+            body:       `{"title":"a","roleSetting":"` + strings.Repeat("a", maxRequestBodySize) + `"}`,
+            wantStatus: http.StatusRequestEntityTooLarge,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rec := httptest.NewRecorder()
+            req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+            var dst AssistantRequest
+            ok := decodeRequest(rec, req, &dst)
+
+            if tt.wantStatus == http.StatusOK {
+                if !ok {
+                    t.Fatalf("rejected valid request: %s", rec.Body.String())
+                }
+                return
+            }
+            if ok {
+                t.Fatal("accepted invalid request")
+            }
+            if rec.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+            }
+            var resp ErrorResponse
+            if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+                t.Fatalf("error response is not JSON: %v", err)
+            }
+            if resp.Error == "" {
+                t.Error("error response has no message")
+            }
+            if tt.wantFields != nil && !reflect.DeepEqual(resp.Fields, tt.wantFields) {
+                t.Errorf("fields = %+v, want %+v", resp.Fields, tt.wantFields)
+            }
+        })
+    }
+}
+
+func TestValidateValue(t *testing.T) {
+    tests := []struct {
+        value string
+        tag   string
+        valid bool
+    }{
+        {"", "required", false},
+        {"", "max=3", true},
+        {"abc", "min=3,max=3", true},
+        {"ab", "min=3", false},
+        {"äöü", "max=3", true},
+        {"Lets Chat", "charset=name", true},
+        {"Assistant (v2)", "charset=name", true},
+        {".", "charset=name", false},
+        {"..", "charset=name", false},
+        {"a/b", "charset=name", false},
+        {`a\b`, "charset=name", false},
+        {" padded", "charset=name", false},
+        {"tab\there", "charset=name", false},
+        {"a16ba0d9-1e57-4db1-aa42-eec315130c8e", historyIDRules, true},
+        {"../secret", historyIDRules, false},
+        {"ünïcode", "charset=id", false},
+        {"0123456789abcdef", "charset=hex", true},
+        {"ABCDEF", "charset=hex", false},
+        {"asc", "oneof=asc|desc", true},
+        {"up", "oneof=asc|desc", false},
+        {"1", "range=1|200", true},
+        {"200", "range=1|200", true},
+        {"0", "range=1|200", false},
+        {"201", "range=1|200", false},
+        {"ten", "range=1|200", false},
+    }
+    for _, tt := range tests {
+        errs := validateValue("field", tt.value, tt.tag)
+        if valid := len(errs) == 0; valid != tt.valid {
+            t.Errorf("validateValue(%q, %q) = %v, want valid=%v", tt.value, tt.tag, errs, tt.valid)
+        }
+    }
+}
+
+// The patterns are published in the OpenAPI document, so they must agree
+// with the checks the server actually performs
+func TestCharsetPatternsMatchValidators(t *testing.T) {
+    samples := []string{
+        "Lets Chat", "Assistant 4", "a", "a b", " a", "a ", ".", "..", "...", "a.b",
+        "a/b", "a:b", "a*b", `a"b`, "a|b", "a\x00b", "a\nb", "a_b-c", "ÄÖÜ", "a16ba0d9-1e57",
+    }
+    for name, cs := range charsets {
+        re := regexp.MustCompile(cs.pattern)
+        for _, s := range samples {
+            if name == "name" && (s == "." || s == "..") {
+                // Reserved names cannot be expressed in the pattern
+                continue
+            }
+            if got, want := re.MatchString(s), cs.valid(s); got != want {
+                t.Errorf("charset %s: pattern matches %q = %v, validator = %v", name, s, got, want)
+            }
+        }
+    }
+}
+
+func TestHandlersRejectInvalidInput(t *testing.T) {
+    tests := []struct {
+        name   string
+        method string
+        target string
+        body   string
+        field  string
+    }{
+        {"create assistant", http.MethodPost, "/createAssistant", `{"title":"../x"}`, "title"},
+        {"delete assistant", http.MethodDelete, "/deleteAssistant?title=..", ``, "title"},
+        {"upload", http.MethodPost, "/upload", ``, "title"},
+        {"fetch history", http.MethodPost, "/fetch-history", `{"assistantTitle":"Lets Chat","historyID":"../../x"}`, "historyID"},
+        {"update chat context", http.MethodPut, "/update-chat-context/", `{"assistantTitle":"Lets Chat","context":"{}"}`, "historyID"},
+        {"chunk size", http.MethodPut, "/update-chunking-settings", `{"knowledgeBaseName":"Docs","strategy":"fixed","chunkSize":8}`, "chunkSize"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rec := httptest.NewRecorder()
+            newTestServer(t).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+            if rec.Code != http.StatusBadRequest {
+                t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+            }
+            var resp ErrorResponse
+            if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+                t.Fatalf("error response is not JSON: %v", err)
+            }
+            if len(resp.Fields) != 1 || resp.Fields[0].Field != tt.field {
+                t.Errorf("fields = %+v, want one error for %q", resp.Fields, tt.field)
+            }
+        })
+    }
+}